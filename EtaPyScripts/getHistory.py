@@ -10,6 +10,9 @@ def response(url):
 def loadJSON(response):
     return json.loads(response.read())
 
+def loadNDJSON(response):
+    return [json.loads(line) for line in response if line.strip()]
+
 def time_in_range(start, end, x):
     """Return true if x is in the range [start, end]"""
     if start <= end:
@@ -20,38 +23,37 @@ def time_in_range(start, end, x):
 def getAvgVelocity(data, route_id, current_time, weekday):
     totalVelocity = 0
     count = 0
-    for i in data:
-        for j in i:
-            dataArrayTime = j["time"].split(":")
-            dataHour = int(dataArrayTime[0].split("T")[1])
-            dataMin = int(dataArrayTime[1])
-            dataTime = dt.time(dataHour, dataMin, 0)
+    for j in data:
+        dataArrayTime = j["time"].split(":")
+        dataHour = int(dataArrayTime[0].split("T")[1])
+        dataMin = int(dataArrayTime[1])
+        dataTime = dt.time(dataHour, dataMin, 0)
 
-            dataArrayDay = dataArrayTime[0].split('-')
-            dataYear = int(dataArrayDay[0])
-            dataMonth = int(dataArrayDay[1])
-            dataDay = int(dataArrayDay[2].split('T')[0])
+        dataArrayDay = dataArrayTime[0].split('-')
+        dataYear = int(dataArrayDay[0])
+        dataMonth = int(dataArrayDay[1])
+        dataDay = int(dataArrayDay[2].split('T')[0])
 
-            day = dt.date(dataYear, dataMonth, dataDay)
-            dataWeekday = day.weekday()
+        day = dt.date(dataYear, dataMonth, dataDay)
+        dataWeekday = day.weekday()
 
 
-            start = dt.time(current_time.hour, current_time.minute, current_time.second)
-            tmp_startDate = dt.datetime.combine(dt.date(1,1,1), start)
+        start = dt.time(current_time.hour, current_time.minute, current_time.second)
+        tmp_startDate = dt.datetime.combine(dt.date(1,1,1), start)
 
-            start = tmp_startDate - dt.timedelta(minutes=MAX_TIME_DIFFERENCE_MIN)
-            start = start.time()
+        start = tmp_startDate - dt.timedelta(minutes=MAX_TIME_DIFFERENCE_MIN)
+        start = start.time()
 
 
-            end = tmp_startDate + dt.timedelta(minutes=MAX_TIME_DIFFERENCE_MIN)
-            end = end.time()
+        end = tmp_startDate + dt.timedelta(minutes=MAX_TIME_DIFFERENCE_MIN)
+        end = end.time()
 
 
-            if j["route_id"] == route_id and dataWeekday == weekday and time_in_range(start, end, dataTime):
-                totalVelocity += j["speed"]
-                count += 1
-            else:
-                continue
+        if j["route_id"] == route_id and dataWeekday == weekday and time_in_range(start, end, dataTime):
+            totalVelocity += j["speed"]
+            count += 1
+        else:
+            continue
     return totalVelocity/count
 
 
@@ -68,17 +70,13 @@ if __name__ == '__main__':
     targetRoute = 20
 
 
-    # Currently on localhost
-    url = "http://localhost:8080/history"
+    # Only look at the last few weeks of history
+    since = (dt.datetime.utcnow() - dt.timedelta(weeks=4)).strftime("%Y-%m-%dT%H:%M:%SZ")
 
-    response = urllib.request.urlopen(url)
-    data = json.loads(response.read())
+    # Currently on localhost
+    url = "http://localhost:8080/api/v1/locations?format=ndjson&route_id={}&since={}".format(targetRoute, since)
 
-    # print(len(data))
-    # for i in data:
-    #     for j in i:
-    #         print(j["time"].split(":"))
-        # print(i)
+    data = loadNDJSON(response(url))
 
-    print(getAvgVelocity(data, 1, targetTime, targetWeekday))
+    print(getAvgVelocity(data, targetRoute, targetTime, targetWeekday))
 
@@ -0,0 +1,91 @@
+package shuttletracker
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Alert severities, from least to most severe.
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeveritySevere  = "severe"
+)
+
+// Severities lists every Alert severity from least to most severe.
+var Severities = []string{SeverityInfo, SeverityWarning, SeveritySevere}
+
+// Alert is a service alert shown to riders, like a detour or a snow day. Many can be
+// active at once.
+type Alert struct {
+	ID       int64  `json:"id"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+	Link     string `json:"link"`
+	Enabled  bool   `json:"enabled"`
+	// An Alert is active from Start until End. Without a Start, it's active as soon
+	// as it's enabled, and without an End, until it's disabled.
+	Start *time.Time `json:"start"`
+	End   *time.Time `json:"end"`
+	// RouteIDs and StopIDs are the Routes and Stops that an Alert affects. An Alert
+	// that doesn't list any affects everything.
+	RouteIDs []int64   `json:"route_ids"`
+	StopIDs  []int64   `json:"stop_ids"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// ActiveAt returns whether an Alert is active at a time.
+func (a *Alert) ActiveAt(t time.Time) bool {
+	if !a.Enabled {
+		return false
+	}
+	if a.Start != nil && t.Before(*a.Start) {
+		return false
+	}
+	return a.End == nil || t.Before(*a.End)
+}
+
+// SeverityRank returns where a severity is in Severities, or -1 if it isn't one.
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// ActiveAlerts returns the Alerts that are active at a time, most severe first and
+// then most recently started.
+func ActiveAlerts(alerts []*Alert, t time.Time) []*Alert {
+	active := []*Alert{}
+	for _, a := range alerts {
+		if a.ActiveAt(t) {
+			active = append(active, a)
+		}
+	}
+	started := func(a *Alert) time.Time {
+		if a.Start != nil {
+			return *a.Start
+		}
+		return a.Created
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		a, b := active[i], active[j]
+		if ra, rb := SeverityRank(a.Severity), SeverityRank(b.Severity); ra != rb {
+			return ra > rb
+		}
+		if sa, sb := started(a), started(b); !sa.Equal(sb) {
+			return sa.After(sb)
+		}
+		return a.ID > b.ID
+	})
+	return active
+}
+
+var (
+	// ErrAlertNotFound indicates that an Alert is not in the database.
+	ErrAlertNotFound = errors.New("alert not found")
+)
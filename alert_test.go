@@ -0,0 +1,30 @@
+package shuttletracker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveAlerts(t *testing.T) {
+	now := time.Date(2019, 12, 2, 12, 0, 0, 0, time.UTC)
+	hourAgo, inAnHour := now.Add(-time.Hour), now.Add(time.Hour)
+	alerts := []*Alert{
+		{ID: 1, Severity: SeverityInfo, Enabled: true, Created: hourAgo},
+		{ID: 2, Severity: SeveritySevere, Enabled: false},
+		{ID: 3, Severity: SeverityWarning, Enabled: true, Start: &inAnHour},
+		{ID: 4, Severity: SeverityWarning, Enabled: true, End: &now},
+		{ID: 5, Severity: SeverityWarning, Enabled: true, Start: &hourAgo, End: &inAnHour},
+		{ID: 6, Severity: SeverityInfo, Enabled: true, Created: now},
+	}
+
+	active := ActiveAlerts(alerts, now)
+	expected := []int64{5, 6, 1}
+	if len(active) != len(expected) {
+		t.Fatalf("got %d active alerts, expected %d", len(active), len(expected))
+	}
+	for i, a := range active {
+		if a.ID != expected[i] {
+			t.Errorf("got alert %d at %d, expected %d", a.ID, i, expected[i])
+		}
+	}
+}
@@ -2,15 +2,17 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"net/http"
-	"net/url"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/spf13/viper"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/auth"
 	"github.com/wtg/shuttletracker/log"
 )
 
@@ -22,6 +24,52 @@ type Config struct {
 	Authenticate         bool
 	ListenURL            string
 	MapboxAPIKey         string
+
+	// FusionTrackTTL is how long rider tracks are stored, e.g. "24h".
+	FusionTrackTTL string
+
+	// FusionPrivacyRadius is how many meters around the ends of rider tracks are
+	// left out of storage and exports.
+	FusionPrivacyRadius float64
+
+	// AuthProvider is how administrators log in: "cas", "oidc", or "local". Whichever
+	// it is, they must also be in the users table.
+	AuthProvider string
+
+	// SessionSecret signs session cookies for the oidc and local providers.
+	SessionSecret string
+
+	// SessionIdleTimeout logs administrators out after they haven't made a request for
+	// this long, e.g. "1h". SessionMaxAge logs them out this long after logging in.
+	SessionIdleTimeout string
+	SessionMaxAge      string
+
+	// CookieSecure only sends session and CSRF cookies over HTTPS. CookieSameSite is
+	// their SameSite attribute: "lax", "strict" (local provider only), or "none"
+	// (which needs CookieSecure).
+	CookieSecure   bool
+	CookieSameSite string
+
+	OIDCIssuer        string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string
+	OIDCUsernameClaim string
+
+	// RateLimits limit how often each IP address can make the requests they match.
+	RateLimits []RateLimit
+
+	// RateLimitStore keeps rate limits in "memory", or in "postgres" to share them
+	// between instances.
+	RateLimitStore string
+
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// X-Forwarded-For headers say where requests came from.
+	TrustedProxies []string
+
+	// CalendarDomain ends the UIDs of iCalendar events, so they stay the same no
+	// matter what host a feed is requested from.
+	CalendarDomain string
 }
 
 // API is responsible for configuring handlers for HTTP endpoints.
@@ -34,22 +82,51 @@ type API struct {
 	fm         *fusionManager
 	etaManager shuttletracker.ETAService
 	fdb        shuttletracker.FeedbackService
+	us         shuttletracker.UserService
+	tokens     shuttletracker.APITokenService
+	audits     shuttletracker.AuditService
+	cli        *CASClient
+	limiter    *rateLimiter
 }
 
 // New initializes the application given a config and connects to backends.
 // It also seeds any needed information to the database.
-func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageService, us shuttletracker.UserService, updater shuttletracker.UpdaterService, etaManager shuttletracker.ETAService, fdb shuttletracker.FeedbackService) (*API, error) {
-	// Set up CAS authentication
-	url, err := url.Parse(cfg.CasURL)
+func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageService, us shuttletracker.UserService, updater shuttletracker.UpdaterService, etaManager shuttletracker.ETAService, fdb shuttletracker.FeedbackService, ts shuttletracker.TrackService, bbs shuttletracker.BusButtonService, audits shuttletracker.AuditService, tokens shuttletracker.APITokenService, rateLimits shuttletracker.RateLimitService) (*API, error) {
+	// Set up authentication
+	cli, err := newAuthClient(cfg, us)
+	if err != nil {
+		return nil, err
+	}
+
+	trackTTL, err := time.ParseDuration(cfg.FusionTrackTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set up rate limiting
+	switch cfg.RateLimitStore {
+	case "", "memory":
+		rateLimits = newMemoryRateLimitService()
+	case "postgres":
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", cfg.RateLimitStore)
+	}
+	limiter, err := newRateLimiter(cfg.RateLimits, rateLimits, proxies)
 	if err != nil {
 		return nil, err
 	}
 
 	// Set up fusion manager
-	fm, err := newFusionManager(etaManager, ms)
+	fm, err := newFusionManager(etaManager, ms, msg, ts, bbs, trackTTL, cfg.FusionPrivacyRadius)
 	if err != nil {
 		return nil, err
 	}
+	fm.proxies = proxies
 
 	// Create API instance to store database session and collections
 	api := API{
@@ -60,125 +137,199 @@ func New(cfg Config, ms shuttletracker.ModelService, msg shuttletracker.MessageS
 		fm:         fm,
 		etaManager: etaManager,
 		fdb:        fdb,
+		us:         us,
+		tokens:     tokens,
+		audits:     audits,
+		limiter:    limiter,
 	}
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.DefaultCompress)
-	r.Use(etag)
+	r.Use(limiter.middleware)
 
-	cli := CreateCASClient(url, us, cfg.Authenticate)
+	cli.tokens = tokens
+	api.cli = cli
 
-	// Vehicles
-	r.Route("/vehicles", func(r chi.Router) {
-		r.Get("/", api.VehiclesHandler)
-		r.Group(func(r chi.Router) {
-			r.Use(cli.casauth)
-			r.Post("/create", api.VehiclesCreateHandler)
-			r.Post("/edit", api.VehiclesEditHandler)
-			r.Delete("/", api.VehiclesDeleteHandler)
-		})
-	})
+	// Login forms and callbacks for providers other than CAS
+	if ep, ok := cli.cas.(auth.EndpointProvider); ok {
+		r.Mount("/auth", ep.Endpoints())
+	}
 
-	// Updates
-	r.Route("/updates", func(r chi.Router) {
-		r.Get("/", api.UpdatesHandler)
-	})
+	// Each group of admin routes requires a role, and a scope if API tokens can be
+	// used; see shuttletracker.Roles and shuttletracker.Scopes. Fusion and the REST API stream
+	// some responses, which etag would buffer, so they pick which of their routes use etag.
+	// Raw rider tracks also need a permission that has to be granted to each User.
+	rawExportAuth := chi.Chain(cli.requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeFusionRaw),
+		cli.requirePermission(shuttletracker.PermissionFusionRawExport)).Handler
+	r.Mount("/fusion", api.fm.router(cli.requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeRead), rawExportAuth))
 
-	// History
-	r.Route("/history", func(r chi.Router) {
-		r.Get("/", api.HistoryHandler)
-	})
+	// Versioned REST API
+	r.Mount("/api/v1", api.v1Router(cli.requireAPIRole))
 
-	// Admin message
-	r.Route("/adminMessage", func(r chi.Router) {
-		r.Get("/", api.AdminMessageHandler)
-		r.Group(func(r chi.Router) {
-			r.Use(cli.casauth)
-			r.Post("/", api.SetAdminMessage)
+	r.Group(func(r chi.Router) {
+		r.Use(etag)
+
+		// Vehicles
+		r.Route("/vehicles", func(r chi.Router) {
+			r.Get("/", api.VehiclesHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeVehicles))
+				r.Post("/create", api.VehiclesCreateHandler)
+				r.Post("/edit", api.VehiclesEditHandler)
+				r.Delete("/", api.VehiclesDeleteHandler)
+			})
 		})
-	})
 
-	// Feedback
-	r.Route("/forms", func(r chi.Router) {
-		r.Post("/", api.FeedbackCreateHandler)
-		r.Group(func(r chi.Router) {
-			r.Use(cli.casauth)
-			r.Get("/admin", api.FeedbackAdminHandler)
-			r.Get("/", api.FeedbackHandler)
-			r.Delete("/", api.FeedbackDeleteHandler)
+		// Updates
+		r.Route("/updates", func(r chi.Router) {
+			r.Get("/", api.UpdatesHandler)
 		})
-	})
 
-	// Routes
-	r.Route("/routes", func(r chi.Router) {
-		r.Get("/", api.RoutesHandler)
-		r.Group(func(r chi.Router) {
-			r.Use(cli.casauth)
-			r.Post("/create", api.RoutesCreateHandler)
-			r.Post("/edit", api.RoutesEditHandler)
-			r.Delete("/", api.RoutesDeleteHandler)
+		// History
+		r.Route("/history", func(r chi.Router) {
+			r.Get("/", api.HistoryHandler)
 		})
-	})
 
-	r.Route("/eta", func(r chi.Router) {
-		r.Get("/", api.ETAHandler)
-	})
+		// Admin message
+		r.Route("/adminMessage", func(r chi.Router) {
+			r.Get("/", api.AdminMessageHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeMessages))
+				r.Post("/", api.SetAdminMessage)
+			})
+		})
 
-	// Stops
-	r.Route("/stops", func(r chi.Router) {
-		r.Get("/", api.StopsHandler)
-		r.Group(func(r chi.Router) {
-			r.Use(cli.casauth)
-			r.Post("/create", api.StopsCreateHandler)
-			r.Delete("/", api.StopsDeleteHandler)
+		// Feedback
+		r.Route("/forms", func(r chi.Router) {
+			r.Post("/", api.FeedbackCreateHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeRead))
+				r.Get("/admin", api.FeedbackAdminHandler)
+				r.Get("/", api.FeedbackHandler)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeFeedback))
+				r.Patch("/", api.FeedbackEditHandler)
+				r.Delete("/", api.FeedbackDeleteHandler)
+				r.Put("/prompt", api.FeedbackPromptHandler)
+			})
+		})
+
+		// Routes
+		r.Route("/routes", func(r chi.Router) {
+			r.Get("/", api.RoutesHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+				r.Post("/create", api.RoutesCreateHandler)
+				r.Post("/edit", api.RoutesEditHandler)
+				r.Delete("/", api.RoutesDeleteHandler)
+			})
 		})
-	})
 
-	// Fusion
-	r.Mount("/fusion", api.fm.router(cli.casauth))
+		r.Route("/eta", func(r chi.Router) {
+			r.Get("/", api.ETAHandler)
+		})
 
-	r.Get("/logout/", cli.logout)
-	// Admin
-	r.Route("/admin", func(r chi.Router) {
-		r.Use(cli.casauth)
-		r.Get("/*", api.AdminHandler)
-		r.Get("/login", api.AdminHandler)
-		r.Get("/logout", cli.logout)
-	})
+		// Stops
+		r.Route("/stops", func(r chi.Router) {
+			r.Get("/", api.StopsHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+				r.Post("/create", api.StopsCreateHandler)
+				r.Post("/edit", api.StopsEditHandler)
+				r.Delete("/", api.StopsDeleteHandler)
+			})
+		})
 
-	r.Group(func(r chi.Router) {
-		r.Use(cli.casauth)
-		r.Get("/getKey/", api.KeyHandler)
-	})
+		r.Get("/logout/", cli.logout)
+		// Admin
+		r.Route("/admin", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeRead))
+				r.Get("/audit", api.AuditHandler)
+				r.Get("/ratelimits", limiter.statsHandler)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(cli.requireRole(shuttletracker.RoleViewer, ""))
+				r.Get("/*", api.AdminHandler)
+				r.Get("/login", api.AdminHandler)
+				r.Get("/logout", cli.logout)
+			})
+		})
 
-	r.Method("GET", "/static/*", http.StripPrefix("/static/", http.FileServer(staticFileSystem{http.Dir("static/")})))
+		r.Group(func(r chi.Router) {
+			r.Use(cli.requireRole(shuttletracker.RoleViewer, ""))
+			r.Get("/getKey/", api.KeyHandler)
+		})
 
-	r.Get("/", api.IndexHandler)
-	r.Get("/about", api.IndexHandler)
-	r.Get("/faq", api.IndexHandler)
-	r.Get("/schedules", api.IndexHandler)
-	r.Get("/settings", api.IndexHandler)
-	r.Get("/changes", api.IndexHandler)
-	r.Get("/etas", api.IndexHandler)
-	r.Get("/feedback", api.IndexHandler)
+		r.Method("GET", "/static/*", http.StripPrefix("/static/", http.FileServer(staticFileSystem{http.Dir("static/")})))
 
-	// iTRAK data feed endpoint
-	r.Get("/datafeed", api.DataFeedHandler)
+		r.Get("/", api.IndexHandler)
+		r.Get("/about", api.IndexHandler)
+		r.Get("/faq", api.IndexHandler)
+		r.Get("/schedules", api.IndexHandler)
+		r.Get("/settings", api.IndexHandler)
+		r.Get("/changes", api.IndexHandler)
+		r.Get("/etas", api.IndexHandler)
+		r.Get("/feedback", api.IndexHandler)
+
+		// iTRAK data feed endpoint
+		r.Get("/datafeed", api.DataFeedHandler)
+	})
 
 	api.handler = r
 
 	return &api, nil
 }
 
+// username returns the username of the administrator making a request, which is
+// recorded with what they change.
+func (api *API) username(r *http.Request) string {
+	if api.cli == nil {
+		return ""
+	}
+	return api.cli.username(r)
+}
+
 func NewConfig(v *viper.Viper) *Config {
 	cfg := &Config{
-		ListenURL:    "0.0.0.0:8080",
-		Authenticate: true,
+		ListenURL:           "0.0.0.0:8080",
+		Authenticate:        true,
+		FusionTrackTTL:      "24h",
+		FusionPrivacyRadius: 200,
+		AuthProvider:        "cas",
+		SessionIdleTimeout:  "1h",
+		SessionMaxAge:       "12h",
+		CookieSameSite:      "lax",
+		RateLimits: []RateLimit{
+			{Path: "/", Burst: 300, Every: "100ms"},
+			{Method: "POST", Path: "/forms", Burst: 5, Every: "1m"},
+			{Method: "POST", Path: "/auth/login", Burst: 10, Every: "30s"},
+		},
+		RateLimitStore: "memory",
+		CalendarDomain: "shuttles.rpi.edu",
 	}
 	v.SetDefault("api.listenurl", cfg.ListenURL)
 	v.SetDefault("api.casurl", cfg.CasURL)
 	v.SetDefault("api.authenticate", cfg.Authenticate)
+	v.SetDefault("api.fusiontrackttl", cfg.FusionTrackTTL)
+	v.SetDefault("api.fusionprivacyradius", cfg.FusionPrivacyRadius)
+	v.SetDefault("api.authprovider", cfg.AuthProvider)
+	v.SetDefault("api.sessionsecret", cfg.SessionSecret)
+	v.SetDefault("api.sessionidletimeout", cfg.SessionIdleTimeout)
+	v.SetDefault("api.sessionmaxage", cfg.SessionMaxAge)
+	v.SetDefault("api.cookiesecure", cfg.CookieSecure)
+	v.SetDefault("api.cookiesamesite", cfg.CookieSameSite)
+	v.SetDefault("api.ratelimits", cfg.RateLimits)
+	v.SetDefault("api.ratelimitstore", cfg.RateLimitStore)
+	v.SetDefault("api.trustedproxies", cfg.TrustedProxies)
+	v.SetDefault("api.calendardomain", cfg.CalendarDomain)
+	v.SetDefault("api.oidcissuer", cfg.OIDCIssuer)
+	v.SetDefault("api.oidcclientid", cfg.OIDCClientID)
+	v.SetDefault("api.oidcclientsecret", cfg.OIDCClientSecret)
+	v.SetDefault("api.oidcredirecturl", cfg.OIDCRedirectURL)
+	v.SetDefault("api.oidcusernameclaim", cfg.OIDCUsernameClaim)
 	return cfg
 }
 
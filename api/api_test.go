@@ -36,16 +36,25 @@ func TestStatic(t *testing.T) {
 	// Go tests are run from the package dir, but our static files are one level higher
 	os.Chdir("..")
 
-	cfg := Config{}
+	cfg := Config{FusionTrackTTL: "24h"}
 	ms := &mock.ModelService{}
 	msg := &mock.MessageService{}
 	us := &mock.UserService{}
 	ups := &mock.UpdaterService{}
 	em := &mock.ETAService{}
+	fdb := &mock.FeedbackService{}
+	ts := &mock.TrackService{}
+	ts.On("TrackPositionsSince", tmock.AnythingOfType("time.Time")).Return([]*shuttletracker.TrackPosition{}, nil)
+	bbs := &mock.BusButtonService{}
+	audits := &mock.AuditService{}
+	tokens := &mock.APITokenService{}
+	rateLimits := &mock.RateLimitService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{}, nil)
+	msg.On("Alerts").Return([]*shuttletracker.Alert{}, nil)
 	em.On("Subscribe", tmock.AnythingOfType("func(shuttletracker.VehicleETA)")).Return()
 	ms.LocationService.On("SubscribeLocations").Return(make(chan *shuttletracker.Location))
 
-	api, err := New(cfg, ms, msg, us, ups, em)
+	api, err := New(cfg, ms, msg, us, ups, em, fdb, ts, bbs, audits, tokens, rateLimits)
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 		return
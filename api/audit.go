@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// auditDefaultLimit and auditMaxLimit bound how many entries /admin/audit returns at once.
+	auditDefaultLimit = 50
+	auditMaxLimit     = 500
+)
+
+// auditPage is a page of AuditEntries. NextBefore is passed as the "before" query
+// parameter to get the next page, and is zero on the last page.
+type auditPage struct {
+	Entries    []*shuttletracker.AuditEntry `json:"entries"`
+	NextBefore int64                        `json:"next_before,omitempty"`
+}
+
+// snapshot marshals something that is about to change so that it can be audited.
+// Nil marshals to null.
+func snapshot(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.WithError(err).Error("unable to marshal audit snapshot")
+		return nil
+	}
+	return b
+}
+
+// audit records that the administrator making a request changed something. Errors are
+// logged instead of returned because the change has already been made by then.
+func (api *API) audit(r *http.Request, action, targetType string, targetID int64, before, after json.RawMessage) {
+	if api.audits == nil {
+		return
+	}
+	entry := &shuttletracker.AuditEntry{
+		Actor:      api.username(r),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     before,
+		After:      after,
+	}
+	err := api.audits.CreateAuditEntry(entry)
+	if err != nil {
+		log.WithError(err).Errorf("unable to record %s of %s %d", action, targetType, targetID)
+	}
+}
+
+// auditFilter parses the query parameters of /admin/audit.
+func auditFilter(r *http.Request) (shuttletracker.AuditFilter, error) {
+	q := r.URL.Query()
+	filter := shuttletracker.AuditFilter{
+		Actor:      q.Get("actor"),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		Limit:      auditDefaultLimit,
+	}
+
+	ints := []struct {
+		key string
+		v   *int64
+	}{
+		{"target_id", &filter.TargetID},
+		{"before", &filter.BeforeID},
+	}
+	for _, i := range ints {
+		if s := q.Get(i.key); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 1 {
+				return filter, fmt.Errorf("%s must be a positive integer", i.key)
+			}
+			*i.v = n
+		}
+	}
+
+	times := []struct {
+		key string
+		v   *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	}
+	for _, t := range times {
+		if s := q.Get(t.key); s != "" {
+			parsed, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 time", t.key)
+			}
+			*t.v = parsed
+		}
+	}
+
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > auditMaxLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", auditMaxLimit)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+// AuditHandler writes a page of the audit log, newest first. It can be filtered by
+// the actor, action, target_type, target_id, since and until query parameters.
+func (api *API) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := api.audits.AuditEntries(filter)
+	if err != nil {
+		log.WithError(err).Error("unable to get audit entries")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := auditPage{Entries: entries}
+	if len(entries) == filter.Limit {
+		page.NextBefore = entries[len(entries)-1].ID
+	}
+	err = WriteJSON(w, page)
+	if err != nil {
+		log.WithError(err).Error("unable to write JSON")
+	}
+}
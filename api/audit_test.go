@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestAuditHandler(t *testing.T) {
+	audits := &mock.AuditService{}
+	since := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	audits.On("AuditEntries", shuttletracker.AuditFilter{
+		Actor:      "alice",
+		TargetType: "route",
+		Since:      since,
+		BeforeID:   10,
+		Limit:      2,
+	}).Return([]*shuttletracker.AuditEntry{{ID: 9}, {ID: 7}}, nil)
+	api := API{audits: audits}
+
+	req := httptest.NewRequest("GET", "/admin/audit?actor=alice&target_type=route&since=2019-03-01T00:00:00Z&before=10&limit=2", nil)
+	w := httptest.NewRecorder()
+	api.AuditHandler(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Fatalf("got status %d, expected 200", resp.StatusCode)
+	}
+	var page auditPage
+	err := json.NewDecoder(resp.Body).Decode(&page)
+	if err != nil {
+		t.Fatalf("unable to decode response: %s", err)
+	}
+	if len(page.Entries) != 2 || page.NextBefore != 7 {
+		t.Errorf("got %d entries and next_before %d, expected 2 and 7", len(page.Entries), page.NextBefore)
+	}
+
+	for _, query := range []string{"limit=0", "limit=501", "before=x", "target_id=-2", "until=yesterday"} {
+		req := httptest.NewRequest("GET", "/admin/audit?"+query, nil)
+		w := httptest.NewRecorder()
+		api.AuditHandler(w, req)
+		if w.Code != 400 {
+			t.Errorf("%s: got status %d, expected 400", query, w.Code)
+		}
+	}
+	audits.AssertNumberOfCalls(t, "AuditEntries", 1)
+}
@@ -1,9 +1,13 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	gc "gopkg.in/cas.v2"
 
@@ -12,13 +16,26 @@ import (
 	"github.com/wtg/shuttletracker/log"
 )
 
-// CASClient stores the local cas client and an instance of the database
+// CASClient stores the authentication provider, which is CAS unless configured
+// otherwise, and an instance of the database
 type CASClient struct {
 	cas          auth.AuthenticationService
 	us           shuttletracker.UserService
+	tokens       shuttletracker.APITokenService
 	authenticate bool
+
+	// cookies has the attributes for cookies that Shuttle Tracker sets itself.
+	cookies auth.SessionOptions
 }
 
+type contextKey int
+
+// tokenUsernameKey is the request context key for the username of an API token's User.
+const tokenUsernameKey contextKey = iota
+
+// apiTokenTouchInterval is how often an API token's last use is recorded.
+const apiTokenTouchInterval = time.Minute
+
 // CreateCASClient creates an authentication service CASClient using a cas url and database
 func CreateCASClient(url *url.URL, us shuttletracker.UserService, authenticate bool) *CASClient {
 	client := gc.NewClient(&gc.Options{
@@ -36,6 +53,72 @@ func CreateCASClient(url *url.URL, us shuttletracker.UserService, authenticate b
 	return cli
 }
 
+// newAuthClient creates a CASClient for the provider in cfg.AuthProvider.
+func newAuthClient(cfg Config, us shuttletracker.UserService) (*CASClient, error) {
+	opts, err := sessionOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.AuthProvider {
+	case "", "cas":
+		if opts.SameSite == http.SameSiteStrictMode {
+			// browsers wouldn't send the session cookie after CAS redirects back
+			return nil, errors.New("CAS can't use SameSite=Strict cookies")
+		}
+		u, err := url.Parse(cfg.CasURL)
+		if err != nil {
+			return nil, err
+		}
+		return &CASClient{cas: auth.NewCAS(u, opts), us: us, authenticate: cfg.Authenticate, cookies: opts}, nil
+	case "oidc":
+		provider, err := auth.NewOIDC(auth.OIDCConfig{
+			Issuer:        cfg.OIDCIssuer,
+			ClientID:      cfg.OIDCClientID,
+			ClientSecret:  cfg.OIDCClientSecret,
+			RedirectURL:   cfg.OIDCRedirectURL,
+			UsernameClaim: cfg.OIDCUsernameClaim,
+		}, cfg.SessionSecret, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &CASClient{cas: provider, us: us, authenticate: cfg.Authenticate, cookies: opts}, nil
+	case "local":
+		provider, err := auth.NewLocal(us, cfg.SessionSecret, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &CASClient{cas: provider, us: us, authenticate: cfg.Authenticate, cookies: opts}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth provider %q", cfg.AuthProvider)
+	}
+}
+
+// sessionOptions parses the session settings in cfg. Empty ones are left to defaults.
+func sessionOptions(cfg Config) (auth.SessionOptions, error) {
+	opts := auth.SessionOptions{Secure: cfg.CookieSecure}
+	var err error
+	if cfg.SessionIdleTimeout != "" {
+		opts.IdleTimeout, err = time.ParseDuration(cfg.SessionIdleTimeout)
+		if err != nil {
+			return opts, fmt.Errorf("invalid session idle timeout: %s", err)
+		}
+	}
+	if cfg.SessionMaxAge != "" {
+		opts.MaxAge, err = time.ParseDuration(cfg.SessionMaxAge)
+		if err != nil {
+			return opts, fmt.Errorf("invalid session max age: %s", err)
+		}
+	}
+	opts.SameSite, err = auth.ParseSameSite(cfg.CookieSameSite)
+	if err != nil {
+		return opts, err
+	}
+	if opts.SameSite == http.SameSiteNoneMode && !opts.Secure {
+		return opts, errors.New("SameSite=None cookies must be secure")
+	}
+	return opts, nil
+}
+
 // InjectMocks allows mock interfaces to be used
 func InjectMocks(cli auth.AuthenticationService, us shuttletracker.UserService, auth bool) *CASClient {
 	c := &CASClient{
@@ -46,6 +129,16 @@ func InjectMocks(cli auth.AuthenticationService, us shuttletracker.UserService,
 	return c
 }
 
+// username returns the lowercase username of whoever made a request, including with
+// an API token. It's empty if they didn't log in, e.g. because authentication is
+// disabled.
+func (cli *CASClient) username(r *http.Request) string {
+	if username, ok := r.Context().Value(tokenUsernameKey).(string); ok {
+		return username
+	}
+	return strings.ToLower(cli.cas.Username(r))
+}
+
 func (cli *CASClient) logout(w http.ResponseWriter, r *http.Request) {
 	cli.cas.Logout(w, r)
 }
@@ -83,3 +176,167 @@ func (cli *CASClient) casauth(next http.Handler) http.Handler {
 
 	})
 }
+
+// authErrorWriter answers a request that couldn't be authenticated or authorized.
+// code is one of the apiError codes, for writers that use them.
+type authErrorWriter func(w http.ResponseWriter, status int, code string, msg string)
+
+// plainAuthError answers with plain text like the older endpoints do.
+func plainAuthError(w http.ResponseWriter, status int, code string, msg string) {
+	http.Error(w, msg, status)
+}
+
+// requireRole only allows Users whose role is at least as capable as role. They log in
+// with casauth, or send an API token with scope as Bearer authorization. API tokens
+// aren't accepted if scope is empty. Requests that log in with casauth are also
+// protected from CSRF.
+func (cli *CASClient) requireRole(role string, scope string) func(http.Handler) http.Handler {
+	return cli.roleAuth(role, scope, plainAuthError, cli.casauth)
+}
+
+// requireAPIRole is like requireRole, but it's for the versioned API. Errors are
+// answered with an apiErrorEnvelope, and requests without a session get a 401 instead
+// of being sent to log in.
+func (cli *CASClient) requireAPIRole(role string, scope string) func(http.Handler) http.Handler {
+	return cli.roleAuth(role, scope, writeAuthAPIError, cli.sessionAuth)
+}
+
+// sessionAuth only serves requests that have logged in, answering others with a 401.
+// Unlike casauth, it doesn't check whether the User exists.
+func (cli *CASClient) sessionAuth(next http.Handler) http.Handler {
+	return cli.cas.HandleFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cli.authenticate && !cli.cas.Authenticated(r) {
+			writeAuthAPIError(w, http.StatusUnauthorized, apiErrorUnauthorized, "unauthenticated")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// roleAuth implements requireRole and requireAPIRole. login wraps requests that
+// don't have an API token, and fail answers those that are turned away.
+func (cli *CASClient) roleAuth(role string, scope string, fail authErrorWriter, login func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		protected := cli.csrf(next, fail)
+		session := login(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cli.authenticate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := cli.us.User(cli.username(r))
+			if err == shuttletracker.ErrUserNotFound {
+				fail(w, http.StatusUnauthorized, apiErrorUnauthorized, "unauthenticated")
+				return
+			} else if err != nil {
+				log.WithError(err).Error("unable to get user")
+				fail(w, http.StatusInternalServerError, apiErrorInternal, err.Error())
+				return
+			}
+			if !user.HasRole(role) {
+				fail(w, http.StatusForbidden, apiErrorForbidden, "forbidden: requires the "+role+" role")
+				return
+			}
+			protected.ServeHTTP(w, r)
+		}))
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cli.authenticate && auth.BearerToken(r) != "" {
+				cli.tokenAuth(w, r, role, scope, fail, next)
+				return
+			}
+			session.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requirePermission only allows Users that have been granted a permission, whether
+// they logged in or sent an API token. It must be used after requireRole.
+func (cli *CASClient) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !cli.authenticate {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := cli.us.User(cli.username(r))
+			if err == shuttletracker.ErrUserNotFound {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			} else if err != nil {
+				log.WithError(err).Error("unable to get user")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !user.HasPermission(permission) {
+				http.Error(w, "forbidden: requires the "+permission+" permission", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenAuth serves a request made with an API token if the token has scope and its
+// User has role.
+func (cli *CASClient) tokenAuth(w http.ResponseWriter, r *http.Request, role string, scope string, fail authErrorWriter, next http.Handler) {
+	unauthorized := func(msg string) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shuttletracker"`)
+		fail(w, http.StatusUnauthorized, apiErrorUnauthorized, msg)
+	}
+	forbidden := func(msg string) {
+		fail(w, http.StatusForbidden, apiErrorForbidden, msg)
+	}
+	if scope == "" {
+		forbidden("forbidden: API tokens can't be used here")
+		return
+	}
+	if cli.tokens == nil {
+		unauthorized("API tokens aren't supported")
+		return
+	}
+
+	now := time.Now()
+	token, err := cli.tokens.APITokenWithHash(auth.HashAPIToken(auth.BearerToken(r)))
+	if err == shuttletracker.ErrAPITokenNotFound {
+		unauthorized("invalid API token")
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get API token")
+		fail(w, http.StatusInternalServerError, apiErrorInternal, err.Error())
+		return
+	}
+	if token.Expired(now) {
+		unauthorized("API token expired")
+		return
+	}
+	if !token.HasScope(scope) {
+		forbidden("forbidden: API token needs the " + scope + " scope")
+		return
+	}
+
+	user, err := cli.us.User(token.Username)
+	if err == shuttletracker.ErrUserNotFound {
+		unauthorized("unauthenticated")
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get user")
+		fail(w, http.StatusInternalServerError, apiErrorInternal, err.Error())
+		return
+	}
+	if !user.HasRole(role) {
+		forbidden("forbidden: requires the " + role + " role")
+		return
+	}
+
+	if token.LastUsed == nil || now.Sub(*token.LastUsed) >= apiTokenTouchInterval {
+		err = cli.tokens.TouchAPIToken(token.ID, now)
+		if err != nil {
+			log.WithError(err).Error("unable to record API token use")
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), tokenUsernameKey, user.Username)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -2,16 +2,21 @@ package api
 
 import (
 	"github.com/go-chi/chi"
+	tmock "github.com/stretchr/testify/mock"
 
+	"github.com/wtg/shuttletracker"
 	"github.com/wtg/shuttletracker/auth"
 	"github.com/wtg/shuttletracker/mock"
 
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCasUnauthenticated(t *testing.T) {
@@ -128,3 +133,213 @@ func TestCasAuthenticatedBadUser(t *testing.T) {
 	_ = err
 
 }
+
+func TestRequirePermission(t *testing.T) {
+	client := &auth.Mock{}
+	us := &mock.UserService{}
+	cli := InjectMocks(client, us, true)
+
+	r := chi.NewRouter()
+	r.Use(cli.requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeFusionRaw))
+	r.Use(cli.requirePermission(shuttletracker.PermissionFusionRawExport))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test"))
+	})
+	us.On("UserExists", "lyonj4").Return(true, nil)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, c := range []struct {
+		user   *shuttletracker.User
+		status int
+	}{
+		{&shuttletracker.User{Username: "lyonj4", Role: shuttletracker.RoleOwner}, http.StatusForbidden},
+		{&shuttletracker.User{Username: "lyonj4", Role: shuttletracker.RoleViewer, Permissions: []string{shuttletracker.PermissionFusionRawExport}}, http.StatusOK},
+	} {
+		us.On("User", "lyonj4").Return(c.user, nil).Twice()
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Error performing http request")
+		}
+		if resp.StatusCode != c.status {
+			t.Errorf("got status %d for %s with permissions %v, expected %d", resp.StatusCode, c.user.Role, c.user.Permissions, c.status)
+		}
+	}
+	us.AssertExpectations(t)
+}
+
+func TestRequireRole(t *testing.T) {
+	client := &auth.Mock{}
+	us := &mock.UserService{}
+	cli := InjectMocks(client, us, true)
+
+	r := chi.NewRouter()
+	r.Use(cli.requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("test"))
+	})
+	us.On("UserExists", "lyonj4").Return(true, nil)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, c := range []struct {
+		role   string
+		status int
+	}{
+		{shuttletracker.RoleViewer, http.StatusForbidden},
+		{shuttletracker.RoleDispatcher, http.StatusForbidden},
+		{shuttletracker.RoleEditor, http.StatusOK},
+		{shuttletracker.RoleOwner, http.StatusOK},
+		{"", http.StatusForbidden},
+	} {
+		us.On("User", "lyonj4").Return(&shuttletracker.User{Username: "lyonj4", Role: c.role}, nil).Once()
+		resp, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Error performing http request")
+		}
+		if resp.StatusCode != c.status {
+			t.Errorf("got status %d for %q, expected %d", resp.StatusCode, c.role, c.status)
+		}
+	}
+	us.AssertExpectations(t)
+}
+
+func TestNewAuthClient(t *testing.T) {
+	us := &mock.UserService{}
+	for _, c := range []struct {
+		cfg      Config
+		provider interface{}
+	}{
+		{Config{CasURL: "https://cas.example.com/"}, &auth.CAS{}},
+		{Config{AuthProvider: "local"}, &auth.Local{}},
+		{Config{AuthProvider: "oidc", OIDCIssuer: "https://id.example.com", OIDCClientID: "st", OIDCRedirectURL: "http://localhost/auth/callback"}, &auth.OIDC{}},
+	} {
+		cli, err := newAuthClient(c.cfg, us)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", c.cfg.AuthProvider, err)
+			continue
+		}
+		if reflect.TypeOf(cli.cas) != reflect.TypeOf(c.provider) {
+			t.Errorf("%q: got provider %T, expected %T", c.cfg.AuthProvider, cli.cas, c.provider)
+		}
+	}
+
+	for _, cfg := range []Config{
+		{AuthProvider: "saml"},
+		{AuthProvider: "oidc"},
+		{AuthProvider: "cas", CookieSameSite: "strict"},
+		{AuthProvider: "local", CookieSameSite: "none"},
+		{AuthProvider: "local", SessionIdleTimeout: "forever"},
+	} {
+		_, err := newAuthClient(cfg, us)
+		if err == nil {
+			t.Errorf("%q: expected an error", cfg.AuthProvider)
+		}
+	}
+}
+
+func TestRequireRoleAPIToken(t *testing.T) {
+	us := &mock.UserService{}
+	us.On("User", "dispatch").Return(&shuttletracker.User{Username: "dispatch", Role: shuttletracker.RoleDispatcher}, nil)
+	tokens := &mock.APITokenService{}
+	valid := &shuttletracker.APIToken{ID: 1, Username: "dispatch", Scopes: []string{shuttletracker.ScopeMessages}, Expires: time.Now().Add(time.Hour)}
+	expired := &shuttletracker.APIToken{ID: 2, Username: "dispatch", Scopes: []string{shuttletracker.ScopeMessages}, Expires: time.Now().Add(-time.Hour)}
+	tokens.On("APITokenWithHash", auth.HashAPIToken("st_valid")).Return(valid, nil)
+	tokens.On("APITokenWithHash", auth.HashAPIToken("st_expired")).Return(expired, nil)
+	tokens.On("APITokenWithHash", auth.HashAPIToken("st_wrong")).Return((*shuttletracker.APIToken)(nil), shuttletracker.ErrAPITokenNotFound)
+	tokens.On("TouchAPIToken", int64(1), tmock.AnythingOfType("time.Time")).Return(nil)
+	cli := InjectMocks(&auth.Mock{}, us, true)
+	cli.tokens = tokens
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(cli.username(r)))
+	}
+	r := chi.NewRouter()
+	r.With(cli.requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeMessages)).Get("/message", handler)
+	r.With(cli.requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeVehicles)).Get("/vehicles", handler)
+	r.With(cli.requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeMessages)).Get("/editor", handler)
+	r.With(cli.requireRole(shuttletracker.RoleViewer, "")).Get("/admin", handler)
+
+	for _, c := range []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/message", "st_valid", http.StatusOK},
+		{"/message", "st_expired", http.StatusUnauthorized},
+		{"/message", "st_wrong", http.StatusUnauthorized},
+		{"/vehicles", "st_valid", http.StatusForbidden},
+		{"/editor", "st_valid", http.StatusForbidden},
+		{"/admin", "st_valid", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s with %s: got status %d, expected %d", c.path, c.token, w.Code, c.status)
+		}
+		if w.Code == http.StatusOK && w.Body.String() != "dispatch" {
+			t.Errorf("got username %q, expected the token's user", w.Body.String())
+		}
+	}
+	tokens.AssertNumberOfCalls(t, "TouchAPIToken", 1)
+}
+
+func TestRequireAPIRole(t *testing.T) {
+	us := &mock.UserService{}
+	us.On("User", "lyonj4").Return(&shuttletracker.User{Username: "lyonj4", Role: shuttletracker.RoleViewer}, nil)
+	tokens := &mock.APITokenService{}
+	tokens.On("APITokenWithHash", auth.HashAPIToken("st_wrong")).Return((*shuttletracker.APIToken)(nil), shuttletracker.ErrAPITokenNotFound)
+	cli := InjectMocks(&auth.Mock{}, us, true)
+	cli.tokens = tokens
+
+	local, err := auth.NewLocal(us, "", auth.SessionOptions{})
+	if err != nil {
+		t.Fatalf("unable to create local auth: %s", err)
+	}
+	anonymous := InjectMocks(local, us, true)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	for _, c := range []struct {
+		cli    *CASClient
+		role   string
+		method string
+		token  string
+		status int
+		code   string
+	}{
+		{anonymous, shuttletracker.RoleViewer, "GET", "", http.StatusUnauthorized, apiErrorUnauthorized},
+		{cli, shuttletracker.RoleEditor, "GET", "", http.StatusForbidden, apiErrorForbidden},
+		{cli, shuttletracker.RoleViewer, "POST", "", http.StatusForbidden, apiErrorForbidden},
+		{cli, shuttletracker.RoleViewer, "GET", "st_wrong", http.StatusUnauthorized, apiErrorUnauthorized},
+	} {
+		r := chi.NewRouter()
+		r.Use(c.cli.requireAPIRole(c.role, shuttletracker.ScopeRoutes))
+		r.HandleFunc("/", ok)
+
+		req := httptest.NewRequest(c.method, "/", nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s %s with %q: got status %d, expected %d", c.role, c.method, c.token, w.Code, c.status)
+			continue
+		}
+		var envelope apiErrorEnvelope
+		err := json.NewDecoder(w.Body).Decode(&envelope)
+		if err != nil {
+			t.Errorf("%s %s with %q: unable to decode error: %s", c.role, c.method, c.token, err)
+			continue
+		}
+		if envelope.Error.Code != c.code {
+			t.Errorf("%s %s with %q: got code %q, expected %q", c.role, c.method, c.token, envelope.Error.Code, c.code)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the reverse proxies in front of Shuttle Tracker. Only their
+// X-Forwarded-For headers are believed, since anyone else could make them up.
+type trustedProxies []*net.IPNet
+
+// parseTrustedProxies parses CIDRs such as "10.0.0.0/8". Single addresses are allowed too.
+func parseTrustedProxies(cidrs []string) (trustedProxies, error) {
+	tp := trustedProxies{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", cidr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			tp = append(tp, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %s", cidr, err)
+		}
+		tp = append(tp, ipNet)
+	}
+	return tp, nil
+}
+
+func (tp trustedProxies) trusted(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range tp {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the IP address that a request came from. If it was passed along by
+// trusted proxies, that's the last address in X-Forwarded-For that isn't one of them.
+func (tp trustedProxies) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if !tp.trusted(ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			// a malformed entry can't be trusted, and neither can anything before it
+			return ip
+		}
+		ip = hop
+		if !tp.trusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// remoteIP returns the IP address that a request came from.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("unable to parse trusted proxies: %s", err)
+	}
+
+	for _, c := range []struct {
+		remote    string
+		forwarded string
+		ip        string
+	}{
+		{"198.51.100.7:1234", "", "198.51.100.7"},
+		// untrusted clients can't pretend to be someone else
+		{"198.51.100.7:1234", "203.0.113.9", "198.51.100.7"},
+		{"192.0.2.1:443", "203.0.113.9", "203.0.113.9"},
+		{"10.1.2.3:443", "203.0.113.9, 10.4.5.6", "203.0.113.9"},
+		// only the hops that trusted proxies added are believed
+		{"10.1.2.3:443", "1.1.1.1, 203.0.113.9, 10.4.5.6", "203.0.113.9"},
+		{"10.1.2.3:443", "10.7.7.7", "10.7.7.7"},
+		{"10.1.2.3:443", "junk, 203.0.113.9", "203.0.113.9"},
+		{"10.1.2.3:443", "203.0.113.9, junk", "10.1.2.3"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if ip := proxies.clientIP(req); ip != c.ip {
+			t.Errorf("%s forwarding %q: got %s, expected %s", c.remote, c.forwarded, ip, c.ip)
+		}
+	}
+
+	_, err = parseTrustedProxies([]string{"10.0.0.0/33"})
+	if err == nil {
+		t.Errorf("expected an invalid CIDR to be rejected")
+	}
+}
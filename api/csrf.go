@@ -0,0 +1,77 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// csrfCookieName is a cookie with a random token that the admin interface copies
+	// into the csrfHeader of requests that change things. Other sites can't read it,
+	// so they can't forge those requests.
+	csrfCookieName = "shuttletracker_csrf"
+	csrfHeader     = "X-CSRF-Token"
+)
+
+func safeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+// newCSRFToken returns a random token for the csrf cookie.
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// csrf makes sure that requests that change things and are authenticated by a session
+// cookie came from Shuttle Tracker itself. Other requests get a csrf cookie if they
+// don't have one yet. Forged requests are answered with fail. It must be used after
+// casauth.
+func (cli *CASClient) csrf(next http.Handler, fail authErrorWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cli.authenticate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(csrfCookieName)
+		if safeMethod(r.Method) {
+			if err != nil || cookie.Value == "" {
+				cli.setCSRFCookie(w)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := r.Header.Get(csrfHeader)
+		if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+			fail(w, http.StatusForbidden, apiErrorForbidden, "forbidden: missing or invalid CSRF token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (cli *CASClient) setCSRFCookie(w http.ResponseWriter) {
+	token, err := newCSRFToken()
+	if err != nil {
+		log.WithError(err).Error("unable to generate CSRF token")
+		return
+	}
+	// the admin interface has to be able to read it
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   cli.cookies.Secure,
+		SameSite: cli.cookies.SameSite,
+	})
+}
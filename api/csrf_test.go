@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/auth"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestCSRF(t *testing.T) {
+	us := &mock.UserService{}
+	us.On("UserExists", "lyonj4").Return(true, nil)
+	us.On("User", "lyonj4").Return(&shuttletracker.User{Username: "lyonj4", Role: shuttletracker.RoleOwner}, nil)
+	cli := InjectMocks(&auth.Mock{}, us, true)
+
+	r := chi.NewRouter()
+	r.Use(cli.requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	r.Get("/routes", ok)
+	r.Post("/routes/create", ok)
+
+	// reading gets a token
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/routes", nil))
+	var token *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookieName {
+			token = c
+		}
+	}
+	if w.Code != http.StatusOK || token == nil || token.Value == "" {
+		t.Fatalf("got status %d and cookies %v, expected a CSRF cookie", w.Code, w.Result().Cookies())
+	}
+
+	for _, c := range []struct {
+		name   string
+		cookie bool
+		header string
+		status int
+	}{
+		{"no token", false, "", http.StatusForbidden},
+		{"header without cookie", false, token.Value, http.StatusForbidden},
+		{"cookie without header", true, "", http.StatusForbidden},
+		{"wrong header", true, "x" + token.Value, http.StatusForbidden},
+		{"matching", true, token.Value, http.StatusOK},
+	} {
+		req := httptest.NewRequest("POST", "/routes/create", nil)
+		if c.cookie {
+			req.AddCookie(token)
+		}
+		if c.header != "" {
+			req.Header.Set(csrfHeader, c.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: got status %d, expected %d", c.name, w.Code, c.status)
+		}
+	}
+}
@@ -1,28 +1,106 @@
 package api
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/mail"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
 )
 
+// Feedback longer than this is more likely to be spam than a long complaint.
+const maxFeedbackLength = 2000
+
 // FeedbackAdminHandler gets the feedback message with admin=true
 func (api *API) FeedbackAdminHandler(w http.ResponseWriter, r *http.Request) {
 	form := api.fdb.GetAdminForm()
 	WriteJSON(w, form)
 }
 
-// FeedbackHandler finds all forms in the database
+// feedbackFilter parses the query parameters of /forms.
+func feedbackFilter(r *http.Request) (shuttletracker.FormFilter, error) {
+	q := r.URL.Query()
+	filter := shuttletracker.FormFilter{
+		Query:    q.Get("q"),
+		Category: q.Get("category"),
+		Status:   q.Get("status"),
+	}
+	if filter.Category != "" && !containsString(shuttletracker.FeedbackCategories, filter.Category) {
+		return filter, fmt.Errorf("category must be one of %s", strings.Join(shuttletracker.FeedbackCategories, ", "))
+	}
+	if filter.Status != "" && !containsString(shuttletracker.FeedbackStatuses, filter.Status) {
+		return filter, fmt.Errorf("status must be one of %s", strings.Join(shuttletracker.FeedbackStatuses, ", "))
+	}
+
+	ints := []struct {
+		key string
+		v   *int64
+	}{
+		{"route_id", &filter.RouteID},
+		{"stop_id", &filter.StopID},
+		{"vehicle_id", &filter.VehicleID},
+	}
+	for _, i := range ints {
+		if s := q.Get(i.key); s != "" {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 1 {
+				return filter, fmt.Errorf("%s must be a positive integer", i.key)
+			}
+			*i.v = n
+		}
+	}
+
+	times := []struct {
+		key string
+		v   *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	}
+	for _, t := range times {
+		if s := q.Get(t.key); s != "" {
+			parsed, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 time", t.key)
+			}
+			*t.v = parsed
+		}
+	}
+	return filter, nil
+}
+
+// FeedbackHandler finds all forms in the database, or the one with the "id" query
+// parameter. The list can be filtered by the q, category, status, route_id, stop_id,
+// vehicle_id, since and until query parameters, and is CSV if "format" is "csv".
 func (api *API) FeedbackHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
 	if err != nil {
-		forms, err := api.fdb.GetForms()
+		filter, err := feedbackFilter(r)
 		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+			return
+		}
+		forms, err := api.fdb.SearchForms(filter)
+		if err != nil {
+			log.WithError(err).Error("unable to get forms")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if format == "csv" {
+			writeFeedbackCSV(w, forms)
+			return
+		}
 		WriteJSON(w, forms)
 	} else {
 		form, err := api.fdb.GetForm(id)
@@ -34,19 +112,261 @@ func (api *API) FeedbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// FeedbackCreateHandler adds a new form to the database
+var feedbackCSVHeader = []string{
+	"id", "created", "updated", "category", "status", "route_id", "stop_id", "vehicle_id",
+	"message", "prompt", "email", "notes",
+}
+
+func writeFeedbackCSV(w http.ResponseWriter, forms []*shuttletracker.Form) {
+	optional := func(id *int64) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatInt(*id, 10)
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="feedback.csv"`)
+	cw := csv.NewWriter(w)
+	_ = cw.Write(feedbackCSVHeader)
+	for _, f := range forms {
+		_ = cw.Write([]string{
+			strconv.FormatInt(f.ID, 10),
+			f.Created.Format(time.RFC3339),
+			f.Updated.Format(time.RFC3339),
+			f.Category,
+			f.Status,
+			optional(f.RouteID),
+			optional(f.StopID),
+			optional(f.VehicleID),
+			csvText(f.Message),
+			csvText(f.Prompt),
+			csvText(f.Email),
+			csvText(f.Notes),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.WithError(err).Error("unable to write feedback")
+	}
+}
+
+// csvText keeps text that riders wrote from being run as a formula when the CSV is
+// opened in a spreadsheet.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// validateFeedback checks a Form that a rider submitted. The route, stop, and
+// vehicle it's about are checked against the ModelService.
+func (api *API) validateFeedback(form *shuttletracker.Form) ([]apiFieldError, error) {
+	fields := []apiFieldError{}
+	if strings.TrimSpace(form.Message) == "" {
+		fields = append(fields, apiFieldError{Field: "message", Message: "is required"})
+	} else if len(form.Message) > maxFeedbackLength {
+		fields = append(fields, apiFieldError{Field: "message", Message: fmt.Sprintf("must be at most %d characters", maxFeedbackLength)})
+	}
+	if !containsString(shuttletracker.FeedbackCategories, form.Category) {
+		fields = append(fields, apiFieldError{Field: "category", Message: "must be one of " + strings.Join(shuttletracker.FeedbackCategories, ", ")})
+	}
+	if form.Email != "" {
+		addr, err := mail.ParseAddress(form.Email)
+		if err != nil || addr.Address != form.Email {
+			fields = append(fields, apiFieldError{Field: "email", Message: "is not a valid email address"})
+		} else if !form.ContactConsent {
+			fields = append(fields, apiFieldError{Field: "contact_consent", Message: "is required to leave an email"})
+		}
+	}
+
+	if form.RouteID != nil {
+		_, err := api.ms.Route(*form.RouteID)
+		if err == shuttletracker.ErrRouteNotFound {
+			fields = append(fields, apiFieldError{Field: "route_id", Message: fmt.Sprintf("route %d does not exist", *form.RouteID)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if form.StopID != nil {
+		_, err := api.ms.Stop(*form.StopID)
+		if err == shuttletracker.ErrStopNotFound {
+			fields = append(fields, apiFieldError{Field: "stop_id", Message: fmt.Sprintf("stop %d does not exist", *form.StopID)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if form.VehicleID != nil {
+		_, err := api.ms.Vehicle(*form.VehicleID)
+		if err == shuttletracker.ErrVehicleNotFound {
+			fields = append(fields, apiFieldError{Field: "vehicle_id", Message: fmt.Sprintf("vehicle %d does not exist", *form.VehicleID)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// writeFieldErrors responds with the fields that failed validation.
+func writeFieldErrors(w http.ResponseWriter, fields []apiFieldError) {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	http.Error(w, strings.Join(msgs, "; "), http.StatusUnprocessableEntity)
+}
+
+// FeedbackCreateHandler adds a new form to the database. Riders' feedback starts out
+// new and without notes, and can't be the prompt; see FeedbackPromptHandler.
 func (api *API) FeedbackCreateHandler(w http.ResponseWriter, r *http.Request) {
 	form := &shuttletracker.Form{}
-	err := json.NewDecoder(r.Body).Decode(form)
+	submission := struct {
+		*shuttletracker.Form
+		// Website is a honeypot. The feedback form hides it from people, so only
+		// bots fill it in.
+		Website string `json:"website"`
+	}{Form: form}
+	err := json.NewDecoder(r.Body).Decode(&submission)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if submission.Website != "" {
+		// Pretend it worked so that bots don't learn to leave it empty.
+		log.Debugf("dropped feedback that filled in the honeypot")
+		return
+	}
+
+	form.ID = 0
+	form.Admin = false
+	form.Status = shuttletracker.FeedbackStatusNew
+	form.Notes = ""
+	form.Email = strings.TrimSpace(form.Email)
+	if form.Email == "" {
+		form.ContactConsent = false
+	}
+	if form.Category == "" {
+		form.Category = shuttletracker.FeedbackCategoryOther
+	}
+	fields, err := api.validateFeedback(form)
+	if err != nil {
+		log.WithError(err).Error("unable to validate feedback")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(fields) > 0 {
+		writeFieldErrors(w, fields)
+		return
+	}
+
+	err = api.fdb.CreateForm(form)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+}
+
+// FeedbackPromptHandler replaces the prompt that the feedback form shows riders with
+// the message in the request body. It's a PUT so that the rate limit on submitting
+// feedback doesn't apply.
+func (api *API) FeedbackPromptHandler(w http.ResponseWriter, r *http.Request) {
+	prompt := struct {
+		Message string `json:"message"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&prompt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(prompt.Message) > maxFeedbackLength {
+		writeFieldErrors(w, []apiFieldError{{Field: "message", Message: fmt.Sprintf("must be at most %d characters", maxFeedbackLength)}})
+		return
+	}
+
+	before := api.fdb.GetAdminForm()
+	form := &shuttletracker.Form{
+		Message:  prompt.Message,
+		Admin:    true,
+		Category: shuttletracker.FeedbackCategoryOther,
+		Status:   shuttletracker.FeedbackStatusNew,
+	}
 	err = api.fdb.CreateForm(form)
 	if err != nil {
+		log.WithError(err).Error("unable to set prompt")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	api.audit(r, "feedback.prompt", "feedback", form.ID, snapshot(before), snapshot(form))
+	WriteJSON(w, form)
+}
+
+// FeedbackEditHandler triages the form with the "id" query parameter. Only its
+// category, status, and notes can be changed, and those that aren't in the request
+// body keep their current values. It's a PATCH so that the rate limit on submitting
+// feedback doesn't apply.
+func (api *API) FeedbackEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	edit := struct {
+		Category *string `json:"category"`
+		Status   *string `json:"status"`
+		Notes    *string `json:"notes"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&edit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	form, err := api.fdb.GetForm(id)
+	if err == shuttletracker.ErrFormNotFound {
+		http.Error(w, "Form not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get form")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	before := snapshot(form)
+
+	if edit.Category != nil {
+		form.Category = *edit.Category
+	}
+	if edit.Status != nil {
+		form.Status = *edit.Status
+	}
+	if edit.Notes != nil {
+		form.Notes = *edit.Notes
+	}
+	fields := []apiFieldError{}
+	if !containsString(shuttletracker.FeedbackCategories, form.Category) {
+		fields = append(fields, apiFieldError{Field: "category", Message: "must be one of " + strings.Join(shuttletracker.FeedbackCategories, ", ")})
+	}
+	if !containsString(shuttletracker.FeedbackStatuses, form.Status) {
+		fields = append(fields, apiFieldError{Field: "status", Message: "must be one of " + strings.Join(shuttletracker.FeedbackStatuses, ", ")})
+	}
+	if len(form.Notes) > maxFeedbackLength {
+		fields = append(fields, apiFieldError{Field: "notes", Message: fmt.Sprintf("must be at most %d characters", maxFeedbackLength)})
+	}
+	if len(fields) > 0 {
+		writeFieldErrors(w, fields)
+		return
+	}
+
+	err = api.fdb.EditForm(form)
+	if err == shuttletracker.ErrFormNotFound {
+		http.Error(w, "Form not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to edit form")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.audit(r, "feedback.modify", "feedback", form.ID, before, snapshot(form))
+	WriteJSON(w, form)
 }
 
 // FeedbackDeleteHandler deletes a form from database
@@ -56,6 +376,15 @@ func (api *API) FeedbackDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	form, err := api.fdb.GetForm(id)
+	if err == shuttletracker.ErrFormNotFound {
+		http.Error(w, "Form not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = api.fdb.DeleteForm(id)
 	if err != nil {
 		if err == shuttletracker.ErrFormNotFound {
@@ -63,5 +392,7 @@ func (api *API) FeedbackDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		return
 	}
+	api.audit(r, "feedback.delete", "feedback", id, snapshot(form), nil)
 }
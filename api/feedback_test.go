@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestFeedbackCreateHandler(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Route", int64(1)).Return(&shuttletracker.Route{ID: 1}, nil)
+	ms.VehicleService.On("Vehicle", int64(9)).Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	fdb := &stmock.FeedbackService{}
+	fdb.On("CreateForm", mock.Anything).Return(nil)
+	api := API{ms: ms, fdb: fdb}
+
+	for _, c := range []struct {
+		body   string
+		fields []string
+	}{
+		{`{"message": " ", "category": "complaint"}`, []string{"message", "category"}},
+		{`{"message": "Bus was late", "email": "rider@rpi.edu"}`, []string{"contact_consent"}},
+		{`{"message": "Bus was late", "email": "not an email", "contact_consent": true}`, []string{"email"}},
+		{`{"message": "Bus was late", "route_id": 1, "vehicle_id": 9}`, []string{"vehicle_id"}},
+	} {
+		req := httptest.NewRequest("POST", "/forms", strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+		api.FeedbackCreateHandler(w, req)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got status code %d, expected 422", c.body, w.Code)
+			continue
+		}
+		for _, field := range c.fields {
+			if !strings.Contains(w.Body.String(), field+" ") {
+				t.Errorf("%s: got %q, expected %s to fail validation", c.body, w.Body.String(), field)
+			}
+		}
+	}
+	fdb.AssertNotCalled(t, "CreateForm", mock.Anything)
+
+	// Bots that fill in the honeypot are told that it worked.
+	req := httptest.NewRequest("POST", "/forms", strings.NewReader(`{"message": "Cheap watches", "website": "http://example.com"}`))
+	w := httptest.NewRecorder()
+	api.FeedbackCreateHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("got status code %d, expected 200", w.Code)
+	}
+	fdb.AssertNotCalled(t, "CreateForm", mock.Anything)
+
+	body := `{"message": "Bus was late", "category": "late_shuttle", "route_id": 1, "email": "rider@rpi.edu",` +
+		` "contact_consent": true, "status": "resolved", "notes": "nothing to see here"}`
+	req = httptest.NewRequest("POST", "/forms", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	api.FeedbackCreateHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	form := fdb.Calls[0].Arguments.Get(0).(*shuttletracker.Form)
+	if form.Category != shuttletracker.FeedbackCategoryLateShuttle || form.RouteID == nil || *form.RouteID != 1 ||
+		form.Email != "rider@rpi.edu" || form.Status != shuttletracker.FeedbackStatusNew || form.Notes != "" {
+		t.Errorf("unexpected form %+v", form)
+	}
+}
+
+func TestFeedbackCreateHandlerAdmin(t *testing.T) {
+	fdb := &stmock.FeedbackService{}
+	fdb.On("CreateForm", mock.Anything).Return(nil)
+	api := API{ms: &stmock.ModelService{}, fdb: fdb}
+
+	// Riders can't skip validation or replace the prompt by claiming to be an admin.
+	req := httptest.NewRequest("POST", "/forms", strings.NewReader(`{"message": "", "admin": true}`))
+	w := httptest.NewRecorder()
+	api.FeedbackCreateHandler(w, req)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "message ") {
+		t.Errorf("got status code %d and %q, expected 422 for the message", w.Code, w.Body.String())
+	}
+	fdb.AssertNotCalled(t, "CreateForm", mock.Anything)
+
+	req = httptest.NewRequest("POST", "/forms", strings.NewReader(`{"message": "Free shuttles!", "admin": true}`))
+	w = httptest.NewRecorder()
+	api.FeedbackCreateHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	form := fdb.Calls[0].Arguments.Get(0).(*shuttletracker.Form)
+	if form.Admin {
+		t.Errorf("got form %+v, expected feedback instead of a prompt", form)
+	}
+}
+
+func TestFeedbackPromptHandler(t *testing.T) {
+	fdb := &stmock.FeedbackService{}
+	fdb.On("GetAdminForm").Return(&shuttletracker.Form{ID: 1, Message: "How are we doing?", Admin: true})
+	fdb.On("CreateForm", mock.Anything).Return(nil)
+	api := API{fdb: fdb}
+
+	req := httptest.NewRequest("PUT", "/forms/prompt", strings.NewReader(`{"message": "`+strings.Repeat("a", maxFeedbackLength+1)+`"}`))
+	w := httptest.NewRecorder()
+	api.FeedbackPromptHandler(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status code %d, expected 422", w.Code)
+	}
+	fdb.AssertNotCalled(t, "CreateForm", mock.Anything)
+
+	req = httptest.NewRequest("PUT", "/forms/prompt", strings.NewReader(`{"message": "Was your shuttle on time?"}`))
+	w = httptest.NewRecorder()
+	api.FeedbackPromptHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	form := fdb.Calls[len(fdb.Calls)-1].Arguments.Get(0).(*shuttletracker.Form)
+	if !form.Admin || form.Message != "Was your shuttle on time?" {
+		t.Errorf("got form %+v, expected the new prompt", form)
+	}
+}
+
+func TestFeedbackEditHandler(t *testing.T) {
+	fdb := &stmock.FeedbackService{}
+	fdb.On("GetForm", int64(4)).Return(&shuttletracker.Form{ID: 4, Message: "Bus was late", Category: shuttletracker.FeedbackCategoryOther, Status: shuttletracker.FeedbackStatusNew}, nil)
+	fdb.On("EditForm", mock.Anything).Return(nil)
+	api := API{fdb: fdb}
+
+	req := httptest.NewRequest("PATCH", "/forms?id=4", strings.NewReader(`{"status": "closed"}`))
+	w := httptest.NewRecorder()
+	api.FeedbackEditHandler(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status code %d, expected 422", w.Code)
+	}
+	fdb.AssertNotCalled(t, "EditForm", mock.Anything)
+
+	req = httptest.NewRequest("PATCH", "/forms?id=4", strings.NewReader(`{"message": "Bus was early", "status": "acknowledged", "notes": "Asked dispatch"}`))
+	w = httptest.NewRecorder()
+	api.FeedbackEditHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	form := shuttletracker.Form{}
+	err := json.NewDecoder(w.Body).Decode(&form)
+	if err != nil {
+		t.Fatalf("unable to decode form: %s", err)
+	}
+	if form.Message != "Bus was late" || form.Status != shuttletracker.FeedbackStatusAcknowledged ||
+		form.Notes != "Asked dispatch" || form.Category != shuttletracker.FeedbackCategoryOther {
+		t.Errorf("unexpected form %+v", form)
+	}
+}
+
+func TestFeedbackHandlerCSV(t *testing.T) {
+	routeID := int64(2)
+	fdb := &stmock.FeedbackService{}
+	filter := shuttletracker.FormFilter{Query: "late", Status: shuttletracker.FeedbackStatusNew, RouteID: 2}
+	fdb.On("SearchForms", filter).Return([]*shuttletracker.Form{
+		{ID: 7, Message: "=HYPERLINK(\"http://example.com\")", Category: shuttletracker.FeedbackCategoryLateShuttle, RouteID: &routeID, Status: shuttletracker.FeedbackStatusNew},
+	}, nil)
+	api := API{fdb: fdb}
+
+	req := httptest.NewRequest("GET", "/forms?q=late&status=new&route_id=2&format=csv", nil)
+	w := httptest.NewRecorder()
+	api.FeedbackHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to read CSV: %s", err)
+	}
+	if len(records) != 2 || records[1][0] != "7" || records[1][5] != "2" || records[1][8] != `'=HYPERLINK("http://example.com")` {
+		t.Errorf("unexpected CSV %v", records)
+	}
+
+	req = httptest.NewRequest("GET", "/forms?category=complaint", nil)
+	w = httptest.NewRecorder()
+	api.FeedbackHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status code %d, expected 400", w.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -66,9 +67,19 @@ type fusionBusButton struct {
 
 type fusionClient struct {
 	id              string
-	conn            *websocket.Conn
+	transport       fusionTransport
 	lastMessageTime time.Time
 	userAgent       string
+	ip              string
+
+	// Clients that can't send messages, like those using Server-Sent Events, pick
+	// their topics when they connect. They can resume after the last event they got.
+	topics      []string
+	lastEventID string
+
+	// Message types the client said it handles in its hello, or nil if it didn't say.
+	// Only fm.run reads or modifies this.
+	accepts map[string]bool
 }
 
 type clientMessage struct {
@@ -82,6 +93,11 @@ type serverMessage struct {
 	msg      interface{}
 }
 
+type tracksRequest struct {
+	since time.Time
+	reply chan map[string][]fusionPosition
+}
+
 type fusionManagerDebug struct {
 	// subscriptions    []sub
 	clients        []fusionClient
@@ -101,6 +117,21 @@ type fusionManager struct {
 	// state behind a mutex to inspect it. No locks around maps or slices required.
 	debug chan chan *fusionManagerDebug
 
+	// positionFuser asks for copies of recent rider tracks through this.
+	tracksReq chan tracksRequest
+
+	// watchRoutes sends active routes through this to validate bus button presses.
+	routesUpdate chan []*shuttletracker.Route
+
+	// watchAlerts sends active alerts through this, and refreshAlerts asks it to
+	// check for changes through alertsChanged.
+	alertsUpdate  chan []*shuttletracker.Alert
+	alertsChanged chan struct{}
+
+	// proxies decide which address clients are connecting from. It's set before any
+	// clients connect.
+	proxies trustedProxies
+
 	// Everything after this is considered internal state. Only fm.run will read
 	// or modify these fields, and it is considered the owner of this state.
 
@@ -113,28 +144,62 @@ type fusionManager struct {
 	tracks         map[string][]fusionPosition
 	busButtonCount uint64
 
-	em shuttletracker.ETAService
-	ms shuttletracker.ModelService
+	// Messages sent to topics are numbered and the most recent are kept so that
+	// clients can resume where they left off.
+	lastEventSeq uint64
+	replay       []fusionEvent
+
+	activeRoutes           []*shuttletracker.Route
+	busButtonClientBuckets *tokenBuckets
+	busButtonIPBuckets     *tokenBuckets
+	busButtonPresses       map[busButtonArea]int
+	activeAlerts           []*shuttletracker.Alert
+
+	em       shuttletracker.ETAService
+	ms       shuttletracker.ModelService
+	bbs      shuttletracker.BusButtonService
+	recorder *trackRecorder
 
 	// an ID for Fusion clients to tell if they get reconnected to the same server or not
 	id string
 }
 
-func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.ModelService) (*fusionManager, error) {
+func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.ModelService, msg shuttletracker.MessageService, ts shuttletracker.TrackService, bbs shuttletracker.BusButtonService, trackTTL time.Duration, privacyRadius float64) (*fusionManager, error) {
 	fm := &fusionManager{
 		addClient:          make(chan *fusionClient),
 		removeClient:       make(chan string),
 		clientMsg:          make(chan clientMessage),
 		serverMsg:          make(chan serverMessage, 100), // buffer needs to be at least as large as the number of messages that will be sent in any given loop through fusionManager's run() method
 		debug:              make(chan chan *fusionManagerDebug),
+		tracksReq:          make(chan tracksRequest),
+		routesUpdate:       make(chan []*shuttletracker.Route),
+		alertsUpdate:       make(chan []*shuttletracker.Alert),
+		alertsChanged:      make(chan struct{}, 1),
 		clients:            map[string]*fusionClient{},
 		tracks:             map[string][]fusionPosition{},
 		subscriptions:      map[string][]string{},
 		subscribeCallbacks: map[string][]func(string){},
-		em:                 etaManager,
-		ms:                 ms,
+
+		busButtonClientBuckets: newTokenBuckets(busButtonClientBurst, busButtonClientRate),
+		busButtonIPBuckets:     newTokenBuckets(busButtonIPBurst, busButtonIPRate),
+		busButtonPresses:       map[busButtonArea]int{},
+
+		em:       etaManager,
+		ms:       ms,
+		bbs:      bbs,
+		recorder: newTrackRecorder(ts, trackTTL, privacyRadius),
 	}
 
+	// pick up recent tracks from before a restart
+	positions, err := ts.TrackPositionsSince(time.Now().Add(-fusionWindow))
+	if err != nil {
+		log.WithError(err).Error("unable to load recent tracks")
+	}
+	for _, p := range positions {
+		fm.tracks[p.Track] = append(fm.tracks[p.Track], fusionPositionFromTrack(p))
+	}
+	fm.recorder.preload(positions)
+
 	// get notified of new ETAs to push out to the ETA topic
 	etaManager.Subscribe(fm.handleETA)
 
@@ -146,6 +211,7 @@ func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.Mo
 	// ETAManager in the future).
 	fm.subscribeCallbacks["eta"] = []func(string){fm.handleETASubscribe}
 	fm.subscribeCallbacks["vehicle_location"] = []func(string){fm.handleVehicleLocationSubscribe}
+	fm.subscribeCallbacks["alerts"] = []func(string){fm.handleAlertsSubscribe}
 
 	// generate a server UUID
 	u, err := uuid.NewV1()
@@ -155,6 +221,13 @@ func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.Mo
 	fm.id = u.String()
 
 	go fm.run()
+	go fm.recorder.run()
+	go fm.watchRoutes()
+	go fm.watchAlerts(msg)
+
+	// associate rider tracks with vehicles and fill in when iTRAK goes quiet
+	go newPositionFuser(ms, fm.recentTracks).run()
+
 	return fm, nil
 }
 
@@ -162,6 +235,8 @@ func newFusionManager(etaManager shuttletracker.ETAService, ms shuttletracker.Mo
 // Responsible (along with any methods it calls) for managing fusionManager state.
 // Anything run calls should obtain the lock on fusionManager state.
 func (fm *fusionManager) run() {
+	pruneTicker := time.NewTicker(fusionInterval)
+	busButtonTicker := time.NewTicker(busButtonInterval)
 	for {
 		// first see if we have any messages to push out
 		select {
@@ -183,6 +258,18 @@ func (fm *fusionManager) run() {
 			fm.processServerMessage(sm)
 		case debugChan := <-fm.debug:
 			fm.processDebug(debugChan)
+		case req := <-fm.tracksReq:
+			fm.processTracksRequest(req)
+		case now := <-pruneTicker.C:
+			fm.pruneTracks(now)
+		case now := <-busButtonTicker.C:
+			fm.flushBusButtonPresses(now)
+			fm.busButtonClientBuckets.prune(now)
+			fm.busButtonIPBuckets.prune(now)
+		case routes := <-fm.routesUpdate:
+			fm.activeRoutes = routes
+		case alerts := <-fm.alertsUpdate:
+			fm.processAlerts(alerts)
 		}
 	}
 }
@@ -269,13 +356,25 @@ func decodeFusionMessage(r io.Reader) (string, json.RawMessage, error) {
 func (fm *fusionManager) processAddClient(client *fusionClient) {
 	fm.clients[client.id] = client
 
+	// send this right away so that it arrives before anything replayed below
 	fme := fusionMessageEnvelope{
 		Type:    "server_id",
 		Message: fm.id,
 	}
-	fm.sendToClient(client.id, fme)
+	fm.processServerMessage(serverMessage{clientID: client.id, msg: fme})
 
-	go fm.handleClient(client)
+	// If the client is resuming and we still have everything it missed, replay that
+	// instead of sending snapshots.
+	if fm.canReplay(client.lastEventID) {
+		for _, topic := range client.topics {
+			fm.subscribe(client.id, topic)
+		}
+		fm.replayEvents(client)
+		return
+	}
+	for _, topic := range client.topics {
+		fm.handleMsgSubscribe(client.id, fusionMessageSubscribe{Topic: topic})
+	}
 }
 
 func (fm *fusionManager) processRemoveClient(clientID string) {
@@ -302,6 +401,9 @@ func (fm *fusionManager) processRemoveClient(clientID string) {
 // the state inside of fusionManager.
 func (fm *fusionManager) processMessage(cm clientMessage) {
 	switch t := cm.msg.(type) {
+	case fusionMessageHello:
+		fmh := cm.msg.(fusionMessageHello)
+		fm.handleMsgHello(cm.clientID, fmh)
 	case fusionMessageSubscribe:
 		fms := cm.msg.(fusionMessageSubscribe)
 		fm.handleMsgSubscribe(cm.clientID, fms)
@@ -313,12 +415,7 @@ func (fm *fusionManager) processMessage(cm clientMessage) {
 		fm.handleMsgPosition(fp)
 	case fusionBusButton:
 		fbb := cm.msg.(fusionBusButton)
-		for _, emoji := range validBusButtonEmoji {
-				if emoji == fbb.Emoji {
-						fm.handleMsgBusButton(fbb)
-						return
-				}
-		}
+		fm.handleMsgBusButton(cm.clientID, fbb, time.Now())
 	default:
 		// This is an error since it means that an unhandled message type was sent to
 		// the channel, probably by handleClient. This shouldn't happen, so please fix
@@ -328,7 +425,8 @@ func (fm *fusionManager) processMessage(cm clientMessage) {
 }
 
 // Send a message from the server to either all clients subscribed to a topic or
-// only a specific client by its ID.
+// only a specific client by its ID. Messages to topics are given event IDs and kept
+// for replaying.
 func (fm *fusionManager) processServerMessage(sm serverMessage) {
 	b, err := json.Marshal(sm.msg)
 	if err != nil {
@@ -337,6 +435,7 @@ func (fm *fusionManager) processServerMessage(sm serverMessage) {
 	}
 
 	if len(sm.topic) > 0 {
+		event := fm.newEvent(sm.topic, b)
 		// find clients subscribed to topic
 		for _, clientID := range fm.subscriptions[sm.topic] {
 			client, ok := fm.clients[clientID]
@@ -344,7 +443,10 @@ func (fm *fusionManager) processServerMessage(sm serverMessage) {
 				log.Error("client not found")
 				continue
 			}
-			err = client.conn.WriteMessage(websocket.TextMessage, b)
+			if !client.acceptsMessage(sm.msg) {
+				continue
+			}
+			err = client.transport.send(event)
 			if err != nil {
 				log.WithError(err).Error("unable to write")
 				continue
@@ -356,7 +458,10 @@ func (fm *fusionManager) processServerMessage(sm serverMessage) {
 			log.Error("client not found")
 			return
 		}
-		err = client.conn.WriteMessage(websocket.TextMessage, b)
+		if !client.acceptsMessage(sm.msg) {
+			return
+		}
+		err = client.transport.send(fusionEvent{data: b})
 		if err != nil {
 			log.WithError(err).Error("unable to write")
 			return
@@ -366,9 +471,11 @@ func (fm *fusionManager) processServerMessage(sm serverMessage) {
 	}
 }
 
-func (fm *fusionManager) handleMsgSubscribe(clientID string, fms fusionMessageSubscribe) {
+// subscribe adds a client to a topic's subscribers. It returns false if the client
+// was already subscribed.
+func (fm *fusionManager) subscribe(clientID string, topic string) bool {
 	// grab the list of existing subscriptions
-	subs := fm.subscriptions[fms.Topic]
+	subs := fm.subscriptions[topic]
 	if subs == nil {
 		// this is the first subscriber, so the list doesn't exist
 		subs = []string{}
@@ -377,12 +484,23 @@ func (fm *fusionManager) handleMsgSubscribe(clientID string, fms fusionMessageSu
 	// if client is already subscribed, do nothing
 	for _, subbedClient := range subs {
 		if subbedClient == clientID {
-			return
+			return false
 		}
 	}
 
 	subs = append(subs, clientID)
-	fm.subscriptions[fms.Topic] = subs
+	fm.subscriptions[topic] = subs
+	return true
+}
+
+func (fm *fusionManager) handleMsgSubscribe(clientID string, fms fusionMessageSubscribe) {
+	if !containsString(fusionTopics[:], fms.Topic) {
+		fm.replyError(clientID, fusionErrorEnvelope(fusionErrorUnknownTopic, "subscribe", "unknown topic \"%s\"", fms.Topic))
+		return
+	}
+	if !fm.subscribe(clientID, fms.Topic) {
+		return
+	}
 
 	// If this topic has a subscription callback, hit it.
 	// Future optimization: this should probably hit all callbacks concurrently.
@@ -408,30 +526,38 @@ func (fm *fusionManager) handleMsgUnsubscribe(clientID string, fmu fusionMessage
 	log.Warnf("client requested unsubscribe from topic it's not subscribed to")
 }
 
+// handleMsgPosition adds a position to its track. Positions whose track isn't a
+// UUID like the ones clients generate are dropped.
 func (fm *fusionManager) handleMsgPosition(fp fusionPosition) {
-	fp.Time = time.Now()
-	fm.tracks[fp.Track] = append(fm.tracks[fp.Track], fp)
-}
-
-func (fm *fusionManager) handleMsgBusButton(fbb fusionBusButton) {
-	fm.busButtonCount++
-	fme := fusionMessageEnvelope{
-		Type:    "bus_button",
-		Message: fbb,
-	}
-	b, err := json.Marshal(fme)
-	if err != nil {
-		log.WithError(err).Error("unable to marshal")
+	if !validTrackID(fp.Track) {
+		log.Debugf("dropping position with invalid track ID %q", fp.Track)
 		return
 	}
-
-	// find clients subscribed to topic
-	for _, clientID := range fm.subscriptions["bus_button"] {
-		client := fm.clients[clientID]
-		err = client.conn.WriteMessage(websocket.TextMessage, b)
-		if err != nil {
-			log.WithError(err).Error("unable to write")
+	fp.Time = time.Now()
+	fm.tracks[fp.Track] = append(fm.tracks[fp.Track], fp)
+	fm.recorder.record(fp)
+}
+
+// validTrackID returns whether a track ID is a UUID in canonical form, which is
+// what the track_positions table expects.
+func validTrackID(track string) bool {
+	u, err := uuid.FromString(track)
+	return err == nil && u.String() == track
+}
+
+// pruneTracks forgets positions that are too old to be associated with a vehicle.
+// Older positions are only kept by trackRecorder.
+func (fm *fusionManager) pruneTracks(now time.Time) {
+	since := now.Add(-fusionWindow)
+	for trackID, positions := range fm.tracks {
+		i := sort.Search(len(positions), func(i int) bool {
+			return positions[i].Time.After(since)
+		})
+		if i == len(positions) {
+			delete(fm.tracks, trackID)
+			continue
 		}
+		fm.tracks[trackID] = append([]fusionPosition{}, positions[i:]...)
 	}
 }
 
@@ -439,9 +565,9 @@ func (fm *fusionManager) handleMsgBusButton(fbb fusionBusButton) {
 // It does not directly manipulate fusionManager state—this is done by sending messages
 // through a chan that is read elsewhere. We do as much JSON parsing here as possible
 // since each connection is handled concurrently.
-func (fm *fusionManager) handleClient(client *fusionClient) {
+func (fm *fusionManager) handleClient(client *fusionClient, conn *websocket.Conn) {
 	for {
-		_, r, err := client.conn.NextReader()
+		_, r, err := conn.NextReader()
 		if err != nil {
 			// did the client e.g. close the tab? then we expect a normal error
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
@@ -453,10 +579,19 @@ func (fm *fusionManager) handleClient(client *fusionClient) {
 		messageType, message, err := decodeFusionMessage(r)
 		if err != nil {
 			log.WithError(err).Error("unable to decode message")
+			fm.sendToClient(client.id, fusionErrorEnvelope(fusionErrorDecode, "", "unable to decode message: %s", err))
 			continue
 		}
 
 		switch messageType {
+		case "hello":
+			fmh := fusionMessageHello{}
+			err = json.Unmarshal(message, &fmh)
+			if err != nil {
+				log.WithError(err).Error("unable to decode fusionMessageHello")
+				break
+			}
+			fm.clientMsg <- clientMessage{client.id, fmh}
 		case "subscribe":
 			fms := fusionMessageSubscribe{}
 			err = json.Unmarshal(message, &fms)
@@ -493,7 +628,13 @@ func (fm *fusionManager) handleClient(client *fusionClient) {
 		default:
 			// This is just a warning and not an error since messageType comes straight
 			// from the client. We can't trust it.
-			log.WithError(err).Warnf("unknown message type \"%s\"", messageType)
+			log.Warnf("unknown message type \"%s\"", messageType)
+			fm.sendToClient(client.id, fusionErrorEnvelope(fusionErrorUnknownType, messageType, "unknown message type \"%s\"", messageType))
+			continue
+		}
+
+		if err != nil {
+			fm.sendToClient(client.id, fusionErrorEnvelope(fusionErrorDecode, messageType, "unable to decode %s message: %s", messageType, err))
 		}
 	}
 
@@ -511,7 +652,7 @@ func (fm *fusionManager) processDebug(ch chan *fusionManagerDebug) {
 
 	for _, v := range fm.clients {
 		newClient := fusionClient{
-			// don't copy the websocket conn
+			// don't copy the transport
 			id:              v.id,
 			lastMessageTime: v.lastMessageTime,
 			userAgent:       v.userAgent,
@@ -529,6 +670,35 @@ func (fm *fusionManager) processDebug(ch chan *fusionManagerDebug) {
 	ch <- debug
 }
 
+// processTracksRequest copies the positions of each track received since the
+// requested time. Tracks without any recent positions are left out.
+func (fm *fusionManager) processTracksRequest(req tracksRequest) {
+	tracks := map[string][]fusionPosition{}
+	for trackID, positions := range fm.tracks {
+		// positions are appended as they arrive, so they're sorted by time
+		i := sort.Search(len(positions), func(i int) bool {
+			return positions[i].Time.After(req.since)
+		})
+		if i == len(positions) {
+			continue
+		}
+		recent := make([]fusionPosition, len(positions)-i)
+		copy(recent, positions[i:])
+		tracks[trackID] = recent
+	}
+	req.reply <- tracks
+}
+
+// recentTracks returns a copy of every track's positions received since a time.
+func (fm *fusionManager) recentTracks(since time.Time) map[string][]fusionPosition {
+	req := tracksRequest{
+		since: since,
+		reply: make(chan map[string][]fusionPosition),
+	}
+	fm.tracksReq <- req
+	return <-req.reply
+}
+
 func (fm *fusionManager) debugInfo() *fusionManagerDebug {
 	copyChan := make(chan *fusionManagerDebug)
 	fm.debug <- copyChan
@@ -585,18 +755,6 @@ func (fm *fusionManager) debugHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (fm *fusionManager) exportHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	enc := json.NewEncoder(w)
-	fmDebug := fm.debugInfo()
-	err := enc.Encode(fmDebug.tracks)
-	if err != nil {
-		log.WithError(err).Error("unable to encode")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-}
-
 func (fm *fusionManager) webSocketHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -614,16 +772,24 @@ func (fm *fusionManager) webSocketHandler(w http.ResponseWriter, r *http.Request
 
 	c := &fusionClient{
 		id:              u1.String(),
-		conn:            conn,
+		transport:       webSocketTransport{conn},
 		lastMessageTime: time.Now(),
 		userAgent:       r.UserAgent(),
+		ip:              fm.proxies.clientIP(r),
 	}
 	fm.addClient <- c
+	go fm.handleClient(c, conn)
 }
-func (fm *fusionManager) router(auth func(http.Handler) http.Handler) http.Handler {
+func (fm *fusionManager) router(auth func(http.Handler) http.Handler, rawExportAuth func(http.Handler) http.Handler) http.Handler {
 	r := chi.NewRouter()
 	r.HandleFunc("/", fm.webSocketHandler)
-	r.With(auth).Get("/debug", fm.debugHandler)
-	r.With(auth).Get("/export", fm.exportHandler)
+	r.Get("/events", fm.eventsHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(etag)
+		r.With(auth).Get("/debug", fm.debugHandler)
+		r.With(auth).Get("/export", fm.exportHandler)
+		r.With(auth).Get("/bus_button", fm.busButtonHandler)
+		r.With(rawExportAuth).Get("/export/raw", fm.rawExportHandler)
+	})
 	return r
 }
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Alerts start and end on their own, so they're checked this often. Changes made
+// through the API are pushed out right away.
+const alertsInterval = 30 * time.Second
+
+// watchAlerts sends the active alerts to fm.run every alertsInterval and whenever
+// refreshAlerts is called.
+func (fm *fusionManager) watchAlerts(msg shuttletracker.MessageService) {
+	ticker := time.NewTicker(alertsInterval)
+	for {
+		alerts, err := msg.Alerts()
+		if err != nil {
+			log.WithError(err).Error("unable to get alerts")
+		} else {
+			fm.alertsUpdate <- shuttletracker.ActiveAlerts(alerts, time.Now())
+		}
+		select {
+		case <-ticker.C:
+		case <-fm.alertsChanged:
+		}
+	}
+}
+
+// refreshAlerts asks watchAlerts to check for changes now.
+func (fm *fusionManager) refreshAlerts() {
+	select {
+	case fm.alertsChanged <- struct{}{}:
+	default:
+		// a check is already pending
+	}
+}
+
+// processAlerts pushes out the active alerts to the alerts topic if they've changed.
+// It must only be called from fm.run.
+func (fm *fusionManager) processAlerts(alerts []*shuttletracker.Alert) {
+	if sameAlerts(fm.activeAlerts, alerts) {
+		return
+	}
+	fm.activeAlerts = alerts
+	fm.processServerMessage(serverMessage{topic: "alerts", msg: alertsEnvelope(alerts)})
+}
+
+// immediately push out the active alerts to newly-subscribed clients
+func (fm *fusionManager) handleAlertsSubscribe(clientID string) {
+	fm.processServerMessage(serverMessage{clientID: clientID, msg: alertsEnvelope(fm.activeAlerts)})
+}
+
+// alertsEnvelope has every active alert so that clients can replace what they have.
+func alertsEnvelope(alerts []*shuttletracker.Alert) fusionMessageEnvelope {
+	if alerts == nil {
+		alerts = []*shuttletracker.Alert{}
+	}
+	return fusionMessageEnvelope{
+		Type:    "alerts",
+		Message: alerts,
+	}
+}
+
+// sameAlerts returns whether two lists of alerts have the same versions of the same
+// alerts in the same order.
+func sameAlerts(a, b []*shuttletracker.Alert) bool {
+	if a == nil || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || !a[i].Updated.Equal(b[i].Updated) {
+			return false
+		}
+	}
+	return true
+}
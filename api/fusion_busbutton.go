@@ -0,0 +1,182 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// presses are collected and broadcast this often
+	busButtonInterval = 2 * time.Second
+
+	// size in degrees of the areas that presses are counted in
+	busButtonAreaSize = 0.001
+
+	// presses farther than this many meters from every active route are ignored
+	busButtonMaxRouteDistance = 100
+
+	// each client can press in bursts of busButtonClientBurst, then once every two seconds
+	busButtonClientBurst = 5
+	busButtonClientRate  = 0.5
+
+	// many clients can share an IP address on campus, so this is more generous
+	busButtonIPBurst = 30
+	busButtonIPRate  = 5
+
+	// active routes are reloaded this often to validate presses against
+	busButtonRoutesInterval = time.Minute
+)
+
+// fusionBusButtonPresses is broadcast to bus_button subscribers. It has the same fields
+// as fusionBusButton so that clients can treat it like a single press.
+type fusionBusButtonPresses struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Emoji     string  `json:"emojiChoice"`
+	Count     int     `json:"count"`
+}
+
+type busButtonArea struct {
+	lat   int64
+	lon   int64
+	emoji string
+}
+
+func validBusButton(fbb fusionBusButton) bool {
+	for _, emoji := range validBusButtonEmoji {
+		if emoji == fbb.Emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// nearActiveRoute returns whether a point is close to any enabled and active route.
+func nearActiveRoute(p shuttletracker.Point, routes []*shuttletracker.Route) bool {
+	for _, route := range routes {
+		if geo.DistanceToPath(p, route.Points) <= busButtonMaxRouteDistance {
+			return true
+		}
+	}
+	return false
+}
+
+// handleMsgBusButton counts a press if the client isn't pressing too often and is
+// near a route. Presses are broadcast later by flushBusButtonPresses.
+func (fm *fusionManager) handleMsgBusButton(clientID string, fbb fusionBusButton, now time.Time) {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return
+	}
+
+	if !validBusButton(fbb) {
+		fm.replyError(clientID, fusionErrorEnvelope(fusionErrorInvalidEmoji, "bus_button", "invalid emoji \"%s\"", fbb.Emoji))
+		return
+	}
+
+	if !fm.busButtonClientBuckets.take(clientID, now) || !fm.busButtonIPBuckets.take(client.ip, now) {
+		log.Debugf("rate limiting bus button from %s", client.ip)
+		fm.replyError(clientID, fusionErrorEnvelope(fusionErrorRateLimited, "bus_button", "too many bus button presses"))
+		return
+	}
+
+	p := shuttletracker.Point{Latitude: fbb.Latitude, Longitude: fbb.Longitude}
+	if !nearActiveRoute(p, fm.activeRoutes) {
+		fm.replyError(clientID, fusionErrorEnvelope(fusionErrorOutOfRange, "bus_button", "bus button presses must be near an active route"))
+		return
+	}
+
+	fm.busButtonCount++
+	area := busButtonArea{
+		lat:   int64(math.Floor(fbb.Latitude / busButtonAreaSize)),
+		lon:   int64(math.Floor(fbb.Longitude / busButtonAreaSize)),
+		emoji: fbb.Emoji,
+	}
+	fm.busButtonPresses[area]++
+}
+
+// flushBusButtonPresses broadcasts the presses counted since the last flush, one
+// message per emoji per area, and saves them to the daily counts.
+func (fm *fusionManager) flushBusButtonPresses(now time.Time) {
+	if len(fm.busButtonPresses) == 0 {
+		return
+	}
+
+	emojiCounts := map[string]int{}
+	for area, count := range fm.busButtonPresses {
+		emojiCounts[area.emoji] += count
+		fme := fusionMessageEnvelope{
+			Type: "bus_button",
+			Message: fusionBusButtonPresses{
+				Latitude:  (float64(area.lat) + 0.5) * busButtonAreaSize,
+				Longitude: (float64(area.lon) + 0.5) * busButtonAreaSize,
+				Emoji:     area.emoji,
+				Count:     count,
+			},
+		}
+		fm.processServerMessage(serverMessage{topic: "bus_button", msg: fme})
+	}
+	fm.busButtonPresses = map[busButtonArea]int{}
+
+	go fm.saveBusButtonPresses(now, emojiCounts)
+}
+
+func (fm *fusionManager) saveBusButtonPresses(day time.Time, emojiCounts map[string]int) {
+	for emoji, count := range emojiCounts {
+		err := fm.bbs.AddBusButtonPresses(day, emoji, count)
+		if err != nil {
+			log.WithError(err).Error("unable to save bus button presses")
+		}
+	}
+}
+
+// watchRoutes sends the enabled and active routes to fm.run periodically.
+func (fm *fusionManager) watchRoutes() {
+	ticker := time.NewTicker(busButtonRoutesInterval)
+	for {
+		routes, err := fm.ms.Routes()
+		if err != nil {
+			log.WithError(err).Error("unable to get routes")
+		} else {
+			active := []*shuttletracker.Route{}
+			for _, route := range routes {
+				if route.Enabled && route.Active {
+					active = append(active, route)
+				}
+			}
+			fm.routesUpdate <- active
+		}
+		<-ticker.C
+	}
+}
+
+// busButtonHandler writes daily bus button press counts for the number of days in
+// the "days" query parameter, or the last 30 days.
+func (fm *fusionManager) busButtonHandler(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if s := r.URL.Query().Get("days"); s != "" {
+		var err error
+		days, err = strconv.Atoi(s)
+		if err != nil || days < 1 {
+			http.Error(w, "days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	counts, err := fm.bbs.BusButtonCounts(time.Now().AddDate(0, 0, 1-days))
+	if err != nil {
+		log.WithError(err).Error("unable to get bus button counts")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = WriteJSON(w, counts)
+	if err != nil {
+		log.WithError(err).Error("unable to write JSON")
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+// testTransport keeps the events sent to a client.
+type testTransport struct {
+	events []fusionEvent
+}
+
+func (t *testTransport) send(event fusionEvent) error {
+	t.events = append(t.events, event)
+	return nil
+}
+
+func newBusButtonTestManager(bbs shuttletracker.BusButtonService) *fusionManager {
+	return &fusionManager{
+		clients:                map[string]*fusionClient{},
+		subscriptions:          map[string][]string{},
+		busButtonClientBuckets: newTokenBuckets(busButtonClientBurst, busButtonClientRate),
+		busButtonIPBuckets:     newTokenBuckets(busButtonIPBurst, busButtonIPRate),
+		busButtonPresses:       map[busButtonArea]int{},
+		activeRoutes: []*shuttletracker.Route{
+			{
+				Enabled: true,
+				Active:  true,
+				Points: []shuttletracker.Point{
+					{Latitude: 42.73, Longitude: -73.69},
+					{Latitude: 42.73, Longitude: -73.68},
+				},
+			},
+		},
+		bbs: bbs,
+	}
+}
+
+func TestBusButtonValidation(t *testing.T) {
+	fm := newBusButtonTestManager(&mock.BusButtonService{})
+	fm.clients["client"] = &fusionClient{id: "client", ip: "192.0.2.1", transport: &testTransport{}}
+	now := time.Now()
+
+	fm.handleMsgBusButton("client", fusionBusButton{Latitude: 42.73, Longitude: -73.685, Emoji: "🐢"}, now)
+	fm.handleMsgBusButton("client", fusionBusButton{Latitude: 42.75, Longitude: -73.685, Emoji: "🚌"}, now)
+	fm.handleMsgBusButton("unknown", fusionBusButton{Latitude: 42.73, Longitude: -73.685, Emoji: "🚌"}, now)
+	if fm.busButtonCount != 0 {
+		t.Errorf("counted %d invalid presses", fm.busButtonCount)
+	}
+
+	fm.handleMsgBusButton("client", fusionBusButton{Latitude: 42.7301, Longitude: -73.685, Emoji: "🚌"}, now)
+	if fm.busButtonCount != 1 {
+		t.Errorf("press near a route wasn't counted")
+	}
+}
+
+func TestBusButtonRateLimit(t *testing.T) {
+	fm := newBusButtonTestManager(&mock.BusButtonService{})
+	now := time.Now()
+	press := fusionBusButton{Latitude: 42.73, Longitude: -73.685, Emoji: "🚌"}
+
+	fm.clients["client"] = &fusionClient{id: "client", ip: "192.0.2.1", transport: &testTransport{}}
+	for i := 0; i < busButtonClientBurst*2; i++ {
+		fm.handleMsgBusButton("client", press, now)
+	}
+	if fm.busButtonCount != busButtonClientBurst {
+		t.Errorf("got %d presses from one client, expected %d", fm.busButtonCount, busButtonClientBurst)
+	}
+
+	// plenty of clients behind one address
+	fm.busButtonCount = 0
+	for i := 0; i < busButtonIPBurst; i++ {
+		id := fmt.Sprintf("shared%d", i)
+		fm.clients[id] = &fusionClient{id: id, ip: "192.0.2.2", transport: &testTransport{}}
+		fm.handleMsgBusButton(id, press, now)
+		fm.handleMsgBusButton(id, press, now)
+	}
+	if fm.busButtonCount != busButtonIPBurst {
+		t.Errorf("got %d presses from one address, expected %d", fm.busButtonCount, busButtonIPBurst)
+	}
+}
+
+func TestFlushBusButtonPresses(t *testing.T) {
+	bbs := &mock.BusButtonService{}
+	saved := make(chan struct{})
+	bbs.On("AddBusButtonPresses", tmock.AnythingOfType("time.Time"), "🚌", 2).Return(nil).Run(func(args tmock.Arguments) {
+		saved <- struct{}{}
+	})
+	fm := newBusButtonTestManager(bbs)
+	fm.clients["client"] = &fusionClient{id: "client", ip: "192.0.2.1", transport: &testTransport{}}
+	now := time.Now()
+
+	// two presses in the same area
+	fm.handleMsgBusButton("client", fusionBusButton{Latitude: 42.73001, Longitude: -73.68501, Emoji: "🚌"}, now)
+	fm.handleMsgBusButton("client", fusionBusButton{Latitude: 42.73002, Longitude: -73.68502, Emoji: "🚌"}, now)
+	if len(fm.busButtonPresses) != 1 {
+		t.Fatalf("got %d areas, expected 1", len(fm.busButtonPresses))
+	}
+	for area, count := range fm.busButtonPresses {
+		if count != 2 {
+			t.Errorf("got %d presses in %+v, expected 2", count, area)
+		}
+	}
+
+	fm.flushBusButtonPresses(now)
+	if len(fm.busButtonPresses) != 0 {
+		t.Errorf("presses weren't cleared after flushing")
+	}
+	select {
+	case <-saved:
+	case <-time.After(time.Second):
+		t.Errorf("presses weren't saved")
+	}
+	bbs.AssertExpectations(t)
+}
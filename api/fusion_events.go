@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/websocket"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// how many recent topic messages are kept for clients that reconnect
+	fusionReplaySize = 500
+
+	// how many messages can be waiting to be written to an SSE client
+	sseBufferSize = 100
+
+	// SSE clients get a comment this often so that proxies don't close idle connections
+	sseKeepAliveInterval = 15 * time.Second
+)
+
+// fusionTopics are the topics that clients can subscribe to.
+var fusionTopics = [...]string{"vehicle_location", "eta", "bus_button", "alerts"}
+
+var errSSEClientBehind = errors.New("SSE client is not keeping up")
+
+// fusionEvent is a marshaled message to a client. Messages sent to topics have an ID
+// so that clients can resume after them.
+type fusionEvent struct {
+	id    string
+	seq   uint64
+	topic string
+	data  []byte
+}
+
+// fusionTransport sends events to a client. fusionManager only calls send from fm.run,
+// so it must not block for long.
+type fusionTransport interface {
+	send(event fusionEvent) error
+}
+
+type webSocketTransport struct {
+	conn *websocket.Conn
+}
+
+func (t webSocketTransport) send(event fusionEvent) error {
+	return t.conn.WriteMessage(websocket.TextMessage, event.data)
+}
+
+// sseTransport hands events to the goroutine serving the client's request.
+type sseTransport struct {
+	events chan fusionEvent
+}
+
+func (t sseTransport) send(event fusionEvent) error {
+	select {
+	case t.events <- event:
+		return nil
+	default:
+		return errSSEClientBehind
+	}
+}
+
+// newEvent numbers a message sent to a topic and keeps it for replaying.
+func (fm *fusionManager) newEvent(topic string, data []byte) fusionEvent {
+	fm.lastEventSeq++
+	event := fusionEvent{
+		id:    fmt.Sprintf("%s:%d", fm.id, fm.lastEventSeq),
+		seq:   fm.lastEventSeq,
+		topic: topic,
+		data:  data,
+	}
+	fm.replay = append(fm.replay, event)
+	if len(fm.replay) > fusionReplaySize {
+		fm.replay = fm.replay[len(fm.replay)-fusionReplaySize:]
+	}
+	return event
+}
+
+// parseEventID returns the sequence number of an event ID if it was given out by this
+// fusionManager.
+func (fm *fusionManager) parseEventID(id string) (uint64, bool) {
+	parts := strings.Split(id, ":")
+	if len(parts) != 2 || parts[0] != fm.id {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil || seq > fm.lastEventSeq {
+		return 0, false
+	}
+	return seq, true
+}
+
+// canReplay returns whether every event after an event ID is still kept.
+func (fm *fusionManager) canReplay(lastEventID string) bool {
+	seq, ok := fm.parseEventID(lastEventID)
+	if !ok {
+		return false
+	}
+	if len(fm.replay) == 0 {
+		return seq == fm.lastEventSeq
+	}
+	return seq+1 >= fm.replay[0].seq
+}
+
+// replayEvents sends a client the events it missed on the topics it's subscribed to.
+func (fm *fusionManager) replayEvents(client *fusionClient) {
+	seq, _ := fm.parseEventID(client.lastEventID)
+	for _, event := range fm.replay {
+		if event.seq <= seq || !containsString(client.topics, event.topic) {
+			continue
+		}
+		err := client.transport.send(event)
+		if err != nil {
+			log.WithError(err).Error("unable to write")
+			return
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// eventsTopics returns the topics in a request's "topics" query parameter, which is a
+// comma-separated list.
+func eventsTopics(r *http.Request) ([]string, error) {
+	topics := []string{}
+	for _, topic := range strings.Split(r.URL.Query().Get("topics"), ",") {
+		topic = strings.TrimSpace(topic)
+		if topic == "" || containsString(topics, topic) {
+			continue
+		}
+		if !containsString(fusionTopics[:], topic) {
+			return nil, fmt.Errorf("unknown topic %q", topic)
+		}
+		topics = append(topics, topic)
+	}
+	if len(topics) == 0 {
+		return nil, errors.New("no topics requested")
+	}
+	return topics, nil
+}
+
+// eventsHandler streams Fusion messages as Server-Sent Events for clients that can't
+// use WebSockets. Topics are picked with the "topics" query parameter, e.g.
+// /fusion/events?topics=vehicle_location,eta. Clients that reconnect with a
+// Last-Event-ID header (or lastEventId query parameter) get the events they missed.
+func (fm *fusionManager) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	topics, err := eventsTopics(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u1, err := uuid.NewV1()
+	if err != nil {
+		log.WithError(err).Error("unable to generate UUID")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// ask nginx not to buffer the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	transport := sseTransport{events: make(chan fusionEvent, sseBufferSize)}
+	c := &fusionClient{
+		id:              u1.String(),
+		transport:       transport,
+		lastMessageTime: time.Now(),
+		userAgent:       r.UserAgent(),
+		ip:              fm.proxies.clientIP(r),
+		topics:          topics,
+		lastEventID:     lastEventID,
+	}
+	fm.addClient <- c
+	defer func() {
+		fm.removeClient <- c.id
+	}()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-transport.events:
+			err = writeSSEEvent(w, event)
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			log.WithError(err).Debug("unable to write event")
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, event fusionEvent) error {
+	if event.id != "" {
+		_, err := fmt.Fprintf(w, "id: %s\n", event.id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", event.data)
+	return err
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+type sseTestEvent struct {
+	id       string
+	envelope struct {
+		Type    string          `json:"type"`
+		Message json.RawMessage `json:"message"`
+	}
+}
+
+// readSSEEvent reads the next event from a stream, skipping comments.
+func readSSEEvent(t *testing.T, r *bufio.Reader) sseTestEvent {
+	event := sseTestEvent{}
+	done := make(chan error)
+	go func() {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				done <- err
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				done <- nil
+				return
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.envelope)
+				if err != nil {
+					done <- err
+					return
+				}
+			}
+		}
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unable to read event: %s", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for event")
+	}
+	return event
+}
+
+func noAuth(next http.Handler) http.Handler {
+	return next
+}
+
+func newEventsTestManager(t *testing.T, locChan chan *shuttletracker.Location) *fusionManager {
+	ms := &mock.ModelService{}
+	em := &mock.ETAService{}
+	ts := &mock.TrackService{}
+	em.On("Subscribe", tmock.AnythingOfType("func(shuttletracker.VehicleETA)")).Return()
+	em.On("CurrentETAs").Return(map[int64]shuttletracker.VehicleETA{})
+	ms.LocationService.On("SubscribeLocations").Return(locChan)
+	ms.LocationService.On("LatestLocations").Return([]*shuttletracker.Location{{ID: 1}}, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{}, nil)
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{}, nil)
+	ts.On("TrackPositionsSince", tmock.AnythingOfType("time.Time")).Return([]*shuttletracker.TrackPosition{}, nil)
+
+	msg := &mock.MessageService{}
+	msg.On("Alerts").Return([]*shuttletracker.Alert{}, nil)
+
+	fm, err := newFusionManager(em, ms, msg, ts, &mock.BusButtonService{}, time.Hour, 200)
+	if err != nil {
+		t.Fatalf("unable to create fusionManager: %s", err)
+	}
+	return fm
+}
+
+func TestEventsResume(t *testing.T) {
+	locChan := make(chan *shuttletracker.Location)
+	fm := newEventsTestManager(t, locChan)
+	server := httptest.NewServer(fm.router(noAuth, noAuth))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events?topics=vehicle_location")
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("got content type %s", resp.Header.Get("Content-Type"))
+	}
+	r := bufio.NewReader(resp.Body)
+
+	if event := readSSEEvent(t, r); event.envelope.Type != "server_id" {
+		t.Errorf("got %s event, expected server_id", event.envelope.Type)
+	}
+	snapshot := readSSEEvent(t, r)
+	if snapshot.envelope.Type != "vehicle_location" || snapshot.id != "" {
+		t.Errorf("got %s event with ID %q, expected a vehicle_location snapshot without an ID", snapshot.envelope.Type, snapshot.id)
+	}
+
+	locChan <- &shuttletracker.Location{ID: 2}
+	first := readSSEEvent(t, r)
+	if first.envelope.Type != "vehicle_location" || first.id == "" {
+		t.Fatalf("got %s event with ID %q, expected a vehicle_location with an ID", first.envelope.Type, first.id)
+	}
+	resp.Body.Close()
+
+	// this is missed while disconnected
+	locChan <- &shuttletracker.Location{ID: 3}
+
+	req, err := http.NewRequest("GET", server.URL+"/events?topics=vehicle_location", nil)
+	if err != nil {
+		t.Fatalf("unable to create request: %s", err)
+	}
+	req.Header.Set("Last-Event-ID", first.id)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	defer resp.Body.Close()
+	r = bufio.NewReader(resp.Body)
+
+	if event := readSSEEvent(t, r); event.envelope.Type != "server_id" {
+		t.Errorf("got %s event, expected server_id", event.envelope.Type)
+	}
+	missed := readSSEEvent(t, r)
+	if missed.id == "" || missed.id == first.id {
+		t.Fatalf("got event with ID %q, expected the missed event instead of a snapshot", missed.id)
+	}
+	loc := shuttletracker.Location{}
+	err = json.Unmarshal(missed.envelope.Message, &loc)
+	if err != nil {
+		t.Fatalf("unable to decode location: %s", err)
+	}
+	if loc.ID != 3 {
+		t.Errorf("got location %d, expected 3", loc.ID)
+	}
+}
+
+func TestEventsTopics(t *testing.T) {
+	fm := newEventsTestManager(t, make(chan *shuttletracker.Location))
+	server := httptest.NewServer(fm.router(noAuth, noAuth))
+	defer server.Close()
+
+	for _, query := range []string{"", "?topics=", "?topics=eta,secrets"} {
+		resp, err := http.Get(server.URL + "/events" + query)
+		if err != nil {
+			t.Fatalf("unable to connect: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d for %q, expected %d", resp.StatusCode, query, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestCanReplay(t *testing.T) {
+	fm := &fusionManager{id: "server"}
+	if fm.canReplay("") || fm.canReplay("server:0") == false {
+		t.Errorf("unexpected replay decision before any events")
+	}
+	for i := 0; i < fusionReplaySize+10; i++ {
+		fm.newEvent("eta", []byte("{}"))
+	}
+	if len(fm.replay) != fusionReplaySize {
+		t.Errorf("got %d events kept, expected %d", len(fm.replay), fusionReplaySize)
+	}
+
+	cases := map[string]bool{
+		"server:5":        false,
+		"server:10":       true,
+		"server:100":      true,
+		"server:1000":     false,
+		"otherserver:100": false,
+		"server:abc":      false,
+		"not an ID":       false,
+	}
+	for id, expected := range cases {
+		if fm.canReplay(id) != expected {
+			t.Errorf("canReplay(%q) = %t, expected %t", id, !expected, expected)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// How often positionFuser looks for riders moving with vehicles.
+	fusionInterval = 5 * time.Second
+
+	// How far back positionFuser looks at rider positions and vehicle locations.
+	fusionWindow = 3 * time.Minute
+
+	// Rider positions and vehicle locations are only compared if the vehicle location
+	// (interpolated to the rider's time) is no further than this from an actual update.
+	fusionMaxTimeOffset = 15 * time.Second
+
+	// A rider must be at least this close to a vehicle (median, in meters) to be on it.
+	fusionMaxDistance = 50.0
+
+	// Minimum number of paired rider positions and vehicle locations to consider a rider.
+	fusionMinSamples = 3
+
+	// Someone on a vehicle should speed up and slow down along with it. If speeds vary
+	// enough to be meaningful (standard deviation in m/s), they must correlate this well.
+	fusionSpeedVariation  = 1.0
+	fusionMinCorrelation  = 0.5
+	fusionMaxSpeedDiffMPS = 2.5
+
+	// The vehicle must be moving (m/s) at some point and the rider must cover at least
+	// this much ground (m), otherwise riders waiting next to a parked vehicle would match.
+	fusionMinVehicleSpeed = 2.0
+	fusionMinTrackLength  = 50.0
+
+	// Associations are forgotten when they haven't been confirmed against iTRAK
+	// for this long, or when the rider stops sending positions.
+	fusionAssociationTTL = 10 * time.Minute
+	fusionTrackIdleAfter = 30 * time.Second
+
+	// A vehicle's iTRAK feed is considered stale after this long without an update.
+	// Fusion Locations are created at most once every fusionInterval after that.
+	fusionStaleAfter = 30 * time.Second
+)
+
+const metersPerSecondToMPH = 2.23693629
+
+// positionFuser associates rider tracks from Fusion clients with vehicles and
+// synthesizes vehicle Locations from them when the iTRAK feed goes quiet.
+// All of its state is owned by the goroutine running positionFuser.run.
+type positionFuser struct {
+	ms shuttletracker.ModelService
+
+	// recentTracks returns a copy of each track's positions received since a time.
+	recentTracks func(since time.Time) map[string][]fusionPosition
+
+	// track ID to association with a vehicle
+	associations map[string]trackAssociation
+}
+
+type trackAssociation struct {
+	vehicleID int64
+	confirmed time.Time
+}
+
+type trackMatch struct {
+	vehicleID int64
+	score     float64
+}
+
+func newPositionFuser(ms shuttletracker.ModelService, recentTracks func(time.Time) map[string][]fusionPosition) *positionFuser {
+	return &positionFuser{
+		ms:           ms,
+		recentTracks: recentTracks,
+		associations: map[string]trackAssociation{},
+	}
+}
+
+func (pf *positionFuser) run() {
+	ticker := time.Tick(fusionInterval)
+	for range ticker {
+		pf.fuse(time.Now())
+	}
+}
+
+func (pf *positionFuser) fuse(now time.Time) {
+	tracks := pf.recentTracks(now.Add(-fusionWindow))
+	if len(tracks) == 0 {
+		pf.associations = map[string]trackAssociation{}
+		return
+	}
+
+	vehicles, err := pf.ms.EnabledVehicles()
+	if err != nil {
+		log.WithError(err).Error("unable to get enabled vehicles")
+		return
+	}
+
+	// find the closest vehicle each track is moving with
+	best := map[string]trackMatch{}
+	live := map[int64]bool{}
+	for _, vehicle := range vehicles {
+		locations, err := pf.ms.LocationsSince(vehicle.ID, now.Add(-fusionWindow))
+		if err != nil {
+			log.WithError(err).Errorf("unable to get locations for vehicle ID %d", vehicle.ID)
+			continue
+		}
+		locations = itrakLocations(locations)
+		if len(locations) < 2 {
+			// the feed is stale (or the vehicle is off), so we can't confirm anything
+			continue
+		}
+		live[vehicle.ID] = true
+
+		for trackID, positions := range tracks {
+			score, ok := associationScore(positions, locations)
+			if !ok {
+				continue
+			}
+			if match, found := best[trackID]; !found || score < match.score {
+				best[trackID] = trackMatch{vehicleID: vehicle.ID, score: score}
+			}
+		}
+	}
+	pf.associate(best, live, now)
+
+	pf.expireAssociations(tracks, now)
+
+	for _, vehicle := range vehicles {
+		err = pf.synthesize(vehicle, tracks, now)
+		if err != nil {
+			log.WithError(err).Errorf("unable to synthesize location for vehicle ID %d", vehicle.ID)
+		}
+	}
+}
+
+// associate records the vehicle each track is moving with. Tracks that no longer
+// match a vehicle whose feed is live are forgotten, but tracks on vehicles with stale
+// feeds are kept since that is exactly when we want to use them.
+func (pf *positionFuser) associate(best map[string]trackMatch, live map[int64]bool, now time.Time) {
+	for trackID, assoc := range pf.associations {
+		if _, ok := best[trackID]; !ok && live[assoc.vehicleID] {
+			log.Debugf("track no longer moving with vehicle ID %d", assoc.vehicleID)
+			delete(pf.associations, trackID)
+		}
+	}
+
+	for trackID, match := range best {
+		if assoc, ok := pf.associations[trackID]; !ok || assoc.vehicleID != match.vehicleID {
+			log.Debugf("track associated with vehicle ID %d (%.1f m)", match.vehicleID, match.score)
+		}
+		pf.associations[trackID] = trackAssociation{vehicleID: match.vehicleID, confirmed: now}
+	}
+}
+
+func (pf *positionFuser) expireAssociations(tracks map[string][]fusionPosition, now time.Time) {
+	for trackID, assoc := range pf.associations {
+		positions := tracks[trackID]
+		if now.Sub(assoc.confirmed) > fusionAssociationTTL ||
+			len(positions) == 0 ||
+			now.Sub(positions[len(positions)-1].Time) > fusionTrackIdleAfter {
+			delete(pf.associations, trackID)
+		}
+	}
+}
+
+// synthesize creates a Fusion Location for a vehicle if its iTRAK feed is stale and
+// riders associated with it have sent positions since its latest Location.
+func (pf *positionFuser) synthesize(vehicle *shuttletracker.Vehicle, tracks map[string][]fusionPosition, now time.Time) error {
+	riders := [][]fusionPosition{}
+	for trackID, assoc := range pf.associations {
+		if assoc.vehicleID == vehicle.ID {
+			riders = append(riders, tracks[trackID])
+		}
+	}
+	if len(riders) == 0 {
+		return nil
+	}
+
+	latest, err := pf.ms.LatestLocation(vehicle.ID)
+	if err == shuttletracker.ErrLocationNotFound {
+		// without any location we don't know which route the vehicle is on
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if latest.Source == shuttletracker.LocationSourceITRAK && now.Sub(latest.Created) < fusionStaleAfter {
+		return nil
+	}
+	if now.Sub(latest.Created) < fusionInterval {
+		return nil
+	}
+
+	loc := synthesizeLocation(riders, latest.Created, now)
+	if loc == nil {
+		return nil
+	}
+	loc.TrackerID = vehicle.TrackerID
+	loc.RouteID = latest.RouteID
+
+	log.Debugf("synthesized location for vehicle ID %d from %d riders", vehicle.ID, len(riders))
+	return pf.ms.CreateLocation(loc)
+}
+
+// synthesizeLocation combines the newest position of each rider track received after
+// a time into a single Location. It returns nil if no track has a new enough position.
+func synthesizeLocation(riders [][]fusionPosition, after, now time.Time) *shuttletracker.Location {
+	var latitude, longitude, speed float64
+	var headingX, headingY float64
+	n := 0
+	for _, positions := range riders {
+		if len(positions) == 0 {
+			continue
+		}
+		newest := positions[len(positions)-1]
+		if !newest.Time.After(after) || now.Sub(newest.Time) > fusionMaxTimeOffset {
+			continue
+		}
+		latitude += newest.Latitude
+		longitude += newest.Longitude
+
+		speeds := positionSpeeds(positions)
+		speed += speeds[len(speeds)-1]
+
+		heading, ok := positionHeading(positions)
+		if ok {
+			headingX += math.Cos(heading * math.Pi / 180)
+			headingY += math.Sin(heading * math.Pi / 180)
+		}
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	// average headings as vectors so that e.g. 350° and 10° become 0°, not 180°
+	heading := math.Atan2(headingY, headingX) * 180 / math.Pi
+	heading = math.Mod(heading+360, 360)
+
+	return &shuttletracker.Location{
+		Latitude:  latitude / float64(n),
+		Longitude: longitude / float64(n),
+		Heading:   heading,
+		Speed:     speed / float64(n) * metersPerSecondToMPH,
+		Time:      now,
+		Source:    shuttletracker.LocationSourceFusion,
+	}
+}
+
+// associationScore determines whether a rider track moved together with a vehicle.
+// If it did, ok is true and score is the median distance in meters between the two.
+// locations must be sorted oldest first.
+func associationScore(positions []fusionPosition, locations []*shuttletracker.Location) (score float64, ok bool) {
+	if len(positions) < fusionMinSamples || len(locations) < 2 {
+		return 0, false
+	}
+
+	riderSpeeds := positionSpeeds(positions)
+	distances := []float64{}
+	pairedRiderSpeeds := []float64{}
+	vehicleSpeeds := []float64{}
+	vehicleMoved := false
+	for i, position := range positions {
+		point, vehicleSpeed, found := interpolateLocation(locations, position.Time)
+		if !found {
+			continue
+		}
+		p := shuttletracker.Point{Latitude: position.Latitude, Longitude: position.Longitude}
+		distances = append(distances, geo.Distance(p, point))
+		pairedRiderSpeeds = append(pairedRiderSpeeds, riderSpeeds[i])
+		vehicleSpeeds = append(vehicleSpeeds, vehicleSpeed)
+		if vehicleSpeed >= fusionMinVehicleSpeed {
+			vehicleMoved = true
+		}
+	}
+
+	if len(distances) < fusionMinSamples || !vehicleMoved || trackLength(positions) < fusionMinTrackLength {
+		return 0, false
+	}
+
+	score = median(distances)
+	if score > fusionMaxDistance {
+		return score, false
+	}
+
+	if stdDev(pairedRiderSpeeds) >= fusionSpeedVariation && stdDev(vehicleSpeeds) >= fusionSpeedVariation {
+		if correlation(pairedRiderSpeeds, vehicleSpeeds) < fusionMinCorrelation {
+			return score, false
+		}
+	} else {
+		diff := 0.0
+		for i := range pairedRiderSpeeds {
+			diff += math.Abs(pairedRiderSpeeds[i] - vehicleSpeeds[i])
+		}
+		if diff/float64(len(pairedRiderSpeeds)) > fusionMaxSpeedDiffMPS {
+			return score, false
+		}
+	}
+
+	return score, true
+}
+
+// interpolateLocation estimates where a vehicle was (and how fast it was going, in m/s)
+// at a time. locations must be sorted oldest first. Times more than fusionMaxTimeOffset
+// from any location are not estimated.
+func interpolateLocation(locations []*shuttletracker.Location, t time.Time) (point shuttletracker.Point, speed float64, ok bool) {
+	for i, loc := range locations {
+		if loc.Created.Before(t) {
+			continue
+		}
+
+		if i == 0 {
+			if loc.Created.Sub(t) > fusionMaxTimeOffset {
+				return point, 0, false
+			}
+			return locationPoint(loc), loc.Speed / metersPerSecondToMPH, true
+		}
+
+		prev := locations[i-1]
+		if t.Sub(prev.Created) > fusionMaxTimeOffset && loc.Created.Sub(t) > fusionMaxTimeOffset {
+			return point, 0, false
+		}
+		span := loc.Created.Sub(prev.Created).Seconds()
+		frac := 0.0
+		if span > 0 {
+			frac = t.Sub(prev.Created).Seconds() / span
+		}
+		point = shuttletracker.Point{
+			Latitude:  prev.Latitude + (loc.Latitude-prev.Latitude)*frac,
+			Longitude: prev.Longitude + (loc.Longitude-prev.Longitude)*frac,
+		}
+		speed = (prev.Speed + (loc.Speed-prev.Speed)*frac) / metersPerSecondToMPH
+		return point, speed, true
+	}
+
+	last := locations[len(locations)-1]
+	if t.Sub(last.Created) > fusionMaxTimeOffset {
+		return point, 0, false
+	}
+	return locationPoint(last), last.Speed / metersPerSecondToMPH, true
+}
+
+// positionSpeeds returns the speed in m/s at each position. Clients often don't know
+// their speed, in which case it is derived from the previous position.
+func positionSpeeds(positions []fusionPosition) []float64 {
+	speeds := make([]float64, len(positions))
+	for i, position := range positions {
+		if position.Speed != nil && *position.Speed >= 0 {
+			speeds[i] = *position.Speed
+			continue
+		}
+		if i == 0 {
+			continue
+		}
+		prev := positions[i-1]
+		elapsed := position.Time.Sub(prev.Time).Seconds()
+		if elapsed <= 0 {
+			speeds[i] = speeds[i-1]
+			continue
+		}
+		speeds[i] = geo.Distance(positionPoint(prev), positionPoint(position)) / elapsed
+	}
+	if len(speeds) > 1 && (positions[0].Speed == nil || *positions[0].Speed < 0) {
+		speeds[0] = speeds[1]
+	}
+	return speeds
+}
+
+// positionHeading returns the heading of the newest position in a track, falling back
+// to the bearing from the previous position.
+func positionHeading(positions []fusionPosition) (float64, bool) {
+	newest := positions[len(positions)-1]
+	if newest.Heading != nil && *newest.Heading >= 0 {
+		return *newest.Heading, true
+	}
+	if len(positions) < 2 {
+		return 0, false
+	}
+	prev := positionPoint(positions[len(positions)-2])
+	return geo.InitialBearing(prev, positionPoint(newest)), true
+}
+
+func trackLength(positions []fusionPosition) float64 {
+	total := 0.0
+	for i := 1; i < len(positions); i++ {
+		total += geo.Distance(positionPoint(positions[i-1]), positionPoint(positions[i]))
+	}
+	return total
+}
+
+// itrakLocations filters out anything that didn't come from iTRAK and sorts the
+// remaining Locations oldest first.
+func itrakLocations(locations []*shuttletracker.Location) []*shuttletracker.Location {
+	filtered := []*shuttletracker.Location{}
+	for _, loc := range locations {
+		if loc.Source == shuttletracker.LocationSourceITRAK {
+			filtered = append(filtered, loc)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Created.Before(filtered[j].Created)
+	})
+	return filtered
+}
+
+func positionPoint(fp fusionPosition) shuttletracker.Point {
+	return shuttletracker.Point{Latitude: fp.Latitude, Longitude: fp.Longitude}
+}
+
+func locationPoint(loc *shuttletracker.Location) shuttletracker.Point {
+	return shuttletracker.Point{Latitude: loc.Latitude, Longitude: loc.Longitude}
+}
+
+func median(vals []float64) float64 {
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+func mean(vals []float64) float64 {
+	total := 0.0
+	for _, v := range vals {
+		total += v
+	}
+	return total / float64(len(vals))
+}
+
+func stdDev(vals []float64) float64 {
+	m := mean(vals)
+	total := 0.0
+	for _, v := range vals {
+		total += (v - m) * (v - m)
+	}
+	return math.Sqrt(total / float64(len(vals)))
+}
+
+// correlation returns the Pearson correlation coefficient of two equal-length samples.
+func correlation(a, b []float64) float64 {
+	meanA := mean(a)
+	meanB := mean(b)
+	var cov, varA, varB float64
+	for i := range a {
+		cov += (a[i] - meanA) * (b[i] - meanB)
+		varA += (a[i] - meanA) * (a[i] - meanA)
+		varB += (b[i] - meanB) * (b[i] - meanB)
+	}
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+// makeVehicleLocations returns iTRAK Locations for a vehicle that left a point at
+// departure driving north at a constant speed (m/s), one every interval, oldest first,
+// ending at end.
+func makeVehicleLocations(start shuttletracker.Point, departure time.Time, speed float64, interval time.Duration, n int, end time.Time) []*shuttletracker.Location {
+	locs := []*shuttletracker.Location{}
+	for i := 0; i < n; i++ {
+		created := end.Add(-time.Duration(n-1-i) * interval)
+		meters := speed * created.Sub(departure).Seconds()
+		locs = append(locs, &shuttletracker.Location{
+			Latitude:  start.Latitude + meters/111111,
+			Longitude: start.Longitude,
+			Speed:     speed * metersPerSecondToMPH,
+			Created:   created,
+			Time:      created,
+			Source:    shuttletracker.LocationSourceITRAK,
+		})
+	}
+	return locs
+}
+
+// makeTrack returns rider positions following the same path as makeVehicleLocations,
+// offset east by some meters, one every interval.
+func makeTrack(start shuttletracker.Point, departure time.Time, speed float64, offset float64, interval time.Duration, n int, end time.Time) []fusionPosition {
+	positions := []fusionPosition{}
+	for i := 0; i < n; i++ {
+		t := end.Add(-time.Duration(n-1-i) * interval)
+		meters := speed * t.Sub(departure).Seconds()
+		positions = append(positions, fusionPosition{
+			Latitude:  start.Latitude + meters/111111,
+			Longitude: start.Longitude + offset/(111111*math.Cos(start.Latitude*math.Pi/180)),
+			Time:      t,
+		})
+	}
+	return positions
+}
+
+func TestAssociationScore(t *testing.T) {
+	now := time.Now()
+	departure := now.Add(-2 * time.Minute)
+	start := shuttletracker.Point{Latitude: 42.73, Longitude: -73.68}
+	locs := makeVehicleLocations(start, departure, 8, 10*time.Second, 12, now)
+
+	type testCase struct {
+		name      string
+		positions []fusionPosition
+		expected  bool
+	}
+	cases := []testCase{
+		{
+			name:      "rider on vehicle",
+			positions: makeTrack(start, departure, 8, 5, 5*time.Second, 20, now),
+			expected:  true,
+		},
+		{
+			name:      "rider on a parallel street",
+			positions: makeTrack(start, departure, 8, 200, 5*time.Second, 20, now),
+			expected:  false,
+		},
+		{
+			name:      "rider standing still",
+			positions: makeTrack(start, departure, 0, 5, 5*time.Second, 20, now),
+			expected:  false,
+		},
+		{
+			name:      "too few positions",
+			positions: makeTrack(start, departure, 8, 5, 5*time.Second, 2, now),
+			expected:  false,
+		},
+	}
+
+	for _, c := range cases {
+		score, ok := associationScore(c.positions, locs)
+		if ok != c.expected {
+			t.Errorf("%s: got association %t (score %f), expected %t", c.name, ok, score, c.expected)
+		}
+	}
+}
+
+func TestInterpolateLocation(t *testing.T) {
+	now := time.Now()
+	locs := []*shuttletracker.Location{
+		{Latitude: 42.0, Longitude: -73.0, Speed: 10, Created: now.Add(-10 * time.Second)},
+		{Latitude: 42.1, Longitude: -73.2, Speed: 20, Created: now},
+	}
+
+	point, speed, ok := interpolateLocation(locs, now.Add(-5*time.Second))
+	if !ok {
+		t.Fatalf("unable to interpolate")
+	}
+	if math.Abs(point.Latitude-42.05) > 0.0001 || math.Abs(point.Longitude+73.1) > 0.0001 {
+		t.Errorf("got point %+v, expected halfway", point)
+	}
+	if math.Abs(speed*metersPerSecondToMPH-15) > 0.0001 {
+		t.Errorf("got speed %f mph, expected 15", speed*metersPerSecondToMPH)
+	}
+
+	_, _, ok = interpolateLocation(locs, now.Add(time.Minute))
+	if ok {
+		t.Errorf("interpolated a time long after the last location")
+	}
+}
+
+func TestSynthesizeLocation(t *testing.T) {
+	now := time.Now()
+	speed := 5.0
+	heading := 350.0
+	otherHeading := 10.0
+	riders := [][]fusionPosition{
+		{{Latitude: 42.0, Longitude: -73.0, Speed: &speed, Heading: &heading, Time: now.Add(-2 * time.Second)}},
+		{{Latitude: 42.2, Longitude: -73.2, Speed: &speed, Heading: &otherHeading, Time: now.Add(-time.Second)}},
+		// too old to use
+		{{Latitude: 50, Longitude: -80, Time: now.Add(-time.Minute)}},
+	}
+
+	loc := synthesizeLocation(riders, now.Add(-30*time.Second), now)
+	if loc == nil {
+		t.Fatalf("no location synthesized")
+	}
+	if loc.Source != shuttletracker.LocationSourceFusion {
+		t.Errorf("got source %s, expected %s", loc.Source, shuttletracker.LocationSourceFusion)
+	}
+	if math.Abs(loc.Latitude-42.1) > 0.0001 || math.Abs(loc.Longitude+73.1) > 0.0001 {
+		t.Errorf("got %f, %f, expected the average of recent positions", loc.Latitude, loc.Longitude)
+	}
+	if math.Abs(loc.Speed-speed*metersPerSecondToMPH) > 0.0001 {
+		t.Errorf("got speed %f, expected %f", loc.Speed, speed*metersPerSecondToMPH)
+	}
+	if loc.Heading > 0.0001 && loc.Heading < 359.9999 {
+		t.Errorf("got heading %f, expected 0", loc.Heading)
+	}
+
+	if synthesizeLocation(riders, now, now) != nil {
+		t.Errorf("synthesized location from positions older than the latest location")
+	}
+}
+
+// nolint: gocyclo
+func TestPositionFuserStaleFeed(t *testing.T) {
+	now := time.Now()
+	departure := now.Add(-2 * time.Minute)
+	start := shuttletracker.Point{Latitude: 42.73, Longitude: -73.68}
+	vehicle := &shuttletracker.Vehicle{ID: 1, TrackerID: "tracker1", Enabled: true}
+	routeID := int64(3)
+	locs := makeVehicleLocations(start, departure, 8, 10*time.Second, 12, now)
+	for _, loc := range locs {
+		loc.RouteID = &routeID
+	}
+	track := makeTrack(start, departure, 8, 5, 5*time.Second, 20, now)
+
+	// newest first, like LocationsSince
+	newestFirst := make([]*shuttletracker.Location, len(locs))
+	for i, loc := range locs {
+		newestFirst[len(locs)-1-i] = loc
+	}
+
+	ms := &mock.ModelService{}
+	ms.VehicleService.On("EnabledVehicles").Return([]*shuttletracker.Vehicle{vehicle}, nil)
+	ms.LocationService.On("LocationsSince", vehicle.ID).Return(newestFirst, nil).Once()
+	ms.LocationService.On("LatestLocation", vehicle.ID).Return(locs[len(locs)-1], nil).Once()
+
+	tracks := map[string][]fusionPosition{"rider": track}
+	pf := newPositionFuser(ms, func(since time.Time) map[string][]fusionPosition {
+		return tracks
+	})
+
+	// feed is live, so the rider should be associated but nothing synthesized
+	pf.fuse(now)
+	if assoc, ok := pf.associations["rider"]; !ok || assoc.vehicleID != vehicle.ID {
+		t.Fatalf("rider not associated with vehicle")
+	}
+	ms.LocationService.AssertNotCalled(t, "CreateLocation", tmock.Anything)
+
+	// a minute later iTRAK hasn't said anything, but the rider has kept going
+	later := now.Add(time.Minute)
+	tracks["rider"] = append(track, makeTrack(start, departure, 8, 5, 5*time.Second, 32, later)[20:]...)
+	ms.LocationService.On("LocationsSince", vehicle.ID).Return([]*shuttletracker.Location{}, nil).Once()
+	ms.LocationService.On("LatestLocation", vehicle.ID).Return(locs[len(locs)-1], nil).Once()
+	ms.LocationService.On("CreateLocation", tmock.AnythingOfType("*shuttletracker.Location")).Return(nil).Once()
+
+	pf.fuse(later)
+	ms.LocationService.AssertNumberOfCalls(t, "CreateLocation", 1)
+	created := ms.LocationService.Calls[len(ms.LocationService.Calls)-1].Arguments.Get(0).(*shuttletracker.Location)
+	if created.Source != shuttletracker.LocationSourceFusion {
+		t.Errorf("got source %s, expected %s", created.Source, shuttletracker.LocationSourceFusion)
+	}
+	if created.TrackerID != vehicle.TrackerID {
+		t.Errorf("got tracker ID %s, expected %s", created.TrackerID, vehicle.TrackerID)
+	}
+	if created.RouteID == nil || *created.RouteID != routeID {
+		t.Errorf("synthesized location isn't on the vehicle's route")
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+)
+
+// fusionProtocolVersion is increased when Fusion messages change in a way that
+// clients need to know about.
+const fusionProtocolVersion = 1
+
+// Codes sent to clients in fusionMessageError.
+const (
+	fusionErrorDecode             = "decode_error"
+	fusionErrorUnknownType        = "unknown_type"
+	fusionErrorUnknownTopic       = "unknown_topic"
+	fusionErrorInvalidEmoji       = "invalid_emoji"
+	fusionErrorRateLimited        = "rate_limited"
+	fusionErrorOutOfRange         = "out_of_range"
+	fusionErrorUnsupportedVersion = "unsupported_version"
+)
+
+// fusionClientMessageTypes are the message types that clients can send.
+var fusionClientMessageTypes = [...]string{"hello", "subscribe", "unsubscribe", "position", "bus_button"}
+
+// fusionServerMessageTypes are the message types that the server can send.
+var fusionServerMessageTypes = [...]string{"hello", "error", "server_id", "vehicle_location", "eta", "bus_button", "alerts"}
+
+// fusionMessageHello is sent by clients when they connect. MessageTypes lists the
+// message types that the client knows how to handle. If it's set, the server won't
+// send the client any others, besides hello and error.
+type fusionMessageHello struct {
+	ProtocolVersion int      `json:"protocol_version"`
+	MessageTypes    []string `json:"message_types"`
+}
+
+// fusionMessageServerHello answers fusionMessageHello with what the server supports.
+type fusionMessageServerHello struct {
+	ProtocolVersion    int      `json:"protocol_version"`
+	ServerID           string   `json:"server_id"`
+	ClientMessageTypes []string `json:"client_message_types"`
+	ServerMessageTypes []string `json:"server_message_types"`
+	Topics             []string `json:"topics"`
+}
+
+// fusionMessageError tells a client that a message it sent couldn't be handled.
+type fusionMessageError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// RequestType is the type of the message that caused the error, if it's known.
+	RequestType string `json:"request_type,omitempty"`
+}
+
+func fusionErrorEnvelope(code string, requestType string, format string, a ...interface{}) fusionMessageEnvelope {
+	return fusionMessageEnvelope{
+		Type: "error",
+		Message: fusionMessageError{
+			Code:        code,
+			Message:     fmt.Sprintf(format, a...),
+			RequestType: requestType,
+		},
+	}
+}
+
+// replyError sends an error to a client. It must only be called from fm.run.
+func (fm *fusionManager) replyError(clientID string, fme fusionMessageEnvelope) {
+	fm.processServerMessage(serverMessage{clientID: clientID, msg: fme})
+}
+
+func (fm *fusionManager) handleMsgHello(clientID string, hello fusionMessageHello) {
+	client, ok := fm.clients[clientID]
+	if !ok {
+		return
+	}
+
+	if hello.ProtocolVersion < 1 || hello.ProtocolVersion > fusionProtocolVersion {
+		fm.replyError(clientID, fusionErrorEnvelope(fusionErrorUnsupportedVersion, "hello",
+			"protocol version %d is not supported; the server supports version %d", hello.ProtocolVersion, fusionProtocolVersion))
+	} else if hello.MessageTypes != nil {
+		client.accepts = map[string]bool{}
+		for _, t := range hello.MessageTypes {
+			client.accepts[t] = true
+		}
+	}
+
+	fme := fusionMessageEnvelope{
+		Type: "hello",
+		Message: fusionMessageServerHello{
+			ProtocolVersion:    fusionProtocolVersion,
+			ServerID:           fm.id,
+			ClientMessageTypes: fusionClientMessageTypes[:],
+			ServerMessageTypes: fusionServerMessageTypes[:],
+			Topics:             fusionTopics[:],
+		},
+	}
+	fm.processServerMessage(serverMessage{clientID: clientID, msg: fme})
+}
+
+// acceptsMessage returns whether a client wants a message, based on its type.
+func (c *fusionClient) acceptsMessage(msg interface{}) bool {
+	fme, ok := msg.(fusionMessageEnvelope)
+	if !ok || c.accepts == nil || fme.Type == "hello" || fme.Type == "error" {
+		return true
+	}
+	return c.accepts[fme.Type]
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/wtg/shuttletracker"
+)
+
+type wsTestEnvelope struct {
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message"`
+}
+
+func readWSEnvelope(t *testing.T, conn *websocket.Conn) wsTestEnvelope {
+	err := conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err != nil {
+		t.Fatalf("unable to set deadline: %s", err)
+	}
+	env := wsTestEnvelope{}
+	err = conn.ReadJSON(&env)
+	if err != nil {
+		t.Fatalf("unable to read message: %s", err)
+	}
+	return env
+}
+
+func TestFusionProtocolErrors(t *testing.T) {
+	fm := newEventsTestManager(t, make(chan *shuttletracker.Location))
+	server := httptest.NewServer(fm.router(noAuth, noAuth))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", nil)
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	defer conn.Close()
+
+	if env := readWSEnvelope(t, conn); env.Type != "server_id" {
+		t.Fatalf("got %s message, expected server_id", env.Type)
+	}
+
+	cases := []struct {
+		name    string
+		message string
+		code    string
+	}{
+		{"malformed", `{"type": `, fusionErrorDecode},
+		{"bad message", `{"type": "subscribe", "message": 5}`, fusionErrorDecode},
+		{"unknown type", `{"type": "teleport", "message": {}}`, fusionErrorUnknownType},
+		{"unknown topic", `{"type": "subscribe", "message": {"topic": "secrets"}}`, fusionErrorUnknownTopic},
+		{"invalid emoji", `{"type": "bus_button", "message": {"latitude": 42.73, "longitude": -73.68, "emojiChoice": "🐢"}}`, fusionErrorInvalidEmoji},
+		{"unsupported version", `{"type": "hello", "message": {"protocol_version": 99}}`, fusionErrorUnsupportedVersion},
+	}
+	for _, c := range cases {
+		err = conn.WriteMessage(websocket.TextMessage, []byte(c.message))
+		if err != nil {
+			t.Fatalf("unable to write: %s", err)
+		}
+		env := readWSEnvelope(t, conn)
+		if env.Type != "error" {
+			t.Errorf("%s: got %s message, expected error", c.name, env.Type)
+			continue
+		}
+		fme := fusionMessageError{}
+		err = json.Unmarshal(env.Message, &fme)
+		if err != nil {
+			t.Fatalf("unable to decode error: %s", err)
+		}
+		if fme.Code != c.code {
+			t.Errorf("%s: got code %s, expected %s", c.name, fme.Code, c.code)
+		}
+	}
+
+	// the unsupported hello is still answered
+	if env := readWSEnvelope(t, conn); env.Type != "hello" {
+		t.Errorf("got %s message, expected hello", env.Type)
+	}
+}
+
+func TestFusionHello(t *testing.T) {
+	fm := newEventsTestManager(t, make(chan *shuttletracker.Location))
+	server := httptest.NewServer(fm.router(noAuth, noAuth))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/", nil)
+	if err != nil {
+		t.Fatalf("unable to connect: %s", err)
+	}
+	defer conn.Close()
+	readWSEnvelope(t, conn)
+
+	err = conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "hello", "message": {"protocol_version": 1, "message_types": ["eta"]}}`))
+	if err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+	env := readWSEnvelope(t, conn)
+	if env.Type != "hello" {
+		t.Fatalf("got %s message, expected hello", env.Type)
+	}
+	hello := fusionMessageServerHello{}
+	err = json.Unmarshal(env.Message, &hello)
+	if err != nil {
+		t.Fatalf("unable to decode hello: %s", err)
+	}
+	if hello.ProtocolVersion != fusionProtocolVersion || hello.ServerID != fm.id {
+		t.Errorf("got unexpected hello %+v", hello)
+	}
+	if len(hello.Topics) != len(fusionTopics) {
+		t.Errorf("got topics %v, expected %v", hello.Topics, fusionTopics)
+	}
+
+	// the client only handles ETAs, so it shouldn't get vehicle locations
+	err = conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "subscribe", "message": {"topic": "vehicle_location"}}`))
+	if err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+	err = conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "teleport", "message": {}}`))
+	if err != nil {
+		t.Fatalf("unable to write: %s", err)
+	}
+	if env := readWSEnvelope(t, conn); env.Type != "error" {
+		t.Errorf("got %s message, expected only the error", env.Type)
+	}
+}
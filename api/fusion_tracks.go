@@ -0,0 +1,334 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// how often expired track positions are deleted and finished tracks forgotten
+	trackRecorderInterval = time.Minute
+
+	// a track that hasn't had a new position in this long is considered finished
+	fusionTrackEndAfter = 10 * time.Minute
+
+	// size in degrees of the grid cells that exported positions are aggregated into
+	fusionExportCellSize = 0.002
+
+	// aggregated cells with fewer distinct tracks than this are left out of exports
+	fusionExportMinTracks = 3
+)
+
+// trackOrigin is where a track started. Nothing is stored until the track leaves
+// the area around it, so that riders' homes don't end up in the database. Likewise,
+// tail holds the positions near where the track is now until it moves on from them,
+// and they're never stored if it ends there.
+type trackOrigin struct {
+	point    shuttletracker.Point
+	left     bool
+	lastSeen time.Time
+	tail     []*shuttletracker.TrackPosition
+}
+
+// trackRecorder stores rider tracks so that they survive restarts and can be exported.
+// Only trackRecorder.run reads or modifies origins. The ends of tracks are only ever
+// kept in memory, so positions that haven't been stored yet are lost on restart.
+type trackRecorder struct {
+	ts        shuttletracker.TrackService
+	ttl       time.Duration
+	radius    float64
+	positions chan fusionPosition
+	origins   map[string]*trackOrigin
+}
+
+func newTrackRecorder(ts shuttletracker.TrackService, ttl time.Duration, radius float64) *trackRecorder {
+	return &trackRecorder{
+		ts:        ts,
+		ttl:       ttl,
+		radius:    radius,
+		positions: make(chan fusionPosition, 1000),
+		origins:   map[string]*trackOrigin{},
+	}
+}
+
+// preload marks tracks that were stored before a restart as having left their origins.
+// It must be called before run.
+func (tr *trackRecorder) preload(positions []*shuttletracker.TrackPosition) {
+	for _, p := range positions {
+		tr.origins[p.Track] = &trackOrigin{
+			point:    shuttletracker.Point{Latitude: p.Latitude, Longitude: p.Longitude},
+			left:     true,
+			lastSeen: p.Time,
+		}
+	}
+}
+
+func (tr *trackRecorder) run() {
+	ticker := time.NewTicker(trackRecorderInterval)
+	for {
+		select {
+		case fp := <-tr.positions:
+			tr.store(fp)
+		case now := <-ticker.C:
+			tr.expire(now)
+		}
+	}
+}
+
+// record queues a position to be stored without blocking the caller.
+func (tr *trackRecorder) record(fp fusionPosition) {
+	select {
+	case tr.positions <- fp:
+	default:
+		log.Warn("track recorder is behind; dropping position")
+	}
+}
+
+func (tr *trackRecorder) store(fp fusionPosition) {
+	point := positionPoint(fp)
+	origin, ok := tr.origins[fp.Track]
+	if !ok {
+		tr.origins[fp.Track] = &trackOrigin{point: point, lastSeen: fp.Time}
+		return
+	}
+	origin.lastSeen = fp.Time
+	if !origin.left {
+		if geo.Distance(origin.point, point) < tr.radius {
+			return
+		}
+		origin.left = true
+	}
+
+	origin.tail = append(origin.tail, trackPosition(fp))
+	stored := trimTrackEnd(origin.tail, tr.radius)
+	for _, p := range stored {
+		err := tr.ts.CreateTrackPosition(p)
+		if err != nil {
+			log.WithError(err).Error("unable to create track position")
+		}
+	}
+	origin.tail = origin.tail[len(stored):]
+}
+
+func (tr *trackRecorder) expire(now time.Time) {
+	for track, origin := range tr.origins {
+		if now.Sub(origin.lastSeen) > fusionTrackEndAfter {
+			// the track has ended, so its tail is dropped
+			delete(tr.origins, track)
+		}
+	}
+
+	deleted, err := tr.ts.DeleteTrackPositionsBefore(now.Add(-tr.ttl))
+	if err != nil {
+		log.WithError(err).Error("unable to delete expired track positions")
+		return
+	}
+	log.Debugf("deleted %d expired track positions", deleted)
+}
+
+func trackPosition(fp fusionPosition) *shuttletracker.TrackPosition {
+	return &shuttletracker.TrackPosition{
+		Track:     fp.Track,
+		Latitude:  fp.Latitude,
+		Longitude: fp.Longitude,
+		Speed:     fp.Speed,
+		Heading:   fp.Heading,
+		Time:      fp.Time,
+	}
+}
+
+func fusionPositionFromTrack(p *shuttletracker.TrackPosition) fusionPosition {
+	return fusionPosition{
+		Track:     p.Track,
+		Latitude:  p.Latitude,
+		Longitude: p.Longitude,
+		Speed:     p.Speed,
+		Heading:   p.Heading,
+		Time:      p.Time,
+	}
+}
+
+// groupTracks splits positions ordered by track into one slice per track.
+func groupTracks(positions []*shuttletracker.TrackPosition) [][]*shuttletracker.TrackPosition {
+	tracks := [][]*shuttletracker.TrackPosition{}
+	for i, p := range positions {
+		if i == 0 || positions[i-1].Track != p.Track {
+			tracks = append(tracks, []*shuttletracker.TrackPosition{})
+		}
+		tracks[len(tracks)-1] = append(tracks[len(tracks)-1], p)
+	}
+	return tracks
+}
+
+// trimTrackEnd removes the positions at the end of a track that are within radius
+// meters of where it ended, since that's likely where the rider was going.
+func trimTrackEnd(track []*shuttletracker.TrackPosition, radius float64) []*shuttletracker.TrackPosition {
+	if len(track) == 0 {
+		return track
+	}
+	last := track[len(track)-1]
+	end := shuttletracker.Point{Latitude: last.Latitude, Longitude: last.Longitude}
+	i := len(track)
+	for i > 0 {
+		p := track[i-1]
+		if geo.Distance(end, shuttletracker.Point{Latitude: p.Latitude, Longitude: p.Longitude}) >= radius {
+			break
+		}
+		i--
+	}
+	return track[:i]
+}
+
+// fusionTrackCell summarizes the positions reported within one grid cell during one hour.
+type fusionTrackCell struct {
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Hour      time.Time `json:"hour"`
+	Positions int       `json:"positions"`
+	Tracks    int       `json:"tracks"`
+
+	// Meters per second. Pointer because no position in the cell may have had a speed.
+	AverageSpeed *float64 `json:"average_speed"`
+}
+
+type fusionTrackCellKey struct {
+	lat  int64
+	lon  int64
+	hour int64
+}
+
+// aggregateTracks counts positions by grid cell and hour. Cells that fewer than
+// fusionExportMinTracks tracks passed through are left out so that individual
+// riders can't be picked out.
+func aggregateTracks(tracks [][]*shuttletracker.TrackPosition) []fusionTrackCell {
+	type cellStats struct {
+		positions  int
+		speedSum   float64
+		speedCount int
+		tracks     map[int]bool
+	}
+	stats := map[fusionTrackCellKey]*cellStats{}
+	for i, track := range tracks {
+		for _, p := range track {
+			key := fusionTrackCellKey{
+				lat:  int64(math.Floor(p.Latitude / fusionExportCellSize)),
+				lon:  int64(math.Floor(p.Longitude / fusionExportCellSize)),
+				hour: p.Time.Truncate(time.Hour).Unix(),
+			}
+			s, ok := stats[key]
+			if !ok {
+				s = &cellStats{tracks: map[int]bool{}}
+				stats[key] = s
+			}
+			s.positions++
+			s.tracks[i] = true
+			if p.Speed != nil {
+				s.speedSum += *p.Speed
+				s.speedCount++
+			}
+		}
+	}
+
+	cells := []fusionTrackCell{}
+	for key, s := range stats {
+		if len(s.tracks) < fusionExportMinTracks {
+			continue
+		}
+		cell := fusionTrackCell{
+			Latitude:  (float64(key.lat) + 0.5) * fusionExportCellSize,
+			Longitude: (float64(key.lon) + 0.5) * fusionExportCellSize,
+			Hour:      time.Unix(key.hour, 0).UTC(),
+			Positions: s.positions,
+			Tracks:    len(s.tracks),
+		}
+		if s.speedCount > 0 {
+			speed := s.speedSum / float64(s.speedCount)
+			cell.AverageSpeed = &speed
+		}
+		cells = append(cells, cell)
+	}
+
+	sort.Slice(cells, func(i, j int) bool {
+		if !cells[i].Hour.Equal(cells[j].Hour) {
+			return cells[i].Hour.Before(cells[j].Hour)
+		}
+		if cells[i].Latitude != cells[j].Latitude {
+			return cells[i].Latitude < cells[j].Latitude
+		}
+		return cells[i].Longitude < cells[j].Longitude
+	})
+	return cells
+}
+
+// exportSince returns the time in the "since" query parameter, or the oldest time
+// that track positions are kept for.
+func (fm *fusionManager) exportSince(r *http.Request) (time.Time, error) {
+	s := r.URL.Query().Get("since")
+	if s == "" {
+		return time.Now().Add(-fm.recorder.ttl), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// exportTracks returns stored tracks since a time. Their ends were never stored.
+func (fm *fusionManager) exportTracks(since time.Time) ([][]*shuttletracker.TrackPosition, error) {
+	positions, err := fm.recorder.ts.TrackPositionsSince(since)
+	if err != nil {
+		return nil, err
+	}
+	return groupTracks(positions), nil
+}
+
+// exportHandler writes rider tracks aggregated into grid cells.
+func (fm *fusionManager) exportHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := fm.exportSince(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tracks, err := fm.exportTracks(since)
+	if err != nil {
+		log.WithError(err).Error("unable to get tracks")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = WriteJSON(w, aggregateTracks(tracks))
+	if err != nil {
+		log.WithError(err).Error("unable to write JSON")
+	}
+}
+
+// rawExportHandler writes every stored position of every rider track. Users need
+// shuttletracker.PermissionFusionRawExport to use it.
+func (fm *fusionManager) rawExportHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := fm.exportSince(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	tracks, err := fm.exportTracks(since)
+	if err != nil {
+		log.WithError(err).Error("unable to get tracks")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	export := make([][]fusionPosition, 0, len(tracks))
+	for _, track := range tracks {
+		positions := make([]fusionPosition, 0, len(track))
+		for _, p := range track {
+			positions = append(positions, fusionPositionFromTrack(p))
+		}
+		export = append(export, positions)
+	}
+	err = WriteJSON(w, export)
+	if err != nil {
+		log.WithError(err).Error("unable to write JSON")
+	}
+}
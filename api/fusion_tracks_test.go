@@ -0,0 +1,183 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/auth"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestTrackRecorderOrigin(t *testing.T) {
+	ts := &mock.TrackService{}
+	ts.On("CreateTrackPosition", tmock.AnythingOfType("*shuttletracker.TrackPosition")).Return(nil)
+	tr := newTrackRecorder(ts, time.Hour, 190)
+
+	now := time.Now()
+	departure := now.Add(-time.Minute)
+	start := shuttletracker.Point{Latitude: 42.73, Longitude: -73.68}
+	// 8 m/s for 60 seconds, so positions from the first and last 20 seconds are
+	// within the radius of where the track starts and ends
+	for _, fp := range makeTrack(start, departure, 8, 0, 5*time.Second, 13, now) {
+		fp.Track = "rider"
+		tr.store(fp)
+	}
+
+	ts.AssertNumberOfCalls(t, "CreateTrackPosition", 3)
+	for _, call := range ts.Calls {
+		p := call.Arguments.Get(0).(*shuttletracker.TrackPosition)
+		if p.Time.Sub(departure) < 25*time.Second {
+			t.Errorf("stored position from %s after departure, which is too close to the origin", p.Time.Sub(departure))
+		}
+		if now.Sub(p.Time) < 20*time.Second {
+			t.Errorf("stored position from %s before the end, which is too close to it", now.Sub(p.Time))
+		}
+	}
+
+	// The tail is dropped when the track ends.
+	ts.On("DeleteTrackPositionsBefore", tmock.AnythingOfType("time.Time")).Return(0, nil)
+	tr.expire(now.Add(fusionTrackEndAfter + time.Minute))
+	if len(tr.origins) != 0 {
+		t.Errorf("got %d tracks, expected the ended one to be forgotten", len(tr.origins))
+	}
+	ts.AssertNumberOfCalls(t, "CreateTrackPosition", 3)
+}
+
+func TestTrimTrackEnd(t *testing.T) {
+	now := time.Now()
+	track := []*shuttletracker.TrackPosition{}
+	// 100 meters apart
+	for i := 0; i < 6; i++ {
+		track = append(track, &shuttletracker.TrackPosition{
+			Latitude:  42.73 + float64(i)*100/111111,
+			Longitude: -73.68,
+			Time:      now.Add(time.Duration(i) * time.Second),
+		})
+	}
+
+	trimmed := trimTrackEnd(track, 150)
+	if len(trimmed) != 4 {
+		t.Errorf("got %d positions, expected 4", len(trimmed))
+	}
+
+	if len(trimTrackEnd(track, 1000)) != 0 {
+		t.Errorf("expected a track entirely within the radius to be removed")
+	}
+}
+
+func TestAggregateTracks(t *testing.T) {
+	hour := time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)
+	speed := 2.0
+	position := func(track string, lat float64) *shuttletracker.TrackPosition {
+		return &shuttletracker.TrackPosition{
+			Track:     track,
+			Latitude:  lat,
+			Longitude: -73.6801,
+			Speed:     &speed,
+			Time:      hour.Add(10 * time.Minute),
+		}
+	}
+
+	tracks := [][]*shuttletracker.TrackPosition{
+		{position("a", 42.7301), position("a", 42.7302), position("a", 42.7501)},
+		{position("b", 42.7301)},
+		{position("c", 42.7303)},
+	}
+
+	cells := aggregateTracks(tracks)
+	if len(cells) != 1 {
+		t.Fatalf("got %d cells, expected only the one with enough tracks", len(cells))
+	}
+	cell := cells[0]
+	if cell.Tracks != 3 || cell.Positions != 4 {
+		t.Errorf("got %d tracks and %d positions, expected 3 and 4", cell.Tracks, cell.Positions)
+	}
+	if !cell.Hour.Equal(hour) {
+		t.Errorf("got hour %s, expected %s", cell.Hour, hour)
+	}
+	if cell.Latitude == 42.7301 || cell.Longitude == -73.6801 {
+		t.Errorf("cell location is a rider's exact position")
+	}
+	if cell.AverageSpeed == nil || *cell.AverageSpeed != speed {
+		t.Errorf("got unexpected average speed")
+	}
+}
+
+func TestRawExportAPIToken(t *testing.T) {
+	ts := &mock.TrackService{}
+	ts.On("TrackPositionsSince", tmock.AnythingOfType("time.Time")).Return([]*shuttletracker.TrackPosition{}, nil)
+	fm := &fusionManager{recorder: newTrackRecorder(ts, time.Hour, 190)}
+
+	us := &mock.UserService{}
+	// Owners don't get raw tracks without the permission, and viewers do with it.
+	us.On("User", "owner").Return(&shuttletracker.User{Username: "owner", Role: shuttletracker.RoleOwner}, nil)
+	us.On("User", "viewer").Return(&shuttletracker.User{Username: "viewer", Role: shuttletracker.RoleViewer,
+		Permissions: []string{shuttletracker.PermissionFusionRawExport}}, nil)
+	tokens := &mock.APITokenService{}
+	for _, token := range []*shuttletracker.APIToken{
+		{ID: 1, Username: "owner", Scopes: []string{shuttletracker.ScopeFusionRaw}},
+		{ID: 2, Username: "viewer", Scopes: []string{shuttletracker.ScopeFusionRaw}},
+		{ID: 3, Username: "viewer", Scopes: []string{shuttletracker.ScopeRead}},
+	} {
+		token.Expires = time.Now().Add(time.Hour)
+		tokens.On("APITokenWithHash", auth.HashAPIToken(fmt.Sprintf("st_%d", token.ID))).Return(token, nil)
+	}
+	tokens.On("TouchAPIToken", tmock.AnythingOfType("int64"), tmock.AnythingOfType("time.Time")).Return(nil)
+	cli := InjectMocks(&auth.Mock{}, us, true)
+	cli.tokens = tokens
+
+	router := fm.router(cli.requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeRead),
+		chi.Chain(cli.requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeFusionRaw),
+			cli.requirePermission(shuttletracker.PermissionFusionRawExport)).Handler)
+	for _, c := range []struct {
+		token  string
+		status int
+	}{
+		{"st_1", http.StatusForbidden},
+		{"st_2", http.StatusOK},
+		{"st_3", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest("GET", "/export/raw", nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: got status %d, expected %d", c.token, w.Code, c.status)
+		}
+	}
+	ts.AssertNumberOfCalls(t, "TrackPositionsSince", 1)
+}
+
+func TestHandleMsgPositionTrackID(t *testing.T) {
+	ts := &mock.TrackService{}
+	ts.On("CreateTrackPosition", tmock.AnythingOfType("*shuttletracker.TrackPosition")).Return(nil)
+	fm := &fusionManager{
+		tracks:   map[string][]fusionPosition{},
+		recorder: newTrackRecorder(ts, time.Hour, 0),
+	}
+
+	for _, track := range []string{
+		"",
+		"rider",
+		"{0b8d4d6c-7b1e-4f5a-9c3d-2e1f0a9b8c7d}",
+		"0B8D4D6C-7B1E-4F5A-9C3D-2E1F0A9B8C7D",
+		"0b8d4d6c-7b1e-4f5a-9c3d-2e1f0a9b8c7d0b8d4d6c",
+	} {
+		fm.handleMsgPosition(fusionPosition{Latitude: 42.73, Longitude: -73.68, Track: track})
+	}
+	if len(fm.tracks) != 0 {
+		t.Errorf("got %d tracks from invalid IDs, expected none", len(fm.tracks))
+	}
+
+	fm.handleMsgPosition(fusionPosition{Latitude: 42.73, Longitude: -73.68, Track: "0b8d4d6c-7b1e-4f5a-9c3d-2e1f0a9b8c7d"})
+	if len(fm.tracks["0b8d4d6c-7b1e-4f5a-9c3d-2e1f0a9b8c7d"]) != 1 {
+		t.Errorf("expected the position with a valid ID to be kept")
+	}
+}
@@ -4,13 +4,34 @@ import (
 	"encoding/json"
 	"html/template"
 	"net/http"
+	"time"
 
 	"github.com/wtg/shuttletracker"
 	"github.com/wtg/shuttletracker/log"
 )
 
-// AdminMessageHandler handles the retrieval of the current administrator message
+// AdminMessageHandler handles the retrieval of the current administrator message. It's
+// a view of alerts for older clients: the most important active alert, or the message
+// set through SetAdminMessage if there aren't any.
 func (api *API) AdminMessageHandler(w http.ResponseWriter, r *http.Request) {
+	alerts, err := api.msg.Alerts()
+	if err != nil {
+		log.WithError(err).Error("unable to get alerts")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if active := shuttletracker.ActiveAlerts(alerts, time.Now()); len(active) > 0 {
+		alert := active[0]
+		WriteJSON(w, &shuttletracker.Message{
+			Message: alert.Message,
+			Enabled: true,
+			Created: alert.Created,
+			Updated: alert.Updated,
+			Link:    alert.Link,
+		})
+		return
+	}
+
 	message, err := api.msg.Message()
 	if err != nil {
 		log.WithError(err).Error("unable to get message")
@@ -34,11 +55,24 @@ func (api *API) SetAdminMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	message.Message = template.HTMLEscapeString(message.Message)
+
+	// there's nothing before the first message is set
+	var before json.RawMessage
+	current, err := api.msg.Message()
+	if err == nil {
+		before = snapshot(current)
+	} else if err != shuttletracker.ErrMessageNotFound {
+		log.WithError(err).Error("unable to get message")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	err = api.msg.SetMessage(message)
 	if err != nil {
 		log.WithError(err).Error("unable to update message")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	api.audit(r, "message.set", "message", 0, before, snapshot(message))
+	api.alertsChanged()
 	WriteJSON(w, "Success")
 }
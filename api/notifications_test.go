@@ -1,5 +1,37 @@
 package api
 
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestSetAdminMessageFirst(t *testing.T) {
+	msg := &mock.MessageService{}
+	msg.On("Message").Return((*shuttletracker.Message)(nil), shuttletracker.ErrMessageNotFound)
+	msg.On("SetMessage", tmock.Anything).Return(nil)
+	audits := &mock.AuditService{}
+	audits.On("CreateAuditEntry", tmock.Anything).Return(nil)
+	api := API{msg: msg, audits: audits}
+
+	req := httptest.NewRequest("POST", "/adminMessage", strings.NewReader(`{"message": "Shuttles are running late", "enabled": true}`))
+	w := httptest.NewRecorder()
+	api.SetAdminMessage(w, req)
+	if w.Code != 200 {
+		t.Fatalf("got status %d, expected 200", w.Code)
+	}
+	msg.AssertCalled(t, "SetMessage", tmock.Anything)
+	entry := audits.Calls[0].Arguments.Get(0).(*shuttletracker.AuditEntry)
+	if entry.Before != nil || entry.After == nil {
+		t.Errorf("got before %s and after %s, expected only after", entry.Before, entry.After)
+	}
+}
+
 // TODO: fix these tests
 
 /*
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// memoryRateLimitPruneInterval is how often memoryRateLimitService forgets full buckets.
+const memoryRateLimitPruneInterval = time.Minute
+
+// RateLimit limits requests whose method and path match. Each IP address can make
+// Burst of them at once, then one more every Every.
+type RateLimit struct {
+	// Method is e.g. "POST", or empty to match every method.
+	Method string
+
+	// Path matches itself and everything under it, so "/" matches every path.
+	Path string
+
+	Burst int
+
+	// Every is a duration like "10s".
+	Every string
+}
+
+// name identifies a RateLimit's buckets and statistics.
+func (rl RateLimit) name() string {
+	method := rl.Method
+	if method == "" {
+		method = "*"
+	}
+	return method + " " + rl.Path
+}
+
+func (rl RateLimit) matches(r *http.Request) bool {
+	if rl.Method != "" && !strings.EqualFold(rl.Method, r.Method) {
+		return false
+	}
+	path := strings.TrimSuffix(rl.Path, "/")
+	return r.URL.Path == path || strings.HasPrefix(r.URL.Path, path+"/")
+}
+
+type rateLimitRule struct {
+	RateLimit
+	rate float64
+}
+
+// rateLimitStats counts what happened to requests that a RateLimit matched. Errors are
+// requests that were allowed because the RateLimitService failed.
+type rateLimitStats struct {
+	Allowed uint64 `json:"allowed"`
+	Limited uint64 `json:"limited"`
+	Errors  uint64 `json:"errors"`
+}
+
+// rateLimiter is middleware that responds with 429 Too Many Requests to clients that
+// make too many requests.
+type rateLimiter struct {
+	rules   []rateLimitRule
+	service shuttletracker.RateLimitService
+	proxies trustedProxies
+
+	mu    sync.Mutex
+	stats map[string]*rateLimitStats
+}
+
+func newRateLimiter(limits []RateLimit, service shuttletracker.RateLimitService, proxies trustedProxies) (*rateLimiter, error) {
+	rl := &rateLimiter{
+		service: service,
+		proxies: proxies,
+		stats:   map[string]*rateLimitStats{},
+	}
+	for _, limit := range limits {
+		every, err := time.ParseDuration(limit.Every)
+		if err != nil || every <= 0 {
+			return nil, fmt.Errorf("rate limit %s: invalid interval %q", limit.name(), limit.Every)
+		}
+		if limit.Burst < 1 {
+			return nil, fmt.Errorf("rate limit %s: burst must be at least 1", limit.name())
+		}
+		if !strings.HasPrefix(limit.Path, "/") {
+			return nil, fmt.Errorf("rate limit %s: path must start with /", limit.name())
+		}
+		rl.rules = append(rl.rules, rateLimitRule{RateLimit: limit, rate: float64(time.Second) / float64(every)})
+		rl.stats[limit.name()] = &rateLimitStats{}
+	}
+	return rl, nil
+}
+
+func (rl *rateLimiter) count(name string, f func(*rateLimitStats)) {
+	rl.mu.Lock()
+	f(rl.stats[name])
+	rl.mu.Unlock()
+}
+
+// take takes a token for a request from the bucket of every rule that matches it. If
+// one is empty, it returns how long the client should wait.
+func (rl *rateLimiter) take(r *http.Request, now time.Time) (bool, time.Duration) {
+	ip := rl.proxies.clientIP(r)
+	for _, rule := range rl.rules {
+		if !rule.matches(r) {
+			continue
+		}
+		name := rule.name()
+		ok, wait, err := rl.service.TakeRateLimitToken(name+" "+ip, float64(rule.Burst), rule.rate, now)
+		if err != nil {
+			// better to let people through than to take the site down with the store
+			log.WithError(err).Error("unable to take rate limit token")
+			rl.count(name, func(s *rateLimitStats) { s.Errors++ })
+			continue
+		}
+		if !ok {
+			log.Debugf("rate limiting %s for %s", ip, name)
+			rl.count(name, func(s *rateLimitStats) { s.Limited++ })
+			return false, wait
+		}
+		rl.count(name, func(s *rateLimitStats) { s.Allowed++ })
+	}
+	return true, 0
+}
+
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := rl.take(r, time.Now())
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		seconds := int(math.Ceil(wait.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+			writeAPIError(w, http.StatusTooManyRequests, apiErrorRateLimited, "too many requests; try again in %d seconds", seconds)
+			return
+		}
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	})
+}
+
+// statsHandler writes how many requests each RateLimit has allowed and limited.
+func (rl *rateLimiter) statsHandler(w http.ResponseWriter, r *http.Request) {
+	rl.mu.Lock()
+	stats := make(map[string]rateLimitStats, len(rl.stats))
+	for name, s := range rl.stats {
+		stats[name] = *s
+	}
+	rl.mu.Unlock()
+
+	err := WriteJSON(w, stats)
+	if err != nil {
+		log.WithError(err).Error("unable to write JSON")
+	}
+}
+
+// memoryRateLimitService implements shuttletracker.RateLimitService for a single
+// Shuttle Tracker instance.
+type memoryRateLimitService struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+func newMemoryRateLimitService() *memoryRateLimitService {
+	return &memoryRateLimitService{buckets: map[string]*tokenBucket{}}
+}
+
+func (mrls *memoryRateLimitService) TakeRateLimitToken(key string, burst float64, rate float64, now time.Time) (bool, time.Duration, error) {
+	mrls.mu.Lock()
+	defer mrls.mu.Unlock()
+
+	if now.Sub(mrls.lastPrune) >= memoryRateLimitPruneInterval {
+		for k, tb := range mrls.buckets {
+			if tb.full(now) {
+				delete(mrls.buckets, k)
+			}
+		}
+		mrls.lastPrune = now
+	}
+
+	tb, ok := mrls.buckets[key]
+	if !ok {
+		tb = newTokenBucket(burst, rate, now)
+		mrls.buckets[key] = tb
+	}
+	if tb.take(now) {
+		return true, 0, nil
+	}
+	return false, tb.wait(now), nil
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker/mock"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl, err := newRateLimiter([]RateLimit{
+		{Path: "/", Burst: 5, Every: "1s"},
+		{Method: "POST", Path: "/forms", Burst: 2, Every: "1m"},
+	}, newMemoryRateLimitService(), nil)
+	if err != nil {
+		t.Fatalf("unable to create rate limiter: %s", err)
+	}
+	handler := rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(method, path, ip string) *http.Response {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := request("POST", "/forms", "198.51.100.7"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("got status %d for form %d, expected 200", resp.StatusCode, i)
+		}
+	}
+	resp := request("POST", "/forms", "198.51.100.7")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+		t.Errorf("got status %d and Retry-After %q, expected 429 and 60", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// other routes and other IP addresses have their own buckets
+	if resp := request("GET", "/forms", "198.51.100.7"); resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for GET /forms, expected 200", resp.StatusCode)
+	}
+	if resp := request("POST", "/forms", "198.51.100.8"); resp.StatusCode != http.StatusOK {
+		t.Errorf("got status %d for another IP, expected 200", resp.StatusCode)
+	}
+
+	// every request counts against the catch-all limit
+	request("GET", "/vehicles", "198.51.100.7")
+	resp = request("GET", "/api/v1/routes/", "198.51.100.7")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got status %d and Content-Type %q, expected a JSON 429", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	stats := rl.stats["POST /forms"]
+	if stats.Allowed != 3 || stats.Limited != 1 {
+		t.Errorf("got stats %+v, expected 3 allowed and 1 limited", *stats)
+	}
+}
+
+func TestRateLimiterServiceError(t *testing.T) {
+	rls := &mock.RateLimitService{}
+	rls.On("TakeRateLimitToken", "* / 198.51.100.7", 5.0, 1.0, tmock.AnythingOfType("time.Time")).Return(false, time.Duration(0), errors.New("no database"))
+	rl, err := newRateLimiter([]RateLimit{{Path: "/", Burst: 5, Every: "1s"}}, rls, nil)
+	if err != nil {
+		t.Fatalf("unable to create rate limiter: %s", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	ok, _ := rl.take(req, time.Now())
+	if !ok {
+		t.Errorf("expected requests to be allowed when the service fails")
+	}
+	if rl.stats["* /"].Errors != 1 {
+		t.Errorf("got %d errors, expected 1", rl.stats["* /"].Errors)
+	}
+}
+
+func TestNewRateLimiterInvalid(t *testing.T) {
+	for _, limit := range []RateLimit{
+		{Path: "/", Burst: 5, Every: "soon"},
+		{Path: "/", Burst: 0, Every: "1s"},
+		{Path: "forms", Burst: 5, Every: "1s"},
+	} {
+		_, err := newRateLimiter([]RateLimit{limit}, newMemoryRateLimitService(), nil)
+		if err == nil {
+			t.Errorf("%+v: expected an error", limit)
+		}
+	}
+}
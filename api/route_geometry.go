@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
+)
+
+// routeSnapTolerance is how far in meters a stop can be from its route before "snap"
+// moves it.
+const routeSnapTolerance = 1.0
+
+var errInvalidDensify = errors.New("densify must be a positive number of meters")
+
+// routeGeometryOptions are what route creates and edits do about issues with a route's
+// shape. They come from the query parameters "densify", which adds points so that none
+// are more than that many meters apart, "snap", which moves the stops that only this
+// route uses onto it, and "strict", which fails with the issues that remain instead of
+// warning about them.
+type routeGeometryOptions struct {
+	densify float64
+	snap    bool
+	strict  bool
+}
+
+func parseRouteGeometryOptions(r *http.Request) (routeGeometryOptions, error) {
+	opts := routeGeometryOptions{}
+	var err error
+	if s := r.URL.Query().Get("densify"); s != "" {
+		opts.densify, err = strconv.ParseFloat(s, 64)
+		if err != nil || opts.densify <= 0 {
+			return opts, errInvalidDensify
+		}
+	}
+	opts.snap, err = queryBool(r, "snap")
+	if err != nil {
+		return opts, err
+	}
+	opts.strict, err = queryBool(r, "strict")
+	return opts, err
+}
+
+// routeGeometry is what checking a route found.
+type routeGeometry struct {
+	Issues []geo.RouteIssue `json:"issues"`
+	// SnappedStops were moved onto the route and need to be saved along with it.
+	SnappedStops []*shuttletracker.Stop `json:"snapped_stops"`
+
+	// Snapshots of the SnappedStops from before they moved
+	before []json.RawMessage
+}
+
+// checkRouteGeometry densifies a route's points and snaps its stops onto them if opts
+// say to, and then checks them with geo.CheckRoute. Stops that other routes also stop
+// at aren't snapped, since moving them could take them off of those routes. Stops
+// that don't exist are skipped, since validateRoute reports them.
+func (api *API) checkRouteGeometry(route *shuttletracker.Route, opts routeGeometryOptions) (*routeGeometry, error) {
+	if opts.densify > 0 {
+		route.Points = geo.Densify(route.Points, opts.densify)
+	}
+
+	shared := map[int64]bool{}
+	if opts.snap {
+		routes, err := api.ms.Routes()
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range routes {
+			if other.ID == route.ID {
+				continue
+			}
+			for _, stopID := range other.StopIDs {
+				shared[stopID] = true
+			}
+		}
+	}
+
+	g := &routeGeometry{SnappedStops: []*shuttletracker.Stop{}}
+	stops := []shuttletracker.Point{}
+	// where each stop ends up, since routes can stop at the same stop more than once
+	located := map[int64]shuttletracker.Point{}
+	for _, stopID := range route.StopIDs {
+		if p, ok := located[stopID]; ok {
+			stops = append(stops, p)
+			continue
+		}
+		stop, err := api.ms.Stop(stopID)
+		if err == shuttletracker.ErrStopNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		p := shuttletracker.Point{Latitude: stop.Latitude, Longitude: stop.Longitude}
+		if opts.snap && len(route.Points) > 0 && !shared[stop.ID] {
+			pos := geo.Locate(p, route.Points)
+			if pos.Distance > routeSnapTolerance {
+				g.before = append(g.before, snapshot(stop))
+				p = pos.Point
+				stop.Latitude = p.Latitude
+				stop.Longitude = p.Longitude
+				g.SnappedStops = append(g.SnappedStops, stop)
+			}
+		}
+		located[stopID] = p
+		stops = append(stops, p)
+	}
+	g.Issues = geo.CheckRoute(route.Points, stops, geo.DefaultRouteCheckOptions)
+	return g, nil
+}
+
+// auditSnappedStops records that the stops checkRouteGeometry moved were saved.
+func (api *API) auditSnappedStops(r *http.Request, g *routeGeometry) {
+	for i, stop := range g.SnappedStops {
+		api.audit(r, "stop.modify", "stop", stop.ID, g.before[i], snapshot(stop))
+	}
+}
+
+// setRouteWarnings adds a Warning header for each issue with a route.
+func setRouteWarnings(w http.ResponseWriter, issues []geo.RouteIssue) {
+	for _, issue := range issues {
+		text := strings.Replace(issue.Field+" "+issue.Message, `"`, `'`, -1)
+		w.Header().Add("Warning", `199 - "`+text+`"`)
+	}
+}
+
+func routeIssueFields(issues []geo.RouteIssue) []apiFieldError {
+	fields := []apiFieldError{}
+	for _, issue := range issues {
+		fields = append(fields, apiFieldError{Field: issue.Field, Message: issue.Message})
+	}
+	return fields
+}
+
+// routeValidation is the response of v1RoutesValidateHandler.
+type routeValidation struct {
+	Route *shuttletracker.Route `json:"route"`
+	*routeGeometry
+}
+
+// v1RoutesValidateHandler checks a route without saving it or its stops. It responds
+// with the route, densified if asked to, the stops that would be snapped, and the
+// issues that remain.
+func (api *API) v1RoutesValidateHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseRouteGeometryOptions(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	route := &shuttletracker.Route{Width: 4, Color: "#ffffff"}
+	if !decodeBody(w, r, route) {
+		return
+	}
+	clearDetours(route)
+
+	fields, err := validateRoute(api.ms, route)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate route")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+	g, err := api.checkRouteGeometry(route, opts)
+	if err != nil {
+		writeInternalError(w, err, "unable to check route")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, routeValidation{Route: route, routeGeometry: g})
+}
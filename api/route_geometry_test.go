@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+// geometryModelService has stop 1 on the route in geometryRoute, and stop 2 about 33
+// meters off of it. otherRoutes are the routes that already exist.
+func geometryModelService(otherRoutes ...*shuttletracker.Route) *stmock.ModelService {
+	ms := &stmock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1, Latitude: 42.73, Longitude: -73.679}, nil)
+	ms.StopService.On("Stop", int64(2)).Return(&shuttletracker.Stop{ID: 2, Latitude: 42.731, Longitude: -73.6784}, nil)
+	ms.RouteService.On("Routes").Return(otherRoutes, nil)
+	ms.RouteService.On("CreateRouteWithStops", mock.Anything, mock.Anything, "").Run(func(args mock.Arguments) {
+		args.Get(0).(*shuttletracker.Route).ID = 7
+	}).Return(nil)
+	return ms
+}
+
+// snappedStops returns the stops that the nth call to CreateRouteWithStops saved.
+func snappedStops(ms *stmock.ModelService, n int) []*shuttletracker.Stop {
+	calls := []mock.Call{}
+	for _, call := range ms.RouteService.Calls {
+		if call.Method == "CreateRouteWithStops" {
+			calls = append(calls, call)
+		}
+	}
+	return calls[n].Arguments.Get(1).([]*shuttletracker.Stop)
+}
+
+const geometryRoute = `{"name": "West", "stop_ids": [1, 2], "points": [
+ {"latitude": 42.73, "longitude": -73.68}, {"latitude": 42.73, "longitude": -73.678}, {"latitude": 42.732, "longitude": -73.678}]}`
+
+func TestV1RoutesGeometry(t *testing.T) {
+	ms := geometryModelService()
+	api := &API{ms: ms}
+	req := httptest.NewRequest("POST", "/routes/", strings.NewReader(geometryRoute))
+	w := httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	warnings := w.Header()["Warning"]
+	if w.Code != 201 || len(warnings) != 1 || !strings.Contains(warnings[0], "stop_ids[1] is 33 meters from the route") {
+		t.Errorf("got status %d and warnings %q, expected 201 and stop 2 off the route", w.Code, warnings)
+	}
+	if len(snappedStops(ms, 0)) != 0 {
+		t.Errorf("got snapped stops %+v without snap, expected none", snappedStops(ms, 0))
+	}
+
+	var envelope apiErrorEnvelope
+	status := v1Request(t, api, "POST", "/routes/?strict=true", geometryRoute, &envelope)
+	if status != 422 || len(envelope.Error.Fields) != 1 || envelope.Error.Fields[0].Field != "stop_ids[1]" {
+		t.Errorf("got status %d and fields %+v, expected 422 for stop 2", status, envelope.Error.Fields)
+	}
+	ms.RouteService.AssertNumberOfCalls(t, "CreateRouteWithStops", 1)
+
+	validation := struct {
+		Route        shuttletracker.Route  `json:"route"`
+		SnappedStops []shuttletracker.Stop `json:"snapped_stops"`
+		Issues       []struct {
+			Kind string `json:"kind"`
+		} `json:"issues"`
+	}{}
+	status = v1Request(t, api, "POST", "/routes/validate?snap=true&densify=100", geometryRoute, &validation)
+	if status != 200 || len(validation.Issues) != 0 || len(validation.Route.Points) != 6 {
+		t.Errorf("got status %d, issues %+v, and %d points, expected 200, none, and 6", status, validation.Issues, len(validation.Route.Points))
+	}
+	if len(validation.SnappedStops) != 1 || validation.SnappedStops[0].ID != 2 || validation.SnappedStops[0].Longitude != -73.678 {
+		t.Errorf("got snapped stops %+v, expected stop 2 on the route", validation.SnappedStops)
+	}
+	ms.RouteService.AssertNumberOfCalls(t, "CreateRouteWithStops", 1)
+
+	ms = geometryModelService()
+	api = &API{ms: ms}
+	req = httptest.NewRequest("POST", "/routes/?snap=true&strict=true", strings.NewReader(geometryRoute))
+	w = httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	if w.Code != 201 || len(w.Header()["Warning"]) != 0 {
+		t.Errorf("got status %d and warnings %q, expected 201 and none", w.Code, w.Header()["Warning"])
+	}
+	if stops := snappedStops(ms, 0); len(stops) != 1 || stops[0].ID != 2 {
+		t.Errorf("got snapped stops %+v, expected stop 2 to be saved with the route", stops)
+	}
+
+	for _, query := range []string{"densify=-1", "snap=maybe"} {
+		status = v1Request(t, api, "POST", "/routes/?"+query, geometryRoute, &envelope)
+		if status != 400 || envelope.Error.Code != apiErrorInvalidQuery {
+			t.Errorf("%s: got status %d, expected 400", query, status)
+		}
+	}
+}
+
+func TestV1RoutesGeometrySnapShared(t *testing.T) {
+	// stop 2 is also on another route, so it stays where it is
+	ms := geometryModelService(&shuttletracker.Route{ID: 3, StopIDs: []int64{2}})
+	api := &API{ms: ms}
+	req := httptest.NewRequest("POST", "/routes/?snap=true", strings.NewReader(geometryRoute))
+	w := httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	warnings := w.Header()["Warning"]
+	if w.Code != 201 || len(warnings) != 1 || !strings.Contains(warnings[0], "stop_ids[1]") {
+		t.Errorf("got status %d and warnings %q, expected 201 and stop 2 off the route", w.Code, warnings)
+	}
+	if stops := snappedStops(ms, 0); len(stops) != 0 {
+		t.Errorf("got snapped stops %+v, expected none", stops)
+	}
+}
+
+func TestV1RoutesGeometrySnapRepeated(t *testing.T) {
+	// stop 2 is visited twice, and both visits should be checked where it was snapped
+	// to, even though the stored stop hasn't moved yet
+	ms := &stmock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1, Latitude: 42.73, Longitude: -73.679}, nil)
+	stop := &shuttletracker.Stop{ID: 2}
+	ms.StopService.On("Stop", int64(2)).Run(func(args mock.Arguments) {
+		stop.Latitude, stop.Longitude = 42.731, -73.6784
+	}).Return(stop, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{}, nil)
+	ms.RouteService.On("CreateRouteWithStops", mock.Anything, mock.Anything, "").Return(nil)
+	api := &API{ms: ms}
+	body := `{"name": "West", "stop_ids": [1, 2, 2], "points": [
+ {"latitude": 42.73, "longitude": -73.68}, {"latitude": 42.73, "longitude": -73.678}, {"latitude": 42.732, "longitude": -73.678}]}`
+	req := httptest.NewRequest("POST", "/routes/?snap=true&strict=true", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	if w.Code != 201 {
+		t.Errorf("got status %d and body %s, expected 201", w.Code, w.Body)
+	}
+	if stops := snappedStops(ms, 0); len(stops) != 1 || stops[0].ID != 2 {
+		t.Errorf("got snapped stops %+v, expected stop 2 once", stops)
+	}
+}
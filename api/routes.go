@@ -2,8 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/wtg/shuttletracker"
 	"github.com/wtg/shuttletracker/log"
@@ -17,7 +20,7 @@ func (api *API) ETAHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// RoutesHandler finds all of the routes in the database
+// RoutesHandler finds all of the routes in the database, with their active detours
 func (api *API) RoutesHandler(w http.ResponseWriter, r *http.Request) {
 	routes, err := api.ms.Routes()
 	if err != nil {
@@ -25,6 +28,12 @@ func (api *API) RoutesHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	routes, err = api.detourRoutes(routes)
+	if err != nil {
+		log.WithError(err).Error("unable to get detours")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	WriteJSON(w, routes)
 }
 
@@ -39,21 +48,58 @@ func (api *API) StopsHandler(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, stops)
 }
 
-// RoutesCreateHandler adds a new route to the database
+// RoutesCreateHandler adds a new route to the database. Issues with its shape are
+// handled like v1RoutesCreateHandler's.
 func (api *API) RoutesCreateHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseRouteGeometryOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	route := &shuttletracker.Route{}
-	err := json.NewDecoder(r.Body).Decode(route)
+	err = json.NewDecoder(r.Body).Decode(route)
 	if err != nil {
 		log.WithError(err).Error("unable to decode route")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	clearDetours(route)
 
-	err = api.ms.CreateRoute(route)
+	g, ok := api.checkRouteGeometryLegacy(w, route, opts)
+	if !ok {
+		return
+	}
+
+	err = api.ms.CreateRouteWithStops(route, g.SnappedStops, api.username(r))
 	if err != nil {
 		log.WithError(err).Error("unable to create route")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.audit(r, "route.create", "route", route.ID, nil, snapshot(route))
+	api.auditSnappedStops(r, g)
+	setRouteWarnings(w, g.Issues)
+}
+
+// checkRouteGeometryLegacy is checkRouteGeometry for the older endpoints, which
+// respond with plain text errors. It writes an error and returns false if the route
+// can't be saved.
+func (api *API) checkRouteGeometryLegacy(w http.ResponseWriter, route *shuttletracker.Route, opts routeGeometryOptions) (*routeGeometry, bool) {
+	g, err := api.checkRouteGeometry(route, opts)
+	if err != nil {
+		log.WithError(err).Error("unable to check route")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
 	}
+	if opts.strict && len(g.Issues) > 0 {
+		msgs := make([]string, len(g.Issues))
+		for i, issue := range g.Issues {
+			msgs[i] = issue.Field + " " + issue.Message
+		}
+		http.Error(w, strings.Join(msgs, "; "), http.StatusUnprocessableEntity)
+		return nil, false
+	}
+	return g, true
 }
 
 // RoutesDeleteHandler deletes a route from database
@@ -64,39 +110,103 @@ func (api *API) RoutesDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = api.ms.DeleteRoute(id)
+	route, err := api.ms.Route(id)
+	if err == shuttletracker.ErrRouteNotFound {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get route")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = api.ms.DeleteRoute(id, api.username(r))
 	if err != nil {
 		if err == shuttletracker.ErrRouteNotFound {
 			http.Error(w, "Route not found", http.StatusNotFound)
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		return
 	}
+	api.audit(r, "route.delete", "route", id, snapshot(route), nil)
 }
 
-// RoutesEditHandler Only handles editing enabled flag for now
+// RoutesEditHandler modifies a route, including its points and stops. Fields that
+// aren't in the request body keep their current values. If the body has the time
+// the route was last updated and the route has changed since, nothing is modified
+// and it responds with 409 Conflict. Issues with its shape are handled like
+// v1RoutesCreateHandler's.
 func (api *API) RoutesEditHandler(w http.ResponseWriter, r *http.Request) {
-	route := &shuttletracker.Route{}
-	err := json.NewDecoder(r.Body).Decode(route)
+	opts, err := parseRouteGeometryOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.WithError(err).Error("Unable to decode route")
+		log.WithError(err).Error("unable to read request body")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	en := route.Enabled
-	sched := route.Schedule
-	route, err = api.ms.Route(route.ID)
-	route.Enabled = en
-	route.Schedule = sched
+	ref := struct {
+		ID int64 `json:"id"`
+	}{}
+	err = json.Unmarshal(body, &ref)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	route, err := api.ms.Route(ref.ID)
+	if err == shuttletracker.ErrRouteNotFound {
+		http.Error(w, "Route not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get route")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = api.ms.ModifyRoute(route)
+	before := snapshot(route)
+	err = json.Unmarshal(body, route)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clearDetours(route)
+
+	fields, err := validateRoute(api.ms, route)
+	if err != nil {
+		log.WithError(err).Error("unable to validate route")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(fields) > 0 {
+		msgs := make([]string, len(fields))
+		for i, field := range fields {
+			msgs[i] = field.Field + " " + field.Message
+		}
+		http.Error(w, strings.Join(msgs, "; "), http.StatusUnprocessableEntity)
+		return
+	}
+	g, ok := api.checkRouteGeometryLegacy(w, route, opts)
+	if !ok {
+		return
+	}
+
+	err = api.ms.ModifyRouteWithStops(route, g.SnappedStops, api.username(r))
+	if err == shuttletracker.ErrRouteModified {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to modify route")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	api.audit(r, "route.modify", "route", route.ID, before, snapshot(route))
+	api.auditSnappedStops(r, g)
+	setRouteWarnings(w, g.Issues)
+	WriteJSON(w, route)
 }
 
 // StopsCreateHandler adds a new route stop to the database
@@ -111,32 +221,118 @@ func (api *API) StopsCreateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if stop.ID < 0 {
-		err = api.ms.CreateStop(stop)
+		err = api.ms.CreateStop(stop, api.username(r))
 	} else {
-		err = api.ms.CreateStopWithID(stop)
+		err = api.ms.CreateStopWithID(stop, api.username(r))
 	}
 	if err != nil {
 		log.WithError(err).Error("unable to create stop")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	api.audit(r, "stop.create", "stop", stop.ID, nil, snapshot(stop))
 	WriteJSON(w, stop)
 }
 
+// StopsEditHandler modifies a stop's name, description, or location. Fields that
+// aren't in the request body keep their current values.
+func (api *API) StopsEditHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.WithError(err).Error("unable to read request body")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ref := struct {
+		ID int64 `json:"id"`
+	}{}
+	err = json.Unmarshal(body, &ref)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stop, err := api.ms.Stop(ref.ID)
+	if err == shuttletracker.ErrStopNotFound {
+		http.Error(w, "Stop not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get stop")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	before := snapshot(stop)
+	err = json.Unmarshal(body, stop)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stop.ID = ref.ID
+
+	if fields := validateStop(stop); len(fields) > 0 {
+		http.Error(w, fields[0].Field+" "+fields[0].Message, http.StatusUnprocessableEntity)
+		return
+	}
+
+	err = api.ms.ModifyStop(stop, api.username(r))
+	if err != nil {
+		log.WithError(err).Error("unable to modify stop")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	api.audit(r, "stop.modify", "stop", stop.ID, before, snapshot(stop))
+	WriteJSON(w, stop)
+}
+
+// StopsDeleteHandler deletes a stop. If routes stop at it, it responds with 409
+// Conflict unless the "detach" query parameter is true, in which case the stop is
+// also removed from those routes.
 func (api *API) StopsDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = api.ms.DeleteStop(id)
+	detach, err := queryBool(r, "detach")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stop, err := api.ms.Stop(id)
+	if err == shuttletracker.ErrStopNotFound {
+		http.Error(w, "Stop not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get stop")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = api.ms.DeleteStop(id, detach, api.username(r))
 	if err != nil {
 		if err == shuttletracker.ErrStopNotFound {
 			http.Error(w, "Stop not found", http.StatusNotFound)
+		} else if _, ok := err.(*shuttletracker.StopInUseError); ok {
+			http.Error(w, err.Error(), http.StatusConflict)
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		return
+	}
+	api.audit(r, "stop.delete", "stop", id, snapshot(stop), nil)
+}
+
+// queryBool returns the value of a boolean query parameter, or false if it's missing.
+func queryBool(r *http.Request, key string) (bool, error) {
+	s := r.URL.Query().Get(key)
+	if s == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", key)
 	}
+	return b, nil
 }
 
 // func (api *API) UnmarshalJSON(data []byte) error
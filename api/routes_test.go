@@ -1,3 +1,98 @@
 package api
 
-import ()
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestRoutesEditHandler(t *testing.T) {
+	ms := &stmock.ModelService{}
+	existing := &shuttletracker.Route{
+		ID:      3,
+		Name:    "West",
+		Color:   "#00ff00",
+		Width:   4,
+		StopIDs: []int64{1},
+		Points:  []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.68}},
+	}
+	ms.RouteService.On("Route", int64(3)).Return(existing, nil)
+	ms.StopService.On("Stop", mock.Anything).Return(&shuttletracker.Stop{}, nil)
+	ms.DetourService.On("Detours").Return([]*shuttletracker.Detour{}, nil)
+	ms.RouteService.On("ModifyRouteWithStops", existing, mock.Anything, "").Return(nil).Once()
+	api := API{ms: ms}
+
+	body := `{"id": 3, "name": "West Loop", "stop_ids": [2, 1], "points": [{"latitude": 42.73, "longitude": -73.68}, {"latitude": 42.74, "longitude": -73.67}]}`
+	req := httptest.NewRequest("POST", "/routes/edit", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	api.RoutesEditHandler(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Fatalf("got status code %d, expected 200", resp.StatusCode)
+	}
+
+	route := shuttletracker.Route{}
+	err := json.NewDecoder(resp.Body).Decode(&route)
+	if err != nil {
+		t.Fatalf("unable to decode route: %s", err)
+	}
+	if route.Name != "West Loop" || route.Color != "#00ff00" || len(route.Points) != 2 ||
+		len(route.StopIDs) != 2 || route.StopIDs[0] != 2 {
+		t.Errorf("unexpected route %+v", route)
+	}
+	ms.RouteService.AssertExpectations(t)
+
+	ms.RouteService.On("ModifyRouteWithStops", existing, mock.Anything, "").Return(shuttletracker.ErrRouteModified).Once()
+	req = httptest.NewRequest("POST", "/routes/edit", strings.NewReader(`{"id": 3, "enabled": true}`))
+	w = httptest.NewRecorder()
+	api.RoutesEditHandler(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("got status code %d, expected 409", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/routes/edit", strings.NewReader(`{"id": 3, "color": "green"}`))
+	w = httptest.NewRecorder()
+	api.RoutesEditHandler(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status code %d, expected 422", w.Code)
+	}
+	ms.RouteService.AssertNumberOfCalls(t, "ModifyRouteWithStops", 2)
+}
+
+func TestStopsEditHandler(t *testing.T) {
+	ms := &stmock.ModelService{}
+	name := "Union"
+	ms.StopService.On("Stop", int64(2)).Return(&shuttletracker.Stop{ID: 2, Name: &name, Latitude: 42.73, Longitude: -73.68}, nil)
+	ms.StopService.On("ModifyStop", mock.Anything, "").Return(nil)
+	api := API{ms: ms}
+
+	req := httptest.NewRequest("POST", "/stops/edit", strings.NewReader(`{"id": 2, "latitude": 42.74}`))
+	w := httptest.NewRecorder()
+	api.StopsEditHandler(w, req)
+	if w.Code != 200 {
+		t.Fatalf("got status code %d, expected 200", w.Code)
+	}
+	stop := shuttletracker.Stop{}
+	err := json.NewDecoder(w.Body).Decode(&stop)
+	if err != nil {
+		t.Fatalf("unable to decode stop: %s", err)
+	}
+	if stop.Name == nil || *stop.Name != "Union" || stop.Latitude != 42.74 || stop.Longitude != -73.68 {
+		t.Errorf("unexpected stop %+v", stop)
+	}
+
+	req = httptest.NewRequest("POST", "/stops/edit", strings.NewReader(`{"id": 2, "longitude": 200}`))
+	w = httptest.NewRecorder()
+	api.StopsEditHandler(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status code %d, expected 422", w.Code)
+	}
+	ms.StopService.AssertNumberOfCalls(t, "ModifyStop", 1)
+}
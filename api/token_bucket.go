@@ -0,0 +1,91 @@
+package api
+
+import (
+	"math"
+	"time"
+)
+
+// tokenBucket allows bursts of up to capacity events, refilling at rate tokens per second.
+type tokenBucket struct {
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity float64, rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity: capacity,
+		rate:     rate,
+		tokens:   capacity,
+		last:     now,
+	}
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens = math.Min(tb.capacity, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+		tb.last = now
+	}
+}
+
+// take removes a token from the bucket if one is available and reports whether it did.
+func (tb *tokenBucket) take(now time.Time) bool {
+	tb.refill(now)
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// wait returns how long until a token is available.
+func (tb *tokenBucket) wait(now time.Time) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled completely, meaning that it is no
+// different from a new bucket.
+func (tb *tokenBucket) full(now time.Time) bool {
+	tb.refill(now)
+	return tb.tokens >= tb.capacity
+}
+
+// tokenBuckets keeps a tokenBucket for each key, such as a client ID or IP address.
+// It is not safe for concurrent use.
+type tokenBuckets struct {
+	capacity float64
+	rate     float64
+	buckets  map[string]*tokenBucket
+}
+
+func newTokenBuckets(capacity float64, rate float64) *tokenBuckets {
+	return &tokenBuckets{
+		capacity: capacity,
+		rate:     rate,
+		buckets:  map[string]*tokenBucket{},
+	}
+}
+
+// take removes a token from key's bucket if one is available and reports whether it did.
+func (tbs *tokenBuckets) take(key string, now time.Time) bool {
+	tb, ok := tbs.buckets[key]
+	if !ok {
+		tb = newTokenBucket(tbs.capacity, tbs.rate, now)
+		tbs.buckets[key] = tb
+	}
+	return tb.take(now)
+}
+
+// prune forgets buckets that have refilled so that they don't pile up.
+func (tbs *tokenBuckets) prune(now time.Time) {
+	for key, tb := range tbs.buckets {
+		if tb.full(now) {
+			delete(tbs.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := newTokenBucket(3, 0.5, now)
+
+	for i := 0; i < 3; i++ {
+		if !tb.take(now) {
+			t.Fatalf("unable to take token %d from a full bucket", i)
+		}
+	}
+	if tb.take(now) {
+		t.Errorf("took a token from an empty bucket")
+	}
+
+	// one token every two seconds
+	if tb.take(now.Add(time.Second)) {
+		t.Errorf("took a token before it refilled")
+	}
+	if !tb.take(now.Add(2 * time.Second)) {
+		t.Errorf("unable to take a refilled token")
+	}
+
+	if tb.full(now.Add(5 * time.Second)) {
+		t.Errorf("bucket is full too soon")
+	}
+	if !tb.full(now.Add(time.Minute)) {
+		t.Errorf("bucket didn't fill back up")
+	}
+	if tb.tokens > 3 {
+		t.Errorf("got %f tokens, which is more than the capacity", tb.tokens)
+	}
+}
+
+func TestTokenBucketsPrune(t *testing.T) {
+	now := time.Now()
+	tbs := newTokenBuckets(1, 1)
+	if !tbs.take("a", now) || !tbs.take("b", now) {
+		t.Fatalf("unable to take tokens from new buckets")
+	}
+	if tbs.take("a", now) {
+		t.Errorf("took a token from an empty bucket")
+	}
+
+	tbs.prune(now)
+	if len(tbs.buckets) != 2 {
+		t.Errorf("pruned buckets that aren't full")
+	}
+	tbs.prune(now.Add(time.Second))
+	if len(tbs.buckets) != 0 {
+		t.Errorf("got %d buckets after pruning, expected 0", len(tbs.buckets))
+	}
+}
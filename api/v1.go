@@ -0,0 +1,277 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Codes sent to clients in apiError.
+const (
+	apiErrorInvalidID        = "invalid_id"
+	apiErrorInvalidBody      = "invalid_body"
+	apiErrorInvalidQuery     = "invalid_query"
+	apiErrorNotFound         = "not_found"
+	apiErrorMethodNotAllowed = "method_not_allowed"
+	apiErrorConflict         = "conflict"
+	apiErrorValidation       = "validation_failed"
+	apiErrorRateLimited      = "rate_limited"
+	apiErrorInternal         = "internal_error"
+	apiErrorUnauthorized     = "unauthorized"
+	apiErrorForbidden        = "forbidden"
+)
+
+// apiError is the body of every error response from the versioned API.
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Fields explains which fields of a request body failed validation.
+	Fields []apiFieldError `json:"fields,omitempty"`
+
+	// Details has more information about some errors, e.g. the routes that a stop is on.
+	Details interface{} `json:"details,omitempty"`
+}
+
+type apiFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type apiErrorEnvelope struct {
+	Error apiError `json:"error"`
+}
+
+// writeJSONStatus is like WriteJSON, but it also sets the status code.
+func writeJSONStatus(w http.ResponseWriter, status int, data interface{}) {
+	b, err := json.MarshalIndent(data, "", " ")
+	if err != nil {
+		log.WithError(err).Error("unable to marshal JSON")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	if err != nil {
+		log.WithError(err).Error("unable to write JSON")
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code string, format string, a ...interface{}) {
+	writeJSONStatus(w, status, apiErrorEnvelope{Error: apiError{Code: code, Message: fmt.Sprintf(format, a...)}})
+}
+
+// writeAuthAPIError is an authErrorWriter for the versioned API.
+func writeAuthAPIError(w http.ResponseWriter, status int, code string, msg string) {
+	writeAPIError(w, status, code, "%s", msg)
+}
+
+// writeInternalError logs an unexpected error and tells the client that something went wrong.
+func writeInternalError(w http.ResponseWriter, err error, msg string) {
+	log.WithError(err).Error(msg)
+	writeAPIError(w, http.StatusInternalServerError, apiErrorInternal, "%s", err)
+}
+
+func writeValidationErrors(w http.ResponseWriter, fields []apiFieldError) {
+	writeJSONStatus(w, http.StatusUnprocessableEntity, apiErrorEnvelope{Error: apiError{
+		Code:    apiErrorValidation,
+		Message: "request body failed validation",
+		Fields:  fields,
+	}})
+}
+
+// urlID returns the "id" URL parameter. If it isn't valid, it writes an error and
+// returns false.
+func urlID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	s := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidID, "invalid ID %q", s)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeBody decodes a JSON request body onto v. If it can't, it writes an error and
+// returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidBody, "unable to decode request body: %s", err)
+		return false
+	}
+	return true
+}
+
+// v1Router serves version 1 of the REST API, which is mounted at /api/v1. Unlike the
+// older endpoints, it uses resource paths (e.g. /routes/4), answers errors with an
+// apiErrorEnvelope, and responds to creates and edits with the resulting resource. It
+// picks which of its routes use etag.
+//
+// The requireRole parameter returns middleware that only allows Users with at least a
+// role, and API tokens with a scope.
+func (api *API) v1Router(requireRole func(role, scope string) func(http.Handler) http.Handler) http.Handler {
+	r := chi.NewRouter()
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "no such endpoint")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, apiErrorMethodNotAllowed, "method %s is not allowed", r.Method)
+	})
+
+	// Locations can be streamed, which etag would buffer, so it isn't used for them.
+	r.Get("/locations", api.v1LocationsHandler)
+
+	r.Route("/routes", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/", api.v1RoutesHandler)
+		r.Get("/{id}", api.v1RouteHandler)
+		r.Get("/{id}/schedule", api.v1RouteScheduleHandler)
+		r.Get("/timetable.ics", api.v1TimetablesICalHandler)
+		r.Get("/{id}/timetable", api.v1RouteTimetableHandler)
+		r.Get("/{id}/timetable.ics", api.v1RouteTimetableICalHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeRead))
+			r.Get("/{id}/revisions", api.revisionsHandler(shuttletracker.RevisionKindRoute))
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+			r.Post("/", api.v1RoutesCreateHandler)
+			r.Post("/validate", api.v1RoutesValidateHandler)
+			r.Post("/import", api.v1RoutesImportHandler)
+			r.Patch("/{id}", api.v1RoutesEditHandler)
+			r.Delete("/{id}", api.v1RoutesDeleteHandler)
+		})
+	})
+
+	r.Route("/stops", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/", api.v1StopsHandler)
+		r.Get("/{id}", api.v1StopHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeRead))
+			r.Get("/{id}/revisions", api.revisionsHandler(shuttletracker.RevisionKindStop))
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+			r.Post("/", api.v1StopsCreateHandler)
+			r.Patch("/{id}", api.v1StopsEditHandler)
+			r.Delete("/{id}", api.v1StopsDeleteHandler)
+		})
+	})
+
+	// Alerts tell riders about detours, delays, and closures. /adminMessage shows
+	// older clients the most important one.
+	r.Route("/alerts", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/", api.v1AlertsHandler)
+		r.Get("/{id}", api.v1AlertHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeMessages))
+			r.Post("/", api.v1AlertsCreateHandler)
+			r.Patch("/{id}", api.v1AlertsEditHandler)
+			r.Delete("/{id}", api.v1AlertsDeleteHandler)
+		})
+	})
+
+	// Service calendars and schedule exceptions change when routes run on some dates.
+	r.Route("/calendars", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/", api.v1CalendarsHandler)
+		r.Get("/{id}", api.v1CalendarHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+			r.Post("/", api.v1CalendarsCreateHandler)
+			r.Patch("/{id}", api.v1CalendarsEditHandler)
+			r.Delete("/{id}", api.v1CalendarsDeleteHandler)
+		})
+	})
+	r.Route("/schedule-exceptions", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/", api.v1ScheduleExceptionsHandler)
+		r.Get("/{id}", api.v1ScheduleExceptionHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+			r.Post("/", api.v1ScheduleExceptionsCreateHandler)
+			r.Patch("/{id}", api.v1ScheduleExceptionsEditHandler)
+			r.Delete("/{id}", api.v1ScheduleExceptionsDeleteHandler)
+		})
+	})
+
+	// Detours reroute part of a route and close some of its stops for a while.
+	r.Route("/detours", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/", api.v1DetoursHandler)
+		r.Get("/{id}", api.v1DetourHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeRoutes))
+			r.Post("/", api.v1DetoursCreateHandler)
+			r.Patch("/{id}", api.v1DetoursEditHandler)
+			r.Delete("/{id}", api.v1DetoursDeleteHandler)
+		})
+	})
+
+	// Revisions of routes and stops
+	r.Route("/revisions", func(r chi.Router) {
+		r.Use(etag)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleViewer, shuttletracker.ScopeRead))
+			r.Get("/diff", api.v1RevisionsDiffHandler)
+			r.Get("/{id}", api.v1RevisionHandler)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleEditor, shuttletracker.ScopeRoutes))
+			r.Post("/{id}/restore", api.v1RevisionsRestoreHandler)
+		})
+	})
+
+	r.Route("/vehicles", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/", api.v1VehiclesHandler)
+		r.Get("/{id}", api.v1VehicleHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(requireRole(shuttletracker.RoleDispatcher, shuttletracker.ScopeVehicles))
+			r.Post("/", api.v1VehiclesCreateHandler)
+			r.Patch("/{id}", api.v1VehiclesEditHandler)
+			r.Delete("/{id}", api.v1VehiclesDeleteHandler)
+		})
+	})
+
+	// Exports for GIS tools, in a format picked by extension (e.g. /routes.kml) or Accept
+	r.Route("/export", func(r chi.Router) {
+		r.Use(etag)
+		r.Get("/routes", api.v1ExportRoutesHandler)
+		r.Get("/routes.{format}", api.v1ExportRoutesHandler)
+		r.Get("/stops", api.v1ExportStopsHandler)
+		r.Get("/stops.{format}", api.v1ExportStopsHandler)
+		r.Get("/vehicles/{id}/track", api.v1ExportTrackHandler)
+		r.Get("/vehicles/{id}/track.{format}", api.v1ExportTrackHandler)
+	})
+
+	r.Route("/users", func(r chi.Router) {
+		r.Use(etag)
+		r.Use(requireRole(shuttletracker.RoleOwner, shuttletracker.ScopeUsers))
+		r.Get("/", api.v1UsersHandler)
+		r.Post("/", api.v1UsersCreateHandler)
+		r.Patch("/{username}", api.v1UsersEditHandler)
+		r.Delete("/{username}", api.v1UsersDeleteHandler)
+	})
+
+	// API tokens can't be used to make more of themselves.
+	r.Route("/tokens", func(r chi.Router) {
+		r.Use(etag)
+		r.Use(requireRole(shuttletracker.RoleOwner, ""))
+		r.Get("/", api.v1TokensHandler)
+		r.Post("/", api.v1TokensCreateHandler)
+		r.Delete("/{id}", api.v1TokensDeleteHandler)
+	})
+
+	return r
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Alerts can be longer than the old admin message, but they still need to fit on a
+// phone.
+const maxAlertLength = 1000
+
+// validateAlert checks an Alert. The routes and stops it affects are checked against
+// the ModelService.
+func (api *API) validateAlert(alert *shuttletracker.Alert) ([]apiFieldError, error) {
+	fields := []apiFieldError{}
+	if alert.Message == "" {
+		fields = append(fields, apiFieldError{Field: "message", Message: "is required"})
+	} else if len(alert.Message) > maxAlertLength {
+		fields = append(fields, apiFieldError{Field: "message", Message: fmt.Sprintf("must be at most %d characters", maxAlertLength)})
+	}
+	if shuttletracker.SeverityRank(alert.Severity) < 0 {
+		fields = append(fields, apiFieldError{Field: "severity", Message: `must be "info", "warning", or "severe"`})
+	}
+	if alert.Link != "" {
+		u, err := url.Parse(alert.Link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fields = append(fields, apiFieldError{Field: "link", Message: "must be an http or https URL"})
+		}
+	}
+	if alert.Start != nil && alert.End != nil && !alert.End.After(*alert.Start) {
+		fields = append(fields, apiFieldError{Field: "end", Message: "must be after start"})
+	}
+
+	for i, id := range alert.RouteIDs {
+		_, err := api.ms.Route(id)
+		if err == shuttletracker.ErrRouteNotFound {
+			fields = append(fields, apiFieldError{Field: fmt.Sprintf("route_ids[%d]", i), Message: fmt.Sprintf("route %d does not exist", id)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	for i, id := range alert.StopIDs {
+		_, err := api.ms.Stop(id)
+		if err == shuttletracker.ErrStopNotFound {
+			fields = append(fields, apiFieldError{Field: fmt.Sprintf("stop_ids[%d]", i), Message: fmt.Sprintf("stop %d does not exist", id)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// alertsChanged pushes out changes to alerts to Fusion clients.
+func (api *API) alertsChanged() {
+	if api.fm != nil {
+		api.fm.refreshAlerts()
+	}
+}
+
+// v1AlertsHandler gets all alerts, or only the ones that are active now if the
+// "active" query parameter is true.
+func (api *API) v1AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	active, err := queryBool(r, "active")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	alerts, err := api.msg.Alerts()
+	if err != nil {
+		writeInternalError(w, err, "unable to get alerts")
+		return
+	}
+	if active {
+		alerts = shuttletracker.ActiveAlerts(alerts, time.Now())
+	}
+	writeJSONStatus(w, http.StatusOK, alerts)
+}
+
+func (api *API) v1AlertHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	alert, err := api.msg.Alert(id)
+	if err == shuttletracker.ErrAlertNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "alert %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get alert")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, alert)
+}
+
+// v1AlertsCreateHandler creates an alert and responds with it. Like the old admin
+// message, its message is HTML-escaped since clients show it as HTML.
+func (api *API) v1AlertsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	alert := &shuttletracker.Alert{Severity: shuttletracker.SeverityInfo, Enabled: true}
+	if !decodeBody(w, r, alert) {
+		return
+	}
+	alert.ID = 0
+
+	fields, err := api.validateAlert(alert)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate alert")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+	alert.Message = template.HTMLEscapeString(alert.Message)
+
+	err = api.msg.CreateAlert(alert)
+	if err != nil {
+		writeInternalError(w, err, "unable to create alert")
+		return
+	}
+	api.audit(r, "alert.create", "alert", alert.ID, nil, snapshot(alert))
+	api.alertsChanged()
+	writeJSONStatus(w, http.StatusCreated, alert)
+}
+
+// v1AlertsEditHandler changes the fields of an alert that are in the request body and
+// responds with the alert.
+func (api *API) v1AlertsEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	alert, err := api.msg.Alert(id)
+	if err == shuttletracker.ErrAlertNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "alert %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get alert")
+		return
+	}
+	before := snapshot(alert)
+
+	// Unescape the message so that it isn't escaped twice if the body leaves it out.
+	alert.Message = html.UnescapeString(alert.Message)
+	if !decodeBody(w, r, alert) {
+		return
+	}
+	alert.ID = id
+
+	fields, err := api.validateAlert(alert)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate alert")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+	alert.Message = template.HTMLEscapeString(alert.Message)
+
+	err = api.msg.ModifyAlert(alert)
+	if err == shuttletracker.ErrAlertNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "alert %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to modify alert")
+		return
+	}
+	api.audit(r, "alert.modify", "alert", id, before, snapshot(alert))
+	api.alertsChanged()
+	writeJSONStatus(w, http.StatusOK, alert)
+}
+
+func (api *API) v1AlertsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	alert, err := api.msg.Alert(id)
+	if err == shuttletracker.ErrAlertNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "alert %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get alert")
+		return
+	}
+
+	err = api.msg.DeleteAlert(id)
+	if err == shuttletracker.ErrAlertNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "alert %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete alert")
+		return
+	}
+	api.audit(r, "alert.delete", "alert", id, snapshot(alert), nil)
+	api.alertsChanged()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestV1AlertsCreate(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Route", int64(1)).Return(&shuttletracker.Route{ID: 1}, nil)
+	ms.StopService.On("Stop", int64(7)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	msg := &stmock.MessageService{}
+	msg.On("CreateAlert", mock.Anything).Return(nil)
+	api := &API{ms: ms, msg: msg}
+
+	for _, c := range []struct {
+		body   string
+		fields []string
+	}{
+		{`{"severity": "apocalyptic", "link": "javascript:alert(1)"}`, []string{"message", "severity", "link"}},
+		{`{"message": "Detour", "start": "2019-12-02T10:00:00Z", "end": "2019-12-02T09:00:00Z"}`, []string{"end"}},
+		{`{"message": "Detour", "route_ids": [1], "stop_ids": [7]}`, []string{"stop_ids[0]"}},
+	} {
+		var envelope apiErrorEnvelope
+		status := v1Request(t, api, "POST", "/alerts/", c.body, &envelope)
+		fields := []string{}
+		for _, f := range envelope.Error.Fields {
+			fields = append(fields, f.Field)
+		}
+		if status != 422 || len(fields) != len(c.fields) {
+			t.Errorf("%s: got status %d and fields %v, expected 422 and %v", c.body, status, fields, c.fields)
+			continue
+		}
+		for i := range fields {
+			if fields[i] != c.fields[i] {
+				t.Errorf("%s: got fields %v, expected %v", c.body, fields, c.fields)
+				break
+			}
+		}
+	}
+	msg.AssertNotCalled(t, "CreateAlert", mock.Anything)
+
+	alert := shuttletracker.Alert{}
+	status := v1Request(t, api, "POST", "/alerts/", `{"message": "Sage & 15th closed", "route_ids": [1]}`, &alert)
+	if status != 201 || alert.Severity != shuttletracker.SeverityInfo || !alert.Enabled || alert.Message != "Sage &amp; 15th closed" {
+		t.Errorf("got status %d and alert %+v, expected 201 and an escaped, enabled info alert", status, alert)
+	}
+}
+
+func TestV1AlertsEdit(t *testing.T) {
+	msg := &stmock.MessageService{}
+	msg.On("Alert", int64(1)).Return(&shuttletracker.Alert{ID: 1, Message: "Sage &amp; 15th closed", Severity: shuttletracker.SeverityInfo, Enabled: true}, nil)
+	msg.On("ModifyAlert", mock.Anything).Return(nil)
+	api := &API{ms: &stmock.ModelService{}, msg: msg}
+
+	// The message stays escaped once when it isn't changed.
+	alert := shuttletracker.Alert{}
+	status := v1Request(t, api, "PATCH", "/alerts/1", `{"severity": "severe"}`, &alert)
+	if status != 200 || alert.Severity != shuttletracker.SeveritySevere || alert.Message != "Sage &amp; 15th closed" {
+		t.Errorf("got status %d and alert %+v", status, alert)
+	}
+}
+
+func TestAdminMessageCompatibility(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour)
+	msg := &stmock.MessageService{}
+	msg.On("Message").Return(&shuttletracker.Message{Message: "Old news", Enabled: false}, nil)
+	api := &API{msg: msg}
+
+	get := func() shuttletracker.Message {
+		w := httptest.NewRecorder()
+		api.AdminMessageHandler(w, httptest.NewRequest("GET", "/adminMessage", nil))
+		message := shuttletracker.Message{}
+		if err := json.NewDecoder(w.Body).Decode(&message); err != nil {
+			t.Fatalf("unable to decode message: %s", err)
+		}
+		return message
+	}
+
+	// Without active alerts, it's the message that was set.
+	msg.On("Alerts").Return([]*shuttletracker.Alert{
+		{ID: 1, Message: "Expired", Severity: shuttletracker.SeveritySevere, Enabled: true, End: &hourAgo},
+	}, nil).Once()
+	if m := get(); m.Message != "Old news" || m.Enabled {
+		t.Errorf("got message %+v, expected the disabled old message", m)
+	}
+
+	// Otherwise, it's the most severe active alert.
+	msg.On("Alerts").Return([]*shuttletracker.Alert{
+		{ID: 2, Message: "Snow day", Severity: shuttletracker.SeverityInfo, Enabled: true},
+		{ID: 3, Message: "Detour", Severity: shuttletracker.SeverityWarning, Enabled: true, Start: &hourAgo, Link: "https://example.com"},
+	}, nil).Once()
+	if m := get(); m.Message != "Detour" || !m.Enabled || m.Link != "https://example.com" {
+		t.Errorf("got message %+v, expected the detour", m)
+	}
+}
+
+func TestFusionAlerts(t *testing.T) {
+	fm := &fusionManager{
+		clients:       map[string]*fusionClient{},
+		subscriptions: map[string][]string{},
+	}
+	transport := &testTransport{}
+	fm.clients["client"] = &fusionClient{id: "client", transport: transport}
+	fm.subscribe("client", "alerts")
+
+	alerts := []*shuttletracker.Alert{{ID: 1, Message: "Detour"}}
+	fm.processAlerts(alerts)
+	fm.processAlerts([]*shuttletracker.Alert{{ID: 1, Message: "Detour"}})
+	if len(transport.events) != 1 {
+		t.Fatalf("got %d events, expected 1", len(transport.events))
+	}
+	fm.processAlerts([]*shuttletracker.Alert{})
+	if len(transport.events) != 2 {
+		t.Fatalf("got %d events, expected 2", len(transport.events))
+	}
+
+	fme := struct {
+		Type    string                  `json:"type"`
+		Message []*shuttletracker.Alert `json:"message"`
+	}{}
+	if err := json.Unmarshal(transport.events[1].data, &fme); err != nil {
+		t.Fatalf("unable to decode event: %s", err)
+	}
+	if fme.Type != "alerts" || fme.Message == nil || len(fme.Message) != 0 {
+		t.Errorf("got %+v, expected no alerts", fme)
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
+)
+
+// detourRoutes sets the effective points and stops of routes from the detours that
+// are active now, so that riders and clients see where vehicles are actually going.
+func (api *API) detourRoutes(routes []*shuttletracker.Route) ([]*shuttletracker.Route, error) {
+	detours, err := api.ms.Detours()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	detoured := make([]*shuttletracker.Route, len(routes))
+	for i, route := range routes {
+		detoured[i] = geo.ApplyDetours(route, detours, now)
+	}
+	return detoured, nil
+}
+
+// clearDetours drops the detoured geometry that a client sent back with a route,
+// since it's only ever worked out from the route's detours.
+func clearDetours(route *shuttletracker.Route) {
+	route.EffectivePoints = nil
+	route.EffectiveStopIDs = nil
+	route.DetourIDs = nil
+}
+
+// validateDetour checks a Detour against its route.
+func (api *API) validateDetour(detour *shuttletracker.Detour) ([]apiFieldError, error) {
+	fields := []apiFieldError{}
+	if detour.Start.IsZero() {
+		fields = append(fields, apiFieldError{Field: "start", Message: "is required"})
+	}
+	if detour.End.IsZero() {
+		fields = append(fields, apiFieldError{Field: "end", Message: "is required"})
+	} else if !detour.End.After(detour.Start) {
+		fields = append(fields, apiFieldError{Field: "end", Message: "must be after start"})
+	}
+	if len(detour.Points) == 0 && len(detour.ClosedStopIDs) == 0 {
+		fields = append(fields, apiFieldError{Field: "points", Message: "or closed_stop_ids is required"})
+	}
+
+	route, err := api.ms.Route(detour.RouteID)
+	if err == shuttletracker.ErrRouteNotFound {
+		return append(fields, apiFieldError{Field: "route_id", Message: fmt.Sprintf("route %d does not exist", detour.RouteID)}), nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(detour.Points) > 0 {
+		_, err = geo.SpliceDetour(route.Points, detour.Points)
+		if err != nil {
+			fields = append(fields, apiFieldError{Field: "points", Message: err.Error()})
+		}
+	}
+	for i, id := range detour.ClosedStopIDs {
+		if !containsID(route.StopIDs, id) {
+			fields = append(fields, apiFieldError{Field: fmt.Sprintf("closed_stop_ids[%d]", i), Message: fmt.Sprintf("stop %d is not on route %d", id, route.ID)})
+		}
+	}
+	return fields, nil
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// v1DetoursHandler gets all detours, or only the ones that are active now if the
+// "active" query parameter is true.
+func (api *API) v1DetoursHandler(w http.ResponseWriter, r *http.Request) {
+	active, err := queryBool(r, "active")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	detours, err := api.ms.Detours()
+	if err != nil {
+		writeInternalError(w, err, "unable to get detours")
+		return
+	}
+	if active {
+		now := time.Now()
+		current := []*shuttletracker.Detour{}
+		for _, d := range detours {
+			if d.ActiveAt(now) {
+				current = append(current, d)
+			}
+		}
+		detours = current
+	}
+	writeJSONStatus(w, http.StatusOK, detours)
+}
+
+func (api *API) v1DetourHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	detour, err := api.ms.Detour(id)
+	if err == shuttletracker.ErrDetourNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "detour %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get detour")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, detour)
+}
+
+// v1DetoursCreateHandler creates a detour and responds with it.
+func (api *API) v1DetoursCreateHandler(w http.ResponseWriter, r *http.Request) {
+	detour := &shuttletracker.Detour{}
+	if !decodeBody(w, r, detour) {
+		return
+	}
+	detour.ID = 0
+
+	fields, err := api.validateDetour(detour)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate detour")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err = api.ms.CreateDetour(detour)
+	if err != nil {
+		writeInternalError(w, err, "unable to create detour")
+		return
+	}
+	api.audit(r, "detour.create", "detour", detour.ID, nil, snapshot(detour))
+	writeJSONStatus(w, http.StatusCreated, detour)
+}
+
+// v1DetoursEditHandler changes the fields of a detour that are in the request body
+// and responds with the detour. Ending a detour early is a matter of setting its end.
+func (api *API) v1DetoursEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	detour, err := api.ms.Detour(id)
+	if err == shuttletracker.ErrDetourNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "detour %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get detour")
+		return
+	}
+	before := snapshot(detour)
+
+	if !decodeBody(w, r, detour) {
+		return
+	}
+	detour.ID = id
+
+	fields, err := api.validateDetour(detour)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate detour")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err = api.ms.ModifyDetour(detour)
+	if err == shuttletracker.ErrDetourNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "detour %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to modify detour")
+		return
+	}
+	api.audit(r, "detour.modify", "detour", id, before, snapshot(detour))
+	writeJSONStatus(w, http.StatusOK, detour)
+}
+
+func (api *API) v1DetoursDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	detour, err := api.ms.Detour(id)
+	if err == shuttletracker.ErrDetourNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "detour %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get detour")
+		return
+	}
+
+	err = api.ms.DeleteDetour(id)
+	if err == shuttletracker.ErrDetourNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "detour %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete detour")
+		return
+	}
+	api.audit(r, "detour.delete", "detour", id, snapshot(detour), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+// detourTestRoute is a straight route east along a street with a stop in the middle.
+func detourTestRoute() *shuttletracker.Route {
+	points := []shuttletracker.Point{}
+	for i := 0; i < 5; i++ {
+		points = append(points, shuttletracker.Point{Latitude: 42.73, Longitude: -73.69 + float64(i)*0.001})
+	}
+	return &shuttletracker.Route{ID: 1, Name: "East", Width: 4, Color: "#00ff00", Points: points, StopIDs: []int64{11}}
+}
+
+// detourTestDetour goes around the block north of the middle of detourTestRoute.
+func detourTestDetour() *shuttletracker.Detour {
+	now := time.Now()
+	return &shuttletracker.Detour{
+		ID:      3,
+		RouteID: 1,
+		Start:   now.Add(-time.Hour),
+		End:     now.Add(time.Hour),
+		Points: []shuttletracker.Point{
+			{Latitude: 42.73, Longitude: -73.6885},
+			{Latitude: 42.731, Longitude: -73.6885},
+			{Latitude: 42.731, Longitude: -73.6865},
+			{Latitude: 42.73, Longitude: -73.6865},
+		},
+		ClosedStopIDs: []int64{11},
+	}
+}
+
+func TestV1DetoursCreate(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Route", int64(1)).Return(detourTestRoute(), nil)
+	ms.RouteService.On("Route", int64(2)).Return((*shuttletracker.Route)(nil), shuttletracker.ErrRouteNotFound)
+	ms.DetourService.On("CreateDetour", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*shuttletracker.Detour).ID = 3
+	}).Return(nil)
+	api := &API{ms: ms}
+
+	for _, c := range []struct {
+		body   string
+		fields []string
+	}{
+		{`{"route_id": 2}`, []string{"start", "end", "points", "route_id"}},
+		{`{"route_id": 1, "start": "2019-12-02T10:00:00Z", "end": "2019-12-02T09:00:00Z", "closed_stop_ids": [11, 12]}`, []string{"end", "closed_stop_ids[1]"}},
+		{`{"route_id": 1, "start": "2019-12-02T09:00:00Z", "end": "2019-12-02T10:00:00Z", "points": [{"latitude": 42.75, "longitude": -73.6885}, {"latitude": 42.75, "longitude": -73.6865}]}`, []string{"points"}},
+	} {
+		var envelope apiErrorEnvelope
+		status := v1Request(t, api, "POST", "/detours/", c.body, &envelope)
+		fields := []string{}
+		for _, f := range envelope.Error.Fields {
+			fields = append(fields, f.Field)
+		}
+		if status != 422 || len(fields) != len(c.fields) {
+			t.Errorf("%s: got status %d and fields %v, expected 422 and %v", c.body, status, fields, c.fields)
+			continue
+		}
+		for i := range fields {
+			if fields[i] != c.fields[i] {
+				t.Errorf("%s: got fields %v, expected %v", c.body, fields, c.fields)
+				break
+			}
+		}
+	}
+	ms.DetourService.AssertNotCalled(t, "CreateDetour", mock.Anything)
+
+	detour := shuttletracker.Detour{}
+	status := v1Request(t, api, "POST", "/detours/", `{"route_id": 1, "start": "2019-12-02T09:00:00Z", "end": "2019-12-02T10:00:00Z", "closed_stop_ids": [11]}`, &detour)
+	if status != 201 || detour.ID != 3 || len(detour.ClosedStopIDs) != 1 {
+		t.Errorf("got status %d and detour %+v, expected 201 and detour 3", status, detour)
+	}
+}
+
+func TestV1RoutesDetoured(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{detourTestRoute()}, nil)
+	ms.DetourService.On("Detours").Return([]*shuttletracker.Detour{detourTestDetour()}, nil)
+	api := &API{ms: ms}
+
+	routes := []*shuttletracker.Route{}
+	status := v1Request(t, api, "GET", "/routes/", "", &routes)
+	if status != 200 || len(routes) != 1 {
+		t.Fatalf("got status %d and %d routes, expected 200 and 1 route", status, len(routes))
+	}
+	route := routes[0]
+	if len(route.DetourIDs) != 1 || route.DetourIDs[0] != 3 {
+		t.Errorf("got detour IDs %v, expected [3]", route.DetourIDs)
+	}
+	if len(route.EffectiveStopIDs) != 0 {
+		t.Errorf("got effective stops %v, expected none", route.EffectiveStopIDs)
+	}
+	// Points 0 and 1, the detour, then point 4
+	if len(route.EffectivePoints) != 7 {
+		t.Errorf("got %d effective points, expected 7", len(route.EffectivePoints))
+	}
+	if len(route.Points) != 5 || len(route.StopIDs) != 1 {
+		t.Errorf("got %d points and stops %v, expected the route's own", len(route.Points), route.StopIDs)
+	}
+}
+
+func TestV1RoutesEditDetoured(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Route", int64(1)).Return(detourTestRoute(), nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{detourTestRoute()}, nil)
+	ms.RouteService.On("ModifyRouteWithStops", mock.Anything, mock.Anything, "").Return(nil)
+	ms.StopService.On("Stop", int64(11)).Return(&shuttletracker.Stop{ID: 11, Latitude: 42.73, Longitude: -73.688}, nil)
+	ms.DetourService.On("Detours").Return([]*shuttletracker.Detour{detourTestDetour()}, nil)
+	api := &API{ms: ms}
+
+	// Send back the route as /routes has it, like the admin interface does.
+	routes := []*shuttletracker.Route{}
+	v1Request(t, api, "GET", "/routes/", "", &routes)
+	routes[0].Name = "East Express"
+	body, err := json.Marshal(routes[0])
+	if err != nil {
+		t.Fatalf("unable to encode route: %s", err)
+	}
+
+	var route shuttletracker.Route
+	status := v1Request(t, api, "PATCH", "/routes/1", string(body), &route)
+	if status != 200 {
+		t.Fatalf("got status %d, expected 200", status)
+	}
+	if route.Name != "East Express" || len(route.Points) != 5 || len(route.StopIDs) != 1 || len(route.DetourIDs) != 0 {
+		t.Errorf("got route %+v, expected its scheduled points and stops", route)
+	}
+}
+
+func TestV1RoutesEditStopsDetoured(t *testing.T) {
+	ms := &stmock.ModelService{}
+	route := detourTestRoute()
+	route.StopIDs = []int64{11, 12}
+	ms.RouteService.On("Route", int64(1)).Return(route, nil)
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{route}, nil)
+	ms.RouteService.On("ModifyRouteWithStops", mock.Anything, mock.Anything, "").Return(nil)
+	ms.StopService.On("Stop", int64(11)).Return(&shuttletracker.Stop{ID: 11, Latitude: 42.73, Longitude: -73.688}, nil)
+	ms.StopService.On("Stop", int64(12)).Return(&shuttletracker.Stop{ID: 12, Latitude: 42.73, Longitude: -73.687}, nil)
+	ms.StopService.On("Stop", int64(13)).Return(&shuttletracker.Stop{ID: 13, Latitude: 42.73, Longitude: -73.686}, nil)
+	ms.DetourService.On("Detours").Return([]*shuttletracker.Detour{detourTestDetour()}, nil)
+	api := &API{ms: ms}
+
+	// Add a stop to the route as /routes has it while stop 11 is closed.
+	routes := []*shuttletracker.Route{}
+	v1Request(t, api, "GET", "/routes/", "", &routes)
+	routes[0].StopIDs = append(routes[0].StopIDs, 13)
+	body, err := json.Marshal(routes[0])
+	if err != nil {
+		t.Fatalf("unable to encode route: %s", err)
+	}
+
+	var edited shuttletracker.Route
+	status := v1Request(t, api, "PATCH", "/routes/1", string(body), &edited)
+	if status != 200 {
+		t.Fatalf("got status %d, expected 200", status)
+	}
+	if len(edited.StopIDs) != 3 || edited.StopIDs[0] != 11 || edited.StopIDs[1] != 12 || edited.StopIDs[2] != 13 {
+		t.Errorf("got stops %v, expected [11 12 13]", edited.StopIDs)
+	}
+	if len(edited.Points) != 5 || edited.EffectivePoints != nil || edited.EffectiveStopIDs != nil || len(edited.DetourIDs) != 0 {
+		t.Errorf("got route %+v, expected its scheduled points and no detours", edited)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/gis"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// exportTrackDuration is how far back vehicle tracks go when "since" isn't given.
+const exportTrackDuration = 24 * time.Hour
+
+// exportFormat picks the format of an export from the URL's extension, or else the
+// Accept header, defaulting to GeoJSON. If the extension is unknown, it writes an error
+// and returns false.
+func exportFormat(w http.ResponseWriter, r *http.Request) (gis.Format, bool) {
+	if ext := chi.URLParam(r, "format"); ext != "" {
+		f, err := gis.ParseFormat(ext)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "%s", err)
+			return "", false
+		}
+		return f, true
+	}
+	if f, ok := gis.FormatFromAccept(r.Header.Get("Accept")); ok {
+		return f, true
+	}
+	return gis.GeoJSON, true
+}
+
+// writeExport writes a file made by write. It's buffered so that errors can still be
+// reported.
+func writeExport(w http.ResponseWriter, f gis.Format, name string, write func(*bytes.Buffer) error) {
+	buf := &bytes.Buffer{}
+	err := write(buf)
+	if err != nil {
+		writeInternalError(w, err, "unable to export "+name)
+		return
+	}
+	w.Header().Set("Content-Type", f.ContentType())
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+f.Extension()+`"`)
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		log.WithError(err).Error("unable to write export")
+	}
+}
+
+func (api *API) v1ExportRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+	routes, err := api.ms.Routes()
+	if err != nil {
+		writeInternalError(w, err, "unable to get routes")
+		return
+	}
+	writeExport(w, f, "routes", func(buf *bytes.Buffer) error {
+		return gis.WriteRoutes(buf, f, routes)
+	})
+}
+
+func (api *API) v1ExportStopsHandler(w http.ResponseWriter, r *http.Request) {
+	f, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+	stops, err := api.ms.Stops()
+	if err != nil {
+		writeInternalError(w, err, "unable to get stops")
+		return
+	}
+	writeExport(w, f, "stops", func(buf *bytes.Buffer) error {
+		return gis.WriteStops(buf, f, stops)
+	})
+}
+
+// v1ExportTrackHandler exports where a vehicle has been since the "since" query
+// parameter, or in the last day.
+func (api *API) v1ExportTrackHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	f, ok := exportFormat(w, r)
+	if !ok {
+		return
+	}
+	since := time.Now().Add(-exportTrackDuration)
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "invalid since %q", s)
+			return
+		}
+	}
+
+	vehicle, err := api.ms.Vehicle(id)
+	if err == shuttletracker.ErrVehicleNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "vehicle %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get vehicle")
+		return
+	}
+	locations, err := api.ms.LocationsSince(id, since)
+	if err != nil {
+		writeInternalError(w, err, "unable to get locations")
+		return
+	}
+	writeExport(w, f, "track", func(buf *bytes.Buffer) error {
+		return gis.WriteTrack(buf, f, vehicle, locations)
+	})
+}
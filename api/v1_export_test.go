@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestV1Export(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{{
+		ID:     1,
+		Name:   "West",
+		Color:  "#ff0000",
+		Width:  4,
+		Points: []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.68}, {Latitude: 42.74, Longitude: -73.67}},
+	}}, nil)
+	ms.StopService.On("Stops").Return([]*shuttletracker.Stop{{ID: 2, Latitude: 42.73, Longitude: -73.68}}, nil)
+	ms.VehicleService.On("Vehicle", int64(3)).Return(&shuttletracker.Vehicle{ID: 3, Name: "Bus 3"}, nil)
+	ms.VehicleService.On("Vehicle", int64(4)).Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	ms.LocationService.On("LocationsSince", int64(3)).Return([]*shuttletracker.Location{
+		{Latitude: 42.73, Longitude: -73.68, Time: time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)},
+	}, nil)
+	api := &API{ms: ms}
+
+	cases := []struct {
+		path        string
+		accept      string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{"/export/routes", "", 200, "application/geo+json", `"stroke": "#ff0000"`},
+		{"/export/routes.kml", "application/gpx+xml", 200, "application/vnd.google-earth.kml+xml", "<color>ff0000ff</color>"},
+		{"/export/routes", "application/gpx+xml", 200, "application/gpx+xml", "<rtept"},
+		{"/export/routes.shp", "", 404, "application/json", "not_found"},
+		{"/export/stops.gpx", "", 200, "application/gpx+xml", `<wpt lat="42.73" lon="-73.68">`},
+		{"/export/stops.json", "", 200, "application/geo+json", `"Point"`},
+		{"/export/vehicles/3/track.gpx?since=2019-03-01T00:00:00Z", "", 200, "application/gpx+xml", "<time>2019-03-01T12:00:00Z</time>"},
+		{"/export/vehicles/3/track", "application/vnd.google-earth.kml+xml", 200, "application/vnd.google-earth.kml+xml", "<gx:Track>"},
+		{"/export/vehicles/3/track?since=yesterday", "", 400, "application/json", "invalid_query"},
+		{"/export/vehicles/4/track", "", 404, "application/json", "not_found"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		w := httptest.NewRecorder()
+		api.v1Router(noRole).ServeHTTP(w, req)
+		if w.Code != c.status || w.Header().Get("Content-Type") != c.contentType {
+			t.Errorf("%s: got status %d and Content-Type %q, expected %d and %q", c.path, w.Code, w.Header().Get("Content-Type"), c.status, c.contentType)
+		}
+		if !strings.Contains(w.Body.String(), c.contains) {
+			t.Errorf("%s: response doesn't contain %q: %s", c.path, c.contains, w.Body)
+		}
+		if c.status == http.StatusOK && !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") {
+			t.Errorf("%s: got Content-Disposition %q, expected an attachment", c.path, w.Header().Get("Content-Disposition"))
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// pages of locations have this many unless the "limit" query parameter says otherwise
+	locationsDefaultLimit = 1000
+	locationsMaxLimit     = 10000
+
+	// streamed locations are flushed to the client this often
+	locationsFlushInterval = 500
+)
+
+// locationsPage is a page of JSON locations. NextCursor gets the next page.
+type locationsPage struct {
+	Locations  []*shuttletracker.Location `json:"locations"`
+	NextCursor string                     `json:"next_cursor,omitempty"`
+}
+
+func encodeLocationCursor(l *shuttletracker.Location) string {
+	s := l.Time.UTC().Format(time.RFC3339Nano) + "," + strconv.FormatInt(l.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeLocationCursor(s string) (*shuttletracker.LocationCursor, error) {
+	errInvalid := fmt.Errorf("invalid cursor %q", s)
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalid
+	}
+	parts := strings.SplitN(string(b), ",", 2)
+	if len(parts) != 2 {
+		return nil, errInvalid
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, errInvalid
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, errInvalid
+	}
+	return &shuttletracker.LocationCursor{Time: t, ID: id}, nil
+}
+
+// queryIDs parses a query parameter with comma-separated IDs, which may be repeated.
+func queryIDs(r *http.Request, key string) ([]int64, error) {
+	ids := []int64{}
+	for _, v := range r.URL.Query()[key] {
+		for _, s := range strings.Split(v, ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil || id < 1 {
+				return nil, fmt.Errorf("invalid %s %q", key, s)
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// parseBounds parses a bounding box in GeoJSON order: "west,south,east,north".
+func parseBounds(s string) (*shuttletracker.Bounds, error) {
+	errInvalid := fmt.Errorf("invalid bbox %q; expected min_longitude,min_latitude,max_longitude,max_latitude", s)
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, errInvalid
+	}
+	values := make([]float64, 4)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, errInvalid
+		}
+		values[i] = v
+	}
+	b := &shuttletracker.Bounds{
+		MinLongitude: values[0],
+		MinLatitude:  values[1],
+		MaxLongitude: values[2],
+		MaxLatitude:  values[3],
+	}
+	if !validLongitude(b.MinLongitude) || !validLongitude(b.MaxLongitude) ||
+		!validLatitude(b.MinLatitude) || !validLatitude(b.MaxLatitude) ||
+		b.MinLongitude > b.MaxLongitude || b.MinLatitude > b.MaxLatitude {
+		return nil, errInvalid
+	}
+	return b, nil
+}
+
+// locationFilter parses the query parameters of a request for locations. Limit is
+// left zero if the request doesn't have one.
+func locationFilter(r *http.Request) (shuttletracker.LocationFilter, error) {
+	q := r.URL.Query()
+	filter := shuttletracker.LocationFilter{}
+	var err error
+
+	filter.VehicleIDs, err = queryIDs(r, "vehicle_id")
+	if err != nil {
+		return filter, err
+	}
+	filter.RouteIDs, err = queryIDs(r, "route_id")
+	if err != nil {
+		return filter, err
+	}
+	for key, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if s := q.Get(key); s != "" {
+			*t, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s %q; expected an RFC 3339 time", key, s)
+			}
+		}
+	}
+	if s := q.Get("bbox"); s != "" {
+		filter.Bounds, err = parseBounds(s)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if s := q.Get("cursor"); s != "" {
+		filter.After, err = decodeLocationCursor(s)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		filter.Limit, err = strconv.Atoi(s)
+		if err != nil || filter.Limit < 1 {
+			return filter, fmt.Errorf("invalid limit %q", s)
+		}
+	}
+	return filter, nil
+}
+
+// locationsFormat returns the format that a request wants locations in: "json",
+// "ndjson", or "csv". The "format" query parameter wins over the Accept header.
+func locationsFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "json", "ndjson", "csv":
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"):
+		return "ndjson", nil
+	case strings.Contains(accept, "text/csv"):
+		return "csv", nil
+	}
+	return "json", nil
+}
+
+// v1LocationsHandler serves vehicle locations that match the query parameters. JSON
+// responses are pages with a cursor for the next page. NDJSON and CSV responses are
+// streamed, and include every matching location unless they have a limit.
+func (api *API) v1LocationsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := locationFilter(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	format, err := locationsFormat(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+
+	if format != "json" {
+		api.streamLocations(w, filter, format)
+		return
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = locationsDefaultLimit
+	} else if filter.Limit > locationsMaxLimit {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "limit must be at most %d; use ndjson or csv for more", locationsMaxLimit)
+		return
+	}
+	limit := filter.Limit
+	// get one extra to find out if there's another page
+	filter.Limit++
+	page := locationsPage{Locations: []*shuttletracker.Location{}}
+	err = api.ms.Locations(filter, func(l *shuttletracker.Location) error {
+		page.Locations = append(page.Locations, l)
+		return nil
+	})
+	if err != nil {
+		writeInternalError(w, err, "unable to get locations")
+		return
+	}
+	if len(page.Locations) > limit {
+		page.Locations = page.Locations[:limit]
+		page.NextCursor = encodeLocationCursor(page.Locations[limit-1])
+	}
+	writeJSONStatus(w, http.StatusOK, page)
+}
+
+var locationsCSVHeader = []string{"id", "tracker_id", "vehicle_id", "route_id", "latitude", "longitude", "heading", "speed", "time", "created", "source"}
+
+func locationCSVRecord(l *shuttletracker.Location) []string {
+	optionalID := func(id *int64) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatInt(*id, 10)
+	}
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return []string{
+		strconv.FormatInt(l.ID, 10),
+		l.TrackerID,
+		optionalID(l.VehicleID),
+		optionalID(l.RouteID),
+		float(l.Latitude),
+		float(l.Longitude),
+		float(l.Heading),
+		float(l.Speed),
+		l.Time.Format(time.RFC3339Nano),
+		l.Created.Format(time.RFC3339Nano),
+		l.Source,
+	}
+}
+
+// errLocationsStreamFailed stops streaming after a location couldn't be written.
+var errLocationsStreamFailed = errors.New("unable to write location")
+
+// streamLocations writes locations as they come from the database instead of holding
+// them in memory. The response starts with the first location, so errors before then
+// still get an error response.
+func (api *API) streamLocations(w http.ResponseWriter, filter shuttletracker.LocationFilter, format string) {
+	flusher, _ := w.(http.Flusher)
+	started := false
+	count := 0
+	var encode func(*shuttletracker.Location) error
+	var flush func()
+
+	start := func() {
+		started = true
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="locations.csv"`)
+			cw := csv.NewWriter(w)
+			_ = cw.Write(locationsCSVHeader)
+			encode = func(l *shuttletracker.Location) error {
+				return cw.Write(locationCSVRecord(l))
+			}
+			flush = cw.Flush
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc := json.NewEncoder(w)
+			encode = func(l *shuttletracker.Location) error {
+				return enc.Encode(l)
+			}
+			flush = func() {}
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	err := api.ms.Locations(filter, func(l *shuttletracker.Location) error {
+		if !started {
+			start()
+		}
+		err := encode(l)
+		if err != nil {
+			log.WithError(err).Error("unable to write location")
+			return errLocationsStreamFailed
+		}
+		count++
+		if count%locationsFlushInterval == 0 {
+			flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	if err != nil && !started {
+		writeInternalError(w, err, "unable to get locations")
+		return
+	} else if err != nil {
+		if err != errLocationsStreamFailed {
+			log.WithError(err).Error("unable to get locations")
+		}
+		return
+	}
+	if !started {
+		start()
+	}
+	flush()
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tmock "github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func testLocations(n int) []*shuttletracker.Location {
+	vehicleID := int64(2)
+	start := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	locations := []*shuttletracker.Location{}
+	for i := 0; i < n; i++ {
+		locations = append(locations, &shuttletracker.Location{
+			ID:        int64(i + 1),
+			TrackerID: "1832",
+			VehicleID: &vehicleID,
+			Latitude:  42.73,
+			Longitude: -73.68,
+			Time:      start.Add(time.Duration(i) * time.Minute),
+			Source:    shuttletracker.LocationSourceITRAK,
+		})
+	}
+	return locations
+}
+
+func TestV1LocationsPages(t *testing.T) {
+	ms := &stmock.ModelService{}
+	locations := testLocations(3)
+	ms.LocationService.On("Locations", tmock.MatchedBy(func(f shuttletracker.LocationFilter) bool {
+		return f.After == nil
+	})).Return(locations, nil)
+	ms.LocationService.On("Locations", tmock.MatchedBy(func(f shuttletracker.LocationFilter) bool {
+		return f.After != nil
+	})).Return(locations[2:], nil)
+	api := &API{ms: ms}
+
+	page := locationsPage{}
+	status := v1Request(t, api, "GET", "/locations?vehicle_id=2&limit=2&since=2019-03-01T00:00:00Z&bbox=-74,42,-73,43", "", &page)
+	if status != http.StatusOK || len(page.Locations) != 2 || page.NextCursor == "" {
+		t.Fatalf("got status %d, %d locations, and cursor %q, expected 200, 2, and a cursor", status, len(page.Locations), page.NextCursor)
+	}
+	filter := ms.LocationService.Calls[0].Arguments.Get(0).(shuttletracker.LocationFilter)
+	if filter.Limit != 3 || len(filter.VehicleIDs) != 1 || filter.Bounds.MinLongitude != -74 || filter.Since.IsZero() {
+		t.Errorf("unexpected filter %+v", filter)
+	}
+
+	page = locationsPage{}
+	status = v1Request(t, api, "GET", "/locations?limit=2&cursor="+page.NextCursor+encodeLocationCursor(locations[1]), "", &page)
+	if status != http.StatusOK || len(page.Locations) != 1 || page.NextCursor != "" {
+		t.Errorf("got status %d, %d locations, and cursor %q, expected 200, 1, and no cursor", status, len(page.Locations), page.NextCursor)
+	}
+	after := ms.LocationService.Calls[1].Arguments.Get(0).(shuttletracker.LocationFilter).After
+	if after == nil || after.ID != 2 || !after.Time.Equal(locations[1].Time) {
+		t.Errorf("got cursor %+v, expected location 2", after)
+	}
+
+	for _, query := range []string{"vehicle_id=x", "since=yesterday", "bbox=1,2,3", "bbox=10,0,0,10", "cursor=abc", "limit=0", "limit=10001", "format=xml"} {
+		var envelope apiErrorEnvelope
+		status := v1Request(t, api, "GET", "/locations?"+query, "", &envelope)
+		if status != http.StatusBadRequest || envelope.Error.Code != apiErrorInvalidQuery {
+			t.Errorf("%s: got status %d and code %q, expected 400 and %q", query, status, envelope.Error.Code, apiErrorInvalidQuery)
+		}
+	}
+}
+
+func TestV1LocationsStream(t *testing.T) {
+	ms := &stmock.ModelService{}
+	locations := testLocations(3)
+	ms.LocationService.On("Locations", tmock.Anything).Return(locations, nil)
+	api := &API{ms: ms}
+
+	req := httptest.NewRequest("GET", "/locations", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != "application/x-ndjson" || w.Header().Get("ETag") != "" {
+		t.Errorf("got headers %v, expected unbuffered NDJSON", w.Header())
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, expected 3", len(lines))
+	}
+	l := shuttletracker.Location{}
+	err := json.Unmarshal([]byte(lines[2]), &l)
+	if err != nil || l.ID != 3 {
+		t.Errorf("got %+v and error %v, expected location 3", l, err)
+	}
+
+	req = httptest.NewRequest("GET", "/locations?format=csv", nil)
+	w = httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("unable to read CSV: %s", err)
+	}
+	if len(records) != 4 || records[0][0] != "id" || records[1][2] != "2" || records[1][3] != "" || records[3][8] != "2019-03-01T12:02:00Z" {
+		t.Errorf("unexpected CSV %v", records)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// revisionChange is a field that differs between two revisions.
+type revisionChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+type revisionDiff struct {
+	From    int64            `json:"from"`
+	To      int64            `json:"to"`
+	Changes []revisionChange `json:"changes"`
+}
+
+// diffRevisions compares the top-level fields of two revisions. Timestamps, whether a
+// route is active, and the time zone of its schedule aren't compared, since they
+// change on their own.
+func diffRevisions(from, to *shuttletracker.Revision) ([]revisionChange, error) {
+	fromFields := map[string]json.RawMessage{}
+	err := json.Unmarshal(from.Data, &fromFields)
+	if err != nil {
+		return nil, err
+	}
+	toFields := map[string]json.RawMessage{}
+	err = json.Unmarshal(to.Data, &toFields)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range fromFields {
+		names = append(names, name)
+	}
+	for name := range toFields {
+		if _, ok := fromFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []revisionChange{}
+	for _, name := range names {
+		if name == "created" || name == "updated" || name == "active" || name == "timezone" {
+			continue
+		}
+		fromValue, toValue := compactJSON(fromFields[name]), compactJSON(toFields[name])
+		if !bytes.Equal(fromValue, toValue) {
+			changes = append(changes, revisionChange{Field: name, From: fromValue, To: toValue})
+		}
+	}
+	return changes, nil
+}
+
+// compactJSON removes insignificant whitespace so that values can be compared. Missing
+// values become null.
+func compactJSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage("null")
+	}
+	buf := &bytes.Buffer{}
+	err := json.Compact(buf, raw)
+	if err != nil {
+		return raw
+	}
+	return buf.Bytes()
+}
+
+// revisionsHandler returns a handler that lists the revisions of one kind of thing.
+func (api *API) revisionsHandler(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := urlID(w, r)
+		if !ok {
+			return
+		}
+		revisions, err := api.ms.Revisions(kind, id)
+		if err != nil {
+			writeInternalError(w, err, "unable to get revisions")
+			return
+		}
+		writeJSONStatus(w, http.StatusOK, revisions)
+	}
+}
+
+// revision gets a revision by ID. If it can't, it writes an error and returns nil.
+func (api *API) revision(w http.ResponseWriter, s string) *shuttletracker.Revision {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidID, "invalid ID %q", s)
+		return nil
+	}
+	revision, err := api.ms.Revision(id)
+	if err == shuttletracker.ErrRevisionNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "revision %d not found", id)
+		return nil
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get revision")
+		return nil
+	}
+	return revision
+}
+
+func (api *API) v1RevisionHandler(w http.ResponseWriter, r *http.Request) {
+	revision := api.revision(w, chi.URLParam(r, "id"))
+	if revision == nil {
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, revision)
+}
+
+// v1RevisionsDiffHandler compares the revisions in the "from" and "to" query parameters.
+func (api *API) v1RevisionsDiffHandler(w http.ResponseWriter, r *http.Request) {
+	from := api.revision(w, r.URL.Query().Get("from"))
+	if from == nil {
+		return
+	}
+	to := api.revision(w, r.URL.Query().Get("to"))
+	if to == nil {
+		return
+	}
+	if from.Kind != to.Kind {
+		writeAPIError(w, http.StatusUnprocessableEntity, apiErrorValidation,
+			"can't compare a %s revision to a %s revision", from.Kind, to.Kind)
+		return
+	}
+
+	changes, err := diffRevisions(from, to)
+	if err != nil {
+		writeInternalError(w, err, "unable to compare revisions")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, revisionDiff{From: from.ID, To: to.ID, Changes: changes})
+}
+
+// v1RevisionsRestoreHandler sets a route or stop back to how it was in a revision and
+// responds with it.
+func (api *API) v1RevisionsRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	revision := api.revision(w, chi.URLParam(r, "id"))
+	if revision == nil {
+		return
+	}
+
+	// The route or stop may have been deleted, in which case there's nothing before.
+	var current, restored interface{}
+	var err error
+	switch revision.Kind {
+	case shuttletracker.RevisionKindRoute:
+		current, err = api.ms.Route(revision.TargetID)
+		if err == shuttletracker.ErrRouteNotFound {
+			current, err = nil, nil
+		}
+		if err == nil {
+			restored, err = api.ms.RestoreRoute(revision.ID, api.username(r))
+		}
+	case shuttletracker.RevisionKindStop:
+		current, err = api.ms.Stop(revision.TargetID)
+		if err == shuttletracker.ErrStopNotFound {
+			current, err = nil, nil
+		}
+		if err == nil {
+			restored, err = api.ms.RestoreStop(revision.ID, api.username(r))
+		}
+	default:
+		writeAPIError(w, http.StatusUnprocessableEntity, apiErrorValidation, "can't restore a %s revision", revision.Kind)
+		return
+	}
+	if err == shuttletracker.ErrRevisionNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "revision %d not found", revision.ID)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to restore revision")
+		return
+	}
+	api.audit(r, revision.Kind+".restore", revision.Kind, revision.TargetID, snapshot(current), snapshot(restored))
+	writeJSONStatus(w, http.StatusOK, restored)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	from := &shuttletracker.Revision{Data: json.RawMessage(`{"name": "West", "width": 4, "updated": "2019-01-01T00:00:00Z", "points": [{"latitude": 1, "longitude": 2}]}`)}
+	to := &shuttletracker.Revision{Data: json.RawMessage(`{"name":"West","width":6,"updated":"2019-01-02T00:00:00Z","points":[{"latitude":1,"longitude":2}],"description":"Loop"}`)}
+
+	changes, err := diffRevisions(from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []revisionChange{
+		{Field: "description", From: json.RawMessage("null"), To: json.RawMessage(`"Loop"`)},
+		{Field: "width", From: json.RawMessage("4"), To: json.RawMessage("6")},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("got changes %+v, expected %+v", changes, expected)
+	}
+	for i := range expected {
+		if changes[i].Field != expected[i].Field || string(changes[i].From) != string(expected[i].From) ||
+			string(changes[i].To) != string(expected[i].To) {
+			t.Errorf("got change %+v, expected %+v", changes[i], expected[i])
+		}
+	}
+}
+
+func TestV1RevisionsRestore(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RevisionService.On("Revision", int64(8)).Return(&shuttletracker.Revision{ID: 8, Kind: shuttletracker.RevisionKindStop, TargetID: 2}, nil)
+	ms.RevisionService.On("Revision", int64(9)).Return((*shuttletracker.Revision)(nil), shuttletracker.ErrRevisionNotFound)
+	ms.StopService.On("Stop", int64(2)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	ms.StopService.On("RestoreStop", int64(8), "").Return(&shuttletracker.Stop{ID: 2}, nil)
+	audits := &stmock.AuditService{}
+	audits.On("CreateAuditEntry", mock.MatchedBy(func(e *shuttletracker.AuditEntry) bool {
+		return e.Action == "stop.restore" && e.TargetID == 2 && string(e.Before) == "null" && len(e.After) > 0
+	})).Return(nil)
+	api := &API{ms: ms, audits: audits}
+
+	var stop shuttletracker.Stop
+	status := v1Request(t, api, "POST", "/revisions/8/restore", "", &stop)
+	if status != 200 || stop.ID != 2 {
+		t.Errorf("got status %d and stop %+v, expected 200 and stop 2", status, stop)
+	}
+
+	var envelope apiErrorEnvelope
+	status = v1Request(t, api, "POST", "/revisions/9/restore", "", &envelope)
+	if status != 404 || envelope.Error.Code != apiErrorNotFound {
+		t.Errorf("got status %d and code %q, expected 404 and %q", status, envelope.Error.Code, apiErrorNotFound)
+	}
+	ms.StopService.AssertNumberOfCalls(t, "RestoreStop", 1)
+	audits.AssertNumberOfCalls(t, "CreateAuditEntry", 1)
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+var routeColorRegexp = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+func validLatitude(lat float64) bool {
+	return lat >= -90 && lat <= 90
+}
+
+func validLongitude(lon float64) bool {
+	return lon >= -180 && lon <= 180
+}
+
+// validateRoute checks a Route against the constraints that the database would
+// otherwise reject it for. Stop IDs are checked against ss.
+func validateRoute(ss shuttletracker.StopService, route *shuttletracker.Route) ([]apiFieldError, error) {
+	fields := validateRouteFields(route)
+	for i, stopID := range route.StopIDs {
+		_, err := ss.Stop(stopID)
+		if err == shuttletracker.ErrStopNotFound {
+			fields = append(fields, apiFieldError{Field: fmt.Sprintf("stop_ids[%d]", i), Message: fmt.Sprintf("stop %d does not exist", stopID)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// validateRouteFields does the checks of validateRoute that don't need its stops.
+func validateRouteFields(route *shuttletracker.Route) []apiFieldError {
+	fields := []apiFieldError{}
+	if route.Name == "" {
+		fields = append(fields, apiFieldError{Field: "name", Message: "is required"})
+	}
+	if route.Width < 1 || route.Width > 100 {
+		fields = append(fields, apiFieldError{Field: "width", Message: "must be between 1 and 100"})
+	}
+	if !routeColorRegexp.MatchString(route.Color) {
+		fields = append(fields, apiFieldError{Field: "color", Message: "must be a hex color like #ff0000"})
+	}
+	for i, p := range route.Points {
+		if !validLatitude(p.Latitude) || !validLongitude(p.Longitude) {
+			fields = append(fields, apiFieldError{Field: fmt.Sprintf("points[%d]", i), Message: "is not a valid coordinate"})
+		}
+	}
+	return append(fields, validateSchedule("schedule", route.Schedule)...)
+}
+
+// validateSchedule checks the intervals of a schedule, which is in the field name.
+// Intervals can wrap around the end of the week, so they only need to end at a
+// different time than they start.
+func validateSchedule(name string, schedule shuttletracker.RouteSchedule) []apiFieldError {
+	fields := []apiFieldError{}
+	for i, interval := range schedule {
+		field := fmt.Sprintf("%s[%d]", name, i)
+		if interval.StartDay < 0 || interval.StartDay > 6 || interval.EndDay < 0 || interval.EndDay > 6 {
+			fields = append(fields, apiFieldError{Field: field, Message: "days must be between 0 and 6"})
+		} else if interval.StartDay == interval.EndDay &&
+			shuttletracker.Clock(interval.StartTime).Equal(shuttletracker.Clock(interval.EndTime)) {
+			fields = append(fields, apiFieldError{Field: field, Message: "must not end when it starts"})
+		}
+	}
+	return fields
+}
+
+func validateStop(stop *shuttletracker.Stop) []apiFieldError {
+	fields := []apiFieldError{}
+	if !validLatitude(stop.Latitude) {
+		fields = append(fields, apiFieldError{Field: "latitude", Message: "must be between -90 and 90"})
+	}
+	if !validLongitude(stop.Longitude) {
+		fields = append(fields, apiFieldError{Field: "longitude", Message: "must be between -180 and 180"})
+	}
+	return fields
+}
+
+// v1RoutesHandler gets all routes with the points and stops of their active detours.
+func (api *API) v1RoutesHandler(w http.ResponseWriter, r *http.Request) {
+	routes, err := api.ms.Routes()
+	if err != nil {
+		writeInternalError(w, err, "unable to get routes")
+		return
+	}
+	routes, err = api.detourRoutes(routes)
+	if err != nil {
+		writeInternalError(w, err, "unable to get detours")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, routes)
+}
+
+func (api *API) v1RouteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	route, err := api.ms.Route(id)
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get route")
+		return
+	}
+	routes, err := api.detourRoutes([]*shuttletracker.Route{route})
+	if err != nil {
+		writeInternalError(w, err, "unable to get detours")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, routes[0])
+}
+
+// v1RoutesCreateHandler creates a route and responds with it. Issues with its shape
+// are sent as Warning headers unless routeGeometryOptions say otherwise.
+func (api *API) v1RoutesCreateHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseRouteGeometryOptions(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	route := &shuttletracker.Route{Width: 4, Color: "#ffffff"}
+	if !decodeBody(w, r, route) {
+		return
+	}
+	route.ID = 0
+	clearDetours(route)
+
+	fields, err := validateRoute(api.ms, route)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate route")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+	g, err := api.checkRouteGeometry(route, opts)
+	if err != nil {
+		writeInternalError(w, err, "unable to check route")
+		return
+	}
+	if opts.strict && len(g.Issues) > 0 {
+		writeValidationErrors(w, routeIssueFields(g.Issues))
+		return
+	}
+
+	err = api.ms.CreateRouteWithStops(route, g.SnappedStops, api.username(r))
+	if err != nil {
+		writeInternalError(w, err, "unable to create route")
+		return
+	}
+	api.audit(r, "route.create", "route", route.ID, nil, snapshot(route))
+	api.auditSnappedStops(r, g)
+	setRouteWarnings(w, g.Issues)
+	writeJSONStatus(w, http.StatusCreated, route)
+}
+
+// v1RoutesEditHandler changes the fields of a route that are in the request body and
+// responds with the route. Clients should include the route's "updated" time so that
+// they get a conflict instead of overwriting someone else's changes. Issues with its
+// shape are handled like v1RoutesCreateHandler's.
+func (api *API) v1RoutesEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	opts, err := parseRouteGeometryOptions(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	route, err := api.ms.Route(id)
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get route")
+		return
+	}
+	before := snapshot(route)
+	if !decodeBody(w, r, route) {
+		return
+	}
+	route.ID = id
+	clearDetours(route)
+
+	fields, err := validateRoute(api.ms, route)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate route")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+	g, err := api.checkRouteGeometry(route, opts)
+	if err != nil {
+		writeInternalError(w, err, "unable to check route")
+		return
+	}
+	if opts.strict && len(g.Issues) > 0 {
+		writeValidationErrors(w, routeIssueFields(g.Issues))
+		return
+	}
+
+	err = api.ms.ModifyRouteWithStops(route, g.SnappedStops, api.username(r))
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err == shuttletracker.ErrRouteModified {
+		writeAPIError(w, http.StatusConflict, apiErrorConflict,
+			"route %d was modified after %s; get it again and reapply your changes", id, route.Updated.Format(time.RFC3339Nano))
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to modify route")
+		return
+	}
+	api.audit(r, "route.modify", "route", id, before, snapshot(route))
+	api.auditSnappedStops(r, g)
+	setRouteWarnings(w, g.Issues)
+	writeJSONStatus(w, http.StatusOK, route)
+}
+
+func (api *API) v1RoutesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	route, err := api.ms.Route(id)
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get route")
+		return
+	}
+
+	err = api.ms.DeleteRoute(id, api.username(r))
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete route")
+		return
+	}
+	api.audit(r, "route.delete", "route", id, snapshot(route), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) v1StopsHandler(w http.ResponseWriter, r *http.Request) {
+	stops, err := api.ms.Stops()
+	if err != nil {
+		writeInternalError(w, err, "unable to get stops")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, stops)
+}
+
+func (api *API) v1StopHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	stop, err := api.ms.Stop(id)
+	if err == shuttletracker.ErrStopNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "stop %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get stop")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, stop)
+}
+
+// v1StopsCreateHandler creates a stop and responds with it.
+func (api *API) v1StopsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	stop := &shuttletracker.Stop{}
+	if !decodeBody(w, r, stop) {
+		return
+	}
+	stop.ID = 0
+
+	if fields := validateStop(stop); len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err := api.ms.CreateStop(stop, api.username(r))
+	if err != nil {
+		writeInternalError(w, err, "unable to create stop")
+		return
+	}
+	api.audit(r, "stop.create", "stop", stop.ID, nil, snapshot(stop))
+	writeJSONStatus(w, http.StatusCreated, stop)
+}
+
+// v1StopsEditHandler changes the fields of a stop that are in the request body and
+// responds with the stop.
+func (api *API) v1StopsEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	stop, err := api.ms.Stop(id)
+	if err == shuttletracker.ErrStopNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "stop %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get stop")
+		return
+	}
+	before := snapshot(stop)
+
+	if !decodeBody(w, r, stop) {
+		return
+	}
+	stop.ID = id
+
+	if fields := validateStop(stop); len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err = api.ms.ModifyStop(stop, api.username(r))
+	if err == shuttletracker.ErrStopNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "stop %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to modify stop")
+		return
+	}
+	api.audit(r, "stop.modify", "stop", id, before, snapshot(stop))
+	writeJSONStatus(w, http.StatusOK, stop)
+}
+
+// v1StopsDeleteHandler deletes a stop. Stops that routes stop at are only deleted if
+// the "detach" query parameter is true, which removes them from those routes too.
+func (api *API) v1StopsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	detach, err := queryBool(r, "detach")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	stop, err := api.ms.Stop(id)
+	if err == shuttletracker.ErrStopNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "stop %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get stop")
+		return
+	}
+
+	err = api.ms.DeleteStop(id, detach, api.username(r))
+	if inUse, ok := err.(*shuttletracker.StopInUseError); ok {
+		writeJSONStatus(w, http.StatusConflict, apiErrorEnvelope{Error: apiError{
+			Code:    apiErrorConflict,
+			Message: fmt.Sprintf("stop %d is on routes %v; delete it with detach=true to remove it from them", id, inUse.RouteIDs),
+			Details: map[string]interface{}{"route_ids": inUse.RouteIDs},
+		}})
+		return
+	} else if err == shuttletracker.ErrStopNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "stop %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete stop")
+		return
+	}
+	api.audit(r, "stop.delete", "stop", id, snapshot(stop), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/gis"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// routesImportMaxBytes is the largest file that can be imported.
+const routesImportMaxBytes = 10 << 20
+
+var errInvalidMaxStopDistance = errors.New("max_stop_distance must be a non-negative number")
+
+// importFormat picks the format of an imported file from the "format" query
+// parameter, the Content-Type header, or else the file itself.
+func importFormat(r *http.Request, body *bufio.Reader) (gis.Format, error) {
+	if s := r.URL.Query().Get("format"); s != "" {
+		return gis.ParseFormat(s)
+	}
+	if f, ok := gis.FormatFromAccept(r.Header.Get("Content-Type")); ok {
+		return f, nil
+	}
+	start, _ := body.Peek(512)
+	if bytes.HasPrefix(bytes.TrimSpace(start), []byte("<")) {
+		return gis.KML, nil
+	}
+	return gis.GeoJSON, nil
+}
+
+// importOptions reads gis.ImportOptions from the query parameters "allow_open" and
+// "max_stop_distance".
+func importOptions(r *http.Request) (gis.ImportOptions, error) {
+	opts := gis.DefaultImportOptions
+	var err error
+	opts.AllowOpen, err = queryBool(r, "allow_open")
+	if err != nil {
+		return opts, err
+	}
+	if s := r.URL.Query().Get("max_stop_distance"); s != "" {
+		opts.MaxStopDistance, err = strconv.ParseFloat(s, 64)
+		if err != nil || opts.MaxStopDistance < 0 {
+			return opts, errInvalidMaxStopDistance
+		}
+	}
+	return opts, nil
+}
+
+// v1RoutesImportHandler creates routes from the lines in a GeoJSON or KML file, and
+// stops from its points. Stops are snapped onto the routes they're near and ordered
+// along them. With "preview=true", nothing is created and it responds with the
+// routes and stops that would be, along with any problems. Otherwise, problems fail
+// the import with 422 and it responds to a successful import with the created routes
+// and stops.
+func (api *API) v1RoutesImportHandler(w http.ResponseWriter, r *http.Request) {
+	preview, err := queryBool(r, "preview")
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	opts, err := importOptions(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, routesImportMaxBytes))
+	f, err := importFormat(r, body)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "%s", err)
+		return
+	}
+	features, err := gis.Read(body, f)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiErrorInvalidBody, "unable to read %s: %s", f, err)
+		return
+	}
+
+	im := gis.PlanImport(features, opts)
+	ValidateImport(im)
+
+	if preview {
+		writeJSONStatus(w, http.StatusOK, im)
+		return
+	}
+	if len(im.Problems) > 0 {
+		fields := []apiFieldError{}
+		for _, p := range im.Problems {
+			fields = append(fields, apiFieldError{Field: p.Feature, Message: p.Message})
+		}
+		writeJSONStatus(w, http.StatusUnprocessableEntity, apiErrorEnvelope{Error: apiError{
+			Code:    apiErrorValidation,
+			Message: "imported file failed validation",
+			Fields:  fields,
+			Details: im,
+		}})
+		return
+	}
+
+	err = im.Create(api.ms, api.username(r))
+	if err != nil {
+		writeInternalError(w, err, "unable to import routes")
+		return
+	}
+	if api.audits != nil {
+		AuditImport(api.audits, im, api.username(r))
+	}
+	writeJSONStatus(w, http.StatusCreated, im)
+}
+
+// ValidateImport adds an ImportProblem for each way that an Import's routes would be
+// rejected if they were created through the API. Their stops are created along with
+// them, so they aren't checked. The routes import command uses it too.
+func ValidateImport(im *gis.Import) {
+	for _, ir := range im.Routes {
+		for _, field := range validateRouteFields(ir.Route) {
+			im.Problem(ir.Feature+"."+field.Field, "%s", field.Message)
+		}
+	}
+}
+
+// AuditImport records that actor created an Import's stops and routes. Like audit,
+// it logs errors instead of returning them because the import has already been done.
+func AuditImport(as shuttletracker.AuditService, im *gis.Import, actor string) {
+	record := func(action, targetType string, targetID int64, after json.RawMessage) {
+		entry := &shuttletracker.AuditEntry{
+			Actor:      actor,
+			Action:     action,
+			TargetType: targetType,
+			TargetID:   targetID,
+			After:      after,
+		}
+		err := as.CreateAuditEntry(entry)
+		if err != nil {
+			log.WithError(err).Errorf("unable to record %s of %s %d", action, targetType, targetID)
+		}
+	}
+	for _, stop := range im.Stops {
+		record("stop.create", "stop", stop.ID, snapshot(stop))
+	}
+	for _, ir := range im.Routes {
+		record("route.create", "route", ir.Route.ID, snapshot(ir.Route))
+	}
+}
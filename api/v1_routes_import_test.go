@@ -0,0 +1,78 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestV1RoutesImport(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("CreateRoutesAndStops", mock.Anything, mock.Anything, mock.Anything, "").Run(func(args mock.Arguments) {
+		for i, stop := range args.Get(0).([]*shuttletracker.Stop) {
+			stop.ID = int64(i + 1)
+		}
+		routeStops := args.Get(2).([][]*shuttletracker.Stop)
+		for i, route := range args.Get(1).([]*shuttletracker.Route) {
+			route.ID = 5
+			for _, stop := range routeStops[i] {
+				route.StopIDs = append(route.StopIDs, stop.ID)
+			}
+		}
+	}).Return(nil)
+	audits := &stmock.AuditService{}
+	audits.On("CreateAuditEntry", mock.AnythingOfType("*shuttletracker.AuditEntry")).Return(nil)
+	api := &API{ms: ms, audits: audits}
+
+	kml := `<kml xmlns="http://www.opengis.net/kml/2.2"><Document>
+ <Placemark><name>Loop</name><LineString><coordinates>-73.68,42.73 -73.67,42.73 -73.67,42.74 -73.68,42.73</coordinates></LineString></Placemark>
+ <Placemark><name>East</name><Point><coordinates>-73.6701,42.735</coordinates></Point></Placemark>
+ <Placemark><name>South</name><Point><coordinates>-73.675,42.7301</coordinates></Point></Placemark>
+</Document></kml>`
+
+	status := v1Request(t, api, "POST", "/routes/import?preview=true", kml, nil)
+	if status != 200 {
+		t.Fatalf("got status %d, expected 200", status)
+	}
+	ms.RouteService.AssertNotCalled(t, "CreateRoutesAndStops", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	im := struct {
+		Routes []struct {
+			Route shuttletracker.Route `json:"route"`
+		} `json:"routes"`
+	}{}
+	status = v1Request(t, api, "POST", "/routes/import", kml, &im)
+	if status != 201 {
+		t.Fatalf("got status %d, expected 201", status)
+	}
+	route := im.Routes[0].Route
+	// South is reached before East.
+	if route.ID != 5 || route.Name != "Loop" || len(route.StopIDs) != 2 || route.StopIDs[0] != 2 || route.StopIDs[1] != 1 {
+		t.Errorf("unexpected route %+v", route)
+	}
+	// two stops and a route
+	audits.AssertNumberOfCalls(t, "CreateAuditEntry", 3)
+
+	geojson := `{"type": "Feature", "properties": {"name": "Spur", "color": "green"}, "geometry": {"type": "LineString", "coordinates": [[-73.68, 42.73], [-73.67, 42.73]]}}`
+	var envelope apiErrorEnvelope
+	status = v1Request(t, api, "POST", "/routes/import", geojson, &envelope)
+	fields := map[string]bool{}
+	for _, f := range envelope.Error.Fields {
+		fields[f.Field] = true
+	}
+	if status != 422 || !fields["lines[0]"] || !fields["lines[0].color"] {
+		t.Errorf("got status %d and fields %+v, expected 422 for an open loop and invalid color", status, envelope.Error.Fields)
+	}
+	ms.RouteService.AssertNumberOfCalls(t, "CreateRoutesAndStops", 1)
+
+	for _, path := range []string{"/routes/import?format=shp", "/routes/import?max_stop_distance=-1", "/routes/import?preview=maybe"} {
+		var envelope apiErrorEnvelope
+		status := v1Request(t, api, "POST", path, geojson, &envelope)
+		if status != 400 || envelope.Error.Code != apiErrorInvalidQuery {
+			t.Errorf("%s: got status %d and code %q, expected 400 and %q", path, status, envelope.Error.Code, apiErrorInvalidQuery)
+		}
+	}
+}
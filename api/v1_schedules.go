@@ -0,0 +1,376 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// validateDates checks the dates of a ServiceCalendar or ScheduleException.
+func validateDates(start, end shuttletracker.Date) []apiFieldError {
+	fields := []apiFieldError{}
+	if start.IsZero() {
+		fields = append(fields, apiFieldError{Field: "start_date", Message: "is required"})
+	}
+	if end.IsZero() {
+		fields = append(fields, apiFieldError{Field: "end_date", Message: "is required"})
+	} else if end.Before(start) {
+		fields = append(fields, apiFieldError{Field: "end_date", Message: "must not be before start_date"})
+	}
+	return fields
+}
+
+func validateServiceCalendar(calendar *shuttletracker.ServiceCalendar) []apiFieldError {
+	fields := []apiFieldError{}
+	if calendar.Name == "" {
+		fields = append(fields, apiFieldError{Field: "name", Message: "is required"})
+	}
+	return append(fields, validateDates(calendar.StartDate, calendar.EndDate)...)
+}
+
+// validateScheduleException checks a ScheduleException. Its route and calendar are
+// checked against the ModelService.
+func (api *API) validateScheduleException(exception *shuttletracker.ScheduleException) ([]apiFieldError, error) {
+	fields := []apiFieldError{}
+	switch exception.Kind {
+	case shuttletracker.ExceptionSuspend:
+		if len(exception.Schedule) > 0 {
+			fields = append(fields, apiFieldError{Field: "schedule", Message: "must be empty when suspending routes"})
+		}
+	case shuttletracker.ExceptionReplace:
+		if len(exception.Schedule) == 0 {
+			fields = append(fields, apiFieldError{Field: "schedule", Message: "is required when replacing schedules"})
+		}
+	default:
+		fields = append(fields, apiFieldError{Field: "kind", Message: `must be "suspend" or "replace"`})
+	}
+	fields = append(fields, validateSchedule("schedule", exception.Schedule)...)
+
+	if exception.RouteID != nil {
+		_, err := api.ms.Route(*exception.RouteID)
+		if err == shuttletracker.ErrRouteNotFound {
+			fields = append(fields, apiFieldError{Field: "route_id", Message: fmt.Sprintf("route %d does not exist", *exception.RouteID)})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if exception.CalendarID == nil {
+		return append(fields, validateDates(exception.StartDate, exception.EndDate)...), nil
+	}
+	_, err := api.ms.ServiceCalendar(*exception.CalendarID)
+	if err == shuttletracker.ErrServiceCalendarNotFound {
+		fields = append(fields, apiFieldError{Field: "calendar_id", Message: fmt.Sprintf("calendar %d does not exist", *exception.CalendarID)})
+	} else if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func (api *API) v1CalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	calendars, err := api.ms.ServiceCalendars()
+	if err != nil {
+		writeInternalError(w, err, "unable to get calendars")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, calendars)
+}
+
+func (api *API) v1CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	calendar, err := api.ms.ServiceCalendar(id)
+	if err == shuttletracker.ErrServiceCalendarNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "calendar %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get calendar")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, calendar)
+}
+
+// v1CalendarsCreateHandler creates a service calendar and responds with it.
+func (api *API) v1CalendarsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := &shuttletracker.ServiceCalendar{}
+	if !decodeBody(w, r, calendar) {
+		return
+	}
+	calendar.ID = 0
+
+	if fields := validateServiceCalendar(calendar); len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err := api.ms.CreateServiceCalendar(calendar)
+	if err != nil {
+		writeInternalError(w, err, "unable to create calendar")
+		return
+	}
+	api.audit(r, "calendar.create", "calendar", calendar.ID, nil, snapshot(calendar))
+	writeJSONStatus(w, http.StatusCreated, calendar)
+}
+
+// v1CalendarsEditHandler changes the fields of a service calendar that are in the
+// request body and responds with the calendar. Exceptions that apply during it move
+// with its dates.
+func (api *API) v1CalendarsEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	calendar, err := api.ms.ServiceCalendar(id)
+	if err == shuttletracker.ErrServiceCalendarNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "calendar %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get calendar")
+		return
+	}
+	before := snapshot(calendar)
+
+	if !decodeBody(w, r, calendar) {
+		return
+	}
+	calendar.ID = id
+
+	if fields := validateServiceCalendar(calendar); len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err = api.ms.ModifyServiceCalendar(calendar)
+	if err == shuttletracker.ErrServiceCalendarNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "calendar %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to modify calendar")
+		return
+	}
+	api.audit(r, "calendar.modify", "calendar", id, before, snapshot(calendar))
+	writeJSONStatus(w, http.StatusOK, calendar)
+}
+
+// v1CalendarsDeleteHandler deletes a service calendar that no schedule exceptions
+// apply during.
+func (api *API) v1CalendarsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	calendar, err := api.ms.ServiceCalendar(id)
+	if err == shuttletracker.ErrServiceCalendarNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "calendar %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get calendar")
+		return
+	}
+
+	err = api.ms.DeleteServiceCalendar(id)
+	if err == shuttletracker.ErrServiceCalendarInUse {
+		writeAPIError(w, http.StatusConflict, apiErrorConflict,
+			"calendar %d is used by schedule exceptions; delete them first", id)
+		return
+	} else if err == shuttletracker.ErrServiceCalendarNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "calendar %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete calendar")
+		return
+	}
+	api.audit(r, "calendar.delete", "calendar", id, snapshot(calendar), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) v1ScheduleExceptionsHandler(w http.ResponseWriter, r *http.Request) {
+	exceptions, err := api.ms.ScheduleExceptions()
+	if err != nil {
+		writeInternalError(w, err, "unable to get schedule exceptions")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, exceptions)
+}
+
+func (api *API) v1ScheduleExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	exception, err := api.ms.ScheduleException(id)
+	if err == shuttletracker.ErrScheduleExceptionNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "schedule exception %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get schedule exception")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, exception)
+}
+
+// v1ScheduleExceptionsCreateHandler creates a schedule exception and responds with it.
+func (api *API) v1ScheduleExceptionsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	exception := &shuttletracker.ScheduleException{Schedule: shuttletracker.RouteSchedule{}}
+	if !decodeBody(w, r, exception) {
+		return
+	}
+	exception.ID = 0
+
+	fields, err := api.validateScheduleException(exception)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate schedule exception")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err = api.ms.CreateScheduleException(exception)
+	if err != nil {
+		writeInternalError(w, err, "unable to create schedule exception")
+		return
+	}
+	api.audit(r, "schedule_exception.create", "schedule_exception", exception.ID, nil, snapshot(exception))
+	writeJSONStatus(w, http.StatusCreated, exception)
+}
+
+// v1ScheduleExceptionsEditHandler changes the fields of a schedule exception that are
+// in the request body and responds with the exception.
+func (api *API) v1ScheduleExceptionsEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	exception, err := api.ms.ScheduleException(id)
+	if err == shuttletracker.ErrScheduleExceptionNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "schedule exception %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get schedule exception")
+		return
+	}
+	before := snapshot(exception)
+
+	if !decodeBody(w, r, exception) {
+		return
+	}
+	exception.ID = id
+
+	fields, err := api.validateScheduleException(exception)
+	if err != nil {
+		writeInternalError(w, err, "unable to validate schedule exception")
+		return
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	err = api.ms.ModifyScheduleException(exception)
+	if err == shuttletracker.ErrScheduleExceptionNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "schedule exception %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to modify schedule exception")
+		return
+	}
+	api.audit(r, "schedule_exception.modify", "schedule_exception", id, before, snapshot(exception))
+	writeJSONStatus(w, http.StatusOK, exception)
+}
+
+func (api *API) v1ScheduleExceptionsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	exception, err := api.ms.ScheduleException(id)
+	if err == shuttletracker.ErrScheduleExceptionNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "schedule exception %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get schedule exception")
+		return
+	}
+
+	err = api.ms.DeleteScheduleException(id)
+	if err == shuttletracker.ErrScheduleExceptionNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "schedule exception %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete schedule exception")
+		return
+	}
+	api.audit(r, "schedule_exception.delete", "schedule_exception", id, snapshot(exception), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// effectiveSchedule is the response of v1RouteScheduleHandler.
+type effectiveSchedule struct {
+	RouteID int64               `json:"route_id"`
+	Date    shuttletracker.Date `json:"date"`
+	// Exception is the schedule exception that applies on Date, if any.
+	Exception *shuttletracker.ScheduleException `json:"exception"`
+	Schedule  shuttletracker.RouteSchedule      `json:"schedule"`
+	// Periods are when the route runs on Date. A route without a schedule runs all
+	// day.
+	Periods []shuttletracker.Period `json:"periods"`
+}
+
+// v1RouteScheduleHandler previews the schedule that a route runs on on the date in
+// the "date" query parameter, like 2019-12-24, or today if there isn't one. Dates and
+// periods are in the route's time zone.
+func (api *API) v1RouteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	var date shuttletracker.Date
+	if s := r.URL.Query().Get("date"); s != "" {
+		var err error
+		date, err = shuttletracker.ParseDate(s)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "date must be like 2006-01-02")
+			return
+		}
+	}
+
+	route, err := api.ms.Route(id)
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get route")
+		return
+	}
+	loc, err := time.LoadLocation(route.Timezone)
+	if err != nil {
+		writeInternalError(w, err, "unable to load route's time zone")
+		return
+	}
+	if date.IsZero() {
+		date = shuttletracker.DateOf(time.Now().In(loc))
+	}
+	exceptions, err := api.ms.ScheduleExceptions()
+	if err != nil {
+		writeInternalError(w, err, "unable to get schedule exceptions")
+		return
+	}
+
+	s := effectiveSchedule{RouteID: id, Date: date}
+	s.Schedule, s.Exception = route.ScheduleOn(date, exceptions)
+	if s.Exception == nil && len(s.Schedule) == 0 {
+		midnight := time.Time{}
+		s.Periods = []shuttletracker.Period{{
+			Start: shuttletracker.WallTime(date, midnight, loc),
+			End:   shuttletracker.WallTime(date.AddDays(1), midnight, loc),
+		}}
+	} else {
+		s.Periods = s.Schedule.Periods(date, loc)
+	}
+	writeJSONStatus(w, http.StatusOK, s)
+}
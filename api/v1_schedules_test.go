@@ -0,0 +1,145 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func scheduleDate(s string) shuttletracker.Date {
+	d, err := shuttletracker.ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// scheduleModelService has route 1, which runs from 8 to 17 on weekdays, a finals
+// week calendar that replaces its schedule with 10 to 14, and a holiday during
+// finals week that suspends all routes.
+func scheduleModelService() *stmock.ModelService {
+	ms := &stmock.ModelService{}
+	clock := func(hour int) time.Time {
+		return time.Date(0, 1, 1, hour, 0, 0, 0, time.UTC)
+	}
+	weekdays := shuttletracker.RouteSchedule{}
+	for day := time.Monday; day <= time.Friday; day++ {
+		weekdays = append(weekdays, shuttletracker.RouteActiveInterval{StartDay: day, StartTime: clock(8), EndDay: day, EndTime: clock(17)})
+	}
+	ms.RouteService.On("Route", int64(1)).Return(&shuttletracker.Route{ID: 1, Schedule: weekdays}, nil)
+	ms.RouteService.On("Route", int64(2)).Return((*shuttletracker.Route)(nil), shuttletracker.ErrRouteNotFound)
+	ms.ScheduleService.On("ServiceCalendar", int64(1)).Return(&shuttletracker.ServiceCalendar{ID: 1, Name: "Finals week"}, nil)
+	ms.ScheduleService.On("ServiceCalendar", int64(2)).Return((*shuttletracker.ServiceCalendar)(nil), shuttletracker.ErrServiceCalendarNotFound)
+
+	routeID, calendarID := int64(1), int64(1)
+	ms.ScheduleService.On("ScheduleExceptions").Return([]*shuttletracker.ScheduleException{
+		{
+			ID:         1,
+			RouteID:    &routeID,
+			CalendarID: &calendarID,
+			StartDate:  scheduleDate("2019-12-16"),
+			EndDate:    scheduleDate("2019-12-20"),
+			Kind:       shuttletracker.ExceptionReplace,
+			Schedule: shuttletracker.RouteSchedule{
+				{StartDay: time.Monday, StartTime: clock(10), EndDay: time.Friday, EndTime: clock(14)},
+			},
+		},
+		{
+			ID:        2,
+			StartDate: scheduleDate("2019-12-18"),
+			EndDate:   scheduleDate("2019-12-18"),
+			Kind:      shuttletracker.ExceptionSuspend,
+		},
+	}, nil)
+	ms.ScheduleService.On("CreateScheduleException", mock.Anything).Return(nil)
+	return ms
+}
+
+func TestV1RouteSchedule(t *testing.T) {
+	api := &API{ms: scheduleModelService()}
+
+	for _, c := range []struct {
+		date      string
+		exception int64
+		periods   [][2]int
+	}{
+		{"2019-12-09", 0, [][2]int{{8, 17}}},
+		{"2019-12-14", 0, [][2]int{}},
+		// The replacement interval runs all week, so Monday starts at 10 and Tuesday
+		// runs all day.
+		{"2019-12-16", 1, [][2]int{{10, 0}}},
+		{"2019-12-17", 1, [][2]int{{0, 0}}},
+		{"2019-12-18", 2, [][2]int{}},
+		{"2019-12-20", 1, [][2]int{{0, 14}}},
+	} {
+		s := effectiveSchedule{}
+		status := v1Request(t, api, "GET", "/routes/1/schedule?date="+c.date, "", &s)
+		if status != 200 {
+			t.Errorf("%s: got status %d, expected 200", c.date, status)
+			continue
+		}
+		if c.exception == 0 && s.Exception != nil || c.exception != 0 && (s.Exception == nil || s.Exception.ID != c.exception) {
+			t.Errorf("%s: got exception %+v, expected %d", c.date, s.Exception, c.exception)
+		}
+		if len(s.Periods) != len(c.periods) {
+			t.Errorf("%s: got periods %+v, expected %v", c.date, s.Periods, c.periods)
+			continue
+		}
+		for i, p := range s.Periods {
+			if p.Start.Hour() != c.periods[i][0] || p.End.Hour() != c.periods[i][1] {
+				t.Errorf("%s: got period %v to %v, expected hours %v", c.date, p.Start, p.End, c.periods[i])
+			}
+		}
+	}
+
+	var envelope apiErrorEnvelope
+	status := v1Request(t, api, "GET", "/routes/1/schedule?date=tomorrow", "", &envelope)
+	if status != 400 || envelope.Error.Code != apiErrorInvalidQuery {
+		t.Errorf("got status %d, expected 400", status)
+	}
+}
+
+func TestV1ScheduleExceptionsCreate(t *testing.T) {
+	ms := scheduleModelService()
+	api := &API{ms: ms}
+
+	for _, c := range []struct {
+		body   string
+		fields []string
+	}{
+		{`{"kind": "skip", "start_date": "2019-12-20", "end_date": "2019-12-19"}`, []string{"kind", "end_date"}},
+		{`{"kind": "suspend", "route_id": 2, "calendar_id": 2}`, []string{"route_id", "calendar_id"}},
+		{`{"kind": "replace", "start_date": "2019-12-24", "end_date": "2019-12-24"}`, []string{"schedule"}},
+		{`{"kind": "replace", "calendar_id": 1, "schedule": [
+		 {"start_day": 5, "start_time": "0000-01-01T10:00:00Z", "end_day": 5, "end_time": "2019-06-01T10:00:00Z"}]}`, []string{"schedule[0]"}},
+	} {
+		var envelope apiErrorEnvelope
+		status := v1Request(t, api, "POST", "/schedule-exceptions/", c.body, &envelope)
+		fields := []string{}
+		for _, f := range envelope.Error.Fields {
+			fields = append(fields, f.Field)
+		}
+		if status != 422 || len(fields) != len(c.fields) {
+			t.Errorf("%s: got status %d and fields %v, expected 422 and %v", c.body, status, fields, c.fields)
+			continue
+		}
+		for i := range fields {
+			if fields[i] != c.fields[i] {
+				t.Errorf("%s: got fields %v, expected %v", c.body, fields, c.fields)
+				break
+			}
+		}
+	}
+	ms.ScheduleService.AssertNotCalled(t, "CreateScheduleException", mock.Anything)
+
+	exception := shuttletracker.ScheduleException{}
+	status := v1Request(t, api, "POST", "/schedule-exceptions/", `{"kind": "suspend", "route_id": 1, "calendar_id": 1}`, &exception)
+	if status != 201 || exception.Kind != shuttletracker.ExceptionSuspend || *exception.RouteID != 1 {
+		t.Errorf("got status %d and exception %+v, expected 201", status, exception)
+	}
+	ms.ScheduleService.AssertNumberOfCalls(t, "CreateScheduleException", 1)
+}
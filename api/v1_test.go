@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+// noRole lets every request through regardless of role.
+func noRole(role, scope string) func(http.Handler) http.Handler {
+	return noAuth
+}
+
+// v1Request sends a request to the v1 router and decodes the JSON response into v.
+func v1Request(t *testing.T, api *API, method, path, body string, v interface{}) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	resp := w.Result()
+
+	if v != nil {
+		if resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got Content-Type %q, expected \"application/json\"", resp.Header.Get("Content-Type"))
+		}
+		err := json.NewDecoder(resp.Body).Decode(v)
+		if err != nil {
+			t.Fatalf("unable to decode response: %s", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestV1Errors(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.RouteService.On("Route", int64(5)).Return((*shuttletracker.Route)(nil), shuttletracker.ErrRouteNotFound)
+	ms.VehicleService.On("Vehicle", int64(3)).Return((*shuttletracker.Vehicle)(nil), shuttletracker.ErrVehicleNotFound)
+	api := &API{ms: ms}
+
+	for _, c := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"GET", "/routes/abc", "", 400, apiErrorInvalidID},
+		{"GET", "/routes/-1", "", 400, apiErrorInvalidID},
+		{"GET", "/routes/5", "", 404, apiErrorNotFound},
+		{"PATCH", "/routes/5", `{"enabled": true}`, 404, apiErrorNotFound},
+		{"DELETE", "/vehicles/3", "", 404, apiErrorNotFound},
+		{"POST", "/vehicles/", `{"name": `, 400, apiErrorInvalidBody},
+		{"POST", "/stops/", `{"latitude": 91, "longitude": 0}`, 422, apiErrorValidation},
+		{"GET", "/nothing", "", 404, apiErrorNotFound},
+		{"PUT", "/routes/5", "", 405, apiErrorMethodNotAllowed},
+	} {
+		var envelope apiErrorEnvelope
+		status := v1Request(t, api, c.method, c.path, c.body, &envelope)
+		if status != c.status {
+			t.Errorf("%s %s: got status %d, expected %d", c.method, c.path, status, c.status)
+		}
+		if envelope.Error.Code != c.code {
+			t.Errorf("%s %s: got code %q, expected %q", c.method, c.path, envelope.Error.Code, c.code)
+		}
+		if envelope.Error.Message == "" {
+			t.Errorf("%s %s: expected a message", c.method, c.path)
+		}
+	}
+}
+
+func TestV1RoutesCreate(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.StopService.On("Stop", int64(1)).Return(&shuttletracker.Stop{ID: 1}, nil)
+	ms.StopService.On("Stop", int64(2)).Return((*shuttletracker.Stop)(nil), shuttletracker.ErrStopNotFound)
+	ms.RouteService.On("CreateRouteWithStops", mock.Anything, mock.Anything, "").Run(func(args mock.Arguments) {
+		args.Get(0).(*shuttletracker.Route).ID = 7
+	}).Return(nil)
+	api := &API{ms: ms}
+
+	var envelope apiErrorEnvelope
+	status := v1Request(t, api, "POST", "/routes/", `{"name": "", "color": "red", "stop_ids": [1, 2]}`, &envelope)
+	if status != 422 {
+		t.Errorf("got status %d, expected 422", status)
+	}
+	fields := map[string]bool{}
+	for _, f := range envelope.Error.Fields {
+		fields[f.Field] = true
+	}
+	for _, field := range []string{"name", "color", "stop_ids[1]"} {
+		if !fields[field] {
+			t.Errorf("expected %s to fail validation", field)
+		}
+	}
+	if len(envelope.Error.Fields) != 3 {
+		t.Errorf("got %d invalid fields, expected 3", len(envelope.Error.Fields))
+	}
+	ms.RouteService.AssertNotCalled(t, "CreateRouteWithStops", mock.Anything, mock.Anything, mock.Anything)
+
+	var route shuttletracker.Route
+	status = v1Request(t, api, "POST", "/routes/", `{"name": "West", "enabled": true, "stop_ids": [1]}`, &route)
+	if status != 201 {
+		t.Errorf("got status %d, expected 201", status)
+	}
+	if route.ID != 7 || route.Name != "West" || route.Width != 4 || route.Color != "#ffffff" {
+		t.Errorf("unexpected route %+v", route)
+	}
+}
+
+func TestV1RoutesEdit(t *testing.T) {
+	ms := &stmock.ModelService{}
+	existing := &shuttletracker.Route{ID: 4, Name: "East", Width: 4, Color: "#00ff00", StopIDs: []int64{}}
+	ms.RouteService.On("Route", int64(4)).Return(existing, nil)
+	ms.RouteService.On("ModifyRouteWithStops", mock.Anything, mock.Anything, "").Return(nil).Once()
+	ms.DetourService.On("Detours").Return([]*shuttletracker.Detour{}, nil)
+	api := &API{ms: ms}
+
+	var route shuttletracker.Route
+	status := v1Request(t, api, "PATCH", "/routes/4", `{"id": 9, "enabled": true}`, &route)
+	if status != 200 {
+		t.Errorf("got status %d, expected 200", status)
+	}
+	if route.ID != 4 || route.Name != "East" || route.Color != "#00ff00" || !route.Enabled {
+		t.Errorf("unexpected route %+v", route)
+	}
+	ms.RouteService.AssertNumberOfCalls(t, "ModifyRouteWithStops", 1)
+
+	ms.RouteService.On("ModifyRouteWithStops", mock.Anything, mock.Anything, "").Return(shuttletracker.ErrRouteModified).Once()
+	var envelope apiErrorEnvelope
+	status = v1Request(t, api, "PATCH", "/routes/4", `{"updated": "2019-01-01T00:00:00Z", "width": 5}`, &envelope)
+	if status != 409 || envelope.Error.Code != apiErrorConflict {
+		t.Errorf("got status %d and code %q, expected 409 and %q", status, envelope.Error.Code, apiErrorConflict)
+	}
+}
+
+func TestV1VehicleConflict(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.VehicleService.On("Vehicle", int64(2)).Return(&shuttletracker.Vehicle{ID: 2, Name: "Bus 2", TrackerID: "2"}, nil)
+	ms.VehicleService.On("VehicleWithTrackerID", "2").Return(&shuttletracker.Vehicle{ID: 2, TrackerID: "2"}, nil)
+	ms.VehicleService.On("VehicleWithTrackerID", "3").Return(&shuttletracker.Vehicle{ID: 3, TrackerID: "3"}, nil)
+	ms.VehicleService.On("ModifyVehicle", mock.Anything).Return(nil)
+	ms.VehicleService.On("DeleteVehicle", int64(2)).Return(nil)
+	api := &API{ms: ms}
+
+	var vehicle shuttletracker.Vehicle
+	status := v1Request(t, api, "PATCH", "/vehicles/2", `{"name": "Bus Two"}`, &vehicle)
+	if status != 200 {
+		t.Errorf("got status %d, expected 200", status)
+	}
+	if vehicle.Name != "Bus Two" || vehicle.TrackerID != "2" {
+		t.Errorf("unexpected vehicle %+v", vehicle)
+	}
+	ms.VehicleService.AssertNumberOfCalls(t, "ModifyVehicle", 1)
+
+	var envelope apiErrorEnvelope
+	status = v1Request(t, api, "PATCH", "/vehicles/2", `{"tracker_id": "3"}`, &envelope)
+	if status != 409 || envelope.Error.Code != apiErrorConflict {
+		t.Errorf("got status %d and code %q, expected 409 and %q", status, envelope.Error.Code, apiErrorConflict)
+	}
+
+	status = v1Request(t, api, "DELETE", "/vehicles/2", "", nil)
+	if status != http.StatusNoContent {
+		t.Errorf("got status %d, expected 204", status)
+	}
+}
+
+func TestV1StopsDelete(t *testing.T) {
+	ms := &stmock.ModelService{}
+	ms.StopService.On("Stop", int64(6)).Return(&shuttletracker.Stop{ID: 6}, nil)
+	ms.StopService.On("DeleteStop", int64(6), false, "").Return(&shuttletracker.StopInUseError{RouteIDs: []int64{1, 3}})
+	ms.StopService.On("DeleteStop", int64(6), true, "").Return(nil)
+	api := &API{ms: ms}
+
+	envelope := struct {
+		Error struct {
+			Code    string
+			Details struct {
+				RouteIDs []int64 `json:"route_ids"`
+			}
+		}
+	}{}
+	status := v1Request(t, api, "DELETE", "/stops/6", "", &envelope)
+	if status != 409 || envelope.Error.Code != apiErrorConflict {
+		t.Errorf("got status %d and code %q, expected 409 and %q", status, envelope.Error.Code, apiErrorConflict)
+	}
+	if len(envelope.Error.Details.RouteIDs) != 2 {
+		t.Errorf("got route IDs %v, expected [1 3]", envelope.Error.Details.RouteIDs)
+	}
+
+	status = v1Request(t, api, "DELETE", "/stops/6?detach=maybe", "", &envelope)
+	if status != 400 {
+		t.Errorf("got status %d, expected 400", status)
+	}
+
+	status = v1Request(t, api, "DELETE", "/stops/6?detach=true", "", nil)
+	if status != http.StatusNoContent {
+		t.Errorf("got status %d, expected 204", status)
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/ical"
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	// Timetables are for a week unless a "days" query parameter says otherwise.
+	defaultTimetableDays = 7
+	maxTimetableDays     = 62
+
+	// iCalendar feeds keep a week of past service so that calendar apps don't
+	// drop events as soon as they end, and look eight weeks ahead.
+	icalPastDays = 7
+	icalDays     = icalPastDays + 8*7
+)
+
+// timetable makes a route's Timetable in its time zone. Routes without enough
+// history for loop stats still get a timetable, just without departures and
+// frequency.
+func (api *API) timetable(route *shuttletracker.Route, exceptions []*shuttletracker.ScheduleException, from shuttletracker.Date, days int, loc *time.Location) *shuttletracker.Timetable {
+	var stats *shuttletracker.RouteLoopStats
+	if api.etaManager != nil {
+		var err error
+		stats, err = api.etaManager.RouteLoopStats(route.ID)
+		if err != nil {
+			log.WithError(err).Warnf("unable to get loop stats for route %d", route.ID)
+			stats = nil
+		}
+	}
+	return shuttletracker.NewTimetable(route, exceptions, stats, from, days, loc)
+}
+
+// v1RouteTimetableHandler gets a route's timetable starting on the date in the "date"
+// query parameter, or today if there isn't one, for the number of days in the "days"
+// query parameter.
+func (api *API) v1RouteTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	var date shuttletracker.Date
+	if s := r.URL.Query().Get("date"); s != "" {
+		var err error
+		date, err = shuttletracker.ParseDate(s)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "date must be like 2006-01-02")
+			return
+		}
+	}
+	days := defaultTimetableDays
+	if s := r.URL.Query().Get("days"); s != "" {
+		var err error
+		days, err = strconv.Atoi(s)
+		if err != nil || days < 1 || days > maxTimetableDays {
+			writeAPIError(w, http.StatusBadRequest, apiErrorInvalidQuery, "days must be between 1 and %d", maxTimetableDays)
+			return
+		}
+	}
+
+	route, err := api.ms.Route(id)
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get route")
+		return
+	}
+	loc, err := time.LoadLocation(route.Timezone)
+	if err != nil {
+		writeInternalError(w, err, "unable to load route's time zone")
+		return
+	}
+	if date.IsZero() {
+		date = shuttletracker.DateOf(time.Now().In(loc))
+	}
+	exceptions, err := api.ms.ScheduleExceptions()
+	if err != nil {
+		writeInternalError(w, err, "unable to get schedule exceptions")
+		return
+	}
+
+	writeJSONStatus(w, http.StatusOK, api.timetable(route, exceptions, date, days, loc))
+}
+
+// v1RouteTimetableICalHandler gets an iCalendar feed of when a route runs.
+func (api *API) v1RouteTimetableICalHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	route, err := api.ms.Route(id)
+	if err == shuttletracker.ErrRouteNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "route %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get route")
+		return
+	}
+	api.writeTimetableICal(w, r, route.Name, []*shuttletracker.Route{route})
+}
+
+// v1TimetablesICalHandler gets an iCalendar feed of when every enabled route runs.
+func (api *API) v1TimetablesICalHandler(w http.ResponseWriter, r *http.Request) {
+	routes, err := api.ms.Routes()
+	if err != nil {
+		writeInternalError(w, err, "unable to get routes")
+		return
+	}
+	enabled := []*shuttletracker.Route{}
+	for _, route := range routes {
+		if route.Enabled {
+			enabled = append(enabled, route)
+		}
+	}
+	api.writeTimetableICal(w, r, "Shuttles", enabled)
+}
+
+// writeTimetableICal writes an iCalendar feed with an event for each span of service
+// of routes.
+func (api *API) writeTimetableICal(w http.ResponseWriter, r *http.Request, name string, routes []*shuttletracker.Route) {
+	exceptions, err := api.ms.ScheduleExceptions()
+	if err != nil {
+		writeInternalError(w, err, "unable to get schedule exceptions")
+		return
+	}
+
+	c := &ical.Calendar{Name: name, Events: []ical.Event{}}
+	for _, route := range routes {
+		loc, err := time.LoadLocation(route.Timezone)
+		if err != nil {
+			writeInternalError(w, err, "unable to load route's time zone")
+			return
+		}
+		if c.Timezone == "" {
+			c.Timezone = loc.String()
+		}
+		from := shuttletracker.DateOf(time.Now().In(loc)).AddDays(-icalPastDays)
+		tt := api.timetable(route, exceptions, from, icalDays, loc)
+		for _, day := range tt.Days {
+			for _, span := range day.Service {
+				c.Events = append(c.Events, ical.Event{
+					UID:         fmt.Sprintf("route-%d-%d@%s", route.ID, span.Start.Unix(), api.cfg.CalendarDomain),
+					Start:       span.Start,
+					End:         span.End,
+					Summary:     route.Name,
+					Description: serviceDescription(tt, span, loc),
+					Updated:     route.Updated,
+				})
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := ical.Write(buf, c); err != nil {
+		writeInternalError(w, err, "unable to write calendar")
+		return
+	}
+	w.Header().Set("Content-Type", ical.ContentType)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.WithError(err).Error("unable to write calendar")
+	}
+}
+
+// serviceDescription describes a span of service for riders, e.g. "First departure
+// 8:00 AM, last departure 4:40 PM. Shuttles leave about every 10 minutes."
+func serviceDescription(tt *shuttletracker.Timetable, span shuttletracker.ServiceSpan, loc *time.Location) string {
+	const kitchen = "3:04 PM"
+	s := fmt.Sprintf("First departure %s, last departure %s.",
+		span.FirstDeparture.In(loc).Format(kitchen), span.LastDeparture.In(loc).Format(kitchen))
+	if tt.FrequencySeconds > 0 {
+		s += fmt.Sprintf(" Shuttles leave about every %d minutes.", (tt.FrequencySeconds+30)/60)
+	}
+	return s
+}
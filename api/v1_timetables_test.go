@@ -0,0 +1,85 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestV1RouteTimetable(t *testing.T) {
+	etas := &stmock.ETAService{}
+	etas.On("RouteLoopStats", int64(1)).Return(&shuttletracker.RouteLoopStats{RouteID: 1, Loops: 8, Duration: 20 * time.Minute, Headway: 10 * time.Minute}, nil)
+	api := &API{ms: scheduleModelService(), etaManager: etas}
+
+	tt := shuttletracker.Timetable{}
+	status := v1Request(t, api, "GET", "/routes/1/timetable?date=2019-12-16&days=3", "", &tt)
+	if status != 200 || len(tt.Days) != 3 || tt.FrequencySeconds != 600 {
+		t.Fatalf("got status %d and timetable %+v, expected 200 and three days", status, tt)
+	}
+	// Finals week runs from 10 on Monday through Tuesday, but Wednesday is a holiday.
+	monday := tt.Days[0].Service
+	if len(monday) != 1 || monday[0].FirstDeparture.Hour() != 10 || !monday[0].End.Equal(monday[0].Start.Add(38*time.Hour)) {
+		t.Errorf("got Monday service %+v, expected 10:00 on Monday until midnight on Tuesday", monday)
+	} else if last := monday[0].LastDeparture; last.Hour() != 23 || last.Minute() != 40 {
+		t.Errorf("got last departure %s, expected 23:40", last)
+	}
+	if len(tt.Days[1].Service) != 0 || len(tt.Days[2].Service) != 0 || tt.Days[2].Exception == nil || tt.Days[2].Exception.ID != 2 {
+		t.Errorf("got days %+v, expected no more service", tt.Days[1:])
+	}
+
+	for _, path := range []string{"/routes/1/timetable?days=0", "/routes/1/timetable?days=week", "/routes/1/timetable?date=monday"} {
+		var envelope apiErrorEnvelope
+		status = v1Request(t, api, "GET", path, "", &envelope)
+		if status != 400 || envelope.Error.Code != apiErrorInvalidQuery {
+			t.Errorf("%s: got status %d, expected 400", path, status)
+		}
+	}
+	var envelope apiErrorEnvelope
+	if status = v1Request(t, api, "GET", "/routes/2/timetable", "", &envelope); status != 404 {
+		t.Errorf("got status %d, expected 404", status)
+	}
+}
+
+func TestV1TimetablesICal(t *testing.T) {
+	ms := scheduleModelService()
+	weekdays := shuttletracker.RouteSchedule{}
+	for day := time.Monday; day <= time.Friday; day++ {
+		weekdays = append(weekdays, shuttletracker.RouteActiveInterval{
+			StartDay: day, StartTime: time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC),
+			EndDay: day, EndTime: time.Date(0, 1, 1, 17, 0, 0, 0, time.UTC),
+		})
+	}
+	ms.RouteService.On("Routes").Return([]*shuttletracker.Route{
+		{ID: 3, Name: "East", Enabled: true, Schedule: weekdays},
+		{ID: 4, Name: "Retired"},
+	}, nil)
+	api := &API{ms: ms, cfg: Config{CalendarDomain: "shuttles.example.edu"}}
+
+	req := httptest.NewRequest("GET", "/routes/timetable.ics", nil)
+	req.Host = "attacker.example.com"
+	w := httptest.NewRecorder()
+	api.v1Router(noRole).ServeHTTP(w, req)
+	resp := w.Result()
+	body, _ := ioutil.ReadAll(resp.Body)
+	out := string(body)
+
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("got status %d and Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	// Nine weeks of weekdays
+	if n := strings.Count(out, "BEGIN:VEVENT"); n < 44 || n > 46 {
+		t.Errorf("got %d events, expected about 45", n)
+	}
+	if strings.Contains(out, "Retired") || !strings.Contains(out, "SUMMARY:East\r\n") {
+		t.Errorf("got calendar with the wrong routes:\n%s", out)
+	}
+	// UIDs don't depend on the Host header
+	if strings.Contains(out, "attacker.example.com") || !strings.Contains(out, "@shuttles.example.edu\r\n") {
+		t.Errorf("got calendar with the wrong UID domain:\n%s", out)
+	}
+}
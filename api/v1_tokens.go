@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/auth"
+)
+
+const (
+	// apiTokenDefaultTTL is how long API tokens last unless they're created with
+	// another expiry. apiTokenMaxTTL is the longest they can last.
+	apiTokenDefaultTTL = 90 * 24 * time.Hour
+	apiTokenMaxTTL     = 366 * 24 * time.Hour
+)
+
+// apiTokenCreated is the response to creating an APIToken. It is the only time that
+// the token itself is available.
+type apiTokenCreated struct {
+	*shuttletracker.APIToken
+	Token string `json:"token"`
+}
+
+// v1TokensHandler lists API tokens, or only a User's if the "username" query parameter
+// is given. Tokens themselves aren't included.
+func (api *API) v1TokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens, err := api.tokens.APITokens(strings.ToLower(r.URL.Query().Get("username")))
+	if err != nil {
+		writeInternalError(w, err, "unable to get API tokens")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, tokens)
+}
+
+// v1TokensCreateHandler creates an API token and responds with it. It acts as the
+// administrator making the request unless the body names another.
+func (api *API) v1TokensCreateHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Name      string   `json:"name"`
+		Username  string   `json:"username"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn string   `json:"expires_in"`
+	}{Username: api.username(r)}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	token := &shuttletracker.APIToken{
+		Name:     body.Name,
+		Username: strings.ToLower(body.Username),
+		Scopes:   body.Scopes,
+	}
+
+	fields := []apiFieldError{}
+	if token.Name == "" {
+		fields = append(fields, apiFieldError{Field: "name", Message: "is required"})
+	}
+	if len(token.Scopes) == 0 {
+		fields = append(fields, apiFieldError{Field: "scopes", Message: "must have at least one of " + strings.Join(shuttletracker.Scopes, ", ")})
+	}
+	for i, scope := range token.Scopes {
+		if !shuttletracker.ValidScope(scope) {
+			fields = append(fields, apiFieldError{Field: fmt.Sprintf("scopes[%d]", i), Message: "is not a scope"})
+		}
+	}
+	ttl := apiTokenDefaultTTL
+	if body.ExpiresIn != "" {
+		var err error
+		ttl, err = time.ParseDuration(body.ExpiresIn)
+		if err != nil || ttl <= 0 || ttl > apiTokenMaxTTL {
+			fields = append(fields, apiFieldError{Field: "expires_in", Message: "must be a duration up to " + apiTokenMaxTTL.String()})
+		}
+	}
+	exists, err := api.us.UserExists(token.Username)
+	if err != nil {
+		writeInternalError(w, err, "unable to check if user exists")
+		return
+	}
+	if !exists {
+		fields = append(fields, apiFieldError{Field: "username", Message: "is not an administrator"})
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	secret, hash, err := auth.NewAPIToken()
+	if err != nil {
+		writeInternalError(w, err, "unable to generate API token")
+		return
+	}
+	token.Prefix = secret[:8]
+	token.Expires = time.Now().Add(ttl)
+	err = api.tokens.CreateAPIToken(token, hash)
+	if err != nil {
+		writeInternalError(w, err, "unable to create API token")
+		return
+	}
+	api.audit(r, "token.create", "token", token.ID, nil, snapshot(token))
+	writeJSONStatus(w, http.StatusCreated, apiTokenCreated{APIToken: token, Token: secret})
+}
+
+// v1TokensDeleteHandler revokes an API token.
+func (api *API) v1TokensDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	token, err := api.tokens.APIToken(id)
+	if err == shuttletracker.ErrAPITokenNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "API token %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get API token")
+		return
+	}
+
+	err = api.tokens.DeleteAPIToken(id)
+	if err == shuttletracker.ErrAPITokenNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "API token %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete API token")
+		return
+	}
+	api.audit(r, "token.delete", "token", id, snapshot(token), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/auth"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestV1TokensCreate(t *testing.T) {
+	us := &stmock.UserService{}
+	us.On("UserExists", "dispatch").Return(true, nil)
+	us.On("UserExists", "nobody").Return(false, nil)
+	tokens := &stmock.APITokenService{}
+	var hash []byte
+	tokens.On("CreateAPIToken", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*shuttletracker.APIToken).ID = 5
+		hash = args.Get(1).([]byte)
+	}).Return(nil)
+	api := &API{us: us, tokens: tokens}
+
+	var envelope apiErrorEnvelope
+	status := v1Request(t, api, "POST", "/tokens/", `{"username": "nobody", "scopes": ["messages", "everything"], "expires_in": "9000h"}`, &envelope)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d, expected 422", status)
+	}
+	fields := map[string]bool{}
+	for _, f := range envelope.Error.Fields {
+		fields[f.Field] = true
+	}
+	for _, field := range []string{"name", "username", "scopes[1]", "expires_in"} {
+		if !fields[field] {
+			t.Errorf("expected %s to fail validation", field)
+		}
+	}
+
+	created := struct {
+		ID       int64
+		Username string
+		Prefix   string
+		Token    string
+	}{}
+	status = v1Request(t, api, "POST", "/tokens/", `{"name": "Dispatch console", "username": "dispatch", "scopes": ["messages", "vehicles"]}`, &created)
+	if status != http.StatusCreated || created.ID != 5 || created.Username != "dispatch" {
+		t.Fatalf("got status %d and %+v, expected 201 and token 5", status, created)
+	}
+	if !strings.HasPrefix(created.Token, created.Prefix) || string(auth.HashAPIToken(created.Token)) != string(hash) {
+		t.Errorf("stored hash doesn't match token %q", created.Token)
+	}
+}
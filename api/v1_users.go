@@ -0,0 +1,148 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// maxUsernameLength is the longest username that can be added. OIDC usernames are
+// often email addresses, so it's much longer than an RCS ID.
+const maxUsernameLength = 254
+
+func (api *API) v1UsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := api.us.Users()
+	if err != nil {
+		writeInternalError(w, err, "unable to get users")
+		return
+	}
+	if users == nil {
+		users = []*shuttletracker.User{}
+	}
+	writeJSONStatus(w, http.StatusOK, users)
+}
+
+// v1User gets the User named by the "username" URL parameter. If it can't, it writes
+// an error and returns nil.
+func (api *API) v1User(w http.ResponseWriter, r *http.Request) *shuttletracker.User {
+	username := strings.ToLower(chi.URLParam(r, "username"))
+	user, err := api.us.User(username)
+	if err == shuttletracker.ErrUserNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "user %q not found", username)
+		return nil
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get user")
+		return nil
+	}
+	return user
+}
+
+// v1UsersCreateHandler adds an administrator. They are a viewer unless the body has
+// another role.
+func (api *API) v1UsersCreateHandler(w http.ResponseWriter, r *http.Request) {
+	user := &shuttletracker.User{Role: shuttletracker.RoleViewer}
+	if !decodeBody(w, r, user) {
+		return
+	}
+	user.ID = 0
+	user.Username = strings.ToLower(user.Username)
+
+	fields := []apiFieldError{}
+	if user.Username == "" || len(user.Username) > maxUsernameLength {
+		fields = append(fields, apiFieldError{Field: "username", Message: fmt.Sprintf("must be 1 to %d characters", maxUsernameLength)})
+	}
+	if !shuttletracker.ValidRole(user.Role) {
+		fields = append(fields, apiFieldError{Field: "role", Message: "must be one of " + strings.Join(shuttletracker.Roles, ", ")})
+	}
+	for i, p := range user.Permissions {
+		if !shuttletracker.ValidPermission(p) {
+			fields = append(fields, apiFieldError{Field: fmt.Sprintf("permissions[%d]", i), Message: "is not a permission"})
+		}
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return
+	}
+
+	exists, err := api.us.UserExists(user.Username)
+	if err != nil {
+		writeInternalError(w, err, "unable to check if user exists")
+		return
+	}
+	if exists {
+		writeAPIError(w, http.StatusConflict, apiErrorConflict, "user %q already exists", user.Username)
+		return
+	}
+
+	err = api.us.CreateUser(user)
+	if err != nil {
+		writeInternalError(w, err, "unable to create user")
+		return
+	}
+	api.audit(r, "user.create", "user", user.ID, nil, snapshot(user))
+	writeJSONStatus(w, http.StatusCreated, user)
+}
+
+// v1UsersEditHandler changes an administrator's role. Owners can't change their own
+// role, so that there is always an owner.
+func (api *API) v1UsersEditHandler(w http.ResponseWriter, r *http.Request) {
+	user := api.v1User(w, r)
+	if user == nil {
+		return
+	}
+	before := snapshot(user)
+
+	body := struct {
+		Role string `json:"role"`
+	}{}
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if !shuttletracker.ValidRole(body.Role) {
+		writeValidationErrors(w, []apiFieldError{{Field: "role", Message: "must be one of " + strings.Join(shuttletracker.Roles, ", ")}})
+		return
+	}
+	if user.Username == api.username(r) && body.Role != user.Role {
+		writeAPIError(w, http.StatusConflict, apiErrorConflict, "you can't change your own role")
+		return
+	}
+
+	err := api.us.SetRole(user.Username, body.Role)
+	if err == shuttletracker.ErrUserNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "user %q not found", user.Username)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to set role")
+		return
+	}
+	user.Role = body.Role
+	api.audit(r, "user.modify", "user", user.ID, before, snapshot(user))
+	writeJSONStatus(w, http.StatusOK, user)
+}
+
+// v1UsersDeleteHandler removes an administrator other than the one making the request.
+func (api *API) v1UsersDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	user := api.v1User(w, r)
+	if user == nil {
+		return
+	}
+	if user.Username == api.username(r) {
+		writeAPIError(w, http.StatusConflict, apiErrorConflict, "you can't remove yourself")
+		return
+	}
+
+	err := api.us.DeleteUser(user.Username)
+	if err == shuttletracker.ErrUserNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "user %q not found", user.Username)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete user")
+		return
+	}
+	api.audit(r, "user.delete", "user", user.ID, snapshot(user), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/auth"
+	stmock "github.com/wtg/shuttletracker/mock"
+)
+
+func TestV1Users(t *testing.T) {
+	us := &stmock.UserService{}
+	us.On("UserExists", "naraya5").Return(true, nil)
+	us.On("UserExists", "lazare2").Return(false, nil)
+	us.On("CreateUser", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*shuttletracker.User).ID = 3
+	}).Return(nil)
+	us.On("User", "lyonj4").Return(&shuttletracker.User{ID: 1, Username: "lyonj4", Role: shuttletracker.RoleOwner}, nil)
+	us.On("User", "naraya5").Return(&shuttletracker.User{ID: 2, Username: "naraya5", Role: shuttletracker.RoleViewer}, nil)
+	us.On("SetRole", "naraya5", shuttletracker.RoleEditor).Return(nil)
+	api := &API{us: us, cli: InjectMocks(&auth.Mock{}, us, false)}
+
+	var envelope apiErrorEnvelope
+	status := v1Request(t, api, "POST", "/users/", `{"username": "naraya5"}`, &envelope)
+	if status != http.StatusConflict {
+		t.Errorf("got status %d creating an existing user, expected 409", status)
+	}
+	status = v1Request(t, api, "POST", "/users/", `{"username": "lazare2", "role": "janitor"}`, &envelope)
+	if status != http.StatusUnprocessableEntity || len(envelope.Error.Fields) != 1 || envelope.Error.Fields[0].Field != "role" {
+		t.Errorf("got status %d and %+v, expected 422 for role", status, envelope.Error.Fields)
+	}
+
+	var user shuttletracker.User
+	status = v1Request(t, api, "POST", "/users/", `{"username": "Lazare2"}`, &user)
+	if status != http.StatusCreated || user.ID != 3 || user.Username != "lazare2" || user.Role != shuttletracker.RoleViewer {
+		t.Errorf("got status %d and user %+v, expected 201 and a viewer", status, user)
+	}
+
+	status = v1Request(t, api, "PATCH", "/users/naraya5", `{"role": "editor"}`, &user)
+	if status != http.StatusOK || user.Role != shuttletracker.RoleEditor {
+		t.Errorf("got status %d and user %+v, expected 200 and an editor", status, user)
+	}
+
+	// owners can't lock themselves out
+	status = v1Request(t, api, "PATCH", "/users/lyonj4", `{"role": "viewer"}`, &envelope)
+	if status != http.StatusConflict {
+		t.Errorf("got status %d demoting yourself, expected 409", status)
+	}
+	status = v1Request(t, api, "DELETE", "/users/lyonj4", "", &envelope)
+	if status != http.StatusConflict {
+		t.Errorf("got status %d removing yourself, expected 409", status)
+	}
+	us.AssertNotCalled(t, "SetRole", "lyonj4", mock.Anything)
+	us.AssertNotCalled(t, "DeleteUser", mock.Anything)
+}
+
+func TestV1UsersCreateLongUsername(t *testing.T) {
+	const username = "transportation.dispatcher@example.edu"
+	us := &stmock.UserService{}
+	us.On("User", "lyonj4").Return(&shuttletracker.User{ID: 1, Username: "lyonj4", Role: shuttletracker.RoleOwner}, nil)
+	us.On("UserExists", username).Return(false, nil)
+	us.On("CreateUser", mock.Anything).Return(nil)
+	api := &API{us: us, cli: InjectMocks(&auth.Mock{}, us, false)}
+
+	var user shuttletracker.User
+	status := v1Request(t, api, "POST", "/users/", `{"username": "`+username+`"}`, &user)
+	if status != http.StatusCreated || user.Username != username {
+		t.Errorf("got status %d and user %+v, expected 201 and %s", status, user, username)
+	}
+
+	var envelope apiErrorEnvelope
+	status = v1Request(t, api, "POST", "/users/", `{"username": "`+strings.Repeat("a", maxUsernameLength+1)+`"}`, &envelope)
+	if status != http.StatusUnprocessableEntity || len(envelope.Error.Fields) != 1 || envelope.Error.Fields[0].Field != "username" {
+		t.Errorf("got status %d and %+v, expected 422 for username", status, envelope.Error.Fields)
+	}
+}
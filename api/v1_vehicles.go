@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// validateVehicle checks a Vehicle's fields. A tracker ID that belongs to another
+// Vehicle is reported separately as a conflict.
+func (api *API) validateVehicle(w http.ResponseWriter, vehicle *shuttletracker.Vehicle) bool {
+	fields := []apiFieldError{}
+	if vehicle.Name == "" {
+		fields = append(fields, apiFieldError{Field: "name", Message: "is required"})
+	}
+	if len(vehicle.TrackerID) > 10 {
+		fields = append(fields, apiFieldError{Field: "tracker_id", Message: "must be at most 10 characters"})
+	}
+	if len(fields) > 0 {
+		writeValidationErrors(w, fields)
+		return false
+	}
+
+	if vehicle.TrackerID == "" {
+		return true
+	}
+	other, err := api.ms.VehicleWithTrackerID(vehicle.TrackerID)
+	if err == shuttletracker.ErrVehicleNotFound {
+		return true
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get vehicle")
+		return false
+	}
+	if other.ID != vehicle.ID {
+		writeAPIError(w, http.StatusConflict, apiErrorConflict,
+			"tracker ID %q is already used by vehicle %d", vehicle.TrackerID, other.ID)
+		return false
+	}
+	return true
+}
+
+func (api *API) v1VehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	vehicles, err := api.ms.Vehicles()
+	if err != nil {
+		writeInternalError(w, err, "unable to get vehicles")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, vehicles)
+}
+
+func (api *API) v1VehicleHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	vehicle, err := api.ms.Vehicle(id)
+	if err == shuttletracker.ErrVehicleNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "vehicle %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get vehicle")
+		return
+	}
+	writeJSONStatus(w, http.StatusOK, vehicle)
+}
+
+// v1VehiclesCreateHandler creates a vehicle and responds with it.
+func (api *API) v1VehiclesCreateHandler(w http.ResponseWriter, r *http.Request) {
+	vehicle := &shuttletracker.Vehicle{}
+	if !decodeBody(w, r, vehicle) {
+		return
+	}
+	vehicle.ID = 0
+
+	if !api.validateVehicle(w, vehicle) {
+		return
+	}
+
+	err := api.ms.CreateVehicle(vehicle)
+	if err != nil {
+		writeInternalError(w, err, "unable to create vehicle")
+		return
+	}
+	api.audit(r, "vehicle.create", "vehicle", vehicle.ID, nil, snapshot(vehicle))
+	writeJSONStatus(w, http.StatusCreated, vehicle)
+}
+
+// v1VehiclesEditHandler changes the fields of a vehicle that are in the request body
+// and responds with the vehicle.
+func (api *API) v1VehiclesEditHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	vehicle, err := api.ms.Vehicle(id)
+	if err == shuttletracker.ErrVehicleNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "vehicle %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get vehicle")
+		return
+	}
+	before := snapshot(vehicle)
+
+	if !decodeBody(w, r, vehicle) {
+		return
+	}
+	vehicle.ID = id
+
+	if !api.validateVehicle(w, vehicle) {
+		return
+	}
+
+	err = api.ms.ModifyVehicle(vehicle)
+	if err == shuttletracker.ErrVehicleNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "vehicle %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to modify vehicle")
+		return
+	}
+	api.audit(r, "vehicle.modify", "vehicle", id, before, snapshot(vehicle))
+	writeJSONStatus(w, http.StatusOK, vehicle)
+}
+
+func (api *API) v1VehiclesDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r)
+	if !ok {
+		return
+	}
+	vehicle, err := api.ms.Vehicle(id)
+	if err == shuttletracker.ErrVehicleNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "vehicle %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to get vehicle")
+		return
+	}
+
+	err = api.ms.DeleteVehicle(id)
+	if err == shuttletracker.ErrVehicleNotFound {
+		writeAPIError(w, http.StatusNotFound, apiErrorNotFound, "vehicle %d not found", id)
+		return
+	} else if err != nil {
+		writeInternalError(w, err, "unable to delete vehicle")
+		return
+	}
+	api.audit(r, "vehicle.delete", "vehicle", id, snapshot(vehicle), nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -36,7 +36,9 @@ func (api *API) VehiclesCreateHandler(w http.ResponseWriter, r *http.Request) {
 	err = api.ms.CreateVehicle(&vehicle)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	api.audit(r, "vehicle.create", "vehicle", vehicle.ID, nil, snapshot(vehicle))
 }
 
 func (api *API) VehiclesEditHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,6 +59,7 @@ func (api *API) VehiclesEditHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	before := snapshot(vehicle)
 
 	vehicle.Name = name
 	vehicle.Enabled = enabled
@@ -68,6 +71,7 @@ func (api *API) VehiclesEditHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	api.audit(r, "vehicle.modify", "vehicle", vehicle.ID, before, snapshot(vehicle))
 }
 
 func (api *API) VehiclesDeleteHandler(w http.ResponseWriter, r *http.Request) {
@@ -76,6 +80,16 @@ func (api *API) VehiclesDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	vehicle, err := api.ms.Vehicle(id)
+	if err == shuttletracker.ErrVehicleNotFound {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("unable to get vehicle")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = api.ms.DeleteVehicle(id)
 	if err != nil {
 		if err == shuttletracker.ErrVehicleNotFound {
@@ -83,7 +97,9 @@ func (api *API) VehiclesDeleteHandler(w http.ResponseWriter, r *http.Request) {
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
+		return
 	}
+	api.audit(r, "vehicle.delete", "vehicle", id, snapshot(vehicle), nil)
 }
 
 // UpdatesHandler gets the most recent update for each enabled vehicle.
@@ -284,6 +284,7 @@ func TestVehiclesEditHandler(t *testing.T) {
 func TestVehiclesDeleteHandler(t *testing.T) {
 	ms := &mock.ModelService{}
 	vehicleID := int64(7)
+	ms.VehicleService.On("Vehicle", vehicleID).Return(&shuttletracker.Vehicle{ID: vehicleID}, nil)
 	ms.VehicleService.On("DeleteVehicle", vehicleID).Return(nil)
 
 	api := API{
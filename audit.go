@@ -0,0 +1,44 @@
+package shuttletracker
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records a change that an administrator made. Before and After are JSON
+// snapshots of what was changed, and are null when it didn't exist.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   int64           `json:"target_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	Created    time.Time       `json:"created"`
+}
+
+// AuditFilter picks which AuditEntries to return. Zero values match everything.
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   int64
+	Since      time.Time
+	Until      time.Time
+
+	// BeforeID only matches AuditEntries older than the one with this ID, so that
+	// results can be paged through.
+	BeforeID int64
+
+	// Limit is the most AuditEntries to return.
+	Limit int
+}
+
+// AuditService is an interface for recording and reading AuditEntries.
+type AuditService interface {
+	CreateAuditEntry(entry *AuditEntry) error
+
+	// AuditEntries returns the AuditEntries that match a filter, newest first.
+	AuditEntries(filter AuditFilter) ([]*AuditEntry, error)
+}
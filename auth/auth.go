@@ -12,3 +12,10 @@ type AuthenticationService interface {
 	Username(r *http.Request) string
 	HandleFunc(func(http.ResponseWriter, *http.Request)) http.Handler
 }
+
+// EndpointProvider is implemented by AuthenticationServices that need their own HTTP
+// endpoints, e.g. to receive a login form or an identity provider's callback. They
+// are served under /auth.
+type EndpointProvider interface {
+	Endpoints() http.Handler
+}
@@ -8,6 +8,9 @@ import (
 // CAS is an implementation of the cas interface using the go-cas package
 type CAS struct {
 	CAS *cas.Client
+
+	// opts has the attributes to add to the cas package's cookies, if any.
+	opts *SessionOptions
 }
 
 // Authenticated returns true if the request has been authenticated with cas, false otherwise
@@ -33,5 +36,11 @@ func (c *CAS) Username(r *http.Request) string {
 
 //HandleFunc acts as an http handler for CAS
 func (c *CAS) HandleFunc(f func(http.ResponseWriter, *http.Request)) http.Handler {
-	return c.CAS.HandleFunc(f)
+	h := c.CAS.HandleFunc(f)
+	if c.opts == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&cookieWriter{ResponseWriter: w, opts: c.opts}, r)
+	})
 }
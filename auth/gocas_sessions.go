@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/cas.v2"
+)
+
+// NewCAS creates a CAS that logs people in with the CAS server at u. Sessions time
+// out as opts says, and its cookies are sent with opts' attributes.
+func NewCAS(u *url.URL, opts SessionOptions) *CAS {
+	opts = opts.withDefaults()
+	return &CAS{
+		CAS: cas.NewClient(&cas.Options{
+			URL:   u,
+			Store: newTicketStore(opts),
+		}),
+		opts: &opts,
+	}
+}
+
+// ticketStore is a cas.TicketStore that forgets tickets once their sessions time out,
+// which makes people log in again.
+type ticketStore struct {
+	opts    SessionOptions
+	mu      sync.Mutex
+	tickets map[string]*storedTicket
+}
+
+type storedTicket struct {
+	resp    *cas.AuthenticationResponse
+	started time.Time
+	seen    time.Time
+}
+
+func newTicketStore(opts SessionOptions) *ticketStore {
+	return &ticketStore{opts: opts, tickets: map[string]*storedTicket{}}
+}
+
+// Read returns a ticket's response and records that its session was used.
+func (ts *ticketStore) Read(id string) (*cas.AuthenticationResponse, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	t, ok := ts.tickets[id]
+	if !ok {
+		return nil, cas.ErrInvalidTicket
+	}
+	now := time.Now()
+	if !ts.opts.valid(t.started, t.seen, now) {
+		delete(ts.tickets, id)
+		return nil, cas.ErrInvalidTicket
+	}
+	t.seen = now
+	return t.resp, nil
+}
+
+// Write stores a ticket, and forgets any that have timed out.
+func (ts *ticketStore) Write(id string, resp *cas.AuthenticationResponse) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	now := time.Now()
+	for other, t := range ts.tickets {
+		if !ts.opts.valid(t.started, t.seen, now) {
+			delete(ts.tickets, other)
+		}
+	}
+	ts.tickets[id] = &storedTicket{resp: resp, started: now, seen: now}
+	return nil
+}
+
+func (ts *ticketStore) Delete(id string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.tickets, id)
+	return nil
+}
+
+func (ts *ticketStore) Clear() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tickets = map[string]*storedTicket{}
+	return nil
+}
+
+// cookieWriter adds Secure and SameSite attributes to the cookies that the cas package
+// sets, since it can't be configured to.
+type cookieWriter struct {
+	http.ResponseWriter
+	opts  *SessionOptions
+	fixed bool
+}
+
+func (cw *cookieWriter) fixCookies() {
+	if cw.fixed {
+		return
+	}
+	cw.fixed = true
+	h := cw.Header()
+	cookies := h["Set-Cookie"]
+	for i, c := range cookies {
+		lower := strings.ToLower(c)
+		if cw.opts.Secure && !strings.Contains(lower, "; secure") {
+			c += "; Secure"
+		}
+		if !strings.Contains(lower, "; samesite=") {
+			c += "; SameSite=" + sameSiteName(cw.opts.SameSite)
+		}
+		cookies[i] = c
+	}
+}
+
+func (cw *cookieWriter) WriteHeader(status int) {
+	cw.fixCookies()
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cookieWriter) Write(b []byte) (int, error) {
+	cw.fixCookies()
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cookieWriter) Flush() {
+	cw.fixCookies()
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func sameSiteName(s http.SameSite) string {
+	switch s {
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	default:
+		return "Lax"
+	}
+}
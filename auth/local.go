@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+// PasswordStore gets the bcrypt hashes of local accounts' passwords. A missing account
+// or one without a password has a nil hash.
+type PasswordStore interface {
+	PasswordHash(username string) ([]byte, error)
+}
+
+// HashPassword hashes a password with bcrypt for storing in a PasswordStore.
+func HashPassword(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// dummyHash is compared against when an account doesn't exist so that logging in
+// takes as long as it would if it did.
+var dummyHash, _ = HashPassword("shuttletracker")
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Shuttle Tracker Login</title></head>
+<body>
+<h1>Shuttle Tracker</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/auth/login">
+<input type="hidden" name="next" value="{{.Next}}">
+<p><label>Username <input name="username" autocomplete="username" required autofocus></label></p>
+<p><label>Password <input name="password" type="password" autocomplete="current-password" required></label></p>
+<p><button type="submit">Log in</button></p>
+</form>
+</body>
+</html>
+`))
+
+// Local is an AuthenticationService for accounts with passwords stored by Shuttle
+// Tracker. It's meant for development and for deployments without single sign-on.
+type Local struct {
+	passwords PasswordStore
+	sessions  *sessions
+}
+
+// NewLocal creates a Local that checks passwords against a PasswordStore and signs
+// sessions with a secret.
+func NewLocal(passwords PasswordStore, secret string, opts SessionOptions) (*Local, error) {
+	s, err := newSessions(secret, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{passwords: passwords, sessions: s}, nil
+}
+
+// Authenticated returns whether someone has logged in.
+func (l *Local) Authenticated(r *http.Request) bool {
+	return l.sessions.username(r) != ""
+}
+
+// Logout logs the user out and sends them to the home page.
+func (l *Local) Logout(w http.ResponseWriter, r *http.Request) {
+	l.sessions.end(w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// Login sends the user to the login form, which returns them to where they were.
+func (l *Local) Login(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+}
+
+// Username returns who is logged in.
+func (l *Local) Username(r *http.Request) string {
+	return l.sessions.username(r)
+}
+
+// HandleFunc returns an http handler for the request that keeps the session from
+// idling out.
+func (l *Local) HandleFunc(f func(http.ResponseWriter, *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.sessions.refresh(w, r)
+		f(w, r)
+	})
+}
+
+// Endpoints serves the login form.
+func (l *Local) Endpoints() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/login", l.loginFormHandler)
+	r.Post("/login", l.loginHandler)
+	return r
+}
+
+type loginForm struct {
+	Next  string
+	Error string
+}
+
+func writeLoginForm(w http.ResponseWriter, status int, form loginForm) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := loginTemplate.Execute(w, form)
+	if err != nil {
+		log.WithError(err).Error("unable to write login form")
+	}
+}
+
+func (l *Local) loginFormHandler(w http.ResponseWriter, r *http.Request) {
+	writeLoginForm(w, http.StatusOK, loginForm{Next: safeRedirect(r.URL.Query().Get("next"))})
+}
+
+// checkPassword returns whether a password is correct for an account.
+func (l *Local) checkPassword(username, password string) (bool, error) {
+	hash, err := l.passwords.PasswordHash(username)
+	if err != nil {
+		return false, err
+	}
+	if hash == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false, nil
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil, nil
+}
+
+func (l *Local) loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := safeRedirect(r.PostFormValue("next"))
+	username := strings.ToLower(r.PostFormValue("username"))
+
+	ok, err := l.checkPassword(username, r.PostFormValue("password"))
+	if err != nil {
+		log.WithError(err).Error("unable to check password")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		writeLoginForm(w, http.StatusUnauthorized, loginForm{Next: next, Error: "Incorrect username or password."})
+		return
+	}
+
+	err = l.sessions.start(w, username)
+	if err != nil {
+		log.WithError(err).Error("unable to start session")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, next, http.StatusFound)
+}
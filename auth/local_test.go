@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type testPasswords map[string][]byte
+
+func (tp testPasswords) PasswordHash(username string) ([]byte, error) {
+	return tp[username], nil
+}
+
+func TestLocalLogin(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("unable to hash password: %s", err)
+	}
+	l, err := NewLocal(testPasswords{"alice": hash}, "secret", SessionOptions{})
+	if err != nil {
+		t.Fatalf("unable to create Local: %s", err)
+	}
+
+	for _, c := range []struct {
+		username string
+		password string
+		next     string
+		status   int
+		location string
+	}{
+		{"alice", "correct horse", "/admin/stops", http.StatusFound, "/admin/stops"},
+		{"Alice", "correct horse", "//evil.example.com", http.StatusFound, "/admin"},
+		{"alice", "battery staple", "/admin", http.StatusUnauthorized, ""},
+		{"bob", "correct horse", "/admin", http.StatusUnauthorized, ""},
+	} {
+		form := url.Values{"username": {c.username}, "password": {c.password}, "next": {c.next}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		l.Endpoints().ServeHTTP(w, req)
+		resp := w.Result()
+		if resp.StatusCode != c.status || resp.Header.Get("Location") != c.location {
+			t.Errorf("%s: got status %d and location %q, expected %d and %q",
+				c.username, resp.StatusCode, resp.Header.Get("Location"), c.status, c.location)
+			continue
+		}
+		if c.status != http.StatusFound {
+			continue
+		}
+
+		req = httptest.NewRequest("GET", "/admin", nil)
+		for _, cookie := range resp.Cookies() {
+			req.AddCookie(cookie)
+		}
+		if l.Username(req) != "alice" {
+			t.Errorf("got username %q, expected alice", l.Username(req))
+		}
+
+		// changing the cookie invalidates it
+		cookie := resp.Cookies()[0]
+		cookie.Value = "x" + cookie.Value
+		req = httptest.NewRequest("GET", "/admin", nil)
+		req.AddCookie(cookie)
+		if l.Authenticated(req) {
+			t.Errorf("expected a tampered cookie to be rejected")
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	oidcStateCookieName = "shuttletracker_oidc"
+
+	// oidcStateTTL is how long someone has to log in with the identity provider.
+	oidcStateTTL = 10 * time.Minute
+
+	// oidcClockSkew is how far the identity provider's clock can be off from ours.
+	oidcClockSkew = time.Minute
+
+	// oidcKeysRefreshInterval is how often signing keys can be fetched when a token
+	// is signed by a key we don't know about, in case the provider rotated its keys.
+	oidcKeysRefreshInterval = time.Minute
+)
+
+// OIDCConfig configures an OpenID Connect identity provider.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL, e.g. "https://accounts.example.edu". Its
+	// configuration is discovered from /.well-known/openid-configuration.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is this server's /auth/callback, and must be registered with the
+	// provider, e.g. "https://shuttles.rpi.edu/auth/callback".
+	RedirectURL string
+
+	// UsernameClaim is the ID token claim that is looked up in the users table.
+	// It defaults to "preferred_username".
+	UsernameClaim string
+}
+
+// oidcDiscovery is the part of the provider's configuration that is used.
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcState is kept in a cookie between sending someone to the provider and them
+// coming back.
+type oidcState struct {
+	State string `json:"s"`
+	Nonce string `json:"n"`
+	Next  string `json:"next"`
+}
+
+// OIDC is an AuthenticationService that logs people in with an OpenID Connect
+// identity provider using the authorization code flow. ID tokens must be signed with
+// RS256.
+type OIDC struct {
+	cfg      OIDCConfig
+	client   *http.Client
+	sessions *sessions
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// NewOIDC creates an OIDC that signs sessions with a secret. The provider isn't
+// contacted until someone logs in.
+func NewOIDC(cfg OIDCConfig, secret string, opts SessionOptions) (*OIDC, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("OIDC needs an issuer, client ID, and redirect URL")
+	}
+	if opts.SameSite == http.SameSiteStrictMode {
+		// browsers wouldn't send the state cookie with the provider's callback
+		return nil, errors.New("OIDC can't use SameSite=Strict cookies")
+	}
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	s, err := newSessions(secret, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDC{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		sessions: s,
+		keys:     map[string]*rsa.PublicKey{},
+	}, nil
+}
+
+// Authenticated returns whether someone has logged in.
+func (o *OIDC) Authenticated(r *http.Request) bool {
+	return o.sessions.username(r) != ""
+}
+
+// Logout logs the user out of Shuttle Tracker, but not the identity provider.
+func (o *OIDC) Logout(w http.ResponseWriter, r *http.Request) {
+	o.sessions.end(w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// Login sends the user to log in with the identity provider, which returns them to
+// where they were.
+func (o *OIDC) Login(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+}
+
+// Username returns who is logged in.
+func (o *OIDC) Username(r *http.Request) string {
+	return o.sessions.username(r)
+}
+
+// HandleFunc returns an http handler for the request that keeps the session from
+// idling out.
+func (o *OIDC) HandleFunc(f func(http.ResponseWriter, *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.sessions.refresh(w, r)
+		f(w, r)
+	})
+}
+
+// Endpoints starts logging in and receives the identity provider's callback.
+func (o *OIDC) Endpoints() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/login", o.loginHandler)
+	r.Get("/callback", o.callbackHandler)
+	return r
+}
+
+func (o *OIDC) getJSON(u string, v interface{}) error {
+	resp, err := o.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// configuration returns the provider's discovered configuration.
+func (o *OIDC) configuration() (*oidcDiscovery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	d := &oidcDiscovery{}
+	err := o.getJSON(o.cfg.Issuer+"/.well-known/openid-configuration", d)
+	if err != nil {
+		return nil, err
+	}
+	if d.Issuer != o.cfg.Issuer {
+		return nil, fmt.Errorf("provider's issuer is %q, expected %q", d.Issuer, o.cfg.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("provider's configuration is missing endpoints")
+	}
+	o.discovery = d
+	return d, nil
+}
+
+func (o *OIDC) loginHandler(w http.ResponseWriter, r *http.Request) {
+	d, err := o.configuration()
+	if err != nil {
+		log.WithError(err).Error("unable to get OIDC configuration")
+		http.Error(w, "unable to reach identity provider", http.StatusBadGateway)
+		return
+	}
+
+	state := oidcState{Next: safeRedirect(r.URL.Query().Get("next"))}
+	state.State, err = randomString()
+	if err == nil {
+		state.Nonce, err = randomString()
+	}
+	if err == nil {
+		err = o.sessions.setCookie(w, oidcStateCookieName, state, oidcStateTTL)
+	}
+	if err != nil {
+		log.WithError(err).Error("unable to start OIDC login")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", o.cfg.ClientID)
+	q.Set("redirect_uri", o.cfg.RedirectURL)
+	q.Set("scope", "openid profile email")
+	q.Set("state", state.State)
+	q.Set("nonce", state.Nonce)
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, d.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+func (o *OIDC) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	state := oidcState{}
+	err := o.sessions.cookie(r, oidcStateCookieName, &state)
+	if err != nil || state.State == "" || r.URL.Query().Get("state") != state.State {
+		http.Error(w, "login expired or was started somewhere else; try again", http.StatusBadRequest)
+		return
+	}
+	o.sessions.clearCookie(w, oidcStateCookieName)
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		http.Error(w, "identity provider refused login: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	idToken, err := o.exchange(r.URL.Query().Get("code"))
+	if err != nil {
+		log.WithError(err).Error("unable to exchange OIDC code")
+		http.Error(w, "unable to log in with identity provider", http.StatusBadGateway)
+		return
+	}
+	username, err := o.verify(idToken, state.Nonce, time.Now())
+	if err != nil {
+		log.WithError(err).Warn("invalid OIDC ID token")
+		http.Error(w, "invalid ID token", http.StatusUnauthorized)
+		return
+	}
+
+	err = o.sessions.start(w, username)
+	if err != nil {
+		log.WithError(err).Error("unable to start session")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, state.Next, http.StatusFound)
+}
+
+// exchange trades an authorization code for an ID token.
+func (o *OIDC) exchange(code string) (string, error) {
+	d, err := o.configuration()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", o.cfg.RedirectURL)
+	req, err := http.NewRequest("POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.cfg.ClientID), url.QueryEscape(o.cfg.ClientSecret))
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint responded with %s", resp.Status)
+	}
+	token := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response has no ID token")
+	}
+	return token.IDToken, nil
+}
+
+// audience is an ID token's "aud" claim, which can be a string or a list of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	var l []string
+	err := json.Unmarshal(b, &l)
+	*a = l
+	return err
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks an ID token's signature and claims and returns its lowercase username.
+func (o *OIDC) verify(idToken string, nonce string, now time.Time) (string, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed token")
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return "", err
+	}
+	if header.Alg != "RS256" {
+		return "", fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	key, err := o.key(header.Kid)
+	if err != nil {
+		return "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig)
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]json.RawMessage{}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return "", err
+	}
+	standard := struct {
+		Issuer   string   `json:"iss"`
+		Audience audience `json:"aud"`
+		Expires  int64    `json:"exp"`
+		Nonce    string   `json:"nonce"`
+	}{}
+	err = decodeSegment(parts[1], &standard)
+	if err != nil {
+		return "", err
+	}
+	if standard.Issuer != o.cfg.Issuer {
+		return "", fmt.Errorf("issuer is %q", standard.Issuer)
+	}
+	if !standard.Audience.contains(o.cfg.ClientID) {
+		return "", errors.New("token is for another client")
+	}
+	if now.Add(-oidcClockSkew).Unix() >= standard.Expires {
+		return "", errors.New("token expired")
+	}
+	if standard.Nonce != nonce {
+		return "", errors.New("nonce doesn't match")
+	}
+
+	var username string
+	err = json.Unmarshal(claims[o.cfg.UsernameClaim], &username)
+	if err != nil || username == "" {
+		return "", fmt.Errorf("token has no %s claim", o.cfg.UsernameClaim)
+	}
+	return strings.ToLower(username), nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// key returns the provider's signing key with an ID, fetching keys again if it's one
+// we haven't seen.
+func (o *OIDC) key(kid string) (*rsa.PublicKey, error) {
+	o.mu.Lock()
+	key, ok := o.keys[kid]
+	stale := time.Since(o.keysFetched) > oidcKeysRefreshInterval
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	d, err := o.configuration()
+	if err != nil {
+		return nil, err
+	}
+	jwks := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	err = o.getJSON(d.JWKSURI, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	o.mu.Lock()
+	o.keys = keys
+	o.keysFetched = time.Now()
+	o.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
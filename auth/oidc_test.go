@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testIssuer is a stand-in OpenID Connect provider. It issues an ID token for
+// username for the code "good".
+type testIssuer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	kid      string
+	username string
+	nonce    string
+	claims   map[string]interface{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	ti := &testIssuer{key: key, kid: "k1", username: "Alice"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                ti.URL,
+			AuthorizationEndpoint: ti.URL + "/authorize",
+			TokenEndpoint:         ti.URL + "/token",
+			JWKSURI:               ti.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": ti.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "shuttletracker" || secret != "hunter2" || r.PostFormValue("code") != "good" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": ti.token(t, ti.key)})
+	})
+	ti.Server = httptest.NewServer(mux)
+	return ti
+}
+
+// token signs an ID token with a key.
+func (ti *testIssuer) token(t *testing.T, key *rsa.PrivateKey) string {
+	claims := map[string]interface{}{
+		"iss":                ti.URL,
+		"aud":                []string{"shuttletracker", "other"},
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              ti.nonce,
+		"preferred_username": ti.username,
+	}
+	for k, v := range ti.claims {
+		claims[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": ti.kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatalf("unable to sign token: %s", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// login starts logging in and follows the provider back to the callback with a code.
+func login(t *testing.T, o *OIDC, ti *testIssuer, code string) *http.Response {
+	endpoints := o.Endpoints()
+	w := httptest.NewRecorder()
+	endpoints.ServeHTTP(w, httptest.NewRequest("GET", "/login?next=/admin/routes", nil))
+	resp := w.Result()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("got status %d starting login, expected 302", resp.StatusCode)
+	}
+	authorize, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("unable to parse redirect: %s", err)
+	}
+	if authorize.Path != "/authorize" || authorize.Query().Get("client_id") != "shuttletracker" {
+		t.Fatalf("unexpected redirect %s", authorize)
+	}
+	ti.nonce = authorize.Query().Get("nonce")
+
+	req := httptest.NewRequest("GET", "/callback?code="+code+"&state="+authorize.Query().Get("state"), nil)
+	for _, c := range resp.Cookies() {
+		req.AddCookie(c)
+	}
+	w = httptest.NewRecorder()
+	endpoints.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func newTestOIDC(t *testing.T, ti *testIssuer) *OIDC {
+	o, err := NewOIDC(OIDCConfig{
+		Issuer:       ti.URL,
+		ClientID:     "shuttletracker",
+		ClientSecret: "hunter2",
+		RedirectURL:  "http://localhost:8080/auth/callback",
+	}, "secret", SessionOptions{})
+	if err != nil {
+		t.Fatalf("unable to create OIDC: %s", err)
+	}
+	return o
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ti := newTestIssuer(t)
+	defer ti.Close()
+	o := newTestOIDC(t, ti)
+
+	resp := login(t, o, ti, "good")
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/admin/routes" {
+		t.Fatalf("got status %d and location %q, expected 302 to /admin/routes", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	req := httptest.NewRequest("GET", "/admin", nil)
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookieName {
+			req.AddCookie(c)
+		}
+	}
+	if !o.Authenticated(req) || o.Username(req) != "alice" {
+		t.Errorf("got username %q, expected alice", o.Username(req))
+	}
+
+	resp = login(t, o, ti, "bad")
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("got status %d for a bad code, expected 502", resp.StatusCode)
+	}
+}
+
+func TestOIDCStateMismatch(t *testing.T) {
+	ti := newTestIssuer(t)
+	defer ti.Close()
+	o := newTestOIDC(t, ti)
+
+	w := httptest.NewRecorder()
+	o.Endpoints().ServeHTTP(w, httptest.NewRequest("GET", "/callback?code=good&state=forged", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d without a state cookie, expected 400", w.Code)
+	}
+}
+
+func TestOIDCVerify(t *testing.T) {
+	ti := newTestIssuer(t)
+	defer ti.Close()
+	o := newTestOIDC(t, ti)
+	ti.nonce = "n"
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err)
+	}
+	username, err := o.verify(ti.token(t, ti.key), "n", time.Now())
+	if err != nil || username != "alice" {
+		t.Errorf("got %q and %v, expected alice", username, err)
+	}
+	_, err = o.verify(ti.token(t, other), "n", time.Now())
+	if err == nil {
+		t.Errorf("expected a token signed by another key to be rejected")
+	}
+	_, err = o.verify(ti.token(t, ti.key), "other nonce", time.Now())
+	if err == nil {
+		t.Errorf("expected a token with another nonce to be rejected")
+	}
+	_, err = o.verify(ti.token(t, ti.key), "n", time.Now().Add(2*time.Hour))
+	if err == nil {
+		t.Errorf("expected an expired token to be rejected")
+	}
+
+	for _, claims := range []map[string]interface{}{
+		{"aud": "someone else"},
+		{"iss": "https://evil.example.com"},
+		{"preferred_username": ""},
+	} {
+		ti.claims = claims
+		_, err = o.verify(ti.token(t, ti.key), "n", time.Now())
+		if err == nil {
+			t.Errorf("expected a token with %v to be rejected", claims)
+		}
+	}
+}
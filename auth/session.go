@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker/log"
+)
+
+const (
+	sessionCookieName = "shuttletracker_session"
+
+	// sessionTTL is how long someone stays logged in unless SessionOptions.MaxAge
+	// says otherwise.
+	sessionTTL = 12 * time.Hour
+
+	// sessionRefreshInterval is how often a session's last use is updated, which is
+	// how precise idle timeouts are.
+	sessionRefreshInterval = time.Minute
+)
+
+var errInvalidCookie = errors.New("invalid cookie")
+
+// SessionOptions control how long administrators stay logged in and which attributes
+// their cookies are sent with.
+type SessionOptions struct {
+	// IdleTimeout ends sessions that haven't been used for this long. Zero disables it.
+	IdleTimeout time.Duration
+
+	// MaxAge ends sessions this long after logging in, however much they're used.
+	MaxAge time.Duration
+
+	// Secure only sends cookies over HTTPS.
+	Secure bool
+
+	SameSite http.SameSite
+}
+
+// withDefaults returns the options with MaxAge and SameSite filled in if they're unset.
+func (o SessionOptions) withDefaults() SessionOptions {
+	if o.MaxAge <= 0 {
+		o.MaxAge = sessionTTL
+	}
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+	return o
+}
+
+// valid returns whether a session that started and was last used at these times
+// hasn't timed out.
+func (o SessionOptions) valid(started, seen, now time.Time) bool {
+	if !now.Before(started.Add(o.MaxAge)) {
+		return false
+	}
+	return o.IdleTimeout <= 0 || now.Before(seen.Add(o.IdleTimeout))
+}
+
+// ParseSameSite parses a SameSite cookie attribute: "lax", "strict", or "none".
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite value %q", s)
+	}
+}
+
+// sessions stores values in cookies that are signed so that clients can't change them.
+type sessions struct {
+	key  []byte
+	opts SessionOptions
+}
+
+// newSessions signs cookies with a secret. Without one, a random key is used, so
+// everyone is logged out when the server restarts.
+func newSessions(secret string, opts SessionOptions) (*sessions, error) {
+	opts = opts.withDefaults()
+	if secret != "" {
+		return &sessions{key: []byte(secret), opts: opts}, nil
+	}
+	log.Warn("No session secret configured; sessions won't survive restarts.")
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return &sessions{key: key, opts: opts}, nil
+}
+
+func (s *sessions) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// setCookie marshals v and stores it in a signed cookie that expires after ttl.
+func (s *sessions) setCookie(w http.ResponseWriter, name string, v interface{}, ttl time.Duration) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload))
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   s.opts.Secure,
+		SameSite: s.opts.SameSite,
+	})
+	return nil
+}
+
+// cookie unmarshals a cookie set by setCookie into v if its signature is valid.
+func (s *sessions) cookie(r *http.Request, name string, v interface{}) error {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	parts := strings.Split(c.Value, ".")
+	if len(parts) != 2 {
+		return errInvalidCookie
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return errInvalidCookie
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, s.sign(payload)) {
+		return errInvalidCookie
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func (s *sessions) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.opts.Secure,
+		SameSite: s.opts.SameSite,
+	})
+}
+
+// session is who is logged in, when they did, and when they last made a request.
+type session struct {
+	Username string `json:"u"`
+	Started  int64  `json:"s"`
+	Seen     int64  `json:"l"`
+}
+
+// start logs someone in.
+func (s *sessions) start(w http.ResponseWriter, username string) error {
+	now := time.Now().Unix()
+	return s.setCookie(w, sessionCookieName, session{Username: username, Started: now, Seen: now}, s.opts.MaxAge)
+}
+
+// current returns the session of whoever made a request if it hasn't timed out.
+func (s *sessions) current(r *http.Request, now time.Time) (session, bool) {
+	sess := session{}
+	err := s.cookie(r, sessionCookieName, &sess)
+	if err != nil || sess.Username == "" {
+		return sess, false
+	}
+	return sess, s.opts.valid(time.Unix(sess.Started, 0), time.Unix(sess.Seen, 0), now)
+}
+
+// username returns who is logged in, or an empty string if nobody is.
+func (s *sessions) username(r *http.Request) string {
+	sess, ok := s.current(r, time.Now())
+	if !ok {
+		return ""
+	}
+	return sess.Username
+}
+
+// refresh records that a session was used so that it doesn't hit the idle timeout.
+func (s *sessions) refresh(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	sess, ok := s.current(r, now)
+	if !ok || now.Sub(time.Unix(sess.Seen, 0)) < sessionRefreshInterval {
+		return
+	}
+	sess.Seen = now.Unix()
+	remaining := time.Unix(sess.Started, 0).Add(s.opts.MaxAge).Sub(now)
+	err := s.setCookie(w, sessionCookieName, sess, remaining)
+	if err != nil {
+		log.WithError(err).Error("unable to refresh session")
+	}
+}
+
+func (s *sessions) end(w http.ResponseWriter) {
+	s.clearCookie(w, sessionCookieName)
+}
+
+// safeRedirect returns next if it's a path on this site, or "/admin" otherwise, so
+// that logging in can't redirect somewhere else.
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/admin"
+	}
+	return next
+}
+
+// randomString returns a random URL-safe string.
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
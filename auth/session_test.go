@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/cas.v2"
+)
+
+func TestSessionTimeouts(t *testing.T) {
+	s, err := newSessions("secret", SessionOptions{IdleTimeout: time.Hour, MaxAge: 8 * time.Hour, Secure: true})
+	if err != nil {
+		t.Fatalf("unable to create sessions: %s", err)
+	}
+	now := time.Now()
+
+	for _, c := range []struct {
+		name    string
+		started time.Time
+		seen    time.Time
+		valid   bool
+	}{
+		{"fresh", now.Add(-time.Minute), now.Add(-time.Minute), true},
+		{"idle", now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), false},
+		{"active but old", now.Add(-9 * time.Hour), now.Add(-time.Minute), false},
+	} {
+		w := httptest.NewRecorder()
+		err = s.setCookie(w, sessionCookieName, session{Username: "alice", Started: c.started.Unix(), Seen: c.seen.Unix()}, time.Hour)
+		if err != nil {
+			t.Fatalf("unable to set cookie: %s", err)
+		}
+		cookie := w.Result().Cookies()[0]
+		if !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || !cookie.HttpOnly {
+			t.Errorf("%s: got cookie %+v, expected it to be secure, lax, and HTTP only", c.name, cookie)
+		}
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.AddCookie(cookie)
+		if (s.username(req) == "alice") != c.valid {
+			t.Errorf("%s: got username %q, expected valid to be %t", c.name, s.username(req), c.valid)
+		}
+
+		// using a session pushes back its idle timeout
+		w = httptest.NewRecorder()
+		s.refresh(w, req)
+		if refreshed := len(w.Result().Cookies()) > 0; refreshed != c.valid {
+			t.Errorf("%s: got refreshed %t, expected %t", c.name, refreshed, c.valid)
+		}
+	}
+}
+
+func TestTicketStoreTimeouts(t *testing.T) {
+	ts := newTicketStore(SessionOptions{IdleTimeout: time.Hour, MaxAge: 8 * time.Hour})
+	resp := &cas.AuthenticationResponse{User: "alice"}
+	err := ts.Write("ST-1", resp)
+	if err != nil {
+		t.Fatalf("unable to write ticket: %s", err)
+	}
+	got, err := ts.Read("ST-1")
+	if err != nil || got != resp {
+		t.Errorf("got %v and error %v, expected the response", got, err)
+	}
+
+	ts.tickets["ST-1"].seen = time.Now().Add(-2 * time.Hour)
+	_, err = ts.Read("ST-1")
+	if err != cas.ErrInvalidTicket {
+		t.Errorf("got error %v, expected an idle ticket to be invalid", err)
+	}
+
+	err = ts.Write("ST-2", resp)
+	if err != nil {
+		t.Fatalf("unable to write ticket: %s", err)
+	}
+	ts.tickets["ST-2"].started = time.Now().Add(-9 * time.Hour)
+	_, err = ts.Read("ST-2")
+	if err != cas.ErrInvalidTicket {
+		t.Errorf("got error %v, expected an old ticket to be invalid", err)
+	}
+}
+
+func TestCookieWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	cw := &cookieWriter{ResponseWriter: w, opts: &SessionOptions{Secure: true, SameSite: http.SameSiteStrictMode}}
+	http.SetCookie(cw, &http.Cookie{Name: "_cas_session", Value: "abc", MaxAge: 86400})
+	cw.WriteHeader(http.StatusOK)
+
+	cookie := w.Result().Cookies()[0]
+	if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("got cookie %+v, expected it to be secure and strict", cookie)
+	}
+}
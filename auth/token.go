@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strings"
+)
+
+// apiTokenPrefix starts every API token so that they're easy to recognize, e.g. by
+// secret scanners.
+const apiTokenPrefix = "st_"
+
+// NewAPIToken returns a new random API token and the hash to store for it.
+func NewAPIToken() (string, []byte, error) {
+	s, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+	token := apiTokenPrefix + s
+	return token, HashAPIToken(token), nil
+}
+
+// HashAPIToken hashes an API token for storage. Tokens are long and random, so a fast
+// hash is enough.
+func HashAPIToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// BearerToken returns the token in a request's "Authorization: Bearer" header, or an
+// empty string if there isn't one.
+func BearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(h[7:])
+}
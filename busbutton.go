@@ -0,0 +1,18 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// BusButtonCount is how many times the bus button was pressed with an emoji on a day.
+type BusButtonCount struct {
+	Day   time.Time `json:"day"`
+	Emoji string    `json:"emoji"`
+	Count int       `json:"count"`
+}
+
+// BusButtonService is an interface for keeping track of bus button presses.
+type BusButtonService interface {
+	AddBusButtonPresses(day time.Time, emoji string, presses int) error
+	BusButtonCounts(since time.Time) ([]*BusButtonCount, error)
+}
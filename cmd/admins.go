@@ -1,13 +1,19 @@
 package cmd
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/auth"
 	"github.com/wtg/shuttletracker/config"
 	"github.com/wtg/shuttletracker/postgres"
 )
@@ -18,9 +24,46 @@ var Add bool
 // Remove is a flag to put the admins command into "remove" mode.
 var Remove bool
 
+// Grant is a permission to give an administrator.
+var Grant string
+
+// Revoke is a permission to take away from an administrator.
+var Revoke string
+
+// Password is a flag to put the admins command into "set password" mode, for logging
+// in with the local auth provider.
+var Password bool
+
+// Role is the role to give an administrator, either when adding them or on its own.
+var Role string
+
+// CreateToken is the name of an API token to create for an administrator.
+var CreateToken string
+
+// TokenScopes is a comma-separated list of scopes for a created API token.
+var TokenScopes string
+
+// TokenExpires is how long a created API token lasts.
+var TokenExpires time.Duration
+
+// RevokeToken is the ID of an API token to revoke.
+var RevokeToken int64
+
+// Tokens is a flag to list API tokens, either everyone's or an administrator's.
+var Tokens bool
+
 func init() {
 	adminsCmd.Flags().BoolVar(&Add, "add", false, "add administrator")
 	adminsCmd.Flags().BoolVar(&Remove, "remove", false, "remove administrator")
+	adminsCmd.Flags().StringVar(&Grant, "grant", "", "grant a permission to administrator ("+strings.Join(shuttletracker.Permissions, ", ")+")")
+	adminsCmd.Flags().StringVar(&Revoke, "revoke", "", "revoke a permission from administrator")
+	adminsCmd.Flags().BoolVar(&Password, "password", false, "set administrator's password for the local auth provider")
+	adminsCmd.Flags().StringVar(&Role, "role", "", "set administrator's role, or the role to add them with ("+strings.Join(shuttletracker.Roles, ", ")+")")
+	adminsCmd.Flags().StringVar(&CreateToken, "create-token", "", "create an API token with this name for administrator")
+	adminsCmd.Flags().StringVar(&TokenScopes, "scopes", "", "comma-separated scopes for --create-token ("+strings.Join(shuttletracker.Scopes, ", ")+")")
+	adminsCmd.Flags().DurationVar(&TokenExpires, "expires", 90*24*time.Hour, "how long a token made with --create-token lasts")
+	adminsCmd.Flags().Int64Var(&RevokeToken, "revoke-token", 0, "revoke the API token with this ID")
+	adminsCmd.Flags().BoolVar(&Tokens, "tokens", false, "list API tokens, optionally only administrator's")
 
 	rootCmd.AddCommand(adminsCmd)
 }
@@ -28,17 +71,53 @@ func init() {
 var adminsCmd = &cobra.Command{
 	Use:   "admins",
 	Short: "Manage Shuttle Tracker administrators",
-	Long:  "List, add, or remove Shuttle Tracker administrators by RCS ID.",
+	Long:  "List, add, or remove Shuttle Tracker administrators by RCS ID, set their roles and passwords, grant or revoke their permissions, and manage their API tokens.",
 	Args: func(cms *cobra.Command, args []string) error {
-		if (Add || Remove) && len(args) != 1 {
-			return errors.New("expects exactly one argument")
+		modes := 0
+		// --role is its own mode unless it's used with --add
+		for _, mode := range []bool{Add, Remove, Grant != "", Revoke != "", Role != "" && !Add, Password, CreateToken != ""} {
+			if mode {
+				modes++
+			}
+		}
+		// token listing and revoking take at most one and no arguments
+		if Tokens || RevokeToken != 0 {
+			if modes > 0 || (Tokens && RevokeToken != 0) {
+				return errors.New("tokens and revoke-token cannot be combined with other modes")
+			}
+			if len(args) > 1 || (RevokeToken != 0 && len(args) > 0) {
+				return errors.New("too many arguments")
+			}
+			return nil
 		}
-		if Add && Remove {
-			return errors.New("add and remove cannot be combined")
+		if modes > 1 {
+			return errors.New("add, remove, role, password, grant, revoke, and create-token cannot be combined")
+		}
+		if modes == 1 && len(args) != 1 {
+			return errors.New("expects exactly one argument")
 		}
-		if !(Add || Remove) && len(args) > 0 {
+		if modes == 0 && len(args) > 0 {
 			return errors.New("too many arguments")
 		}
+		if Grant != "" && !shuttletracker.ValidPermission(Grant) {
+			return fmt.Errorf("unknown permission %q", Grant)
+		}
+		if Role != "" && !shuttletracker.ValidRole(Role) {
+			return fmt.Errorf("unknown role %q", Role)
+		}
+		if CreateToken != "" {
+			if TokenScopes == "" {
+				return errors.New("create-token needs --scopes")
+			}
+			for _, scope := range strings.Split(TokenScopes, ",") {
+				if !shuttletracker.ValidScope(scope) {
+					return fmt.Errorf("unknown scope %q", scope)
+				}
+			}
+			if TokenExpires <= 0 {
+				return errors.New("expires must be positive")
+			}
+		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
@@ -54,18 +133,48 @@ var adminsCmd = &cobra.Command{
 			os.Exit(1)
 		}
 		var us shuttletracker.UserService = pg
+		var tokens shuttletracker.APITokenService = pg
 
-		if Add {
+		if Tokens {
+			listTokens(tokens, args)
+		} else if RevokeToken != 0 {
+			err := tokens.DeleteAPIToken(RevokeToken)
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to revoke token:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Revoked token %d.\n", RevokeToken)
+		} else if CreateToken != "" {
+			token := &shuttletracker.APIToken{
+				Name:     CreateToken,
+				Username: args[0],
+				Scopes:   strings.Split(TokenScopes, ","),
+				Expires:  time.Now().Add(TokenExpires),
+			}
+			secret, hash, err := auth.NewAPIToken()
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to generate token:", err)
+				os.Exit(1)
+			}
+			token.Prefix = secret[:8]
+			err = tokens.CreateAPIToken(token, hash)
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to create token:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Created token %d for %s. It won't be shown again:\n%s\n", token.ID, token.Username, secret)
+		} else if Add {
 			username := args[0]
 			user := &shuttletracker.User{
 				Username: username,
+				Role:     Role,
 			}
 			err := us.CreateUser(user)
 			if err != nil {
 				_, _ = fmt.Fprintln(os.Stderr, "Unable to add admin:", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Added %s.\n", username)
+			fmt.Printf("Added %s as %s.\n", username, user.Role)
 		} else if Remove {
 			username := args[0]
 			err := us.DeleteUser(username)
@@ -74,6 +183,48 @@ var adminsCmd = &cobra.Command{
 				os.Exit(1)
 			}
 			fmt.Printf("Removed %s.\n", username)
+		} else if Role != "" {
+			username := args[0]
+			err := us.SetRole(username, Role)
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to set role:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s is now %s.\n", username, Role)
+		} else if Password {
+			username := args[0]
+			password, err := readPassword()
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to read password:", err)
+				os.Exit(1)
+			}
+			hash, err := auth.HashPassword(password)
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to hash password:", err)
+				os.Exit(1)
+			}
+			err = us.SetPasswordHash(username, hash)
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to set password:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Set password for %s.\n", username)
+		} else if Grant != "" {
+			username := args[0]
+			err := us.GrantPermission(username, Grant)
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to grant permission:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Granted %s to %s.\n", Grant, username)
+		} else if Revoke != "" {
+			username := args[0]
+			err := us.RevokePermission(username, Revoke)
+			if err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, "Unable to revoke permission:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Revoked %s from %s.\n", Revoke, username)
 		} else {
 			users, err := us.Users()
 			if err != nil {
@@ -87,8 +238,71 @@ var adminsCmd = &cobra.Command{
 			}
 
 			for _, user := range users {
-				_, _ = fmt.Println(user.Username)
+				if len(user.Permissions) == 0 {
+					_, _ = fmt.Printf("%s (%s)\n", user.Username, user.Role)
+					continue
+				}
+				_, _ = fmt.Printf("%s (%s; %s)\n", user.Username, user.Role, strings.Join(user.Permissions, ", "))
 			}
 		}
 	},
 }
+
+// listTokens prints API tokens, only those of the administrator in args if there is one.
+func listTokens(tokens shuttletracker.APITokenService, args []string) {
+	username := ""
+	if len(args) == 1 {
+		username = args[0]
+	}
+	list, err := tokens.APITokens(username)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to get tokens:", err)
+		os.Exit(1)
+	}
+	if len(list) == 0 {
+		fmt.Println("No API tokens.")
+		return
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tADMIN\tSCOPES\tPREFIX\tEXPIRES\tLAST USED")
+	for _, token := range list {
+		lastUsed := "never"
+		if token.LastUsed != nil {
+			lastUsed = token.LastUsed.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, token.Username,
+			strings.Join(token.Scopes, ","), token.Prefix, token.Expires.Format(time.RFC3339), lastUsed)
+	}
+	_ = tw.Flush()
+}
+
+// readPassword prompts for a password without echoing it, or reads a line from
+// standard input if it isn't a terminal.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, "Password: ")
+	password, err := terminal.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	_, _ = fmt.Fprint(os.Stderr, "Again: ")
+	again, err := terminal.ReadPassword(fd)
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(password) != string(again) {
+		return "", errors.New("passwords don't match")
+	}
+	return string(password), nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/postgres"
+)
+
+// AuditActor only shows audit entries by this administrator.
+var AuditActor string
+
+// AuditAction only shows audit entries with this action, e.g. "route.delete".
+var AuditAction string
+
+// AuditTarget only shows audit entries for this type of target, e.g. "route".
+var AuditTarget string
+
+// AuditTargetID only shows audit entries for the target with this ID.
+var AuditTargetID int64
+
+// AuditSince only shows audit entries from this long ago or later, e.g. "24h".
+var AuditSince time.Duration
+
+// AuditLimit is how many audit entries to show.
+var AuditLimit int
+
+// AuditJSON prints whole audit entries, including what changed, as JSON.
+var AuditJSON bool
+
+func init() {
+	auditCmd.Flags().StringVar(&AuditActor, "actor", "", "only show changes by this administrator")
+	auditCmd.Flags().StringVar(&AuditAction, "action", "", "only show this action, e.g. route.delete")
+	auditCmd.Flags().StringVar(&AuditTarget, "target", "", "only show changes to this type of target, e.g. route")
+	auditCmd.Flags().Int64Var(&AuditTargetID, "target-id", 0, "only show changes to the target with this ID")
+	auditCmd.Flags().DurationVar(&AuditSince, "since", 0, "only show changes from this long ago or later, e.g. 24h")
+	auditCmd.Flags().IntVar(&AuditLimit, "limit", 50, "how many changes to show")
+	auditCmd.Flags().BoolVar(&AuditJSON, "json", false, "print changes as JSON, including before and after")
+
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show what Shuttle Tracker administrators have changed",
+	Long:  "List changes that administrators have made to vehicles, routes, stops, feedback, and the admin message, newest first.",
+	Args: func(cms *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			return errors.New("too many arguments")
+		}
+		if AuditLimit < 1 {
+			return errors.New("limit must be positive")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.New()
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration.")
+			os.Exit(1)
+		}
+
+		pg, err := postgres.New(*cfg.Postgres)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to connect to Postgres:", err)
+			os.Exit(1)
+		}
+		var as shuttletracker.AuditService = pg
+
+		filter := shuttletracker.AuditFilter{
+			Actor:      AuditActor,
+			Action:     AuditAction,
+			TargetType: AuditTarget,
+			TargetID:   AuditTargetID,
+			Limit:      AuditLimit,
+		}
+		if AuditSince > 0 {
+			filter.Since = time.Now().Add(-AuditSince)
+		}
+		entries, err := as.AuditEntries(filter)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to get audit entries:", err)
+			os.Exit(1)
+		}
+
+		if AuditJSON {
+			enc := json.NewEncoder(os.Stdout)
+			for _, entry := range entries {
+				_ = enc.Encode(entry)
+			}
+			return
+		}
+
+		if len(entries) == 0 {
+			_, _ = fmt.Println("No changes.")
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, entry := range entries {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s %d\n", entry.Created.Local().Format(time.RFC3339), entry.Actor, entry.Action, entry.TargetType, entry.TargetID)
+		}
+		_ = tw.Flush()
+	},
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/gis"
+	"github.com/wtg/shuttletracker/postgres"
+)
+
+// ExportFormat is the format to export in: geojson, kml, or gpx. If it's empty, the
+// format comes from ExportOutput's extension.
+var ExportFormat string
+
+// ExportOutput is the file to export to. If it's empty, the export is printed.
+var ExportOutput string
+
+// ExportSince is how far back vehicle tracks go.
+var ExportSince time.Duration
+
+func init() {
+	exportCmd.PersistentFlags().StringVar(&ExportFormat, "format", "", "geojson, kml, or gpx (default from the output file's extension, or geojson)")
+	exportCmd.PersistentFlags().StringVarP(&ExportOutput, "output", "o", "", "file to write to instead of printing")
+	exportTrackCmd.Flags().DurationVar(&ExportSince, "since", 24*time.Hour, "how far back the track goes")
+
+	exportCmd.AddCommand(exportRoutesCmd, exportStopsCmd, exportTrackCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+// exportFormat returns the Format picked by ExportFormat or ExportOutput.
+func exportFormat() (gis.Format, error) {
+	if ExportFormat != "" {
+		return gis.ParseFormat(ExportFormat)
+	}
+	if ExportOutput != "" {
+		return gis.ParseFormat(ExportOutput)
+	}
+	return gis.GeoJSON, nil
+}
+
+// runExport connects to Postgres, writes an export with write, and saves or prints it.
+func runExport(write func(pg *postgres.Postgres, f gis.Format, buf *bytes.Buffer) error) {
+	f, err := exportFormat()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	cfg, err := config.New()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration.")
+		os.Exit(1)
+	}
+
+	pg, err := postgres.New(*cfg.Postgres)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to connect to Postgres:", err)
+		os.Exit(1)
+	}
+
+	buf := &bytes.Buffer{}
+	err = write(pg, f, buf)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to export:", err)
+		os.Exit(1)
+	}
+
+	if ExportOutput == "" {
+		_, _ = buf.WriteTo(os.Stdout)
+		return
+	}
+	err = ioutil.WriteFile(ExportOutput, buf.Bytes(), 0644)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, "Unable to write export:", err)
+		os.Exit(1)
+	}
+}
+
+func noArgs(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errors.New("too many arguments")
+	}
+	return nil
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export routes, stops, and vehicle tracks for GIS tools",
+	Long:  "Export routes, stops, and vehicle tracks as GeoJSON, KML, or GPX so that they can be opened in tools like QGIS and Google Earth.",
+}
+
+var exportRoutesCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "Export routes as lines with their colors and widths",
+	Args:  noArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runExport(func(pg *postgres.Postgres, f gis.Format, buf *bytes.Buffer) error {
+			var rs shuttletracker.RouteService = pg
+			routes, err := rs.Routes()
+			if err != nil {
+				return err
+			}
+			return gis.WriteRoutes(buf, f, routes)
+		})
+	},
+}
+
+var exportStopsCmd = &cobra.Command{
+	Use:   "stops",
+	Short: "Export stops as points",
+	Args:  noArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runExport(func(pg *postgres.Postgres, f gis.Format, buf *bytes.Buffer) error {
+			var ss shuttletracker.StopService = pg
+			stops, err := ss.Stops()
+			if err != nil {
+				return err
+			}
+			return gis.WriteStops(buf, f, stops)
+		})
+	},
+}
+
+var exportTrackCmd = &cobra.Command{
+	Use:   "track VEHICLE_ID",
+	Short: "Export where a vehicle has been",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("a vehicle ID is required")
+		}
+		if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+			return fmt.Errorf("invalid vehicle ID %q", args[0])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		id, _ := strconv.ParseInt(args[0], 10, 64)
+		runExport(func(pg *postgres.Postgres, f gis.Format, buf *bytes.Buffer) error {
+			var ms shuttletracker.ModelService = pg
+			vehicle, err := ms.Vehicle(id)
+			if err != nil {
+				return err
+			}
+			locations, err := ms.LocationsSince(id, time.Now().Add(-ExportSince))
+			if err != nil {
+				return err
+			}
+			return gis.WriteTrack(buf, f, vehicle, locations)
+		})
+	},
+}
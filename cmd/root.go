@@ -47,9 +47,22 @@ var rootCmd = &cobra.Command{
 		// User service
 		var us shuttletracker.UserService = pg
 
-		// User service
+		// Feedback service
 		var fdb shuttletracker.FeedbackService = pg
 
+		// Track service
+		var ts shuttletracker.TrackService = pg
+
+		// Bus button service
+		var bbs shuttletracker.BusButtonService = pg
+
+		// Audit service
+		var audits shuttletracker.AuditService = pg
+
+		// API token service
+		var tokens shuttletracker.APITokenService = pg
+		var rateLimits shuttletracker.RateLimitService = pg
+
 		// Make spoofer
 		spoofer, err := spoofer.New(*cfg.Spoofer, ms)
 		if err != nil {
@@ -74,7 +87,7 @@ var rootCmd = &cobra.Command{
 		runner.Add(etaManager)
 
 		// Make API server
-		api, err := api.New(*cfg.API, ms, msg, us, updater, etaManager, fdb)
+		api, err := api.New(*cfg.API, ms, msg, us, updater, etaManager, fdb, ts, bbs, audits, tokens, rateLimits)
 		if err != nil {
 			log.WithError(err).Error("Could not create API server.")
 			return
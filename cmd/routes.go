@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wtg/shuttletracker/api"
+	"github.com/wtg/shuttletracker/config"
+	"github.com/wtg/shuttletracker/gis"
+	"github.com/wtg/shuttletracker/postgres"
+)
+
+// ImportFormat is the format of the imported file: geojson or kml. If it's empty, the
+// format comes from the file's extension.
+var ImportFormat string
+
+// ImportPreview prints what would be imported without creating anything.
+var ImportPreview bool
+
+// ImportAllowOpen allows routes that aren't closed loops.
+var ImportAllowOpen bool
+
+// ImportMaxStopDistance is how far in meters a stop can be from a route and still be on it.
+var ImportMaxStopDistance float64
+
+// ImportUsername is recorded as the administrator who created the routes and stops.
+var ImportUsername string
+
+func init() {
+	username := ""
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+	routesImportCmd.Flags().StringVar(&ImportFormat, "format", "", "geojson or kml (default from the file's extension)")
+	routesImportCmd.Flags().BoolVar(&ImportPreview, "preview", false, "print what would be imported without creating anything")
+	routesImportCmd.Flags().BoolVar(&ImportAllowOpen, "allow-open", false, "allow routes that aren't closed loops")
+	routesImportCmd.Flags().Float64Var(&ImportMaxStopDistance, "max-stop-distance", gis.DefaultImportOptions.MaxStopDistance, "how far in meters a stop can be from a route")
+	routesImportCmd.Flags().StringVar(&ImportUsername, "username", username, "who to record as creating the routes and stops")
+
+	routesCmd.AddCommand(routesImportCmd)
+	rootCmd.AddCommand(routesCmd)
+}
+
+var routesCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "Manage Shuttle Tracker routes",
+}
+
+var routesImportCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Create routes and stops from a GeoJSON or KML file",
+	Long: "Create a route from each line in a GeoJSON or KML file, and a stop from each point. " +
+		"Stops are moved onto the routes they're near and ordered along them.",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("a file is required")
+		}
+		if ImportMaxStopDistance < 0 {
+			return errors.New("max-stop-distance can't be negative")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		name := ImportFormat
+		if name == "" {
+			name = args[0]
+		}
+		f, err := gis.ParseFormat(name)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to open file:", err)
+			os.Exit(1)
+		}
+		features, err := gis.Read(file, f)
+		_ = file.Close()
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to read file:", err)
+			os.Exit(1)
+		}
+
+		opts := gis.DefaultImportOptions
+		opts.AllowOpen = ImportAllowOpen
+		opts.MaxStopDistance = ImportMaxStopDistance
+		im := gis.PlanImport(features, opts)
+
+		api.ValidateImport(im)
+
+		if ImportPreview {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", " ")
+			_ = enc.Encode(im)
+			return
+		}
+		if len(im.Problems) > 0 {
+			for _, p := range im.Problems {
+				_, _ = fmt.Fprintf(os.Stderr, "%s %s\n", p.Feature, p.Message)
+			}
+			os.Exit(1)
+		}
+
+		cfg, err := config.New()
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to read configuration.")
+			os.Exit(1)
+		}
+
+		pg, err := postgres.New(*cfg.Postgres)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to connect to Postgres:", err)
+			os.Exit(1)
+		}
+
+		err = im.Create(pg, ImportUsername)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, "Unable to import:", err)
+			os.Exit(1)
+		}
+		api.AuditImport(pg, im, ImportUsername)
+		for _, ir := range im.Routes {
+			_, _ = fmt.Printf("Created route %d (%s) with %d stops.\n", ir.Route.ID, ir.Route.Name, len(ir.Stops))
+		}
+	},
+}
@@ -0,0 +1,43 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// Detour temporarily reroutes part of a Route, e.g. around construction, and closes
+// the Stops that vehicles can't get to.
+type Detour struct {
+	ID          int64  `json:"id"`
+	RouteID     int64  `json:"route_id"`
+	Description string `json:"description"`
+	// A Detour is active from Start until End.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Points replace the part of the Route between where the first and last of them
+	// leave and rejoin it. Without Points, the Route's shape doesn't change.
+	Points []Point `json:"points"`
+	// ClosedStopIDs are Stops of the Route that vehicles skip during the Detour.
+	ClosedStopIDs []int64   `json:"closed_stop_ids"`
+	Created       time.Time `json:"created"`
+	Updated       time.Time `json:"updated"`
+}
+
+// ActiveAt returns whether a Detour is active at a time.
+func (d *Detour) ActiveAt(t time.Time) bool {
+	return !t.Before(d.Start) && t.Before(d.End)
+}
+
+// DetourService is an interface for interacting with Detours.
+type DetourService interface {
+	Detours() ([]*Detour, error)
+	Detour(id int64) (*Detour, error)
+	CreateDetour(detour *Detour) error
+	ModifyDetour(detour *Detour) error
+	DeleteDetour(id int64) error
+}
+
+var (
+	// ErrDetourNotFound indicates that a Detour is not in the database.
+	ErrDetourNotFound = errors.New("detour not found")
+)
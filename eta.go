@@ -20,8 +20,22 @@ type StopETA struct {
 	Arriving bool      `json:"arriving"`
 }
 
+// RouteLoopStats describes how long vehicles have historically taken to make a loop of
+// a Route, starting and ending at its first stop, and how often they depart.
+type RouteLoopStats struct {
+	RouteID int64
+	// Loops is how many loops the stats come from. The durations are zero without any.
+	Loops int
+	// Duration is the median time that a loop takes.
+	Duration time.Duration
+	// Headway is the median time between departures from the first stop by any vehicle.
+	Headway time.Duration
+	Updated time.Time
+}
+
 // ETAService is an interface for interacting with vehicle estimated times of arrival.
 type ETAService interface {
 	Subscribe(func(VehicleETA))
 	CurrentETAs() map[int64]VehicleETA
+	RouteLoopStats(routeID int64) (*RouteLoopStats, error)
 }
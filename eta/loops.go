@@ -0,0 +1,116 @@
+package eta
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/log"
+)
+
+// Finding loops looks through a month of locations, so it's done in the background
+// this often instead of when stats are requested.
+const loopStatsInterval = time.Hour
+
+// Gaps between departures longer than this are breaks in service, not headways.
+const maxHeadway = 2 * time.Hour
+
+// RouteLoopStats returns how long vehicles have taken to make loops of a Route and how
+// often they've departed from its first stop. The stats are up to loopStatsInterval
+// old, and have no loops if they haven't been found for the Route yet.
+func (em *ETAManager) RouteLoopStats(routeID int64) (*shuttletracker.RouteLoopStats, error) {
+	em.lsm.Lock()
+	stats, ok := em.loopStats[routeID]
+	em.lsm.Unlock()
+	if !ok {
+		return &shuttletracker.RouteLoopStats{RouteID: routeID}, nil
+	}
+	return stats, nil
+}
+
+// refreshLoopStats finds the loop stats of every Route now and then every
+// loopStatsInterval.
+func (em *ETAManager) refreshLoopStats() {
+	for {
+		em.updateLoopStats()
+		time.Sleep(loopStatsInterval)
+	}
+}
+
+// updateLoopStats finds the loop stats of every Route. Routes whose stats can't be
+// found keep their old ones.
+func (em *ETAManager) updateLoopStats() {
+	routes, err := em.ms.Routes()
+	if err != nil {
+		log.WithError(err).Error("unable to get routes for loop stats")
+		return
+	}
+
+	em.lsm.Lock()
+	old := em.loopStats
+	em.lsm.Unlock()
+
+	all := map[int64]*shuttletracker.RouteLoopStats{}
+	for _, route := range routes {
+		loops := [][]*shuttletracker.Location{}
+		if len(route.StopIDs) > 0 {
+			loops, err = em.findRouteLoops(route)
+			if err != nil {
+				log.WithError(err).Errorf("unable to find loops of route %d", route.ID)
+				if stats, ok := old[route.ID]; ok {
+					all[route.ID] = stats
+				}
+				continue
+			}
+		}
+		all[route.ID] = loopStats(route.ID, loops)
+	}
+
+	em.lsm.Lock()
+	em.loopStats = all
+	em.lsm.Unlock()
+}
+
+// loopStats finds the median duration of loops and the median time between their
+// departures.
+func loopStats(routeID int64, loops [][]*shuttletracker.Location) *shuttletracker.RouteLoopStats {
+	stats := &shuttletracker.RouteLoopStats{
+		RouteID: routeID,
+		Updated: time.Now(),
+	}
+	durations := []time.Duration{}
+	departures := []time.Time{}
+	for _, loop := range loops {
+		if len(loop) < 2 {
+			continue
+		}
+		durations = append(durations, loop[len(loop)-1].Time.Sub(loop[0].Time))
+		departures = append(departures, loop[0].Time)
+	}
+	stats.Loops = len(durations)
+	stats.Duration = median(durations)
+
+	sort.Slice(departures, func(i, j int) bool {
+		return departures[i].Before(departures[j])
+	})
+	headways := []time.Duration{}
+	for i := 1; i < len(departures); i++ {
+		headway := departures[i].Sub(departures[i-1])
+		if headway > 0 && headway <= maxHeadway {
+			headways = append(headways, headway)
+		}
+	}
+	stats.Headway = median(headways)
+	return stats
+}
+
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted[len(sorted)/2]
+}
@@ -9,6 +9,7 @@ import (
 	// "github.com/wcharczuk/go-chart"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
 	"github.com/wtg/shuttletracker/log"
 	"github.com/wtg/shuttletracker/updater"
 )
@@ -22,6 +23,9 @@ type ETAManager struct {
 
 	sm          *sync.Mutex
 	subscribers []func(shuttletracker.VehicleETA)
+
+	lsm       *sync.Mutex
+	loopStats map[int64]*shuttletracker.RouteLoopStats
 }
 
 // NewManager creates an ETAManager subscribed to Location updates from Updater.
@@ -33,14 +37,30 @@ func NewManager(ms shuttletracker.ModelService, updater *updater.Updater) (*ETAM
 		etasReqChan: make(chan chan map[int64]shuttletracker.VehicleETA),
 		sm:          &sync.Mutex{},
 		subscribers: []func(shuttletracker.VehicleETA){},
+		lsm:         &sync.Mutex{},
+		loopStats:   map[int64]*shuttletracker.RouteLoopStats{},
 	}
 
 	// subscribe to new Locations with Updater
 	updater.Subscribe(em.locationSubscriber)
 
+	// Updater doesn't know about Locations that Fusion synthesizes from rider
+	// positions, so get those from the database.
+	go em.handleFusionLocations(ms.SubscribeLocations())
+
 	return em, nil
 }
 
+func (em *ETAManager) handleFusionLocations(locChan chan *shuttletracker.Location) {
+	for loc := range locChan {
+		if loc.Source != shuttletracker.LocationSourceFusion {
+			// Updater already told us about this one
+			continue
+		}
+		go em.handleNewLocation(loc)
+	}
+}
+
 // This gets new Locations from Updater. As soon as this happens, we'll
 // determine new ETAs for the vehicle in another goroutine.
 func (em *ETAManager) locationSubscriber(loc *shuttletracker.Location) {
@@ -95,6 +115,12 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 	if err != nil {
 		return nil, err
 	}
+	// follow the route's detours and skip the stops they close
+	detours, err := em.ms.Detours()
+	if err != nil {
+		return nil, err
+	}
+	route = geo.FollowDetours(route, detours, time.Now())
 
 	lastDepartureTrack, err := em.getLastDepartureTrack(vehicle, route)
 	if err != nil {
@@ -195,6 +221,8 @@ func (em *ETAManager) calculateVehicleETAs(vehicleID int64) (*shuttletracker.Veh
 
 // Run is in charge of managing all of the state inside of ETAManager.
 func (em *ETAManager) Run() {
+	go em.refreshLoopStats()
+
 	err := em.createInitialETAs()
 	if err != nil {
 		log.WithError(err).Error("unable to create initial ETAs")
@@ -417,6 +445,17 @@ func (em *ETAManager) findRouteLoops(route *shuttletracker.Route) ([][]*shuttlet
 			return nil, err
 		}
 
+		// Only use iTRAK Locations for historical travel times. Fusion Locations are
+		// good enough to tell where a vehicle is now, but they are too imprecise
+		// (and too sparse) to learn from.
+		itrak := make([]*shuttletracker.Location, 0, len(locations))
+		for _, loc := range locations {
+			if loc.Source == shuttletracker.LocationSourceITRAK {
+				itrak = append(itrak, loc)
+			}
+		}
+		locations = itrak
+
 		// reverse locations so oldest is first
 		for left, right := 0, len(locations)-1; left < right; left, right = left+1, right-1 {
 			locations[left], locations[right] = locations[right], locations[left]
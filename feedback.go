@@ -5,6 +5,34 @@ import (
 	"time"
 )
 
+// Feedback categories.
+const (
+	FeedbackCategoryAppBug      = "app_bug"
+	FeedbackCategoryDriver      = "driver"
+	FeedbackCategoryLateShuttle = "late_shuttle"
+	FeedbackCategorySuggestion  = "suggestion"
+	FeedbackCategoryOther       = "other"
+)
+
+// FeedbackCategories lists every feedback category.
+var FeedbackCategories = []string{
+	FeedbackCategoryAppBug,
+	FeedbackCategoryDriver,
+	FeedbackCategoryLateShuttle,
+	FeedbackCategorySuggestion,
+	FeedbackCategoryOther,
+}
+
+// Feedback statuses, in the order that feedback usually moves through them.
+const (
+	FeedbackStatusNew          = "new"
+	FeedbackStatusAcknowledged = "acknowledged"
+	FeedbackStatusResolved     = "resolved"
+)
+
+// FeedbackStatuses lists every feedback status.
+var FeedbackStatuses = []string{FeedbackStatusNew, FeedbackStatusAcknowledged, FeedbackStatusResolved}
+
 // details of each form
 type Form struct {
 	ID      int64     `json:"id"`
@@ -12,6 +40,33 @@ type Form struct {
 	Prompt  string    `json:"prompt"`
 	Created time.Time `json:"created"`
 	Admin   bool      `json:"admin"`
+
+	Category string `json:"category"`
+	// The Route, Stop, and Vehicle that the feedback is about, if any
+	RouteID   *int64 `json:"route_id"`
+	StopID    *int64 `json:"stop_id"`
+	VehicleID *int64 `json:"vehicle_id"`
+	// Email is only kept if the rider agreed to be contacted.
+	Email          string `json:"email"`
+	ContactConsent bool   `json:"contact_consent"`
+
+	// Status and Notes are for administrators triaging feedback.
+	Status  string    `json:"status"`
+	Notes   string    `json:"notes"`
+	Updated time.Time `json:"updated"`
+}
+
+// FormFilter picks which Forms to return. Zero values match everything.
+type FormFilter struct {
+	// Query matches Forms whose message, notes, or email contain it, ignoring case.
+	Query     string
+	Category  string
+	Status    string
+	RouteID   int64
+	StopID    int64
+	VehicleID int64
+	Since     time.Time
+	Until     time.Time
 }
 
 // FeedbackService is an interface for interacting with Feedback.
@@ -19,7 +74,11 @@ type FeedbackService interface {
 	GetAdminForm() *Form
 	GetForm(id int64) (*Form, error)
 	GetForms() ([]*Form, error)
+	// SearchForms returns the Forms that match a filter, newest first.
+	SearchForms(filter FormFilter) ([]*Form, error)
 	CreateForm(form *Form) error
+	// EditForm changes a Form's category, status, and notes.
+	EditForm(form *Form) error
 	DeleteForm(id int64) error
 }
 
@@ -1,5 +1,15 @@
 var state = 0;
 
+// Requests that change things must send the token from the shuttletracker_csrf cookie.
+$.ajaxSetup({
+  beforeSend: function (xhr, settings) {
+    if (!/^(GET|HEAD|OPTIONS)$/i.test(settings.type)) {
+      var match = document.cookie.match(/(?:^|;\s*)shuttletracker_csrf=([^;]*)/);
+      xhr.setRequestHeader("X-CSRF-Token", match ? decodeURIComponent(match[1]) : "");
+    }
+  }
+});
+
 Vue.component('titlebar', {
   template:
   `<div>
@@ -10,6 +10,7 @@ import vehicleEditing from '@/components/admin/vehicleEditing.vue';
 import vehicleOverview from '@/components/admin/vehicleOverview.vue';
 import messagesAdmin from '@/components/admin/MessagesAdmin.vue';
 import feedbackAdmin from '@/components/admin/feedbackAdmin.vue';
+import busButtonAdmin from '@/components/admin/busButtonAdmin.vue';
 
 Vue.use(Router);
 
@@ -63,6 +64,11 @@ export default new Router({
         name: 'feedback',
         component: feedbackAdmin,
       },
+      {
+        path: '/admin/busbutton',
+        name: 'bus button',
+        component: busButtonAdmin,
+      },
       {
         path: '/admin/vehicles',
         name: 'vehicles overview',
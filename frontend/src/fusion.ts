@@ -117,6 +117,7 @@ export default class Fusion {
             }
         });
         this.ws.registerReconnectCallback(() => {
+            this.sendHello();
             for (const topic of this.subscriptionTopics) {
                 this.requestSubscription(topic);
             }
@@ -125,6 +126,15 @@ export default class Fusion {
 
     public start() {
         this.ws.open();
+        this.sendHello();
+
+        // the server tells us when it couldn't handle one of our messages
+        this.registerMessageReceivedCallback((message: any) => {
+            if (message.type !== 'error') {
+                return;
+            }
+            console.warn(`Fusion error ${message.message.code}: ${message.message.message}`);
+        });
 
         // register server ID changed refresh callback
         this.registerMessageReceivedCallback((message: any) => {
@@ -198,6 +208,18 @@ export default class Fusion {
         this.callbacks.push(callback);
     }
 
+    // Tell the server which protocol version and message types we understand.
+    public sendHello() {
+        const data = {
+            type: 'hello',
+            message: {
+                protocol_version: 1,
+                message_types: ['hello', 'error', 'server_id', 'vehicle_location', 'eta', 'bus_button'],
+            },
+        };
+        this.ws.send(JSON.stringify(data));
+    }
+
     public sendBusButton() {
         const ls = UserLocationService.getInstance();
         const pos = ls.getCurrentLocation();
@@ -216,8 +216,8 @@ const store: StoreOptions<StoreState> = {
         state.Routes.forEach((r: Route) => {
           if (r.shouldShow()) {
             const points = new Array<L.LatLng>();
-            if (r.points !== undefined) {
-              r.points.forEach((p: { latitude: number, longitude: number }) => {
+            if (r.effective_points !== undefined) {
+              r.effective_points.forEach((p: { latitude: number, longitude: number }) => {
                 points.push(new L.LatLng(p.latitude, p.longitude));
               });
             }
@@ -236,8 +236,8 @@ const store: StoreOptions<StoreState> = {
       const points = new Array<L.LatLng>();
       if (state.Routes !== undefined && state.Routes.length !== 0) {
         state.Routes.forEach((r: Route) => {
-          if (r.shouldShow() && r.points !== undefined) {
-            r.points.forEach((p: { latitude: number, longitude: number }) => {
+          if (r.shouldShow() && r.effective_points !== undefined) {
+            r.effective_points.forEach((p: { latitude: number, longitude: number }) => {
               points.push(new L.LatLng(p.latitude, p.longitude));
             });
           }
@@ -0,0 +1,14 @@
+// BusButtonCount is how many times the bus button was pressed with an emoji on a day
+export default class BusButtonCount {
+
+    public day: Date;
+    public emoji: string;
+    public count: number;
+
+    constructor(day: Date, emoji: string, count: number) {
+        this.day = day;
+        this.emoji = emoji;
+        this.count = count;
+    }
+
+}
@@ -13,6 +13,7 @@ export interface RouteInterface {
         longitude: number,
     }>;
     stop_ids: number[];
+    updated?: string;
 }
 
 /**
@@ -33,6 +34,17 @@ export default class Route implements RouteInterface {
     }>;
     public stop_ids: number[];
 
+    // where the route goes and which stops it serves with its active detours, which
+    // riders should see instead of its own points and stops
+    public effective_points: Array<{
+        latitude: number,
+        longitude: number,
+    }>;
+    public effective_stop_ids: number[];
+
+    // when the route was last modified, so that edits based on an old copy are rejected
+    public updated?: string;
+
     constructor(id: number, name: string, description: string, enabled: boolean,
                 color: string, width: number, points: Array<{
             latitude: number,
@@ -49,6 +61,8 @@ export default class Route implements RouteInterface {
         this.points = points;
         this.schedule = schedule;
         this.stop_ids = stop_ids;
+        this.effective_points = points;
+        this.effective_stop_ids = stop_ids;
     }
 
     public shouldShow(): boolean {
@@ -56,7 +70,7 @@ export default class Route implements RouteInterface {
     }
 
     public containsStop(stop_id: number): boolean {
-        for (const id of this.stop_ids) {
+        for (const id of this.effective_stop_ids) {
             if (id === stop_id) {
                 return true;
             }
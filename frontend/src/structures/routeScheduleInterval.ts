@@ -18,6 +18,34 @@ export default class RotueScheduleInterval {
         this.end_time = end_time;
     }
 
+    // Schedules are in the wall-clock time of the route's time zone, so times are read
+    // and sent by their hours and minutes instead of being converted to and from UTC.
+    public static fromWallClock(time: string): Date {
+        const match = /T(\d\d):(\d\d):(\d\d)/.exec(time);
+        const date = new Date();
+        if (match === null) {
+            return date;
+        }
+        date.setHours(Number(match[1]), Number(match[2]), Number(match[3]), 0);
+        return date;
+    }
+
+    public static toWallClock(date: Date): string {
+        const pad = (n: number) => (n < 10 ? '0' : '') + n;
+        return '0000-01-01T' + pad(date.getHours()) + ':' + pad(date.getMinutes()) + ':' + pad(date.getSeconds()) + 'Z';
+    }
+
+    public toJSON(): object {
+        return {
+            id: this.id,
+            route_id: this.route_id,
+            start_day: this.start_day,
+            start_time: RotueScheduleInterval.toWallClock(this.start_time),
+            end_day: this.end_day,
+            end_time: RotueScheduleInterval.toWallClock(this.end_time),
+        };
+    }
+
     // Make the interval into a readable string
     public toString(): string {
         return dateToSttr[this.start_day] + ' at ' + this.start_time.getHours() + ':00 to ' + dateToSttr[this.end_day] + ' at ' + this.end_time.getHours() + ':00';
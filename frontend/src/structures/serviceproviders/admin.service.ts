@@ -4,71 +4,84 @@ import { Stop } from '../stop';
 import Form from '../form';
 import AdminMessageUpdate from '../adminMessageUpdate';
 import FeedbackMessageUpdate from '../feedbackMessageUpdate';
+import BusButtonCount from '../busButtonCount';
+
+// csrfToken returns the token that the server expects in the X-CSRF-Token header of
+// admin requests that change things.
+function csrfToken(): string {
+    const match = document.cookie.match(/(?:^|;\s*)shuttletracker_csrf=([^;]*)/);
+    return match ? decodeURIComponent(match[1]) : '';
+}
+
+// send makes an admin request that changes something.
+function send(url: string, method: string, body?: string): Promise<Response> {
+    return fetch(url, {
+        method,
+        body,
+        headers: { 'X-CSRF-Token': csrfToken() },
+    });
+}
 
 export default class AdminServiceProvider {
     public static EditRoute(route: Route): Promise<Response> {
-        return fetch('/routes/edit', {
-            method: 'POST',
-            body: JSON.stringify(route as RouteInterface),
-        });
+        return send('/routes/edit', 'POST', JSON.stringify(route as RouteInterface));
     }
 
     public static DeleteRoute(route: Route): Promise<Response> {
-        return fetch('/routes?id=' + String(route.id), {
-            method: 'DELETE',
-        });
+        return send('/routes?id=' + String(route.id), 'DELETE');
     }
 
     public static CreateRoute(route: Route): Promise<Response> {
-        return fetch('/routes/create', {
-            method: 'POST',
-            body: JSON.stringify(route as RouteInterface),
-        });
+        return send('/routes/create', 'POST', JSON.stringify(route as RouteInterface));
     }
 
     public static EditVehicle(vehicle: Vehicle): Promise<Response> {
-        return fetch('/vehicles/edit', {
-            method: 'POST',
-            body: JSON.stringify(vehicle.asJSON()),
-        });
+        return send('/vehicles/edit', 'POST', JSON.stringify(vehicle.asJSON()));
     }
 
     public static DeleteVehicle(vehicle: Vehicle): Promise<Response> {
-        return fetch('/vehicles?id=' + String(vehicle.id), {
-            method: 'DELETE',
-        });
+        return send('/vehicles?id=' + String(vehicle.id), 'DELETE');
     }
 
     public static NewVehicle(vehicle: Vehicle): Promise<Response> {
-        return fetch('/vehicles/create', {
-            method: 'POST',
-            body: JSON.stringify(vehicle.asJSON()),
-        });
+        return send('/vehicles/create', 'POST', JSON.stringify(vehicle.asJSON()));
     }
 
     public static NewStop(stop: Stop): Promise<Response> {
-        return fetch('/stops/create', {
-            method: 'POST',
-            body: JSON.stringify(stop.asJSON()),
-        });
+        return send('/stops/create', 'POST', JSON.stringify(stop.asJSON()));
+    }
+
+    public static EditStop(stop: Stop): Promise<Response> {
+        return send('/stops/edit', 'POST', JSON.stringify(stop.asJSON()));
+    }
+
+    // DeleteStop deletes a stop. Stops that routes stop at are only deleted if detach is
+    // true, which also removes them from those routes.
+    public static DeleteStop(stop: Stop, detach: boolean): Promise<Response> {
+        return send('/stops?id=' + String(stop.id) + '&detach=' + String(detach), 'DELETE');
     }
 
     public static SetMessage(message: AdminMessageUpdate): Promise<Response> {
-        return fetch('/adminMessage', {
-            method: 'POST',
-            body: JSON.stringify(message),
-        });
+        return send('/adminMessage', 'POST', JSON.stringify(message));
     }
 
-    public static CreateForm(form: Form): Promise<Response> {
+    // website is the feedback form's honeypot field, which only bots fill in.
+    public static CreateForm(form: Form, website: string = ''): Promise<Response> {
         return fetch('/forms', {
             method: 'POST',
-            body: JSON.stringify(form.asJSON()),
+            body: JSON.stringify({ ...form.asJSON(), website }),
         });
     }
+    public static SetFeedbackPrompt(message: string): Promise<Response> {
+        return send('/forms/prompt', 'PUT', JSON.stringify({ message }));
+    }
     public static DeleteForm(id: number): Promise<Response> {
-        return fetch('/forms?id=' + String(id), {
-            method: 'DELETE',
+        return send('/forms?id=' + String(id), 'DELETE');
+    }
+
+    public static GetBusButtonCounts(days: number): Promise<BusButtonCount[]> {
+        return fetch('/fusion/bus_button?days=' + String(days)).then((data) => data.json()).then((data) => {
+            return data.map((c: any) => new BusButtonCount(new Date(c.day), c.emoji, c.count));
         });
     }
 }
@@ -48,21 +48,33 @@ export default class InfoServiceProvider {
                         id: number;
                         route_id: number;
                         start_day: number;
-                        start_time: Date;
+                        start_time: string;
                         end_day: number;
-                        end_time: Date;
+                        end_time: string;
                     }
                 ],
                 active: boolean,
                 stop_ids: number[],
+                effective_points: [{
+                    latitude: number,
+                    longitude: number,
+                }],
+                effective_stop_ids: number[],
+                updated: string,
             }) => {
                 const myschedule: routeScheduleInterval[] = [];
                 element.schedule.forEach((interval) => {
-                    myschedule.push(new routeScheduleInterval(interval.id, interval.route_id, interval.start_day, new Date(interval.start_time), interval.end_day, new Date(interval.end_time)));
+                    myschedule.push(new routeScheduleInterval(interval.id, interval.route_id, interval.start_day,
+                        routeScheduleInterval.fromWallClock(interval.start_time), interval.end_day,
+                        routeScheduleInterval.fromWallClock(interval.end_time)));
                 });
-                ret.push(new Route(element.id, element.name, element.description,
+                const route = new Route(element.id, element.name, element.description,
                     element.enabled, element.color, Number(element.width), element.points, myschedule, element.active,
-                    element.stop_ids));
+                    element.stop_ids);
+                route.updated = element.updated;
+                route.effective_points = element.effective_points;
+                route.effective_stop_ids = element.effective_stop_ids;
+                ret.push(route);
             });
             return ret;
         });
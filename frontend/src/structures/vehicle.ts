@@ -171,10 +171,10 @@ export default class Vehicle {
                 this.updateClosestStartingPoint();
             }
             this.updateClosestDestinationPoint();
-            if (this.Route !== undefined && this.pointIndex !== null  && this.endPointIndex !== null && this.marker.getLatLng().distanceTo(L.latLng(this.Route.points[this.pointIndex].latitude, this.Route.points[this.pointIndex].longitude)) < 100) {
+            if (this.Route !== undefined && this.pointIndex !== null  && this.endPointIndex !== null && this.marker.getLatLng().distanceTo(L.latLng(this.Route.effective_points[this.pointIndex].latitude, this.Route.effective_points[this.pointIndex].longitude)) < 100) {
                 if (this.pointIndex !== this.endPointIndex) {
                     this.pointIndex++;
-                    if (this.pointIndex >= this.Route.points.length) {
+                    if (this.pointIndex >= this.Route.effective_points.length) {
                         this.pointIndex = 0;
                     }
                 }
@@ -196,11 +196,11 @@ export default class Vehicle {
             const origPointIndex = this.pointIndex;
             if (this.pointIndex !== this.endPointIndex) {
                 // Shuttle can transition to a route point closer to the destination point
-                const point = this.Route.points[this.pointIndex];
+                const point = this.Route.effective_points[this.pointIndex];
                 this.lat = point.latitude;
                 this.lng = point.longitude;
                 this.pointIndex++;
-                if (this.pointIndex >= this.Route.points.length) {
+                if (this.pointIndex >= this.Route.effective_points.length) {
                     this.pointIndex = 0;
                 }
             } else {
@@ -215,7 +215,7 @@ export default class Vehicle {
                 const transitionRatio = transitionDistance / this.totalTransitionDistance;
                 const transitionTime = Math.round(transitionRatio * 3000); // 3 s (3000 ms) for the total transition
                 // Update shuttle's rotation based on the angle between route points
-                const newAngle = this.angleBetween(this.marker.getLatLng().lat, this.marker.getLatLng().lng, this.Route.points[origPointIndex].latitude, this.Route.points[origPointIndex].longitude);
+                const newAngle = this.angleBetween(this.marker.getLatLng().lat, this.marker.getLatLng().lng, this.Route.effective_points[origPointIndex].latitude, this.Route.effective_points[origPointIndex].longitude);
                 this.marker.setRotationAngle(newAngle);
                 // Begin the next segment
                 (this.marker as any).slideTo([this.lat, this.lng], { duration: transitionTime, keepAtCenter: false });
@@ -232,8 +232,8 @@ export default class Vehicle {
         if (this.Route !== undefined) {
             // Find closest point index to the vehicle's current position
             let minDistance = -1.0;
-            for (let i = 0; i < this.Route.points.length; i++) {
-                const distance = this.marker.getLatLng().distanceTo(L.latLng(this.Route.points[i].latitude, this.Route.points[i].longitude));
+            for (let i = 0; i < this.Route.effective_points.length; i++) {
+                const distance = this.marker.getLatLng().distanceTo(L.latLng(this.Route.effective_points[i].latitude, this.Route.effective_points[i].longitude));
                 if (distance < minDistance || minDistance < 0) {
                     minDistance = distance;
                     this.pointIndex = i;
@@ -249,25 +249,25 @@ export default class Vehicle {
                 this.totalTransitionDistance = 0.0;
                 let currentPointIndex = this.pointIndex;
                 let nextPointIndex = this.pointIndex + 1;
-                if (nextPointIndex >= this.Route.points.length) {
+                if (nextPointIndex >= this.Route.effective_points.length) {
                     nextPointIndex = 0;
                 }
-                let distanceToNextPoint = this.marker.getLatLng().distanceTo(L.latLng(this.Route.points[currentPointIndex].latitude, this.Route.points[currentPointIndex].longitude));
-                while (distanceToNextPoint < L.latLng(this.Route.points[currentPointIndex].latitude, this.Route.points[currentPointIndex].longitude).distanceTo(L.latLng(this.destinationLat, this.destinationLng))) {
+                let distanceToNextPoint = this.marker.getLatLng().distanceTo(L.latLng(this.Route.effective_points[currentPointIndex].latitude, this.Route.effective_points[currentPointIndex].longitude));
+                while (distanceToNextPoint < L.latLng(this.Route.effective_points[currentPointIndex].latitude, this.Route.effective_points[currentPointIndex].longitude).distanceTo(L.latLng(this.destinationLat, this.destinationLng))) {
                     this.totalTransitionDistance += distanceToNextPoint;
                     currentPointIndex = nextPointIndex;
                     nextPointIndex++;
-                    if (nextPointIndex >= this.Route.points.length) {
+                    if (nextPointIndex >= this.Route.effective_points.length) {
                         nextPointIndex = 0;
                     }
-                    distanceToNextPoint = L.latLng(this.Route.points[currentPointIndex].latitude, this.Route.points[currentPointIndex].longitude).distanceTo(L.latLng(this.Route.points[nextPointIndex].latitude, this.Route.points[nextPointIndex].longitude));
+                    distanceToNextPoint = L.latLng(this.Route.effective_points[currentPointIndex].latitude, this.Route.effective_points[currentPointIndex].longitude).distanceTo(L.latLng(this.Route.effective_points[nextPointIndex].latitude, this.Route.effective_points[nextPointIndex].longitude));
                     if (currentPointIndex === this.pointIndex) { // We've wrapped around to the original point
                         this.totalTransitionDistance = 0.0;
                         break;
                     }
                 }
                 this.endPointIndex = currentPointIndex;
-                this.totalTransitionDistance += L.latLng(this.Route.points[this.endPointIndex].latitude, this.Route.points[this.endPointIndex].longitude).distanceTo(L.latLng(this.destinationLat, this.destinationLng));
+                this.totalTransitionDistance += L.latLng(this.Route.effective_points[this.endPointIndex].latitude, this.Route.effective_points[this.endPointIndex].longitude).distanceTo(L.latLng(this.destinationLat, this.destinationLng));
             }
         }
     }
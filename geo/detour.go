@@ -0,0 +1,106 @@
+package geo
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// MaxDetourJoinDistance is how far in meters the ends of a detour can be from the
+// route that it leaves and rejoins.
+const MaxDetourJoinDistance = 100.0
+
+var (
+	// ErrDetourTooShort indicates that a detour has fewer than two points.
+	ErrDetourTooShort = errors.New("detour must have at least two points")
+	// ErrDetourOffRoute indicates that a detour doesn't start or end near its route.
+	ErrDetourOffRoute = errors.New("detour must start and end near its route")
+	// ErrDetourBackwards indicates that a detour rejoins its route before it leaves it.
+	ErrDetourBackwards = errors.New("detour must rejoin its route after it leaves it")
+)
+
+// SpliceDetour returns a copy of a route's points with the part between where a
+// detour's first and last points leave and rejoin it replaced by the detour.
+func SpliceDetour(points, detour []shuttletracker.Point) ([]shuttletracker.Point, error) {
+	if len(detour) < 2 {
+		return nil, ErrDetourTooShort
+	}
+	if len(points) < 2 {
+		return nil, ErrDetourOffRoute
+	}
+	leave := Locate(detour[0], points)
+	rejoin := Locate(detour[len(detour)-1], points)
+	if leave.Distance > MaxDetourJoinDistance || rejoin.Distance > MaxDetourJoinDistance {
+		return nil, ErrDetourOffRoute
+	}
+	if rejoin.Along <= leave.Along {
+		return nil, ErrDetourBackwards
+	}
+
+	spliced := make([]shuttletracker.Point, 0, len(points)+len(detour)+2)
+	add := func(ps ...shuttletracker.Point) {
+		for _, p := range ps {
+			if n := len(spliced); n > 0 && spliced[n-1] == p {
+				continue
+			}
+			spliced = append(spliced, p)
+		}
+	}
+	add(points[:leave.Segment+1]...)
+	add(leave.Point)
+	add(detour...)
+	add(rejoin.Point)
+	add(points[rejoin.Segment+1:]...)
+	return spliced, nil
+}
+
+// ApplyDetours returns a copy of a route with its EffectivePoints and
+// EffectiveStopIDs set to those it has with its detours that are active at a time
+// applied, in the order they were created. A detour whose points don't fit the
+// route only closes its stops. The route's own Points and StopIDs are left alone.
+func ApplyDetours(route *shuttletracker.Route, detours []*shuttletracker.Detour, t time.Time) *shuttletracker.Route {
+	active := []*shuttletracker.Detour{}
+	for _, d := range detours {
+		if d.RouteID == route.ID && d.ActiveAt(t) {
+			active = append(active, d)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].ID < active[j].ID
+	})
+
+	r := *route
+	r.EffectivePoints = append([]shuttletracker.Point{}, route.Points...)
+	closed := map[int64]bool{}
+	r.DetourIDs = nil
+	for _, d := range active {
+		r.DetourIDs = append(r.DetourIDs, d.ID)
+		for _, id := range d.ClosedStopIDs {
+			closed[id] = true
+		}
+		if len(d.Points) == 0 {
+			continue
+		}
+		if points, err := SpliceDetour(r.EffectivePoints, d.Points); err == nil {
+			r.EffectivePoints = points
+		}
+	}
+	r.EffectiveStopIDs = []int64{}
+	for _, id := range route.StopIDs {
+		if !closed[id] {
+			r.EffectiveStopIDs = append(r.EffectiveStopIDs, id)
+		}
+	}
+	return &r
+}
+
+// FollowDetours returns a copy of a route whose Points and StopIDs are where its
+// vehicles go at a time, for code that follows them. It must not be saved or sent
+// to clients as the route.
+func FollowDetours(route *shuttletracker.Route, detours []*shuttletracker.Detour, t time.Time) *shuttletracker.Route {
+	r := ApplyDetours(route, detours, t)
+	r.Points, r.StopIDs = r.EffectivePoints, r.EffectiveStopIDs
+	return r
+}
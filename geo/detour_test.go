@@ -0,0 +1,83 @@
+package geo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestApplyDetours(t *testing.T) {
+	// A straight route east along a street, about 80 meters between points
+	points := []shuttletracker.Point{}
+	for i := 0; i < 5; i++ {
+		points = append(points, shuttletracker.Point{Latitude: 42.73, Longitude: -73.69 + float64(i)*0.001})
+	}
+	route := &shuttletracker.Route{ID: 1, Points: points, StopIDs: []int64{10, 11, 12}}
+
+	now := time.Date(2019, 10, 7, 12, 0, 0, 0, time.UTC)
+	// Around the block north of the middle of the route
+	detour := &shuttletracker.Detour{
+		ID:      1,
+		RouteID: 1,
+		Start:   now.Add(-time.Hour),
+		End:     now.Add(time.Hour),
+		Points: []shuttletracker.Point{
+			{Latitude: 42.73, Longitude: -73.6885},
+			{Latitude: 42.731, Longitude: -73.6885},
+			{Latitude: 42.731, Longitude: -73.6865},
+			{Latitude: 42.73, Longitude: -73.6865},
+		},
+		ClosedStopIDs: []int64{11},
+	}
+	other := &shuttletracker.Detour{ID: 2, RouteID: 2, Start: now.Add(-time.Hour), End: now.Add(time.Hour), ClosedStopIDs: []int64{10}}
+
+	r := ApplyDetours(route, []*shuttletracker.Detour{detour, other}, now)
+	if len(r.DetourIDs) != 1 || r.DetourIDs[0] != 1 {
+		t.Errorf("got detour IDs %v, expected [1]", r.DetourIDs)
+	}
+	if len(r.EffectiveStopIDs) != 2 || r.EffectiveStopIDs[0] != 10 || r.EffectiveStopIDs[1] != 12 {
+		t.Errorf("got stops %v, expected [10 12]", r.EffectiveStopIDs)
+	}
+	// Points 0 and 1, the detour, then point 4
+	expected := append(append(append([]shuttletracker.Point{}, points[:2]...), detour.Points...), points[4:]...)
+	if len(r.EffectivePoints) != len(expected) {
+		t.Fatalf("got points %v, expected %v", r.EffectivePoints, expected)
+	}
+	for i := range expected {
+		if Distance(r.EffectivePoints[i], expected[i]) > 0.01 {
+			t.Errorf("got point %d %v, expected %v", i, r.EffectivePoints[i], expected[i])
+		}
+	}
+	if len(r.Points) != 5 || len(r.StopIDs) != 3 || len(route.Points) != 5 || len(route.StopIDs) != 3 || route.EffectivePoints != nil {
+		t.Error("route's own points or stops were changed")
+	}
+
+	// Vehicles follow the detour.
+	if f := FollowDetours(route, []*shuttletracker.Detour{detour}, now); len(f.Points) != len(expected) || len(f.StopIDs) != 2 {
+		t.Errorf("got %d points and stops %v to follow, expected %d points and [10 12]", len(f.Points), f.StopIDs, len(expected))
+	}
+
+	// Inactive detours don't change anything.
+	r = ApplyDetours(route, []*shuttletracker.Detour{detour}, now.Add(2*time.Hour))
+	if len(r.DetourIDs) != 0 || len(r.EffectivePoints) != 5 || len(r.EffectiveStopIDs) != 3 {
+		t.Errorf("got route %+v, expected its own points and stops", r)
+	}
+}
+
+func TestSpliceDetourErrors(t *testing.T) {
+	points := []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.69}, {Latitude: 42.73, Longitude: -73.68}}
+	for _, c := range []struct {
+		detour []shuttletracker.Point
+		err    error
+	}{
+		{[]shuttletracker.Point{{Latitude: 42.73, Longitude: -73.685}}, ErrDetourTooShort},
+		{[]shuttletracker.Point{{Latitude: 42.74, Longitude: -73.689}, {Latitude: 42.73, Longitude: -73.681}}, ErrDetourOffRoute},
+		{[]shuttletracker.Point{{Latitude: 42.73, Longitude: -73.681}, {Latitude: 42.73, Longitude: -73.689}}, ErrDetourBackwards},
+	} {
+		if _, err := SpliceDetour(points, c.detour); err != c.err {
+			t.Errorf("%v: got error %v, expected %v", c.detour, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package geo contains geometry helpers for working with shuttletracker Points.
+package geo
+
+import (
+	"math"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// EarthRadius is the mean radius of the Earth in meters.
+const EarthRadius = 6371000.0
+
+func haversine(theta float64) float64 {
+	return (1 - math.Cos(theta)) / 2
+}
+
+func toRadians(n float64) float64 {
+	return n * math.Pi / 180
+}
+
+// Distance returns the great-circle distance between two Points in meters.
+func Distance(p1, p2 shuttletracker.Point) float64 {
+	lat1Rad := toRadians(p1.Latitude)
+	lon1Rad := toRadians(p1.Longitude)
+	lat2Rad := toRadians(p2.Latitude)
+	lon2Rad := toRadians(p2.Longitude)
+
+	return 2 * EarthRadius * math.Asin(math.Sqrt(
+		haversine(lat2Rad-lat1Rad)+
+			math.Cos(lat1Rad)*math.Cos(lat2Rad)*
+				haversine(lon2Rad-lon1Rad)))
+}
+
+// InitialBearing returns the bearing in degrees from p1 to p2, in the range [0, 360).
+func InitialBearing(p1, p2 shuttletracker.Point) float64 {
+	lat1Rad := toRadians(p1.Latitude)
+	lon1Rad := toRadians(p1.Longitude)
+	lat2Rad := toRadians(p2.Latitude)
+	lon2Rad := toRadians(p2.Longitude)
+	lonDiff := lon2Rad - lon1Rad
+
+	y := math.Sin(lonDiff) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(lonDiff)
+	bearing := math.Atan2(y, x) / (math.Pi / 180)
+	return math.Mod(bearing+360, 360)
+}
+
+// DistanceToSegment returns the distance in meters from p to the closest point on the
+// segment between a and b. The Earth is treated as flat around p, which is accurate
+// enough for segments that are a few kilometers long at most.
+func DistanceToSegment(p, a, b shuttletracker.Point) float64 {
+	_, d := closestOnSegment(p, a, b)
+	return d
+}
+
+// closestOnSegment returns how far along the segment from a to b (from 0 to 1) the
+// point closest to p is, and its distance from p in meters.
+func closestOnSegment(p, a, b shuttletracker.Point) (float64, float64) {
+	ax, ay := project(p, a)
+	bx, by := project(p, b)
+	dx, dy := bx-ax, by-ay
+
+	t := 0.0
+	if lengthSquared := dx*dx + dy*dy; lengthSquared > 0 {
+		t = -(ax*dx + ay*dy) / lengthSquared
+		t = math.Max(0, math.Min(1, t))
+	}
+	return t, math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+// DistanceToPath returns the distance in meters from p to the closest segment of a
+// path. It returns +Inf for an empty path.
+func DistanceToPath(p shuttletracker.Point, path []shuttletracker.Point) float64 {
+	if len(path) == 1 {
+		return Distance(p, path[0])
+	}
+	min := math.Inf(1)
+	for i := 1; i < len(path); i++ {
+		min = math.Min(min, DistanceToSegment(p, path[i-1], path[i]))
+	}
+	return min
+}
+
+// project returns the position of p in meters east and north of origin.
+func project(origin, p shuttletracker.Point) (float64, float64) {
+	x := toRadians(p.Longitude-origin.Longitude) * math.Cos(toRadians(origin.Latitude)) * EarthRadius
+	y := toRadians(p.Latitude-origin.Latitude) * EarthRadius
+	return x, y
+}
+
+// PathPosition is where a point is closest to a path.
+type PathPosition struct {
+	// Point is the closest point on the path.
+	Point shuttletracker.Point
+	// Segment is the index of the path point that starts the closest segment.
+	Segment int
+	// Distance is how far away the path is, in meters.
+	Distance float64
+	// Along is how far Point is from the start of the path, in meters.
+	Along float64
+}
+
+// Locate returns the position on a path that is closest to p. The path must have at
+// least one point.
+func Locate(p shuttletracker.Point, path []shuttletracker.Point) PathPosition {
+	best := PathPosition{Point: path[0], Distance: Distance(p, path[0])}
+	along := 0.0
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		t, d := closestOnSegment(p, a, b)
+		length := Distance(a, b)
+		if d < best.Distance {
+			best = PathPosition{
+				Point: shuttletracker.Point{
+					Latitude:  a.Latitude + t*(b.Latitude-a.Latitude),
+					Longitude: a.Longitude + t*(b.Longitude-a.Longitude),
+				},
+				Segment:  i - 1,
+				Distance: d,
+				Along:    along + t*length,
+			}
+		}
+		along += length
+	}
+	return best
+}
@@ -0,0 +1,94 @@
+package geo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestDistance(t *testing.T) {
+	// Student Union to the Troy Building, measured at about 306 meters.
+	union := shuttletracker.Point{Latitude: 42.730028, Longitude: -73.676654}
+	troy := shuttletracker.Point{Latitude: 42.730958, Longitude: -73.680210}
+
+	d := Distance(union, troy)
+	if math.Abs(d-306) > 5 {
+		t.Errorf("got distance %f, expected about 306", d)
+	}
+
+	if Distance(union, union) != 0 {
+		t.Errorf("distance from a point to itself is not zero")
+	}
+}
+
+func TestInitialBearing(t *testing.T) {
+	origin := shuttletracker.Point{Latitude: 42.73, Longitude: -73.68}
+	cases := []struct {
+		to       shuttletracker.Point
+		expected float64
+	}{
+		{shuttletracker.Point{Latitude: 42.74, Longitude: -73.68}, 0},
+		{shuttletracker.Point{Latitude: 42.73, Longitude: -73.67}, 90},
+		{shuttletracker.Point{Latitude: 42.72, Longitude: -73.68}, 180},
+		{shuttletracker.Point{Latitude: 42.73, Longitude: -73.69}, 270},
+	}
+	for _, c := range cases {
+		b := InitialBearing(origin, c.to)
+		if math.Abs(b-c.expected) > 0.1 {
+			t.Errorf("got bearing %f to %+v, expected %f", b, c.to, c.expected)
+		}
+	}
+}
+
+func TestDistanceToPath(t *testing.T) {
+	// a path going east, then north
+	path := []shuttletracker.Point{
+		{Latitude: 42.73, Longitude: -73.69},
+		{Latitude: 42.73, Longitude: -73.68},
+		{Latitude: 42.74, Longitude: -73.68},
+	}
+	// about 100 meters north of the first segment
+	above := shuttletracker.Point{Latitude: 42.730899, Longitude: -73.685}
+	if d := DistanceToPath(above, path); math.Abs(d-100) > 1 {
+		t.Errorf("got distance %f, expected about 100", d)
+	}
+
+	// past the start of the path, so the closest point is its first point
+	before := shuttletracker.Point{Latitude: 42.73, Longitude: -73.70}
+	if d, expected := DistanceToPath(before, path), Distance(before, path[0]); math.Abs(d-expected) > 1 {
+		t.Errorf("got distance %f, expected %f", d, expected)
+	}
+
+	if d := DistanceToPath(path[1], path); d > 0.001 {
+		t.Errorf("got distance %f for a point on the path", d)
+	}
+
+	if !math.IsInf(DistanceToPath(above, nil), 1) {
+		t.Errorf("expected infinite distance to an empty path")
+	}
+}
+
+func TestLocate(t *testing.T) {
+	path := []shuttletracker.Point{
+		{Latitude: 42.73, Longitude: -73.68},
+		{Latitude: 42.73, Longitude: -73.67},
+		{Latitude: 42.74, Longitude: -73.67},
+	}
+	// Just north of the middle of the first segment
+	pos := Locate(shuttletracker.Point{Latitude: 42.7301, Longitude: -73.675}, path)
+	if pos.Segment != 0 || math.Abs(pos.Distance-11.1) > 0.5 {
+		t.Errorf("got segment %d and distance %f, expected 0 and about 11.1", pos.Segment, pos.Distance)
+	}
+	if math.Abs(pos.Point.Latitude-42.73) > 1e-9 || math.Abs(pos.Point.Longitude+73.675) > 1e-6 {
+		t.Errorf("got point %+v, expected it on the path", pos.Point)
+	}
+	if math.Abs(pos.Along-Distance(path[0], path[1])/2) > 1 {
+		t.Errorf("got %f meters along, expected half of the first segment", pos.Along)
+	}
+
+	pos = Locate(shuttletracker.Point{Latitude: 42.745, Longitude: -73.66}, path)
+	if pos.Segment != 1 || pos.Point != path[2] {
+		t.Errorf("got segment %d and point %+v, expected the end of the path", pos.Segment, pos.Point)
+	}
+}
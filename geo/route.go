@@ -0,0 +1,150 @@
+package geo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Kinds of RouteIssue
+const (
+	IssueOffRouteStop   = "off_route_stop"
+	IssueDuplicatePoint = "duplicate_point"
+	IssueGap            = "gap"
+	IssueStopOrder      = "stop_order"
+)
+
+// RouteCheckOptions are the thresholds that CheckRoute uses, in meters.
+type RouteCheckOptions struct {
+	// MaxStopDistance is how far a stop can be from the route.
+	MaxStopDistance float64
+	// MaxGap is how far apart consecutive points can be.
+	MaxGap float64
+	// MinSpacing is how close consecutive points can be before they're duplicates.
+	MinSpacing float64
+}
+
+// DefaultRouteCheckOptions are the RouteCheckOptions used unless others are given.
+var DefaultRouteCheckOptions = RouteCheckOptions{
+	MaxStopDistance: 20,
+	MaxGap:          250,
+	MinSpacing:      0.5,
+}
+
+// RouteIssue is something wrong with the shape of a route or where its stops are.
+type RouteIssue struct {
+	Kind string `json:"kind"`
+	// Field is the point or stop with the issue, e.g. "points[3]" or "stop_ids[1]".
+	Field string `json:"field"`
+	// Distance is the issue's distance in meters: how far an off-route stop is from
+	// the route, or how far apart the points of a gap or duplicate are. For off-route
+	// stops, it's negative if the stop is on the left side of the route.
+	Distance float64 `json:"distance"`
+	Message  string  `json:"message"`
+}
+
+// CheckRoute checks a route's points and its stops, in the order the route visits
+// them, for stops that are off the route or out of order, points that duplicate the
+// one before them, and gaps between points. A route whose ends meet is a loop, so
+// its stops can wrap around its start once.
+func CheckRoute(points, stops []shuttletracker.Point, opts RouteCheckOptions) []RouteIssue {
+	issues := []RouteIssue{}
+	for i := 1; i < len(points); i++ {
+		d := Distance(points[i-1], points[i])
+		field := fmt.Sprintf("points[%d]", i)
+		if d < opts.MinSpacing {
+			issues = append(issues, RouteIssue{
+				Kind:     IssueDuplicatePoint,
+				Field:    field,
+				Distance: d,
+				Message:  "duplicates the previous point",
+			})
+		} else if d > opts.MaxGap {
+			issues = append(issues, RouteIssue{
+				Kind:     IssueGap,
+				Field:    field,
+				Distance: d,
+				Message:  fmt.Sprintf("is %.0f meters from the previous point, more than %.0f", d, opts.MaxGap),
+			})
+		}
+	}
+	if len(points) == 0 {
+		return issues
+	}
+
+	loop := len(points) > 2 && Distance(points[0], points[len(points)-1]) <= opts.MaxStopDistance
+	wrapped := false
+	firstAlong := math.NaN()
+	prevAlong := math.Inf(-1)
+	for i, stop := range stops {
+		field := fmt.Sprintf("stop_ids[%d]", i)
+		pos := Locate(stop, points)
+		if pos.Distance > opts.MaxStopDistance {
+			crossTrack := pos.Distance
+			if len(points) > 1 && side(stop, points[pos.Segment], points[pos.Segment+1]) > 0 {
+				crossTrack = -crossTrack
+			}
+			issues = append(issues, RouteIssue{
+				Kind:     IssueOffRouteStop,
+				Field:    field,
+				Distance: crossTrack,
+				Message:  fmt.Sprintf("is %.0f meters from the route, more than %.0f", pos.Distance, opts.MaxStopDistance),
+			})
+			// Where an off-route stop is along the route doesn't mean much.
+			continue
+		}
+		if math.IsNaN(firstAlong) {
+			firstAlong = pos.Along
+		}
+		// After wrapping around a loop, stops must come before the first one again.
+		outOfOrder := false
+		if pos.Along < prevAlong {
+			if loop && !wrapped {
+				wrapped = true
+			} else {
+				outOfOrder = true
+			}
+		}
+		if outOfOrder || (wrapped && pos.Along > firstAlong) {
+			issues = append(issues, RouteIssue{
+				Kind:    IssueStopOrder,
+				Field:   field,
+				Message: "comes before the previous stop in the route's direction of travel",
+			})
+		}
+		prevAlong = pos.Along
+	}
+	return issues
+}
+
+// side returns a positive number if p is to the left of the line from a to b, and a
+// negative number if it's to the right.
+func side(p, a, b shuttletracker.Point) float64 {
+	ax, ay := project(p, a)
+	bx, by := project(p, b)
+	// Cross product of a→b and a→p, where p is at the origin
+	return (bx-ax)*(-ay) - (by-ay)*(-ax)
+}
+
+// Densify returns a copy of path with points added so that consecutive points are at
+// most maxGap meters apart.
+func Densify(path []shuttletracker.Point, maxGap float64) []shuttletracker.Point {
+	if len(path) == 0 || maxGap <= 0 {
+		return path
+	}
+	dense := []shuttletracker.Point{path[0]}
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		n := int(math.Ceil(Distance(a, b) / maxGap))
+		for j := 1; j < n; j++ {
+			t := float64(j) / float64(n)
+			dense = append(dense, shuttletracker.Point{
+				Latitude:  a.Latitude + t*(b.Latitude-a.Latitude),
+				Longitude: a.Longitude + t*(b.Longitude-a.Longitude),
+			})
+		}
+		dense = append(dense, b)
+	}
+	return dense
+}
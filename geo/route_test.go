@@ -0,0 +1,83 @@
+package geo
+
+import (
+	"math"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// A loop around a block, counterclockwise from its southwest corner
+var testLoop = []shuttletracker.Point{
+	{Latitude: 42.730, Longitude: -73.680},
+	{Latitude: 42.730, Longitude: -73.678},
+	{Latitude: 42.732, Longitude: -73.678},
+	{Latitude: 42.732, Longitude: -73.680},
+	{Latitude: 42.730, Longitude: -73.680},
+}
+
+func issueKinds(issues []RouteIssue) map[string]string {
+	kinds := map[string]string{}
+	for _, issue := range issues {
+		kinds[issue.Field] = issue.Kind
+	}
+	return kinds
+}
+
+func TestCheckRoute(t *testing.T) {
+	south := shuttletracker.Point{Latitude: 42.73, Longitude: -73.679}
+	east := shuttletracker.Point{Latitude: 42.731, Longitude: -73.678}
+	north := shuttletracker.Point{Latitude: 42.732, Longitude: -73.679}
+
+	// Starting partway around the loop is fine.
+	issues := CheckRoute(testLoop, []shuttletracker.Point{east, north, south}, DefaultRouteCheckOptions)
+	if len(issues) != 0 {
+		t.Errorf("got issues %+v, expected none", issues)
+	}
+
+	issues = CheckRoute(testLoop, []shuttletracker.Point{south, north, east}, DefaultRouteCheckOptions)
+	if kinds := issueKinds(issues); len(issues) != 1 || kinds["stop_ids[2]"] != IssueStopOrder {
+		t.Errorf("got issues %+v, expected east to be out of order", issues)
+	}
+
+	// Outside the loop, which is to the right of its direction of travel
+	outside := shuttletracker.Point{Latitude: 42.7297, Longitude: -73.679}
+	inside := shuttletracker.Point{Latitude: 42.7303, Longitude: -73.679}
+	issues = CheckRoute(testLoop, []shuttletracker.Point{outside, inside}, DefaultRouteCheckOptions)
+	if len(issues) != 2 || issues[0].Kind != IssueOffRouteStop || issues[1].Kind != IssueOffRouteStop {
+		t.Fatalf("got issues %+v, expected both stops off the route", issues)
+	}
+	if math.Abs(issues[0].Distance-33.4) > 1 || math.Abs(issues[1].Distance+33.4) > 1 {
+		t.Errorf("got cross-track distances %f and %f, expected about 33 and -33", issues[0].Distance, issues[1].Distance)
+	}
+
+	points := []shuttletracker.Point{testLoop[0], testLoop[0], {Latitude: 42.74, Longitude: -73.68}}
+	issues = CheckRoute(points, nil, DefaultRouteCheckOptions)
+	kinds := issueKinds(issues)
+	if len(issues) != 2 || kinds["points[1]"] != IssueDuplicatePoint || kinds["points[2]"] != IssueGap {
+		t.Errorf("got issues %+v, expected a duplicate point and a gap", issues)
+	}
+
+	// Open routes can't wrap around.
+	issues = CheckRoute(testLoop[:4], []shuttletracker.Point{north, south}, DefaultRouteCheckOptions)
+	if kinds := issueKinds(issues); len(issues) != 1 || kinds["stop_ids[1]"] != IssueStopOrder {
+		t.Errorf("got issues %+v, expected south to be out of order", issues)
+	}
+}
+
+func TestDensify(t *testing.T) {
+	path := []shuttletracker.Point{testLoop[0], {Latitude: 42.74, Longitude: -73.68}}
+	dense := Densify(path, 250)
+	// The segment is about 1112 meters long.
+	if len(dense) != 6 || dense[0] != path[0] || dense[5] != path[1] {
+		t.Fatalf("got %d points, expected 6 including the ends", len(dense))
+	}
+	for i := 1; i < len(dense); i++ {
+		if d := Distance(dense[i-1], dense[i]); d > 250 {
+			t.Errorf("points %d and %d are %f meters apart", i-1, i, d)
+		}
+	}
+	if len(Densify(testLoop, 1000)) != len(testLoop) {
+		t.Errorf("short segments were densified")
+	}
+}
@@ -0,0 +1,245 @@
+package gis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+type featureCollection struct {
+	Type     string    `json:"type"`
+	Features []feature `json:"features"`
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	Geometry   geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// position is a GeoJSON position, which puts longitude first.
+func position(latitude, longitude float64) []float64 {
+	return []float64{longitude, latitude}
+}
+
+func writeGeoJSON(w io.Writer, features []feature) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(featureCollection{Type: "FeatureCollection", Features: features})
+}
+
+func writeGeoJSONRoutes(w io.Writer, routes []*shuttletracker.Route) error {
+	features := []feature{}
+	for _, route := range routes {
+		coordinates := [][]float64{}
+		for _, p := range route.Points {
+			coordinates = append(coordinates, position(p.Latitude, p.Longitude))
+		}
+		features = append(features, feature{
+			Type:     "Feature",
+			Geometry: geometry{Type: "LineString", Coordinates: coordinates},
+			Properties: map[string]interface{}{
+				"id":          route.ID,
+				"name":        route.Name,
+				"description": route.Description,
+				"enabled":     route.Enabled,
+				"color":       route.Color,
+				"width":       route.Width,
+				"stop_ids":    route.StopIDs,
+				// stroke and stroke-width are the simplestyle names that many map viewers draw lines with.
+				"stroke":       route.Color,
+				"stroke-width": route.Width,
+			},
+		})
+	}
+	return writeGeoJSON(w, features)
+}
+
+func writeGeoJSONStops(w io.Writer, stops []*shuttletracker.Stop) error {
+	features := []feature{}
+	for _, stop := range stops {
+		features = append(features, feature{
+			Type:     "Feature",
+			Geometry: geometry{Type: "Point", Coordinates: position(stop.Latitude, stop.Longitude)},
+			Properties: map[string]interface{}{
+				"id":          stop.ID,
+				"name":        stopName(stop),
+				"description": stopDescription(stop),
+			},
+		})
+	}
+	return writeGeoJSON(w, features)
+}
+
+func writeGeoJSONTrack(w io.Writer, vehicle *shuttletracker.Vehicle, locations []*shuttletracker.Location) error {
+	coordinates := [][]float64{}
+	times := []string{}
+	for _, l := range locations {
+		coordinates = append(coordinates, position(l.Latitude, l.Longitude))
+		times = append(times, l.Time.UTC().Format(time.RFC3339))
+	}
+	return writeGeoJSON(w, []feature{{
+		Type:     "Feature",
+		Geometry: geometry{Type: "LineString", Coordinates: coordinates},
+		Properties: map[string]interface{}{
+			"vehicle_id": vehicle.ID,
+			"name":       vehicle.Name,
+			"tracker_id": vehicle.TrackerID,
+			// coordTimes holds the time of each coordinate, which is how togeojson and
+			// other converters put timestamps on a LineString.
+			"coordTimes": times,
+		},
+	}})
+}
+
+// geoJSONObject is any GeoJSON object: a FeatureCollection, a Feature, or a geometry.
+type geoJSONObject struct {
+	Type        string                 `json:"type"`
+	Features    []geoJSONObject        `json:"features"`
+	Geometry    *geoJSONObject         `json:"geometry"`
+	Geometries  []geoJSONObject        `json:"geometries"`
+	Properties  map[string]interface{} `json:"properties"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+func readGeoJSON(r io.Reader) (*Features, error) {
+	obj := geoJSONObject{}
+	err := json.NewDecoder(r).Decode(&obj)
+	if err != nil {
+		return nil, err
+	}
+	fs := &Features{}
+	err = fs.addGeoJSON(obj, nil)
+	if err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// addGeoJSON adds the lines and places in obj. Geometries get the properties of the
+// Feature they're in.
+func (fs *Features) addGeoJSON(obj geoJSONObject, props map[string]interface{}) error {
+	switch obj.Type {
+	case "FeatureCollection":
+		for _, feature := range obj.Features {
+			err := fs.addGeoJSON(feature, nil)
+			if err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if obj.Geometry == nil {
+			return nil
+		}
+		return fs.addGeoJSON(*obj.Geometry, obj.Properties)
+	case "GeometryCollection":
+		for _, g := range obj.Geometries {
+			err := fs.addGeoJSON(g, props)
+			if err != nil {
+				return err
+			}
+		}
+	case "Point":
+		var position []float64
+		err := json.Unmarshal(obj.Coordinates, &position)
+		if err != nil {
+			return err
+		}
+		return fs.addGeoJSONPlaces([][]float64{position}, props)
+	case "MultiPoint":
+		var positions [][]float64
+		err := json.Unmarshal(obj.Coordinates, &positions)
+		if err != nil {
+			return err
+		}
+		return fs.addGeoJSONPlaces(positions, props)
+	case "LineString":
+		var positions [][]float64
+		err := json.Unmarshal(obj.Coordinates, &positions)
+		if err != nil {
+			return err
+		}
+		return fs.addGeoJSONLines([][][]float64{positions}, props)
+	case "MultiLineString":
+		var lines [][][]float64
+		err := json.Unmarshal(obj.Coordinates, &lines)
+		if err != nil {
+			return err
+		}
+		return fs.addGeoJSONLines(lines, props)
+	default:
+		return fmt.Errorf("unsupported GeoJSON type %q", obj.Type)
+	}
+	return nil
+}
+
+func (fs *Features) addGeoJSONPlaces(positions [][]float64, props map[string]interface{}) error {
+	for _, position := range positions {
+		p, err := geoJSONPoint(position)
+		if err != nil {
+			return err
+		}
+		fs.Places = append(fs.Places, Place{
+			Name:        propertyString(props, "name"),
+			Description: propertyString(props, "description"),
+			Point:       p,
+		})
+	}
+	return nil
+}
+
+func (fs *Features) addGeoJSONLines(lines [][][]float64, props map[string]interface{}) error {
+	for _, positions := range lines {
+		line := Line{
+			Name:        propertyString(props, "name"),
+			Description: propertyString(props, "description"),
+			Color:       propertyString(props, "color", "stroke"),
+			Width:       int64(propertyNumber(props, "width", "stroke-width")),
+		}
+		for _, position := range positions {
+			p, err := geoJSONPoint(position)
+			if err != nil {
+				return err
+			}
+			line.Points = append(line.Points, p)
+		}
+		fs.Lines = append(fs.Lines, line)
+	}
+	return nil
+}
+
+// geoJSONPoint converts a GeoJSON position, which may have an altitude, to a Point.
+func geoJSONPoint(position []float64) (shuttletracker.Point, error) {
+	if len(position) < 2 {
+		return shuttletracker.Point{}, fmt.Errorf("invalid GeoJSON position %v", position)
+	}
+	return shuttletracker.Point{Latitude: position[1], Longitude: position[0]}, nil
+}
+
+// propertyString returns the first of the keys in props that is a string.
+func propertyString(props map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := props[key].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// propertyNumber returns the first of the keys in props that is a number.
+func propertyNumber(props map[string]interface{}, keys ...string) float64 {
+	for _, key := range keys {
+		if n, ok := props[key].(float64); ok {
+			return n
+		}
+	}
+	return 0
+}
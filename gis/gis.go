@@ -0,0 +1,179 @@
+// Package gis converts routes, stops, and vehicle tracks to and from the file formats
+// that GIS tools like QGIS and Google Earth use: GeoJSON, KML, and GPX.
+package gis
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// Format is a GIS file format.
+type Format string
+
+// Formats that routes, stops, and tracks can be written in.
+const (
+	GeoJSON Format = "geojson"
+	KML     Format = "kml"
+	GPX     Format = "gpx"
+)
+
+// Formats lists every Format.
+var Formats = []Format{GeoJSON, KML, GPX}
+
+var contentTypes = map[Format]string{
+	GeoJSON: "application/geo+json",
+	KML:     "application/vnd.google-earth.kml+xml",
+	GPX:     "application/gpx+xml",
+}
+
+// ContentType returns the media type of the Format.
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// Extension returns the file extension of the Format, including the dot.
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// ParseFormat returns the Format with a name like "kml" or a file name with its
+// extension, like "routes.kml". ".json" files are GeoJSON.
+func ParseFormat(name string) (Format, error) {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext("."+name), "."))
+	if ext == "json" {
+		return GeoJSON, nil
+	}
+	for _, f := range Formats {
+		if string(f) == ext {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q", name)
+}
+
+// FormatFromAccept returns the first Format in an Accept header, or false if it doesn't
+// list any. "application/json" is GeoJSON.
+func FormatFromAccept(accept string) (Format, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" {
+			return GeoJSON, true
+		}
+		for _, f := range Formats {
+			if f.ContentType() == mediaType {
+				return f, true
+			}
+		}
+	}
+	return "", false
+}
+
+// WriteRoutes writes each Route as a line that has the Route's color and width.
+func WriteRoutes(w io.Writer, f Format, routes []*shuttletracker.Route) error {
+	switch f {
+	case GeoJSON:
+		return writeGeoJSONRoutes(w, routes)
+	case KML:
+		return writeKMLRoutes(w, routes)
+	case GPX:
+		return writeGPXRoutes(w, routes)
+	}
+	return fmt.Errorf("unknown format %q", f)
+}
+
+// WriteStops writes each Stop as a point.
+func WriteStops(w io.Writer, f Format, stops []*shuttletracker.Stop) error {
+	switch f {
+	case GeoJSON:
+		return writeGeoJSONStops(w, stops)
+	case KML:
+		return writeKMLStops(w, stops)
+	case GPX:
+		return writeGPXStops(w, stops)
+	}
+	return fmt.Errorf("unknown format %q", f)
+}
+
+// WriteTrack writes the path that a Vehicle took through its Locations, along with
+// the time it was at each one.
+func WriteTrack(w io.Writer, f Format, vehicle *shuttletracker.Vehicle, locations []*shuttletracker.Location) error {
+	// Locations usually come newest first, but tracks go in the order they were driven.
+	sorted := make([]*shuttletracker.Location, len(locations))
+	copy(sorted, locations)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	switch f {
+	case GeoJSON:
+		return writeGeoJSONTrack(w, vehicle, sorted)
+	case KML:
+		return writeKMLTrack(w, vehicle, sorted)
+	case GPX:
+		return writeGPXTrack(w, vehicle, sorted)
+	}
+	return fmt.Errorf("unknown format %q", f)
+}
+
+// Line is a named line read from a file, e.g. a GeoJSON LineString Feature.
+type Line struct {
+	Name        string
+	Description string
+	// Color is a hex color like "#ff0000", or empty if the file doesn't have one.
+	Color string
+	// Width is zero if the file doesn't have one.
+	Width  int64
+	Points []shuttletracker.Point
+}
+
+// Place is a named point read from a file, e.g. a KML Point Placemark.
+type Place struct {
+	Name        string
+	Description string
+	Point       shuttletracker.Point
+}
+
+// Features are the lines and places in a file.
+type Features struct {
+	Lines  []Line
+	Places []Place
+}
+
+// Read returns the Features in a GeoJSON or KML file.
+func Read(r io.Reader, f Format) (*Features, error) {
+	switch f {
+	case GeoJSON:
+		return readGeoJSON(r)
+	case KML:
+		return readKML(r)
+	}
+	return nil, fmt.Errorf("%s files can't be read", f)
+}
+
+func stopName(stop *shuttletracker.Stop) string {
+	if stop.Name != nil {
+		return *stop.Name
+	}
+	return ""
+}
+
+func stopDescription(stop *shuttletracker.Stop) string {
+	if stop.Description != nil {
+		return *stop.Description
+	}
+	return ""
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
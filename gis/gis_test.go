@@ -0,0 +1,188 @@
+package gis
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+var testRoute = &shuttletracker.Route{
+	ID:      1,
+	Name:    "West",
+	Enabled: true,
+	Color:   "#ff8000",
+	Width:   4,
+	StopIDs: []int64{2},
+	Points: []shuttletracker.Point{
+		{Latitude: 42.73, Longitude: -73.68},
+		{Latitude: 42.74, Longitude: -73.67},
+	},
+}
+
+func testStop() *shuttletracker.Stop {
+	name := "Union"
+	return &shuttletracker.Stop{ID: 2, Name: &name, Latitude: 42.73, Longitude: -73.68}
+}
+
+func testTrack() (*shuttletracker.Vehicle, []*shuttletracker.Location) {
+	start := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Newest first, the way LocationsSince returns them
+	return &shuttletracker.Vehicle{ID: 3, Name: "Bus 3"}, []*shuttletracker.Location{
+		{Latitude: 42.74, Longitude: -73.67, Time: start.Add(time.Minute)},
+		{Latitude: 42.73, Longitude: -73.68, Time: start},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{
+		"kml":            KML,
+		"routes.GPX":     GPX,
+		"stops.geojson":  GeoJSON,
+		"/tmp/data.json": GeoJSON,
+	} {
+		f, err := ParseFormat(name)
+		if err != nil || f != expected {
+			t.Errorf("%s: got %q and error %v, expected %q", name, f, err, expected)
+		}
+	}
+	if _, err := ParseFormat("routes.shp"); err == nil {
+		t.Errorf("expected an error for a shapefile")
+	}
+}
+
+func TestFormatFromAccept(t *testing.T) {
+	cases := []struct {
+		accept   string
+		expected Format
+		ok       bool
+	}{
+		{"application/gpx+xml", GPX, true},
+		{"text/html, application/vnd.google-earth.kml+xml;q=0.9", KML, true},
+		{"application/json", GeoJSON, true},
+		{"*/*", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		f, ok := FormatFromAccept(c.accept)
+		if f != c.expected || ok != c.ok {
+			t.Errorf("%q: got %q and %t, expected %q and %t", c.accept, f, ok, c.expected, c.ok)
+		}
+	}
+}
+
+func TestGeoJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := WriteRoutes(buf, GeoJSON, []*shuttletracker.Route{testRoute})
+	if err != nil {
+		t.Fatalf("unable to write routes: %s", err)
+	}
+	var routes struct {
+		Features []struct {
+			Geometry struct {
+				Type        string      `json:"type"`
+				Coordinates [][]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &routes)
+	if err != nil {
+		t.Fatalf("unable to decode routes: %s", err)
+	}
+	route := routes.Features[0]
+	if route.Geometry.Type != "LineString" || route.Geometry.Coordinates[1][0] != -73.67 {
+		t.Errorf("got geometry %+v, expected a LineString with longitude first", route.Geometry)
+	}
+	if route.Properties["color"] != "#ff8000" || route.Properties["stroke-width"] != float64(4) {
+		t.Errorf("got properties %+v, expected color and width", route.Properties)
+	}
+
+	buf.Reset()
+	vehicle, locations := testTrack()
+	err = WriteTrack(buf, GeoJSON, vehicle, locations)
+	if err != nil {
+		t.Fatalf("unable to write track: %s", err)
+	}
+	err = json.Unmarshal(buf.Bytes(), &routes)
+	if err != nil {
+		t.Fatalf("unable to decode track: %s", err)
+	}
+	track := routes.Features[0]
+	times := track.Properties["coordTimes"].([]interface{})
+	if track.Geometry.Type != "LineString" || times[0] != "2019-03-01T12:00:00Z" || track.Geometry.Coordinates[0][1] != 42.73 {
+		t.Errorf("got track %+v, expected a LineString in time order", track)
+	}
+}
+
+func TestKML(t *testing.T) {
+	if kmlColor("#ff8000") != "ff0080ff" || kmlColor("#f80") != "ff0088ff" || kmlColor("red") != "" {
+		t.Errorf("KML colors aren't converted")
+	}
+
+	buf := &bytes.Buffer{}
+	err := WriteRoutes(buf, KML, []*shuttletracker.Route{testRoute})
+	if err != nil {
+		t.Fatalf("unable to write routes: %s", err)
+	}
+	var routes struct {
+		Placemarks []struct {
+			Name        string `xml:"name"`
+			Color       string `xml:"Style>LineStyle>color"`
+			Width       int64  `xml:"Style>LineStyle>width"`
+			Coordinates string `xml:"LineString>coordinates"`
+		} `xml:"Document>Placemark"`
+	}
+	err = xml.Unmarshal(buf.Bytes(), &routes)
+	if err != nil {
+		t.Fatalf("unable to decode routes: %s", err)
+	}
+	route := routes.Placemarks[0]
+	if route.Name != "West" || route.Color != "ff0080ff" || route.Width != 4 || route.Coordinates != "-73.68,42.73 -73.67,42.74" {
+		t.Errorf("unexpected placemark %+v", route)
+	}
+
+	buf.Reset()
+	err = WriteStops(buf, KML, []*shuttletracker.Stop{testStop()})
+	if err != nil {
+		t.Fatalf("unable to write stops: %s", err)
+	}
+	if !strings.Contains(buf.String(), "<coordinates>-73.68,42.73</coordinates>") {
+		t.Errorf("stop isn't a Point: %s", buf)
+	}
+}
+
+func TestGPX(t *testing.T) {
+	buf := &bytes.Buffer{}
+	vehicle, locations := testTrack()
+	err := WriteTrack(buf, GPX, vehicle, locations)
+	if err != nil {
+		t.Fatalf("unable to write track: %s", err)
+	}
+	var doc struct {
+		Points []struct {
+			Latitude float64 `xml:"lat,attr"`
+			Time     string  `xml:"time"`
+		} `xml:"trk>trkseg>trkpt"`
+	}
+	err = xml.Unmarshal(buf.Bytes(), &doc)
+	if err != nil {
+		t.Fatalf("unable to decode track: %s", err)
+	}
+	if len(doc.Points) != 2 || doc.Points[0].Time != "2019-03-01T12:00:00Z" || doc.Points[1].Latitude != 42.74 {
+		t.Errorf("got points %+v, expected them oldest first", doc.Points)
+	}
+
+	buf.Reset()
+	err = WriteStops(buf, GPX, []*shuttletracker.Stop{testStop()})
+	if err != nil {
+		t.Fatalf("unable to write stops: %s", err)
+	}
+	if !strings.Contains(buf.String(), `<wpt lat="42.73" lon="-73.68">`) || !strings.Contains(buf.String(), "<name>Union</name>") {
+		t.Errorf("stop isn't a waypoint: %s", buf)
+	}
+}
@@ -0,0 +1,95 @@
+package gis
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+type gpxDocument struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Version   string     `xml:"version,attr"`
+	Creator   string     `xml:"creator,attr"`
+	Namespace string     `xml:"xmlns,attr"`
+	Waypoints []gpxPoint `xml:"wpt"`
+	Routes    []gpxRoute `xml:"rte"`
+	Tracks    []gpxTrack `xml:"trk"`
+}
+
+type gpxPoint struct {
+	Latitude    float64 `xml:"lat,attr"`
+	Longitude   float64 `xml:"lon,attr"`
+	Time        string  `xml:"time,omitempty"`
+	Name        string  `xml:"name,omitempty"`
+	Description string  `xml:"desc,omitempty"`
+}
+
+type gpxRoute struct {
+	Name        string     `xml:"name,omitempty"`
+	Description string     `xml:"desc,omitempty"`
+	Points      []gpxPoint `xml:"rtept"`
+}
+
+type gpxTrack struct {
+	Name   string     `xml:"name,omitempty"`
+	Points []gpxPoint `xml:"trkseg>trkpt"`
+}
+
+func writeGPX(w io.Writer, doc gpxDocument) error {
+	doc.Version = "1.1"
+	doc.Creator = "Shuttle Tracker"
+	doc.Namespace = "http://www.topografix.com/GPX/1/1"
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// writeGPXRoutes writes routes as GPX routes. GPX has no place for a line's color or
+// width, so they're left out.
+func writeGPXRoutes(w io.Writer, routes []*shuttletracker.Route) error {
+	doc := gpxDocument{}
+	for _, route := range routes {
+		rte := gpxRoute{Name: route.Name, Description: route.Description}
+		for _, p := range route.Points {
+			rte.Points = append(rte.Points, gpxPoint{Latitude: p.Latitude, Longitude: p.Longitude})
+		}
+		doc.Routes = append(doc.Routes, rte)
+	}
+	return writeGPX(w, doc)
+}
+
+func writeGPXStops(w io.Writer, stops []*shuttletracker.Stop) error {
+	doc := gpxDocument{}
+	for _, stop := range stops {
+		doc.Waypoints = append(doc.Waypoints, gpxPoint{
+			Latitude:    stop.Latitude,
+			Longitude:   stop.Longitude,
+			Name:        stopName(stop),
+			Description: stopDescription(stop),
+		})
+	}
+	return writeGPX(w, doc)
+}
+
+func writeGPXTrack(w io.Writer, vehicle *shuttletracker.Vehicle, locations []*shuttletracker.Location) error {
+	trk := gpxTrack{Name: vehicle.Name}
+	for _, l := range locations {
+		trk.Points = append(trk.Points, gpxPoint{
+			Latitude:  l.Latitude,
+			Longitude: l.Longitude,
+			Time:      l.Time.UTC().Format(time.RFC3339),
+		})
+	}
+	return writeGPX(w, gpxDocument{Tracks: []gpxTrack{trk}})
+}
@@ -0,0 +1,170 @@
+package gis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
+)
+
+// ImportOptions control how Features become routes and stops.
+type ImportOptions struct {
+	// MaxStopDistance is how far in meters a stop can be from a route and still be on it.
+	MaxStopDistance float64
+	// LoopDistance is how close in meters the ends of a line must be for it to be a
+	// closed loop.
+	LoopDistance float64
+	// AllowOpen allows routes that aren't closed loops.
+	AllowOpen bool
+}
+
+// DefaultImportOptions are the ImportOptions used unless others are given.
+var DefaultImportOptions = ImportOptions{
+	MaxStopDistance: 30,
+	LoopDistance:    50,
+}
+
+// ImportedRoute is a Route that an import would create.
+type ImportedRoute struct {
+	// Feature is the line that the Route came from, e.g. "lines[0]".
+	Feature string                `json:"feature"`
+	Route   *shuttletracker.Route `json:"route"`
+	Closed  bool                  `json:"closed"`
+	// Stops are in the order that the Route reaches them. They're shared with
+	// other ImportedRoutes that they're on.
+	Stops []*shuttletracker.Stop `json:"stops"`
+}
+
+// ImportProblem is a reason that an import can't be done.
+type ImportProblem struct {
+	// Feature is the line or place that has the problem, e.g. "places[2]".
+	Feature string `json:"feature"`
+	Message string `json:"message"`
+}
+
+// Import is what importing Features would create.
+type Import struct {
+	Routes   []*ImportedRoute       `json:"routes"`
+	Stops    []*shuttletracker.Stop `json:"stops"`
+	Problems []ImportProblem        `json:"problems"`
+}
+
+// Problem adds an ImportProblem.
+func (im *Import) Problem(feature, format string, a ...interface{}) {
+	im.Problems = append(im.Problems, ImportProblem{Feature: feature, Message: fmt.Sprintf(format, a...)})
+}
+
+// PlanImport turns each Line into a Route and each Place into a Stop. Stops are moved
+// onto the closest route and put in order on every route that they're close enough
+// to. Lines that are too short or aren't closed loops and places that aren't near any
+// route are reported as ImportProblems. Nothing is given an ID.
+func PlanImport(fs *Features, opts ImportOptions) *Import {
+	im := &Import{
+		Routes:   []*ImportedRoute{},
+		Stops:    []*shuttletracker.Stop{},
+		Problems: []ImportProblem{},
+	}
+
+	for i, line := range fs.Lines {
+		feature := fmt.Sprintf("lines[%d]", i)
+		if len(line.Points) < 2 {
+			im.Problem(feature, "has %d points, but routes need at least 2", len(line.Points))
+			continue
+		}
+
+		ir := &ImportedRoute{
+			Feature: feature,
+			Route: &shuttletracker.Route{
+				Name:        line.Name,
+				Description: line.Description,
+				Color:       line.Color,
+				Width:       line.Width,
+				Points:      line.Points,
+				StopIDs:     []int64{},
+			},
+			Stops: []*shuttletracker.Stop{},
+		}
+		if ir.Route.Name == "" {
+			ir.Route.Name = fmt.Sprintf("Route %d", i+1)
+		}
+		if ir.Route.Color == "" {
+			ir.Route.Color = "#ffffff"
+		}
+		if ir.Route.Width == 0 {
+			ir.Route.Width = 4
+		}
+
+		first, last := line.Points[0], line.Points[len(line.Points)-1]
+		gap := geo.Distance(first, last)
+		if gap <= opts.LoopDistance {
+			ir.Closed = true
+			if first != last {
+				ir.Route.Points = append(append([]shuttletracker.Point{}, line.Points...), first)
+			}
+		} else if !opts.AllowOpen {
+			im.Problem(feature, "is not a closed loop; its ends are %.0f meters apart", gap)
+		}
+		im.Routes = append(im.Routes, ir)
+	}
+
+	// How far along each route its stops are
+	along := map[*ImportedRoute]map[*shuttletracker.Stop]float64{}
+	for i, place := range fs.Places {
+		feature := fmt.Sprintf("places[%d]", i)
+		stop := &shuttletracker.Stop{Latitude: place.Point.Latitude, Longitude: place.Point.Longitude}
+		if place.Name != "" {
+			name := place.Name
+			stop.Name = &name
+		}
+		if place.Description != "" {
+			description := place.Description
+			stop.Description = &description
+		}
+		im.Stops = append(im.Stops, stop)
+
+		closest := math.Inf(1)
+		var snapped shuttletracker.Point
+		for _, ir := range im.Routes {
+			pos := geo.Locate(place.Point, ir.Route.Points)
+			if pos.Distance > opts.MaxStopDistance {
+				continue
+			}
+			if along[ir] == nil {
+				along[ir] = map[*shuttletracker.Stop]float64{}
+			}
+			along[ir][stop] = pos.Along
+			ir.Stops = append(ir.Stops, stop)
+			if pos.Distance < closest {
+				closest = pos.Distance
+				snapped = pos.Point
+			}
+		}
+		if math.IsInf(closest, 1) {
+			im.Problem(feature, "is not within %.0f meters of any route", opts.MaxStopDistance)
+			continue
+		}
+		stop.Latitude = snapped.Latitude
+		stop.Longitude = snapped.Longitude
+	}
+
+	for _, ir := range im.Routes {
+		sort.SliceStable(ir.Stops, func(i, j int) bool {
+			return along[ir][ir.Stops[i]] < along[ir][ir.Stops[j]]
+		})
+	}
+	return im
+}
+
+// Create creates the Import's stops and then its routes, which stop at them in order.
+// Either all of them are created or, if there's an error, none are.
+func (im *Import) Create(rs shuttletracker.RouteService, username string) error {
+	routes := make([]*shuttletracker.Route, 0, len(im.Routes))
+	routeStops := make([][]*shuttletracker.Stop, 0, len(im.Routes))
+	for _, ir := range im.Routes {
+		routes = append(routes, ir.Route)
+		routeStops = append(routeStops, ir.Stops)
+	}
+	return rs.CreateRoutesAndStops(im.Stops, routes, routeStops, username)
+}
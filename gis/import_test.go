@@ -0,0 +1,149 @@
+package gis
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+const testGeoJSON = `{
+ "type": "FeatureCollection",
+ "features": [
+  {"type": "Feature", "properties": {"name": "Loop", "stroke": "#00ff00", "stroke-width": 6},
+   "geometry": {"type": "LineString", "coordinates": [[-73.68, 42.73], [-73.67, 42.73], [-73.67, 42.74], [-73.68, 42.74], [-73.68, 42.7301]]}},
+  {"type": "Feature", "properties": {"name": "Far"}, "geometry": {"type": "Point", "coordinates": [-73.60, 42.70]}},
+  {"type": "Feature", "properties": {"name": "East"}, "geometry": {"type": "Point", "coordinates": [-73.6701, 42.735, 20]}},
+  {"type": "Feature", "properties": {"name": "South"}, "geometry": {"type": "Point", "coordinates": [-73.675, 42.7301]}}
+ ]
+}`
+
+const testKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+ <Document>
+  <Style id="red"><LineStyle><color>ff0000ff</color><width>3.0</width></LineStyle></Style>
+  <Folder>
+   <Placemark>
+    <name>Spur</name>
+    <styleUrl>#red</styleUrl>
+    <LineString><coordinates>-73.68,42.73,0 -73.67,42.73,0</coordinates></LineString>
+   </Placemark>
+   <Placemark>
+    <name>Union</name>
+    <Point><coordinates>-73.675,42.73</coordinates></Point>
+   </Placemark>
+  </Folder>
+ </Document>
+</kml>`
+
+func TestRead(t *testing.T) {
+	fs, err := Read(strings.NewReader(testGeoJSON), GeoJSON)
+	if err != nil {
+		t.Fatalf("unable to read GeoJSON: %s", err)
+	}
+	if len(fs.Lines) != 1 || len(fs.Places) != 3 {
+		t.Fatalf("got %d lines and %d places, expected 1 and 3", len(fs.Lines), len(fs.Places))
+	}
+	line := fs.Lines[0]
+	if line.Name != "Loop" || line.Color != "#00ff00" || line.Width != 6 || line.Points[1].Longitude != -73.67 {
+		t.Errorf("unexpected line %+v", line)
+	}
+
+	fs, err = Read(strings.NewReader(testKML), KML)
+	if err != nil {
+		t.Fatalf("unable to read KML: %s", err)
+	}
+	if len(fs.Lines) != 1 || len(fs.Places) != 1 {
+		t.Fatalf("got %d lines and %d places, expected 1 and 1", len(fs.Lines), len(fs.Places))
+	}
+	line = fs.Lines[0]
+	if line.Name != "Spur" || line.Color != "#ff0000" || line.Width != 3 || len(line.Points) != 2 || line.Points[0].Latitude != 42.73 {
+		t.Errorf("unexpected line %+v", line)
+	}
+	if fs.Places[0].Name != "Union" {
+		t.Errorf("got place %+v, expected Union", fs.Places[0])
+	}
+
+	for _, bad := range []string{`{"type": "Polygon", "coordinates": []}`, `{"type": "Point", "coordinates": [1]}`, `not json`} {
+		_, err = Read(strings.NewReader(bad), GeoJSON)
+		if err == nil {
+			t.Errorf("expected an error reading %s", bad)
+		}
+	}
+	_, err = Read(strings.NewReader(""), GPX)
+	if err == nil {
+		t.Errorf("expected an error reading GPX")
+	}
+}
+
+func TestReadExport(t *testing.T) {
+	// Exports can be imported again.
+	for _, f := range []Format{GeoJSON, KML} {
+		buf := &bytes.Buffer{}
+		err := WriteRoutes(buf, f, []*shuttletracker.Route{testRoute})
+		if err != nil {
+			t.Fatalf("unable to write routes: %s", err)
+		}
+		fs, err := Read(buf, f)
+		if err != nil {
+			t.Fatalf("unable to read %s: %s", f, err)
+		}
+		line := fs.Lines[0]
+		if line.Name != testRoute.Name || line.Color != testRoute.Color || line.Width != testRoute.Width || len(line.Points) != len(testRoute.Points) {
+			t.Errorf("%s: got line %+v, expected it to match the route", f, line)
+		}
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	fs, err := Read(strings.NewReader(testGeoJSON), GeoJSON)
+	if err != nil {
+		t.Fatalf("unable to read GeoJSON: %s", err)
+	}
+	fs.Lines = append(fs.Lines, Line{Points: fs.Lines[0].Points[:1]}, Line{Points: fs.Lines[0].Points[:3]})
+
+	im := PlanImport(fs, DefaultImportOptions)
+	if len(im.Routes) != 2 || len(im.Stops) != 3 {
+		t.Fatalf("got %d routes and %d stops, expected 2 and 3", len(im.Routes), len(im.Stops))
+	}
+	problems := map[string]bool{}
+	for _, p := range im.Problems {
+		problems[p.Feature] = true
+	}
+	if len(im.Problems) != 3 || !problems["places[0]"] || !problems["lines[1]"] || !problems["lines[2]"] {
+		t.Errorf("got problems %+v, expected ones for the far place, the short line, and the open line", im.Problems)
+	}
+
+	loop := im.Routes[0]
+	if !loop.Closed || loop.Route.Points[len(loop.Route.Points)-1] != loop.Route.Points[0] {
+		t.Errorf("expected the loop to be closed")
+	}
+	if loop.Route.Name != "Loop" || loop.Route.Width != 6 || loop.Route.Color != "#00ff00" {
+		t.Errorf("unexpected route %+v", loop.Route)
+	}
+	// South is reached before East, even though it's listed after.
+	if len(loop.Stops) != 2 || *loop.Stops[0].Name != "South" || *loop.Stops[1].Name != "East" {
+		t.Fatalf("got stops %+v, expected South then East", loop.Stops)
+	}
+	if loop.Stops[0].Latitude != 42.73 || math.Abs(loop.Stops[1].Longitude+73.67) > 1e-9 {
+		t.Errorf("stops weren't snapped onto the route: %+v %+v", loop.Stops[0], loop.Stops[1])
+	}
+
+	open := im.Routes[1]
+	if open.Closed || open.Route.Name != "Route 3" || open.Route.Color != "#ffffff" || open.Route.Width != 4 {
+		t.Errorf("unexpected open route %+v", open.Route)
+	}
+	if len(open.Stops) != 2 || open.Stops[0] != loop.Stops[0] {
+		t.Errorf("expected the open route to share the loop's stops")
+	}
+
+	opts := DefaultImportOptions
+	opts.AllowOpen = true
+	opts.MaxStopDistance = 10000
+	im = PlanImport(fs, opts)
+	if len(im.Problems) != 1 {
+		t.Errorf("got problems %+v, expected only the short line", im.Problems)
+	}
+}
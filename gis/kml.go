@@ -0,0 +1,270 @@
+package gis
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"kml"`
+	Namespace  string         `xml:"xmlns,attr"`
+	GXNS       string         `xml:"xmlns:gx,attr,omitempty"`
+	Name       string         `xml:"Document>name"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name         string         `xml:"name"`
+	Description  string         `xml:"description,omitempty"`
+	Style        *kmlStyle      `xml:"Style"`
+	ExtendedData []kmlData      `xml:"ExtendedData>Data"`
+	Point        *kmlPoint      `xml:"Point"`
+	LineString   *kmlLineString `xml:"LineString"`
+	Track        *kmlTrack      `xml:"gx:Track"`
+}
+
+type kmlStyle struct {
+	Color string `xml:"LineStyle>color,omitempty"`
+	Width int64  `xml:"LineStyle>width,omitempty"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlTrack struct {
+	When  []string `xml:"when"`
+	Coord []string `xml:"gx:coord"`
+}
+
+const kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+// kmlCoordinate formats a point as KML does, with longitude first.
+func kmlCoordinate(latitude, longitude float64) string {
+	return formatFloat(longitude) + "," + formatFloat(latitude)
+}
+
+// kmlColor converts a color like "#ff8000" to KML's alpha, blue, green, red order. It
+// returns an empty string if the color isn't in that form.
+func kmlColor(color string) string {
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil {
+		return ""
+	}
+	hex = strings.ToLower(hex)
+	return "ff" + hex[4:6] + hex[2:4] + hex[0:2]
+}
+
+func writeKML(w io.Writer, doc kmlDocument) error {
+	doc.Namespace = kmlNamespace
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	err = enc.Encode(doc)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+func writeKMLRoutes(w io.Writer, routes []*shuttletracker.Route) error {
+	doc := kmlDocument{Name: "Routes"}
+	for _, route := range routes {
+		coordinates := []string{}
+		for _, p := range route.Points {
+			coordinates = append(coordinates, kmlCoordinate(p.Latitude, p.Longitude))
+		}
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:        route.Name,
+			Description: route.Description,
+			Style:       &kmlStyle{Color: kmlColor(route.Color), Width: route.Width},
+			ExtendedData: []kmlData{
+				{Name: "id", Value: strconv.FormatInt(route.ID, 10)},
+				{Name: "enabled", Value: strconv.FormatBool(route.Enabled)},
+				{Name: "color", Value: route.Color},
+				{Name: "width", Value: strconv.FormatInt(route.Width, 10)},
+			},
+			LineString: &kmlLineString{Tessellate: 1, Coordinates: strings.Join(coordinates, " ")},
+		})
+	}
+	return writeKML(w, doc)
+}
+
+func writeKMLStops(w io.Writer, stops []*shuttletracker.Stop) error {
+	doc := kmlDocument{Name: "Stops"}
+	for _, stop := range stops {
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:         stopName(stop),
+			Description:  stopDescription(stop),
+			ExtendedData: []kmlData{{Name: "id", Value: strconv.FormatInt(stop.ID, 10)}},
+			Point:        &kmlPoint{Coordinates: kmlCoordinate(stop.Latitude, stop.Longitude)},
+		})
+	}
+	return writeKML(w, doc)
+}
+
+// writeKMLTrack uses Google's gx:Track extension, which Google Earth can play back.
+func writeKMLTrack(w io.Writer, vehicle *shuttletracker.Vehicle, locations []*shuttletracker.Location) error {
+	track := &kmlTrack{}
+	for _, l := range locations {
+		track.When = append(track.When, l.Time.UTC().Format(time.RFC3339))
+		track.Coord = append(track.Coord, formatFloat(l.Longitude)+" "+formatFloat(l.Latitude)+" 0")
+	}
+	return writeKML(w, kmlDocument{
+		GXNS: "http://www.google.com/kml/ext/2.2",
+		Name: vehicle.Name,
+		Placemarks: []kmlPlacemark{{
+			Name: vehicle.Name,
+			ExtendedData: []kmlData{
+				{Name: "vehicle_id", Value: strconv.FormatInt(vehicle.ID, 10)},
+				{Name: "tracker_id", Value: vehicle.TrackerID},
+			},
+			Track: track,
+		}},
+	})
+}
+
+// kmlStyleInput is a Style read from a KML file. Widths may have decimals.
+type kmlStyleInput struct {
+	ID    string  `xml:"id,attr"`
+	Color string  `xml:"LineStyle>color"`
+	Width float64 `xml:"LineStyle>width"`
+}
+
+type kmlPlacemarkInput struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description"`
+	StyleURL    string         `xml:"styleUrl"`
+	Style       *kmlStyleInput `xml:"Style"`
+
+	Points           []kmlPoint      `xml:"Point"`
+	LineStrings      []kmlLineString `xml:"LineString"`
+	MultiPoints      []kmlPoint      `xml:"MultiGeometry>Point"`
+	MultiLineStrings []kmlLineString `xml:"MultiGeometry>LineString"`
+}
+
+// readKML reads the Placemarks in a KML file, wherever they are in its Documents and
+// Folders. Lines get the color and width of their Style, either inline or shared.
+func readKML(r io.Reader) (*Features, error) {
+	styles := map[string]*kmlStyleInput{}
+	placemarks := []kmlPlacemarkInput{}
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "Style":
+			style := &kmlStyleInput{}
+			err = dec.DecodeElement(style, &start)
+			if err != nil {
+				return nil, err
+			}
+			styles["#"+style.ID] = style
+		case "Placemark":
+			placemark := kmlPlacemarkInput{}
+			err = dec.DecodeElement(&placemark, &start)
+			if err != nil {
+				return nil, err
+			}
+			placemarks = append(placemarks, placemark)
+		}
+	}
+
+	fs := &Features{}
+	for _, placemark := range placemarks {
+		style := placemark.Style
+		if style == nil {
+			style = styles[placemark.StyleURL]
+		}
+		for _, point := range append(placemark.Points, placemark.MultiPoints...) {
+			coordinates, err := parseKMLCoordinates(point.Coordinates)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range coordinates {
+				fs.Places = append(fs.Places, Place{Name: placemark.Name, Description: placemark.Description, Point: p})
+			}
+		}
+		for _, lineString := range append(placemark.LineStrings, placemark.MultiLineStrings...) {
+			coordinates, err := parseKMLCoordinates(lineString.Coordinates)
+			if err != nil {
+				return nil, err
+			}
+			line := Line{Name: placemark.Name, Description: placemark.Description, Points: coordinates}
+			if style != nil {
+				line.Color = fromKMLColor(style.Color)
+				line.Width = int64(style.Width + 0.5)
+			}
+			fs.Lines = append(fs.Lines, line)
+		}
+	}
+	return fs, nil
+}
+
+// parseKMLCoordinates parses KML's space-separated "longitude,latitude[,altitude]" tuples.
+func parseKMLCoordinates(s string) ([]shuttletracker.Point, error) {
+	points := []shuttletracker.Point{}
+	for _, tuple := range strings.Fields(s) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid KML coordinates %q", tuple)
+		}
+		lon, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML coordinates %q", tuple)
+		}
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML coordinates %q", tuple)
+		}
+		points = append(points, shuttletracker.Point{Latitude: lat, Longitude: lon})
+	}
+	return points, nil
+}
+
+// fromKMLColor converts a KML color like "ff0080ff" to one like "#ff8000", ignoring
+// its alpha. It returns an empty string if the color isn't in that form.
+func fromKMLColor(color string) string {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if len(color) != 8 {
+		return ""
+	}
+	if _, err := strconv.ParseUint(color, 16, 32); err != nil {
+		return ""
+	}
+	return "#" + color[6:8] + color[4:6] + color[2:4]
+}
@@ -17,6 +17,7 @@ require (
 	github.com/spf13/viper v1.3.2
 	github.com/stretchr/objx v0.1.1 // indirect
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 	golang.org/x/net v0.0.0-20190318221613-d196dffd7c2b // indirect
 	golang.org/x/sys v0.0.0-20190318195719-6c81ef8f67ca // indirect
 	gopkg.in/cas.v2 v2.1.0
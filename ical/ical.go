@@ -0,0 +1,105 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can subscribe to.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of an iCalendar feed.
+const ContentType = "text/calendar; charset=utf-8"
+
+// Lines longer than this many octets are folded.
+const maxLineLength = 75
+
+const timeFormat = "20060102T150405Z"
+
+// Calendar is a feed of Events.
+type Calendar struct {
+	Name string
+	// Timezone is the IANA name of the zone that calendar apps should show Events in.
+	Timezone string
+	Events   []Event
+}
+
+// Event is a stretch of time on a Calendar. UID must be unique and stay the same
+// across requests so that calendar apps can update Events instead of duplicating them.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	Updated     time.Time
+}
+
+// Write writes a Calendar to w.
+func Write(w io.Writer, c *Calendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeLine(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//WTG//Shuttle Tracker//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	if c.Timezone != "" {
+		line("X-WR-TIMEZONE", c.Timezone)
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", formatTime(e.Updated))
+		line("DTSTART", formatTime(e.Start))
+		line("DTEND", formatTime(e.End))
+		line("SUMMARY", escape(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// writeLine writes a content line, folding it so that no line is longer than
+// maxLineLength octets and no character is split across lines.
+func writeLine(w *bufio.Writer, s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		fmt.Fprintf(w, "%s\r\n ", s[:i])
+		s = s[i:]
+		// The space that continues a folded line counts towards its length.
+		limit = maxLineLength - 1
+	}
+	fmt.Fprintf(w, "%s\r\n", s)
+}
@@ -0,0 +1,63 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	start := time.Date(2019, 12, 9, 8, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+	c := &Calendar{
+		Name:     "West Route",
+		Timezone: "America/New_York",
+		Events: []Event{{
+			UID:         "route-1-1575896400@example.com",
+			Start:       start,
+			End:         start.Add(9 * time.Hour),
+			Summary:     "West Route; runs, usually",
+			Description: strings.Repeat("é", 60) + "\nSecond line",
+			Updated:     start,
+		}},
+	}
+	buf := &bytes.Buffer{}
+	if err := Write(buf, c); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := buf.String()
+
+	if !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Errorf("output doesn't end with END:VCALENDAR")
+	}
+	for _, want := range []string{
+		"\r\nDTSTART:20191209T130000Z\r\n",
+		"\r\nDTEND:20191209T220000Z\r\n",
+		`SUMMARY:West Route\; runs\, usually`,
+		"X-WR-TIMEZONE:America/New_York",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, out)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	description := ""
+	for i, l := range lines {
+		if len(l) > maxLineLength {
+			t.Errorf("line %d is %d octets long", i, len(l))
+		}
+		if strings.HasPrefix(l, "DESCRIPTION:") {
+			description = l
+			for _, next := range lines[i+1:] {
+				if !strings.HasPrefix(next, " ") {
+					break
+				}
+				description += next[1:]
+			}
+		}
+	}
+	if description != "DESCRIPTION:"+strings.Repeat("é", 60)+`\nSecond line` {
+		t.Errorf("got unfolded description %q", description)
+	}
+}
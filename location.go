@@ -21,6 +21,54 @@ type Location struct {
 
 	// RouteID is a pointer to an int64 because it may be null.
 	RouteID *int64 `json:"route_id"`
+
+	// Source is where this Location came from. Clients can use it to decide how
+	// much to trust a Location, since Fusion positions are less precise than iTRAK's.
+	Source string `json:"source"`
+}
+
+const (
+	// LocationSourceITRAK indicates that a Location was reported by the iTRAK data feed.
+	LocationSourceITRAK = "itrak"
+
+	// LocationSourceFusion indicates that a Location was synthesized from the
+	// positions of riders who appear to be on a vehicle.
+	LocationSourceFusion = "fusion"
+)
+
+// LocationFilter selects Locations. Empty fields match every Location.
+type LocationFilter struct {
+	VehicleIDs []int64
+	RouteIDs   []int64
+
+	// Since and Until bound Locations' tracker times. Since is inclusive and Until
+	// is exclusive.
+	Since time.Time
+	Until time.Time
+
+	// Bounds only matches Locations within a box, if it's set.
+	Bounds *Bounds
+
+	// After continues from a previous page; only Locations after it are matched.
+	After *LocationCursor
+
+	// Limit is the most Locations to match, or zero for no limit.
+	Limit int
+}
+
+// Bounds is a box of latitudes and longitudes.
+type Bounds struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// LocationCursor is where a page of Locations ended. Locations are ordered by time,
+// then by ID.
+type LocationCursor struct {
+	Time time.Time
+	ID   int64
 }
 
 // LocationService is an interface for interacting with information about vehicle positions.
@@ -31,6 +79,11 @@ type LocationService interface {
 	LatestLocation(vehicleID int64) (*Location, error)
 	LatestLocations() ([]*Location, error)
 	Location(id int64) (*Location, error)
+
+	// Locations calls f with each Location that matches a filter, ordered by time and
+	// then ID, so that they don't all have to be in memory. It stops if f returns an
+	// error and returns that error.
+	Locations(filter LocationFilter, f func(*Location) error) error
 	SubscribeLocations() chan *Location
 }
 
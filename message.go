@@ -5,7 +5,8 @@ import (
 	"time"
 )
 
-// Message represents a message displayed to users.
+// Message represents a message displayed to users. It's what older clients see of
+// Alerts: the most important active Alert, or the Message set through SetMessage.
 type Message struct {
 	Message string    `json:"message"`
 	Enabled bool      `json:"enabled"`
@@ -14,10 +15,18 @@ type Message struct {
 	Link    string    `json:"link"`
 }
 
-// MessageService is an interface for interacting with Messages.
+// MessageService is an interface for interacting with Messages and Alerts.
 type MessageService interface {
+	// Message and SetMessage get and set an Alert that stands in for the single
+	// Message that there used to be.
 	Message() (*Message, error)
 	SetMessage(message *Message) error
+
+	Alerts() ([]*Alert, error)
+	Alert(id int64) (*Alert, error)
+	CreateAlert(alert *Alert) error
+	ModifyAlert(alert *Alert) error
+	DeleteAlert(id int64) error
 }
 
 var (
@@ -0,0 +1,24 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// AuditService implements a mock of shuttletracker.AuditService.
+type AuditService struct {
+	mock.Mock
+}
+
+// CreateAuditEntry records an AuditEntry.
+func (as *AuditService) CreateAuditEntry(entry *shuttletracker.AuditEntry) error {
+	args := as.Called(entry)
+	return args.Error(0)
+}
+
+// AuditEntries returns the AuditEntries that match a filter.
+func (as *AuditService) AuditEntries(filter shuttletracker.AuditFilter) ([]*shuttletracker.AuditEntry, error) {
+	args := as.Called(filter)
+	return args.Get(0).([]*shuttletracker.AuditEntry), args.Error(1)
+}
@@ -0,0 +1,26 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// BusButtonService implements a mock of shuttletracker.BusButtonService.
+type BusButtonService struct {
+	mock.Mock
+}
+
+// AddBusButtonPresses adds to a day's count of presses for an emoji.
+func (bbs *BusButtonService) AddBusButtonPresses(day time.Time, emoji string, presses int) error {
+	args := bbs.Called(day, emoji, presses)
+	return args.Error(0)
+}
+
+// BusButtonCounts gets daily press counts since a time.
+func (bbs *BusButtonService) BusButtonCounts(since time.Time) ([]*shuttletracker.BusButtonCount, error) {
+	args := bbs.Called(since)
+	return args.Get(0).([]*shuttletracker.BusButtonCount), args.Error(1)
+}
@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// DetourService implements a mock of shuttletracker.DetourService.
+type DetourService struct {
+	mock.Mock
+}
+
+// Detours gets all Detours.
+func (ds *DetourService) Detours() ([]*shuttletracker.Detour, error) {
+	args := ds.Called()
+	return args.Get(0).([]*shuttletracker.Detour), args.Error(1)
+}
+
+// Detour gets a Detour.
+func (ds *DetourService) Detour(id int64) (*shuttletracker.Detour, error) {
+	args := ds.Called(id)
+	return args.Get(0).(*shuttletracker.Detour), args.Error(1)
+}
+
+// CreateDetour creates a Detour.
+func (ds *DetourService) CreateDetour(detour *shuttletracker.Detour) error {
+	args := ds.Called(detour)
+	return args.Error(0)
+}
+
+// ModifyDetour modifies an existing Detour.
+func (ds *DetourService) ModifyDetour(detour *shuttletracker.Detour) error {
+	args := ds.Called(detour)
+	return args.Error(0)
+}
+
+// DeleteDetour deletes a Detour.
+func (ds *DetourService) DeleteDetour(id int64) error {
+	args := ds.Called(id)
+	return args.Error(0)
+}
@@ -21,3 +21,9 @@ func (es *ETAService) CurrentETAs() map[int64]shuttletracker.VehicleETA {
 func (es *ETAService) Subscribe(f func(shuttletracker.VehicleETA)) {
 	es.Called(f)
 }
+
+// RouteLoopStats returns how long loops of a Route take.
+func (es *ETAService) RouteLoopStats(routeID int64) (*shuttletracker.RouteLoopStats, error) {
+	args := es.Called(routeID)
+	return args.Get(0).(*shuttletracker.RouteLoopStats), args.Error(1)
+}
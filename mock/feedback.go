@@ -23,20 +23,32 @@ func (fs *FeedbackService) DeleteForm(id int64) error {
 	return args.Error(0)
 }
 
-// Form gets a form
-func (fs *FeedbackService) Form(id int64) (*shuttletracker.Form, error) {
+// GetAdminForm gets the admin form
+func (fs *FeedbackService) GetAdminForm() *shuttletracker.Form {
+	args := fs.Called()
+	return args.Get(0).(*shuttletracker.Form)
+}
+
+// GetForm gets a form
+func (fs *FeedbackService) GetForm(id int64) (*shuttletracker.Form, error) {
 	args := fs.Called(id)
 	return args.Get(0).(*shuttletracker.Form), args.Error(1)
 }
 
-// EditForm edits form
+// EditForm edits a form's category, status, and notes
 func (fs *FeedbackService) EditForm(form *shuttletracker.Form) error {
 	args := fs.Called(form)
 	return args.Error(0)
 }
 
-// Forms returns all forms
-func (fs *FeedbackService) Forms() ([]*shuttletracker.Form, error) {
+// GetForms returns all forms
+func (fs *FeedbackService) GetForms() ([]*shuttletracker.Form, error) {
 	args := fs.Called()
 	return args.Get(0).([]*shuttletracker.Form), args.Error(1)
 }
+
+// SearchForms returns the forms that match a filter
+func (fs *FeedbackService) SearchForms(filter shuttletracker.FormFilter) ([]*shuttletracker.Form, error) {
+	args := fs.Called(filter)
+	return args.Get(0).([]*shuttletracker.Form), args.Error(1)
+}
@@ -49,6 +49,18 @@ func (ls *LocationService) Location(id int64) (*shuttletracker.Location, error)
 	return args.Get(0).(*shuttletracker.Location), args.Error(1)
 }
 
+// Locations calls f with each of the Locations that the mock returns for a filter.
+func (ls *LocationService) Locations(filter shuttletracker.LocationFilter, f func(*shuttletracker.Location) error) error {
+	args := ls.Called(filter)
+	for _, l := range args.Get(0).([]*shuttletracker.Location) {
+		err := f(l)
+		if err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
 // SubscribeLocations returns a chan that receives each new Location.
 func (ls *LocationService) SubscribeLocations() chan *shuttletracker.Location {
 	args := ls.Called()
@@ -22,3 +22,33 @@ func (ms *MessageService) SetMessage(message *shuttletracker.Message) error {
 	args := ms.Called(message)
 	return args.Error(0)
 }
+
+// Alerts returns all Alerts.
+func (ms *MessageService) Alerts() ([]*shuttletracker.Alert, error) {
+	args := ms.Called()
+	return args.Get(0).([]*shuttletracker.Alert), args.Error(1)
+}
+
+// Alert returns an Alert by its ID.
+func (ms *MessageService) Alert(id int64) (*shuttletracker.Alert, error) {
+	args := ms.Called(id)
+	return args.Get(0).(*shuttletracker.Alert), args.Error(1)
+}
+
+// CreateAlert creates an Alert.
+func (ms *MessageService) CreateAlert(alert *shuttletracker.Alert) error {
+	args := ms.Called(alert)
+	return args.Error(0)
+}
+
+// ModifyAlert modifies an existing Alert.
+func (ms *MessageService) ModifyAlert(alert *shuttletracker.Alert) error {
+	args := ms.Called(alert)
+	return args.Error(0)
+}
+
+// DeleteAlert deletes an Alert.
+func (ms *MessageService) DeleteAlert(id int64) error {
+	args := ms.Called(id)
+	return args.Error(0)
+}
@@ -7,4 +7,7 @@ type ModelService struct {
 	StopService
 	LocationService
 	FeedbackService
+	RevisionService
+	ScheduleService
+	DetourService
 }
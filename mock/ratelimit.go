@@ -0,0 +1,18 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+// RateLimitService implements a mock of shuttletracker.RateLimitService.
+type RateLimitService struct {
+	mock.Mock
+}
+
+// TakeRateLimitToken takes a token from a bucket.
+func (rls *RateLimitService) TakeRateLimitToken(key string, burst float64, rate float64, now time.Time) (bool, time.Duration, error) {
+	args := rls.Called(key, burst, rate, now)
+	return args.Bool(0), args.Get(1).(time.Duration), args.Error(2)
+}
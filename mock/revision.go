@@ -0,0 +1,24 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// RevisionService implements a mock of shuttletracker.RevisionService.
+type RevisionService struct {
+	mock.Mock
+}
+
+// Revision gets a Revision.
+func (rs *RevisionService) Revision(id int64) (*shuttletracker.Revision, error) {
+	args := rs.Called(id)
+	return args.Get(0).(*shuttletracker.Revision), args.Error(1)
+}
+
+// Revisions gets every Revision of a Route or Stop.
+func (rs *RevisionService) Revisions(kind string, targetID int64) ([]*shuttletracker.Revision, error) {
+	args := rs.Called(kind, targetID)
+	return args.Get(0).([]*shuttletracker.Revision), args.Error(1)
+}
@@ -12,14 +12,32 @@ type RouteService struct {
 }
 
 // CreateRoute creates a Route.
-func (rs *RouteService) CreateRoute(route *shuttletracker.Route) error {
-	args := rs.Called(route)
+func (rs *RouteService) CreateRoute(route *shuttletracker.Route, username string) error {
+	args := rs.Called(route, username)
+	return args.Error(0)
+}
+
+// CreateRoutesAndStops creates Stops and Routes that stop at them.
+func (rs *RouteService) CreateRoutesAndStops(stops []*shuttletracker.Stop, routes []*shuttletracker.Route, routeStops [][]*shuttletracker.Stop, username string) error {
+	args := rs.Called(stops, routes, routeStops, username)
+	return args.Error(0)
+}
+
+// CreateRouteWithStops creates a Route and modifies Stops.
+func (rs *RouteService) CreateRouteWithStops(route *shuttletracker.Route, stops []*shuttletracker.Stop, username string) error {
+	args := rs.Called(route, stops, username)
+	return args.Error(0)
+}
+
+// ModifyRouteWithStops modifies a Route and Stops.
+func (rs *RouteService) ModifyRouteWithStops(route *shuttletracker.Route, stops []*shuttletracker.Stop, username string) error {
+	args := rs.Called(route, stops, username)
 	return args.Error(0)
 }
 
 // DeleteRoute deletes a Route.
-func (rs *RouteService) DeleteRoute(id int64) error {
-	args := rs.Called(id)
+func (rs *RouteService) DeleteRoute(id int64, username string) error {
+	args := rs.Called(id, username)
 	return args.Error(0)
 }
 
@@ -30,11 +48,17 @@ func (rs *RouteService) Route(id int64) (*shuttletracker.Route, error) {
 }
 
 // ModifyRoute modifies a Route.
-func (rs *RouteService) ModifyRoute(route *shuttletracker.Route) error {
-	args := rs.Called(route)
+func (rs *RouteService) ModifyRoute(route *shuttletracker.Route, username string) error {
+	args := rs.Called(route, username)
 	return args.Error(0)
 }
 
+// RestoreRoute restores a Route from a Revision.
+func (rs *RouteService) RestoreRoute(revisionID int64, username string) (*shuttletracker.Route, error) {
+	args := rs.Called(revisionID, username)
+	return args.Get(0).(*shuttletracker.Route), args.Error(1)
+}
+
 // Routes returns all Routes.
 func (rs *RouteService) Routes() ([]*shuttletracker.Route, error) {
 	args := rs.Called()
@@ -0,0 +1,72 @@
+package mock
+
+import (
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ScheduleService implements a mock of shuttletracker.ScheduleService.
+type ScheduleService struct {
+	mock.Mock
+}
+
+// ServiceCalendars gets all ServiceCalendars.
+func (ss *ScheduleService) ServiceCalendars() ([]*shuttletracker.ServiceCalendar, error) {
+	args := ss.Called()
+	return args.Get(0).([]*shuttletracker.ServiceCalendar), args.Error(1)
+}
+
+// ServiceCalendar gets a ServiceCalendar.
+func (ss *ScheduleService) ServiceCalendar(id int64) (*shuttletracker.ServiceCalendar, error) {
+	args := ss.Called(id)
+	return args.Get(0).(*shuttletracker.ServiceCalendar), args.Error(1)
+}
+
+// CreateServiceCalendar creates a ServiceCalendar.
+func (ss *ScheduleService) CreateServiceCalendar(calendar *shuttletracker.ServiceCalendar) error {
+	args := ss.Called(calendar)
+	return args.Error(0)
+}
+
+// ModifyServiceCalendar modifies a ServiceCalendar.
+func (ss *ScheduleService) ModifyServiceCalendar(calendar *shuttletracker.ServiceCalendar) error {
+	args := ss.Called(calendar)
+	return args.Error(0)
+}
+
+// DeleteServiceCalendar deletes a ServiceCalendar.
+func (ss *ScheduleService) DeleteServiceCalendar(id int64) error {
+	args := ss.Called(id)
+	return args.Error(0)
+}
+
+// ScheduleExceptions gets all ScheduleExceptions.
+func (ss *ScheduleService) ScheduleExceptions() ([]*shuttletracker.ScheduleException, error) {
+	args := ss.Called()
+	return args.Get(0).([]*shuttletracker.ScheduleException), args.Error(1)
+}
+
+// ScheduleException gets a ScheduleException.
+func (ss *ScheduleService) ScheduleException(id int64) (*shuttletracker.ScheduleException, error) {
+	args := ss.Called(id)
+	return args.Get(0).(*shuttletracker.ScheduleException), args.Error(1)
+}
+
+// CreateScheduleException creates a ScheduleException.
+func (ss *ScheduleService) CreateScheduleException(exception *shuttletracker.ScheduleException) error {
+	args := ss.Called(exception)
+	return args.Error(0)
+}
+
+// ModifyScheduleException modifies a ScheduleException.
+func (ss *ScheduleService) ModifyScheduleException(exception *shuttletracker.ScheduleException) error {
+	args := ss.Called(exception)
+	return args.Error(0)
+}
+
+// DeleteScheduleException deletes a ScheduleException.
+func (ss *ScheduleService) DeleteScheduleException(id int64) error {
+	args := ss.Called(id)
+	return args.Error(0)
+}
@@ -11,14 +11,32 @@ type StopService struct {
 }
 
 // CreateStop creates a Stop.
-func (ss *StopService) CreateStop(stop *shuttletracker.Stop) error {
-	args := ss.Called(stop)
+func (ss *StopService) CreateStop(stop *shuttletracker.Stop, username string) error {
+	args := ss.Called(stop, username)
 	return args.Error(0)
 }
 
+// CreateStopWithID creates a Stop with a specific ID.
+func (ss *StopService) CreateStopWithID(stop *shuttletracker.Stop, username string) error {
+	args := ss.Called(stop, username)
+	return args.Error(0)
+}
+
+// ModifyStop modifies a Stop.
+func (ss *StopService) ModifyStop(stop *shuttletracker.Stop, username string) error {
+	args := ss.Called(stop, username)
+	return args.Error(0)
+}
+
+// RestoreStop restores a Stop from a Revision.
+func (ss *StopService) RestoreStop(revisionID int64, username string) (*shuttletracker.Stop, error) {
+	args := ss.Called(revisionID, username)
+	return args.Get(0).(*shuttletracker.Stop), args.Error(1)
+}
+
 // DeleteStop deletes a Stop.
-func (ss *StopService) DeleteStop(id int64) error {
-	args := ss.Called(id)
+func (ss *StopService) DeleteStop(id int64, detach bool, username string) error {
+	args := ss.Called(id, detach, username)
 	return args.Error(0)
 }
 
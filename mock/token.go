@@ -0,0 +1,50 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// APITokenService implements a mock of shuttletracker.APITokenService.
+type APITokenService struct {
+	mock.Mock
+}
+
+// CreateAPIToken stores an APIToken.
+func (ats *APITokenService) CreateAPIToken(token *shuttletracker.APIToken, hash []byte) error {
+	args := ats.Called(token, hash)
+	return args.Error(0)
+}
+
+// APIToken returns an APIToken by its ID.
+func (ats *APITokenService) APIToken(id int64) (*shuttletracker.APIToken, error) {
+	args := ats.Called(id)
+	return args.Get(0).(*shuttletracker.APIToken), args.Error(1)
+}
+
+// APITokenWithHash returns the APIToken whose secret has a hash.
+func (ats *APITokenService) APITokenWithHash(hash []byte) (*shuttletracker.APIToken, error) {
+	args := ats.Called(hash)
+	return args.Get(0).(*shuttletracker.APIToken), args.Error(1)
+}
+
+// APITokens returns a User's APITokens.
+func (ats *APITokenService) APITokens(username string) ([]*shuttletracker.APIToken, error) {
+	args := ats.Called(username)
+	return args.Get(0).([]*shuttletracker.APIToken), args.Error(1)
+}
+
+// DeleteAPIToken deletes an APIToken.
+func (ats *APITokenService) DeleteAPIToken(id int64) error {
+	args := ats.Called(id)
+	return args.Error(0)
+}
+
+// TouchAPIToken records when an APIToken was last used.
+func (ats *APITokenService) TouchAPIToken(id int64, used time.Time) error {
+	args := ats.Called(id, used)
+	return args.Error(0)
+}
@@ -0,0 +1,32 @@
+package mock
+
+import (
+	"time"
+
+	"github.com/stretchr/testify/mock"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// TrackService implements a mock of shuttletracker.TrackService.
+type TrackService struct {
+	mock.Mock
+}
+
+// CreateTrackPosition creates a TrackPosition.
+func (ts *TrackService) CreateTrackPosition(position *shuttletracker.TrackPosition) error {
+	args := ts.Called(position)
+	return args.Error(0)
+}
+
+// TrackPositionsSince gets TrackPositions since a time.
+func (ts *TrackService) TrackPositionsSince(since time.Time) ([]*shuttletracker.TrackPosition, error) {
+	args := ts.Called(since)
+	return args.Get(0).([]*shuttletracker.TrackPosition), args.Error(1)
+}
+
+// DeleteTrackPositionsBefore deletes TrackPositions from before a certain time.
+func (ts *TrackService) DeleteTrackPositionsBefore(before time.Time) (int, error) {
+	args := ts.Called(before)
+	return args.Int(0), args.Error(1)
+}
@@ -33,3 +33,39 @@ func (us *UserService) DeleteUser(username string) error {
 	args := us.Called(username)
 	return args.Error(0)
 }
+
+// User gets a User by username.
+func (us *UserService) User(username string) (*shuttletracker.User, error) {
+	args := us.Called(username)
+	return args.Get(0).(*shuttletracker.User), args.Error(1)
+}
+
+// GrantPermission gives a User a permission.
+func (us *UserService) GrantPermission(username string, permission string) error {
+	args := us.Called(username, permission)
+	return args.Error(0)
+}
+
+// RevokePermission takes a permission away from a User.
+func (us *UserService) RevokePermission(username string, permission string) error {
+	args := us.Called(username, permission)
+	return args.Error(0)
+}
+
+// SetRole changes a User's role.
+func (us *UserService) SetRole(username string, role string) error {
+	args := us.Called(username, role)
+	return args.Error(0)
+}
+
+// PasswordHash returns the hash of a User's password.
+func (us *UserService) PasswordHash(username string) ([]byte, error) {
+	args := us.Called(username)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+// SetPasswordHash sets the hash of a User's password.
+func (us *UserService) SetPasswordHash(username string, hash []byte) error {
+	args := us.Called(username, hash)
+	return args.Error(0)
+}
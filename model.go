@@ -1,9 +1,13 @@
 package shuttletracker
 
-// ModelService is a collection of interfaces related to vehicles, routes, stops, and their locations.
+// ModelService is a collection of interfaces related to vehicles, routes, stops, their
+// locations, revisions of routes and stops, exceptions to route schedules, and detours.
 type ModelService interface {
 	VehicleService
 	RouteService
 	StopService
 	LocationService
+	RevisionService
+	ScheduleService
+	DetourService
 }
@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// AuditService is an implementation of shuttletracker.AuditService.
+type AuditService struct {
+	db *sql.DB
+}
+
+func (as *AuditService) initializeSchema(db *sql.DB) error {
+	as.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS audit_entries (
+	id serial PRIMARY KEY,
+	actor text NOT NULL,
+	action text NOT NULL,
+	target_type text NOT NULL,
+	target_id integer NOT NULL,
+	before jsonb,
+	after jsonb,
+	created timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS audit_entries_created_idx ON audit_entries (created);`
+	_, err := as.db.Exec(schema)
+	return err
+}
+
+// nullJSON makes empty JSON into a database NULL.
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 || string(b) == "null" {
+		return nil
+	}
+	return b
+}
+
+// CreateAuditEntry records an AuditEntry.
+func (as *AuditService) CreateAuditEntry(entry *shuttletracker.AuditEntry) error {
+	statement := "INSERT INTO audit_entries (actor, action, target_type, target_id, before, after)" +
+		" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created;"
+	row := as.db.QueryRow(statement, entry.Actor, entry.Action, entry.TargetType, entry.TargetID,
+		nullJSON(entry.Before), nullJSON(entry.After))
+	return row.Scan(&entry.ID, &entry.Created)
+}
+
+// AuditEntries returns the AuditEntries that match a filter, newest first.
+func (as *AuditService) AuditEntries(filter shuttletracker.AuditFilter) ([]*shuttletracker.AuditEntry, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+	if filter.Actor != "" {
+		where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != 0 {
+		where("target_id = ?", filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		where("created >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("created < ?", filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		where("id < ?", filter.BeforeID)
+	}
+
+	query := "SELECT id, actor, action, target_type, target_id, before, after, created FROM audit_entries"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	entries := []*shuttletracker.AuditEntry{}
+	rows, err := as.db.Query(query+";", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := &shuttletracker.AuditEntry{}
+		var before, after []byte
+		err = rows.Scan(&e.ID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.Created)
+		if err != nil {
+			return nil, err
+		}
+		if before != nil {
+			e.Before = before
+		}
+		if after != nil {
+			e.After = after
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestAuditEntries(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	entries := []*shuttletracker.AuditEntry{
+		{Actor: "alice", Action: "route.create", TargetType: "route", TargetID: 1, After: json.RawMessage(`{"name": "West"}`)},
+		{Actor: "bob", Action: "route.delete", TargetType: "route", TargetID: 1, Before: json.RawMessage(`{"name": "West"}`)},
+		{Actor: "alice", Action: "stop.delete", TargetType: "stop", TargetID: 2},
+	}
+	for _, entry := range entries {
+		err := pg.CreateAuditEntry(entry)
+		if err != nil {
+			t.Fatalf("unable to create AuditEntry: %s", err)
+		}
+		if entry.ID == 0 || entry.Created.IsZero() {
+			t.Errorf("expected ID and created time to be set, got %+v", entry)
+		}
+	}
+
+	all, err := pg.AuditEntries(shuttletracker.AuditFilter{})
+	if err != nil {
+		t.Fatalf("unable to get AuditEntries: %s", err)
+	}
+	if len(all) != 3 || all[0].ID != entries[2].ID {
+		t.Fatalf("got %d entries starting with %d, expected 3 starting with %d", len(all), all[0].ID, entries[2].ID)
+	}
+	if all[1].After != nil || string(all[2].After) != `{"name": "West"}` {
+		t.Errorf("got after %s and %s", all[1].After, all[2].After)
+	}
+
+	alice, err := pg.AuditEntries(shuttletracker.AuditFilter{Actor: "alice", Limit: 1})
+	if err != nil {
+		t.Fatalf("unable to get AuditEntries: %s", err)
+	}
+	if len(alice) != 1 || alice[0].Action != "stop.delete" {
+		t.Fatalf("got %+v, expected alice's stop deletion", alice)
+	}
+	older, err := pg.AuditEntries(shuttletracker.AuditFilter{Actor: "alice", BeforeID: alice[0].ID})
+	if err != nil {
+		t.Fatalf("unable to get AuditEntries: %s", err)
+	}
+	if len(older) != 1 || older[0].Action != "route.create" {
+		t.Errorf("got %+v, expected alice's route creation", older)
+	}
+
+	routes, err := pg.AuditEntries(shuttletracker.AuditFilter{TargetType: "route", TargetID: 1, Action: "route.delete"})
+	if err != nil {
+		t.Fatalf("unable to get AuditEntries: %s", err)
+	}
+	if len(routes) != 1 || routes[0].Actor != "bob" {
+		t.Errorf("got %+v, expected bob's route deletion", routes)
+	}
+}
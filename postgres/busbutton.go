@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// BusButtonService implements shuttletracker.BusButtonService.
+type BusButtonService struct {
+	db *sql.DB
+}
+
+func (bbs *BusButtonService) initializeSchema(db *sql.DB) error {
+	bbs.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS bus_button_presses (
+	day date NOT NULL,
+	emoji varchar(10) NOT NULL,
+	count integer NOT NULL,
+	PRIMARY KEY (day, emoji)
+);
+	`
+	_, err := bbs.db.Exec(schema)
+	return err
+}
+
+// AddBusButtonPresses adds to the number of times the bus button was pressed with an
+// emoji on the day that contains a time, in that time's location.
+func (bbs *BusButtonService) AddBusButtonPresses(day time.Time, emoji string, presses int) error {
+	statement := "INSERT INTO bus_button_presses (day, emoji, count) VALUES ($1, $2, $3) " +
+		"ON CONFLICT (day, emoji) DO UPDATE SET count = bus_button_presses.count + EXCLUDED.count;"
+	_, err := bbs.db.Exec(statement, day.Format("2006-01-02"), emoji, presses)
+	return err
+}
+
+// BusButtonCounts returns daily press counts since the day that contains a time,
+// ordered by day and then emoji.
+func (bbs *BusButtonService) BusButtonCounts(since time.Time) ([]*shuttletracker.BusButtonCount, error) {
+	counts := []*shuttletracker.BusButtonCount{}
+	query := "SELECT day, emoji, count FROM bus_button_presses WHERE day >= $1 ORDER BY day, emoji;"
+	rows, err := bbs.db.Query(query, since.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		c := &shuttletracker.BusButtonCount{}
+		err := rows.Scan(&c.Day, &c.Emoji, &c.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, nil
+}
@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+// nolint: gocyclo
+func TestBusButtonCounts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	today := time.Now()
+	yesterday := today.AddDate(0, 0, -1)
+	presses := []struct {
+		day     time.Time
+		emoji   string
+		presses int
+	}{
+		{yesterday, "🚌", 1},
+		{today, "🚌", 2},
+		{today, "🚌", 3},
+		{today, "🚗", 4},
+	}
+	for _, p := range presses {
+		err := pg.AddBusButtonPresses(p.day, p.emoji, p.presses)
+		if err != nil {
+			t.Fatalf("unable to add presses: %s", err)
+		}
+	}
+
+	counts, err := pg.BusButtonCounts(today)
+	if err != nil {
+		t.Fatalf("unable to get counts: %s", err)
+	}
+	if len(counts) != 2 {
+		t.Fatalf("got %d counts, expected 2", len(counts))
+	}
+	if counts[0].Emoji != "🚌" || counts[0].Count != 5 {
+		t.Errorf("got %d %s presses, expected 5 🚌", counts[0].Count, counts[0].Emoji)
+	}
+	if counts[1].Emoji != "🚗" || counts[1].Count != 4 {
+		t.Errorf("got %d %s presses, expected 4 🚗", counts[1].Count, counts[1].Emoji)
+	}
+
+	counts, err = pg.BusButtonCounts(yesterday)
+	if err != nil {
+		t.Fatalf("unable to get counts: %s", err)
+	}
+	if len(counts) != 3 {
+		t.Errorf("got %d counts, expected 3", len(counts))
+	}
+}
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// DetourService implements shuttletracker.DetourService.
+type DetourService struct {
+	db *sql.DB
+}
+
+func (ds *DetourService) initializeSchema(db *sql.DB) error {
+	ds.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS detours (
+	id serial PRIMARY KEY,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	description text NOT NULL DEFAULT '',
+	start_time timestamp with time zone NOT NULL,
+	end_time timestamp with time zone NOT NULL CHECK (end_time > start_time),
+	points path,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS detours_stops (
+	detour_id integer REFERENCES detours ON DELETE CASCADE NOT NULL,
+	stop_id integer REFERENCES stops ON DELETE CASCADE NOT NULL,
+	PRIMARY KEY (detour_id, stop_id)
+);`
+	_, err := ds.db.Exec(schema)
+	return err
+}
+
+const selectDetoursQuery = "SELECT d.id, d.route_id, d.description, d.start_time, d.end_time, d.points," +
+	" array(SELECT stop_id FROM detours_stops WHERE detour_id = d.id ORDER BY stop_id)," +
+	" d.created, d.updated FROM detours d"
+
+func (ds *DetourService) selectDetours(where string, args ...interface{}) ([]*shuttletracker.Detour, error) {
+	detours := []*shuttletracker.Detour{}
+	rows, err := ds.db.Query(selectDetoursQuery+" "+where+" ORDER BY d.id;", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d := &shuttletracker.Detour{}
+		p := scanPoints{}
+		err = rows.Scan(&d.ID, &d.RouteID, &d.Description, &d.Start, &d.End, &p,
+			pq.Array(&d.ClosedStopIDs), &d.Created, &d.Updated)
+		if err != nil {
+			return nil, err
+		}
+		d.Points = p.points
+		if d.Points == nil {
+			d.Points = []shuttletracker.Point{}
+		}
+		detours = append(detours, d)
+	}
+	return detours, rows.Err()
+}
+
+// Detours returns all Detours.
+func (ds *DetourService) Detours() ([]*shuttletracker.Detour, error) {
+	return ds.selectDetours("")
+}
+
+// Detour returns a Detour by its ID.
+func (ds *DetourService) Detour(id int64) (*shuttletracker.Detour, error) {
+	detours, err := ds.selectDetours("WHERE d.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(detours) == 0 {
+		return nil, shuttletracker.ErrDetourNotFound
+	}
+	return detours[0], nil
+}
+
+// CreateDetour creates a Detour.
+func (ds *DetourService) CreateDetour(detour *shuttletracker.Detour) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "INSERT INTO detours (route_id, description, start_time, end_time, points)" +
+		" VALUES ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
+	row := tx.QueryRow(statement, detour.RouteID, detour.Description, detour.Start, detour.End, valuePoints(detour.Points))
+	err = row.Scan(&detour.ID, &detour.Created, &detour.Updated)
+	if err != nil {
+		return err
+	}
+	err = insertDetourStops(tx, detour)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ModifyDetour modifies an existing Detour, replacing the Stops it closes.
+func (ds *DetourService) ModifyDetour(detour *shuttletracker.Detour) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "UPDATE detours SET route_id = $1, description = $2, start_time = $3, end_time = $4, points = $5," +
+		" updated = now() WHERE id = $6 RETURNING created, updated;"
+	row := tx.QueryRow(statement, detour.RouteID, detour.Description, detour.Start, detour.End,
+		valuePoints(detour.Points), detour.ID)
+	err = row.Scan(&detour.Created, &detour.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrDetourNotFound
+	} else if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM detours_stops WHERE detour_id = $1;", detour.ID)
+	if err != nil {
+		return err
+	}
+	err = insertDetourStops(tx, detour)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertDetourStops(tx *sql.Tx, detour *shuttletracker.Detour) error {
+	if detour.ClosedStopIDs == nil {
+		detour.ClosedStopIDs = []int64{}
+	}
+	statement := "INSERT INTO detours_stops (detour_id, stop_id) SELECT $1, unnest($2::integer[]);"
+	_, err := tx.Exec(statement, detour.ID, pq.Array(detour.ClosedStopIDs))
+	return err
+}
+
+// DeleteDetour deletes a Detour.
+func (ds *DetourService) DeleteDetour(id int64) error {
+	result, err := ds.db.Exec("DELETE FROM detours WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrDetourNotFound
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestDetours(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stop := &shuttletracker.Stop{Latitude: 42.73, Longitude: -73.687}
+	err := pg.CreateStop(stop, "")
+	if err != nil {
+		t.Fatalf("unable to create Stop: %s", err)
+	}
+	route := &shuttletracker.Route{
+		Name:     "Test Route",
+		Schedule: shuttletracker.RouteSchedule{},
+		StopIDs:  []int64{stop.ID},
+		Points:   []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.69}, {Latitude: 42.73, Longitude: -73.68}},
+	}
+	err = pg.CreateRoute(route, "")
+	if err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	start := time.Now().Truncate(time.Second)
+	detour := &shuttletracker.Detour{
+		RouteID:       route.ID,
+		Description:   "Construction on Sage Ave",
+		Start:         start,
+		End:           start.Add(7 * 24 * time.Hour),
+		Points:        []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.688}, {Latitude: 42.731, Longitude: -73.687}, {Latitude: 42.73, Longitude: -73.686}},
+		ClosedStopIDs: []int64{stop.ID},
+	}
+	err = pg.CreateDetour(detour)
+	if err != nil {
+		t.Fatalf("unable to create Detour: %s", err)
+	}
+
+	got, err := pg.Detour(detour.ID)
+	if err != nil {
+		t.Fatalf("unable to get Detour: %s", err)
+	}
+	if !got.Start.Equal(start) || len(got.Points) != 3 || len(got.ClosedStopIDs) != 1 || got.ClosedStopIDs[0] != stop.ID {
+		t.Errorf("got Detour %+v, expected %+v", got, detour)
+	}
+
+	detour.Points = []shuttletracker.Point{}
+	detour.ClosedStopIDs = []int64{}
+	err = pg.ModifyDetour(detour)
+	if err != nil {
+		t.Fatalf("unable to modify Detour: %s", err)
+	}
+	detours, err := pg.Detours()
+	if err != nil {
+		t.Fatalf("unable to get Detours: %s", err)
+	}
+	if len(detours) != 1 || len(detours[0].Points) != 0 || len(detours[0].ClosedStopIDs) != 0 {
+		t.Errorf("got Detours %+v, expected one without points or closed stops", detours)
+	}
+
+	// Detours go away with their routes.
+	err = pg.DeleteRoute(route.ID, "")
+	if err != nil {
+		t.Fatalf("unable to delete Route: %s", err)
+	}
+	err = pg.DeleteDetour(detour.ID)
+	if err != shuttletracker.ErrDetourNotFound {
+		t.Errorf("got error %v, expected ErrDetourNotFound", err)
+	}
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"database/sql"
 	"strconv"
+	"strings"
 
 	"github.com/wtg/shuttletracker"
 	"github.com/wtg/shuttletracker/log"
@@ -22,53 +23,118 @@ CREATE TABLE IF NOT EXISTS forms (
 	message text,
 	created timestamp with time zone NOT NULL DEFAULT now(),
 	admin bool DEFAULT false
-);`
+);
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS category text NOT NULL DEFAULT 'other';
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS route_id integer REFERENCES routes ON DELETE SET NULL;
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS stop_id integer REFERENCES stops ON DELETE SET NULL;
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS vehicle_id integer REFERENCES vehicles ON DELETE SET NULL;
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS email text NOT NULL DEFAULT '';
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS contact_consent bool NOT NULL DEFAULT false;
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'new'
+	CHECK (status IN ('new', 'acknowledged', 'resolved'));
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS notes text NOT NULL DEFAULT '';
+ALTER TABLE forms ADD COLUMN IF NOT EXISTS updated timestamp with time zone NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS forms_created_idx ON forms (created);`
 	_, err := fs.db.Exec(schema)
 	return err
 }
 
 // Form returns a Form if its admin field is true
 func (fs *FeedbackService) GetAdminForm() *shuttletracker.Form {
-	statement := "SELECT f.id, f.message, f.prompt, f.created, f.admin" +
-		" FROM forms f WHERE admin = true;"
-	f := &shuttletracker.Form{}
-	row := fs.db.QueryRow(statement)
-	row.Scan(&f.ID, &f.Message, &f.Prompt, &f.Created, &f.Admin)
-	return f
-}
-
-// Form returns a Form by its ID.
-func (fs *FeedbackService) GetForm(id int64) (*shuttletracker.Form, error) {
-	statement := "SELECT f.message, f.prompt, f.created, f.admin" +
-		" FROM forms f WHERE id = $1;"
-	f := &shuttletracker.Form{ID: id}
-	row := fs.db.QueryRow(statement, id)
-	err := row.Scan(&f.Message, &f.Prompt, &f.Created, &f.Admin)
-	if err == sql.ErrNoRows {
-		return nil, shuttletracker.ErrFormNotFound
+	forms, err := fs.selectForms("WHERE f.admin = true")
+	if err != nil || len(forms) == 0 {
+		return &shuttletracker.Form{}
 	}
-	return f, err
+	return forms[0]
 }
 
-// Forms returns all Forms.
-func (fs *FeedbackService) GetForms() ([]*shuttletracker.Form, error) {
+const selectFormsQuery = "SELECT f.id, coalesce(f.message, ''), coalesce(f.prompt, ''), f.created," +
+	" coalesce(f.admin, false), f.category, f.route_id, f.stop_id, f.vehicle_id, f.email, f.contact_consent," +
+	" f.status, f.notes, f.updated FROM forms f"
+
+func (fs *FeedbackService) selectForms(where string, args ...interface{}) ([]*shuttletracker.Form, error) {
 	forms := []*shuttletracker.Form{}
-	// Add GROUP BY f.prompt to sort the table with
-	query := "SELECT f.id, f.message, f.prompt, f.created, f.admin" +
-		" FROM forms f GROUP BY f.id, f.prompt;"
-	rows, err := fs.db.Query(query)
+	rows, err := fs.db.Query(selectFormsQuery+" "+where+" ORDER BY f.id DESC;", args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		f := &shuttletracker.Form{}
-		err := rows.Scan(&f.ID, &f.Message, &f.Prompt, &f.Created, &f.Admin)
+		var routeID, stopID, vehicleID sql.NullInt64
+		err = rows.Scan(&f.ID, &f.Message, &f.Prompt, &f.Created, &f.Admin, &f.Category, &routeID, &stopID,
+			&vehicleID, &f.Email, &f.ContactConsent, &f.Status, &f.Notes, &f.Updated)
 		if err != nil {
 			return nil, err
 		}
+		if routeID.Valid {
+			f.RouteID = &routeID.Int64
+		}
+		if stopID.Valid {
+			f.StopID = &stopID.Int64
+		}
+		if vehicleID.Valid {
+			f.VehicleID = &vehicleID.Int64
+		}
 		forms = append(forms, f)
 	}
-	return forms, nil
+	return forms, rows.Err()
+}
+
+// Form returns a Form by its ID.
+func (fs *FeedbackService) GetForm(id int64) (*shuttletracker.Form, error) {
+	forms, err := fs.selectForms("WHERE f.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(forms) == 0 {
+		return nil, shuttletracker.ErrFormNotFound
+	}
+	return forms[0], nil
+}
+
+// Forms returns all Forms, newest first.
+func (fs *FeedbackService) GetForms() ([]*shuttletracker.Form, error) {
+	return fs.selectForms("")
+}
+
+// SearchForms returns the Forms that match a filter, newest first.
+func (fs *FeedbackService) SearchForms(filter shuttletracker.FormFilter) ([]*shuttletracker.Form, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.Replace(condition, "?", "$"+strconv.Itoa(len(args)), -1))
+	}
+	if filter.Query != "" {
+		where("(strpos(lower(f.message), lower(?)) > 0 OR strpos(lower(f.notes), lower(?)) > 0"+
+			" OR strpos(lower(f.email), lower(?)) > 0)", filter.Query)
+	}
+	if filter.Category != "" {
+		where("f.category = ?", filter.Category)
+	}
+	if filter.Status != "" {
+		where("f.status = ?", filter.Status)
+	}
+	if filter.RouteID != 0 {
+		where("f.route_id = ?", filter.RouteID)
+	}
+	if filter.StopID != 0 {
+		where("f.stop_id = ?", filter.StopID)
+	}
+	if filter.VehicleID != 0 {
+		where("f.vehicle_id = ?", filter.VehicleID)
+	}
+	if !filter.Since.IsZero() {
+		where("f.created >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("f.created < ?", filter.Until)
+	}
+	if len(conditions) == 0 {
+		return fs.selectForms("")
+	}
+	return fs.selectForms("WHERE "+strings.Join(conditions, " AND "), args...)
 }
 
 // CreateForm creates a Form.
@@ -84,13 +150,33 @@ func (fs *FeedbackService) CreateForm(form *shuttletracker.Form) error {
 		}
 		log.Debugf(strconv.FormatInt(n, 10) + " stale admin feedback message(s) were successfully deleted")
 	}
+	if form.Category == "" {
+		form.Category = shuttletracker.FeedbackCategoryOther
+	}
+	if form.Status == "" {
+		form.Status = shuttletracker.FeedbackStatusNew
+	}
 	// Add prompt when inserting value to the table
-	statement := "INSERT INTO forms (prompt, message, created, admin) VALUES" +
-		" ($1, $2, now(), $3) RETURNING id, message, prompt, created;"
+	statement := "INSERT INTO forms (prompt, message, created, admin, category, route_id, stop_id, vehicle_id," +
+		" email, contact_consent, status, notes) VALUES ($1, $2, now(), $3, $4, $5, $6, $7, $8, $9, $10, $11)" +
+		" RETURNING id, message, prompt, created, updated;"
 	// Use GetAdminForm function to get the current prompt visible to user
 	msg := fs.GetAdminForm()
-	row := fs.db.QueryRow(statement, msg.Message, form.Message, form.Admin)
-	return row.Scan(&form.ID, &form.Message, &form.Prompt, &form.Created)
+	row := fs.db.QueryRow(statement, msg.Message, form.Message, form.Admin, form.Category, form.RouteID,
+		form.StopID, form.VehicleID, form.Email, form.ContactConsent, form.Status, form.Notes)
+	return row.Scan(&form.ID, &form.Message, &form.Prompt, &form.Created, &form.Updated)
+}
+
+// EditForm changes a Form's category, status, and notes.
+func (fs *FeedbackService) EditForm(form *shuttletracker.Form) error {
+	statement := "UPDATE forms SET category = $1, status = $2, notes = $3, updated = now()" +
+		" WHERE id = $4 RETURNING updated;"
+	row := fs.db.QueryRow(statement, form.Category, form.Status, form.Notes, form.ID)
+	err := row.Scan(&form.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrFormNotFound
+	}
+	return err
 }
 
 // DeleteForm deletes a Form.
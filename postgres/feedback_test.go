@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestSearchForms(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	route := &shuttletracker.Route{Name: "Test Route", Schedule: shuttletracker.RouteSchedule{}}
+	err := pg.CreateRoute(route, "")
+	if err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	late := &shuttletracker.Form{
+		Message:        "The shuttle was LATE again",
+		Category:       shuttletracker.FeedbackCategoryLateShuttle,
+		RouteID:        &route.ID,
+		Email:          "rider@rpi.edu",
+		ContactConsent: true,
+	}
+	idea := &shuttletracker.Form{Message: "Show the weather"}
+	for _, f := range []*shuttletracker.Form{late, idea} {
+		err = pg.CreateForm(f)
+		if err != nil {
+			t.Fatalf("unable to create Form: %s", err)
+		}
+	}
+	if idea.Category != shuttletracker.FeedbackCategoryOther || idea.Status != shuttletracker.FeedbackStatusNew {
+		t.Errorf("got category %q and status %q, expected other and new", idea.Category, idea.Status)
+	}
+
+	late.Status = shuttletracker.FeedbackStatusAcknowledged
+	late.Notes = "Talked to dispatch"
+	err = pg.EditForm(late)
+	if err != nil {
+		t.Fatalf("unable to edit Form: %s", err)
+	}
+
+	forms, err := pg.GetForms()
+	if err != nil {
+		t.Fatalf("unable to get Forms: %s", err)
+	}
+	if len(forms) != 2 || forms[0].ID != idea.ID {
+		t.Fatalf("got %d Forms, expected 2 with the newest first", len(forms))
+	}
+
+	for _, c := range []struct {
+		filter   shuttletracker.FormFilter
+		expected []int64
+	}{
+		{shuttletracker.FormFilter{Query: "late"}, []int64{late.ID}},
+		{shuttletracker.FormFilter{Query: "dispatch"}, []int64{late.ID}},
+		{shuttletracker.FormFilter{Status: shuttletracker.FeedbackStatusNew}, []int64{idea.ID}},
+		{shuttletracker.FormFilter{RouteID: route.ID, Category: shuttletracker.FeedbackCategoryLateShuttle}, []int64{late.ID}},
+		{shuttletracker.FormFilter{Since: time.Now().Add(time.Hour)}, []int64{}},
+	} {
+		forms, err = pg.SearchForms(c.filter)
+		if err != nil {
+			t.Fatalf("unable to search Forms: %s", err)
+		}
+		if len(forms) != len(c.expected) {
+			t.Errorf("%+v: got %d Forms, expected %v", c.filter, len(forms), c.expected)
+			continue
+		}
+		for i, f := range forms {
+			if f.ID != c.expected[i] {
+				t.Errorf("%+v: got Form %d, expected %d", c.filter, f.ID, c.expected[i])
+			}
+		}
+	}
+
+	got, err := pg.GetForm(late.ID)
+	if err != nil {
+		t.Fatalf("unable to get Form: %s", err)
+	}
+	if got.RouteID == nil || *got.RouteID != route.ID || got.Email != late.Email || !got.ContactConsent ||
+		got.Status != shuttletracker.FeedbackStatusAcknowledged || got.Notes != late.Notes {
+		t.Errorf("got Form %+v, expected %+v", got, late)
+	}
+
+	// Feedback outlives the route it was about.
+	err = pg.DeleteRoute(route.ID, "")
+	if err != nil {
+		t.Fatalf("unable to delete Route: %s", err)
+	}
+	got, err = pg.GetForm(late.ID)
+	if err != nil {
+		t.Fatalf("unable to get Form: %s", err)
+	}
+	if got.RouteID != nil {
+		t.Errorf("got route ID %d, expected none", *got.RouteID)
+	}
+
+	late.ID = idea.ID + 1
+	err = pg.EditForm(late)
+	if err != shuttletracker.ErrFormNotFound {
+		t.Errorf("got error %v, expected ErrFormNotFound", err)
+	}
+}
@@ -3,6 +3,7 @@ package postgres
 import (
 	"database/sql"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -36,8 +37,11 @@ CREATE TABLE IF NOT EXISTS locations (
 	time timestamp with time zone NOT NULL,
 	route_id integer,
 	created timestamp with time zone NOT NULL DEFAULT now(),
+	source varchar(10) NOT NULL DEFAULT 'itrak',
 	UNIQUE (tracker_id, time)
 );
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS source varchar(10) NOT NULL DEFAULT 'itrak';
+CREATE INDEX IF NOT EXISTS locations_time_id ON locations (time, id);
 
 -- notify clients when locations inserted
 CREATE OR REPLACE FUNCTION locations_insert_notify() RETURNS trigger AS $$
@@ -98,8 +102,12 @@ func (ls *LocationService) SubscribeLocations() chan *shuttletracker.Location {
 	return c
 }
 
-// CreateLocation creates a Location in the database.
+// CreateLocation creates a Location in the database. Locations without a Source
+// are assumed to be from iTRAK.
 func (ls *LocationService) CreateLocation(l *shuttletracker.Location) error {
+	if l.Source == "" {
+		l.Source = shuttletracker.LocationSourceITRAK
+	}
 	query := `
 WITH location AS (
 	INSERT INTO locations (
@@ -109,8 +117,9 @@ WITH location AS (
 		heading,
 		speed,
 		time,
-		route_id
-	) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		route_id,
+		source
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	RETURNING id, tracker_id, created)
 SELECT
 	location.id AS location_id,
@@ -118,7 +127,7 @@ SELECT
 	location.created
 FROM location
 LEFT JOIN vehicles ON vehicles.tracker_id = location.tracker_id;`
-	row := ls.db.QueryRow(query, l.TrackerID, l.Latitude, l.Longitude, l.Heading, l.Speed, l.Time, l.RouteID)
+	row := ls.db.QueryRow(query, l.TrackerID, l.Latitude, l.Longitude, l.Heading, l.Speed, l.Time, l.RouteID, l.Source)
 	err := row.Scan(&l.ID, &l.VehicleID, &l.Created)
 	return err
 }
@@ -140,7 +149,7 @@ func (ls *LocationService) DeleteLocationsBefore(before time.Time) (int, error)
 // LocationsSince returns all Locations since a tracker Time for a certain Vehicle, ordered newest to oldest.
 func (ls *LocationService) LocationsSince(vehicleID int64, since time.Time) ([]*shuttletracker.Location, error) {
 	locations := []*shuttletracker.Location{}
-	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created " +
+	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.source " +
 		"FROM locations l, vehicles v WHERE l.tracker_id = v.tracker_id AND v.id = $1 AND l.time > $2 ORDER BY l.created DESC;"
 	rows, err := ls.db.Query(query, vehicleID, since)
 	if err != nil {
@@ -150,7 +159,7 @@ func (ls *LocationService) LocationsSince(vehicleID int64, since time.Time) ([]*
 		l := &shuttletracker.Location{
 			VehicleID: &vehicleID,
 		}
-		err := rows.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created)
+		err := rows.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.Source)
 		if err != nil {
 			return nil, err
 		}
@@ -164,11 +173,11 @@ func (ls *LocationService) LatestLocation(vehicleID int64) (*shuttletracker.Loca
 	l := &shuttletracker.Location{
 		VehicleID: &vehicleID,
 	}
-	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created " +
+	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.source " +
 		"FROM locations l, vehicles v WHERE l.tracker_id = v.tracker_id AND v.id = $1 " +
 		"ORDER BY l.created DESC LIMIT 1;"
 	row := ls.db.QueryRow(query, vehicleID)
-	err := row.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created)
+	err := row.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.Source)
 	if err == sql.ErrNoRows {
 		return nil, shuttletracker.ErrLocationNotFound
 	} else if err != nil {
@@ -181,7 +190,7 @@ func (ls *LocationService) LatestLocation(vehicleID int64) (*shuttletracker.Loca
 func (ls *LocationService) LatestLocations() ([]*shuttletracker.Location, error) {
 	locations := []*shuttletracker.Location{}
 	query := `
-SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, v.id
+SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.source, v.id
 FROM vehicles v,
         locations l JOIN (
                 SELECT tracker_id, max(created) AS created
@@ -196,7 +205,7 @@ WHERE v.tracker_id = l.tracker_id;
 	}
 	for rows.Next() {
 		l := &shuttletracker.Location{}
-		err := rows.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.VehicleID)
+		err := rows.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.Source, &l.VehicleID)
 		if err != nil {
 			return nil, err
 		}
@@ -205,15 +214,74 @@ WHERE v.tracker_id = l.tracker_id;
 	return locations, nil
 }
 
+// Locations calls f with each Location that matches a filter, ordered by time and then ID.
+func (ls *LocationService) Locations(filter shuttletracker.LocationFilter, f func(*shuttletracker.Location) error) error {
+	conditions := []string{}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if len(filter.VehicleIDs) > 0 {
+		conditions = append(conditions, "v.id = ANY("+arg(pq.Array(filter.VehicleIDs))+")")
+	}
+	if len(filter.RouteIDs) > 0 {
+		conditions = append(conditions, "l.route_id = ANY("+arg(pq.Array(filter.RouteIDs))+")")
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "l.time >= "+arg(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "l.time < "+arg(filter.Until))
+	}
+	if b := filter.Bounds; b != nil {
+		conditions = append(conditions,
+			"l.latitude BETWEEN "+arg(b.MinLatitude)+" AND "+arg(b.MaxLatitude),
+			"l.longitude BETWEEN "+arg(b.MinLongitude)+" AND "+arg(b.MaxLongitude))
+	}
+	if c := filter.After; c != nil {
+		conditions = append(conditions, "(l.time, l.id) > ("+arg(c.Time)+", "+arg(c.ID)+")")
+	}
+
+	query := "SELECT l.id, l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.source, v.id " +
+		"FROM locations l LEFT JOIN vehicles v ON l.tracker_id = v.tracker_id"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY l.time, l.id"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	query += ";"
+
+	rows, err := ls.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		l := &shuttletracker.Location{}
+		err := rows.Scan(&l.ID, &l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.Source, &l.VehicleID)
+		if err != nil {
+			return err
+		}
+		err = f(l)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // Location returns a Location with the provided ID.
 func (ls *LocationService) Location(id int64) (*shuttletracker.Location, error) {
 	l := &shuttletracker.Location{
 		ID: id,
 	}
-	query := "SELECT l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, v.id " +
+	query := "SELECT l.tracker_id, l.latitude, l.longitude, l.heading, l.speed, l.time, l.route_id, l.created, l.source, v.id " +
 		"FROM locations l, vehicles v WHERE l.tracker_id = v.tracker_id AND l.id = $1;"
 	row := ls.db.QueryRow(query, id)
-	err := row.Scan(&l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.VehicleID)
+	err := row.Scan(&l.TrackerID, &l.Latitude, &l.Longitude, &l.Heading, &l.Speed, &l.Time, &l.RouteID, &l.Created, &l.Source, &l.VehicleID)
 	if err == sql.ErrNoRows {
 		return nil, shuttletracker.ErrLocationNotFound
 	} else if err != nil {
@@ -74,6 +74,9 @@ func TestCreateLocation(t *testing.T) {
 	if time.Since(actual.Time).Seconds() > 1 {
 		t.Errorf("got created %v, which is too old", actual.Created)
 	}
+	if actual.Source != shuttletracker.LocationSourceITRAK {
+		t.Errorf("got source %s, expected %s", actual.Source, shuttletracker.LocationSourceITRAK)
+	}
 }
 
 // nolint: gocyclo
@@ -166,3 +169,70 @@ func TestDeleteLocationsBefore(t *testing.T) {
 		t.Fatalf("got %d Locations, expected 1", len(actuals))
 	}
 }
+
+// nolint: gocyclo
+func TestLocations(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	vehicle := &shuttletracker.Vehicle{Name: "test vehicle", TrackerID: "tracker1"}
+	err := pg.CreateVehicle(vehicle)
+	if err != nil {
+		t.Fatalf("unable to create Vehicle: %s", err)
+	}
+	start := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, trackerID := range []string{"tracker1", "tracker1", "tracker2", "tracker1"} {
+		location := &shuttletracker.Location{
+			TrackerID: trackerID,
+			Latitude:  42.73 + float64(i)*0.01,
+			Longitude: -73.68,
+			Time:      start.Add(time.Duration(i) * time.Minute),
+		}
+		err = pg.CreateLocation(location)
+		if err != nil {
+			t.Fatalf("unable to create Location: %s", err)
+		}
+	}
+
+	collect := func(filter shuttletracker.LocationFilter) []*shuttletracker.Location {
+		locations := []*shuttletracker.Location{}
+		err := pg.Locations(filter, func(l *shuttletracker.Location) error {
+			locations = append(locations, l)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unable to get Locations: %s", err)
+		}
+		return locations
+	}
+
+	all := collect(shuttletracker.LocationFilter{})
+	if len(all) != 4 || all[2].VehicleID != nil || *all[0].VehicleID != vehicle.ID {
+		t.Fatalf("got %d locations, expected 4 with tracker2's lacking a vehicle", len(all))
+	}
+
+	for _, c := range []struct {
+		name   string
+		filter shuttletracker.LocationFilter
+		count  int
+	}{
+		{"vehicle", shuttletracker.LocationFilter{VehicleIDs: []int64{vehicle.ID}}, 3},
+		{"time", shuttletracker.LocationFilter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, 2},
+		{"bounds", shuttletracker.LocationFilter{Bounds: &shuttletracker.Bounds{
+			MinLatitude: 42.735, MaxLatitude: 42.755, MinLongitude: -74, MaxLongitude: -73,
+		}}, 2},
+		{"cursor", shuttletracker.LocationFilter{After: &shuttletracker.LocationCursor{Time: all[1].Time, ID: all[1].ID}, Limit: 1}, 1},
+	} {
+		locations := collect(c.filter)
+		if len(locations) != c.count {
+			t.Errorf("%s: got %d locations, expected %d", c.name, len(locations), c.count)
+		}
+		if c.name == "cursor" && locations[0].ID != all[2].ID {
+			t.Errorf("cursor: got location %d, expected %d", locations[0].ID, all[2].ID)
+		}
+	}
+}
@@ -3,10 +3,12 @@ package postgres
 import (
 	"database/sql"
 
+	"github.com/lib/pq"
+
 	"github.com/wtg/shuttletracker"
 )
 
-// MessageService implements a mock of shuttletracker.MessageService.
+// MessageService implements shuttletracker.MessageService.
 type MessageService struct {
 	db *sql.DB
 }
@@ -14,22 +16,47 @@ type MessageService struct {
 func (ms *MessageService) initializeSchema(db *sql.DB) error {
 	ms.db = db
 	schema := `
-CREATE TABLE IF NOT EXISTS messages (
-	id bool PRIMARY KEY DEFAULT true CHECK (id = true),
-	message text,
+CREATE TABLE IF NOT EXISTS alerts (
+	id serial PRIMARY KEY,
+	message text NOT NULL,
+	severity text NOT NULL DEFAULT 'info' CHECK (severity IN ('info', 'warning', 'severe')),
+	link text NOT NULL DEFAULT '',
 	enabled bool NOT NULL,
+	start_time timestamp with time zone,
+	end_time timestamp with time zone CHECK (end_time > start_time),
+	-- The alert that stands in for the single message that there used to be
+	legacy bool NOT NULL DEFAULT false,
 	created timestamp with time zone NOT NULL DEFAULT now(),
-	updated timestamp with time zone NOT NULL DEFAULT now(),
-	link text
+	updated timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS alerts_legacy_idx ON alerts (legacy) WHERE legacy;
+CREATE TABLE IF NOT EXISTS alerts_routes (
+	alert_id integer REFERENCES alerts ON DELETE CASCADE NOT NULL,
+	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
+	PRIMARY KEY (alert_id, route_id)
+);
+CREATE TABLE IF NOT EXISTS alerts_stops (
+	alert_id integer REFERENCES alerts ON DELETE CASCADE NOT NULL,
+	stop_id integer REFERENCES stops ON DELETE CASCADE NOT NULL,
+	PRIMARY KEY (alert_id, stop_id)
 );
-ALTER TABLE messages ADD COLUMN IF NOT EXISTS link text;`
+DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'messages') THEN
+		INSERT INTO alerts (message, link, enabled, legacy, created, updated)
+			SELECT coalesce(message, ''), coalesce(link, ''), enabled, true, created, updated FROM messages
+			ON CONFLICT (legacy) WHERE legacy DO NOTHING;
+		DROP TABLE messages;
+	END IF;
+END
+$$;`
 	_, err := ms.db.Exec(schema)
 	return err
 }
 
 // Message returns the Message.
 func (ms *MessageService) Message() (*shuttletracker.Message, error) {
-	query := "SELECT message, enabled, created, updated, link FROM messages;"
+	query := "SELECT message, enabled, created, updated, link FROM alerts WHERE legacy;"
 	row := ms.db.QueryRow(query)
 	message := &shuttletracker.Message{}
 	err := row.Scan(&message.Message, &message.Enabled, &message.Created, &message.Updated, &message.Link)
@@ -43,9 +70,150 @@ func (ms *MessageService) Message() (*shuttletracker.Message, error) {
 
 // SetMessage updates the Message.
 func (ms *MessageService) SetMessage(message *shuttletracker.Message) error {
-	statement := "INSERT INTO messages (message, enabled, updated, link) VALUES ($1, $2, now(), $3)" +
-		" ON CONFLICT (id) DO UPDATE SET message = excluded.message, enabled = excluded.enabled, updated = excluded.updated, link = excluded.link" +
+	statement := "INSERT INTO alerts (message, enabled, updated, link, legacy) VALUES ($1, $2, now(), $3, true)" +
+		" ON CONFLICT (legacy) WHERE legacy DO UPDATE SET message = excluded.message, enabled = excluded.enabled, updated = excluded.updated, link = excluded.link" +
 		" RETURNING created, updated;"
 	row := ms.db.QueryRow(statement, message.Message, message.Enabled, message.Link)
 	return row.Scan(&message.Created, &message.Updated)
 }
+
+const selectAlertsQuery = "SELECT a.id, a.message, a.severity, a.link, a.enabled, a.start_time, a.end_time," +
+	" array(SELECT route_id FROM alerts_routes WHERE alert_id = a.id ORDER BY route_id)," +
+	" array(SELECT stop_id FROM alerts_stops WHERE alert_id = a.id ORDER BY stop_id)," +
+	" a.created, a.updated FROM alerts a"
+
+func (ms *MessageService) selectAlerts(where string, args ...interface{}) ([]*shuttletracker.Alert, error) {
+	alerts := []*shuttletracker.Alert{}
+	rows, err := ms.db.Query(selectAlertsQuery+" "+where+" ORDER BY a.id;", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := &shuttletracker.Alert{}
+		var start, end pq.NullTime
+		err = rows.Scan(&a.ID, &a.Message, &a.Severity, &a.Link, &a.Enabled, &start, &end,
+			pq.Array(&a.RouteIDs), pq.Array(&a.StopIDs), &a.Created, &a.Updated)
+		if err != nil {
+			return nil, err
+		}
+		if start.Valid {
+			a.Start = &start.Time
+		}
+		if end.Valid {
+			a.End = &end.Time
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// Alerts returns all Alerts.
+func (ms *MessageService) Alerts() ([]*shuttletracker.Alert, error) {
+	return ms.selectAlerts("")
+}
+
+// Alert returns an Alert by its ID.
+func (ms *MessageService) Alert(id int64) (*shuttletracker.Alert, error) {
+	alerts, err := ms.selectAlerts("WHERE a.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(alerts) == 0 {
+		return nil, shuttletracker.ErrAlertNotFound
+	}
+	return alerts[0], nil
+}
+
+// CreateAlert creates an Alert.
+func (ms *MessageService) CreateAlert(alert *shuttletracker.Alert) error {
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "INSERT INTO alerts (message, severity, link, enabled, start_time, end_time)" +
+		" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created, updated;"
+	row := tx.QueryRow(statement, alert.Message, alert.Severity, alert.Link, alert.Enabled, alert.Start, alert.End)
+	err = row.Scan(&alert.ID, &alert.Created, &alert.Updated)
+	if err != nil {
+		return err
+	}
+	err = insertAlertTargets(tx, alert)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ModifyAlert modifies an existing Alert, replacing the Routes and Stops it affects.
+func (ms *MessageService) ModifyAlert(alert *shuttletracker.Alert) error {
+	tx, err := ms.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "UPDATE alerts SET message = $1, severity = $2, link = $3, enabled = $4, start_time = $5," +
+		" end_time = $6, updated = now() WHERE id = $7 RETURNING created, updated;"
+	row := tx.QueryRow(statement, alert.Message, alert.Severity, alert.Link, alert.Enabled, alert.Start, alert.End, alert.ID)
+	err = row.Scan(&alert.Created, &alert.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrAlertNotFound
+	} else if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM alerts_routes WHERE alert_id = $1;", alert.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM alerts_stops WHERE alert_id = $1;", alert.ID)
+	if err != nil {
+		return err
+	}
+	err = insertAlertTargets(tx, alert)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertAlertTargets stores the Routes and Stops that an Alert affects.
+func insertAlertTargets(tx *sql.Tx, alert *shuttletracker.Alert) error {
+	if alert.RouteIDs == nil {
+		alert.RouteIDs = []int64{}
+	}
+	if alert.StopIDs == nil {
+		alert.StopIDs = []int64{}
+	}
+	statement := "INSERT INTO alerts_routes (alert_id, route_id) SELECT $1, unnest($2::integer[]);"
+	_, err := tx.Exec(statement, alert.ID, pq.Array(alert.RouteIDs))
+	if err != nil {
+		return err
+	}
+	statement = "INSERT INTO alerts_stops (alert_id, stop_id) SELECT $1, unnest($2::integer[]);"
+	_, err = tx.Exec(statement, alert.ID, pq.Array(alert.StopIDs))
+	return err
+}
+
+// DeleteAlert deletes an Alert.
+func (ms *MessageService) DeleteAlert(id int64) error {
+	result, err := ms.db.Exec("DELETE FROM alerts WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrAlertNotFound
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestAlerts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	route := &shuttletracker.Route{Name: "Test Route", Schedule: shuttletracker.RouteSchedule{}}
+	err := pg.CreateRoute(route, "")
+	if err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	end := time.Now().Add(time.Hour).Truncate(time.Second)
+	alert := &shuttletracker.Alert{
+		Message:  "Detour on Sage Ave",
+		Severity: shuttletracker.SeverityWarning,
+		Enabled:  true,
+		End:      &end,
+		RouteIDs: []int64{route.ID},
+	}
+	err = pg.CreateAlert(alert)
+	if err != nil {
+		t.Fatalf("unable to create Alert: %s", err)
+	}
+
+	// The old message is an Alert too.
+	message := &shuttletracker.Message{Message: "Welcome back!", Enabled: true}
+	err = pg.SetMessage(message)
+	if err != nil {
+		t.Fatalf("unable to set Message: %s", err)
+	}
+	message.Enabled = false
+	err = pg.SetMessage(message)
+	if err != nil {
+		t.Fatalf("unable to set Message: %s", err)
+	}
+
+	alerts, err := pg.Alerts()
+	if err != nil {
+		t.Fatalf("unable to get Alerts: %s", err)
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("got %d Alerts, expected 2", len(alerts))
+	}
+	got := alerts[0]
+	if got.ID != alert.ID || got.End == nil || !got.End.Equal(end) || got.Start != nil ||
+		len(got.RouteIDs) != 1 || got.RouteIDs[0] != route.ID || len(got.StopIDs) != 0 {
+		t.Errorf("got Alert %+v, expected %+v", got, alert)
+	}
+	if alerts[1].Message != "Welcome back!" || alerts[1].Enabled {
+		t.Errorf("got Alert %+v, expected the disabled message", alerts[1])
+	}
+
+	alert.RouteIDs = []int64{}
+	alert.Severity = shuttletracker.SeveritySevere
+	err = pg.ModifyAlert(alert)
+	if err != nil {
+		t.Fatalf("unable to modify Alert: %s", err)
+	}
+	got, err = pg.Alert(alert.ID)
+	if err != nil {
+		t.Fatalf("unable to get Alert: %s", err)
+	}
+	if got.Severity != shuttletracker.SeveritySevere || len(got.RouteIDs) != 0 {
+		t.Errorf("got Alert %+v, expected it to affect everything", got)
+	}
+
+	err = pg.DeleteAlert(alert.ID)
+	if err != nil {
+		t.Fatalf("unable to delete Alert: %s", err)
+	}
+	_, err = pg.Alert(alert.ID)
+	if err != shuttletracker.ErrAlertNotFound {
+		t.Errorf("got error %v, expected ErrAlertNotFound", err)
+	}
+	err = pg.DeleteAlert(alert.ID)
+	if err != shuttletracker.ErrAlertNotFound {
+		t.Errorf("got error %v, expected ErrAlertNotFound", err)
+	}
+}
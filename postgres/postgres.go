@@ -11,7 +11,11 @@ import (
 /*
 Postgres implements shuttletracker.VehicleService, shuttletracker.RouteService,
 shuttletracker.StopService, shuttletracker.LoctionService, shuttletracker.MessageService,
-and shuttletracker.UserService.
+shuttletracker.UserService, shuttletracker.FeedbackService, shuttletracker.TrackService,
+shuttletracker.BusButtonService, shuttletracker.RevisionService,
+shuttletracker.AuditService, shuttletracker.APITokenService,
+shuttletracker.RateLimitService, shuttletracker.ScheduleService, and
+shuttletracker.DetourService.
 */
 type Postgres struct {
 	VehicleService
@@ -21,11 +25,21 @@ type Postgres struct {
 	MessageService
 	UserService
 	FeedbackService
+	TrackService
+	BusButtonService
+	RevisionService
+	AuditService
+	APITokenService
+	RateLimitService
+	ScheduleService
+	DetourService
 }
 
 // Config contains database connection information.
 type Config struct {
 	URL string
+	// Timezone is the IANA time zone that route schedules are in.
+	Timezone string
 }
 
 // New returns a configured Postgres.
@@ -40,10 +54,19 @@ func New(cfg Config) (*Postgres, error) {
 		return nil, err
 	}
 
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
 	listener := pq.NewListener(cfg.URL, time.Second, time.Minute, nil)
 
 	pg := &Postgres{}
 
+	err = pg.RevisionService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
 	err = pg.VehicleService.initializeSchema(db)
 	if err != nil {
 		return nil, err
@@ -52,7 +75,15 @@ func New(cfg Config) (*Postgres, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = pg.RouteService.initializeSchema(db)
+	err = pg.RouteService.initializeSchema(db, loc)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.ScheduleService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.DetourService.initializeSchema(db)
 	if err != nil {
 		return nil, err
 	}
@@ -68,10 +99,30 @@ func New(cfg Config) (*Postgres, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = pg.APITokenService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
 	err = pg.FeedbackService.initializeSchema(db)
 	if err != nil {
 		return nil, err
 	}
+	err = pg.TrackService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.BusButtonService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.AuditService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	err = pg.RateLimitService.initializeSchema(db)
+	if err != nil {
+		return nil, err
+	}
 
 	go pg.LocationService.run()
 
@@ -81,9 +132,11 @@ func New(cfg Config) (*Postgres, error) {
 // NewConfig creates a new Config.
 func NewConfig(v *viper.Viper) (*Config, error) {
 	cfg := &Config{
-		URL: "postgres://localhost/shuttletracker?sslmode=disable",
+		URL:      "postgres://localhost/shuttletracker?sslmode=disable",
+		Timezone: "America/New_York",
 	}
 	v.SetDefault("postgres.url", cfg.URL)
+	v.SetDefault("postgres.timezone", cfg.Timezone)
 
 	// Allow DATABASE_URL to set the Postgres connection string for ease of deployment.
 	err := v.BindEnv("postgres.url", "DATABASE_URL")
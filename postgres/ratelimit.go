@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// rateLimitPruneInterval is how often unused buckets are deleted, and how long they must
+// have been unused. Buckets that take longer than this to refill lose what they took.
+const rateLimitPruneInterval = time.Hour
+
+// RateLimitService implements shuttletracker.RateLimitService.
+type RateLimitService struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func (rls *RateLimitService) initializeSchema(db *sql.DB) error {
+	rls.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+	key text PRIMARY KEY,
+	tokens double precision NOT NULL,
+	allowed boolean NOT NULL,
+	updated timestamp with time zone NOT NULL
+);`
+	_, err := rls.db.Exec(schema)
+	return err
+}
+
+// TakeRateLimitToken refills and takes from a bucket in one statement so that
+// instances sharing the database can't both take the last token.
+func (rls *RateLimitService) TakeRateLimitToken(key string, burst float64, rate float64, now time.Time) (bool, time.Duration, error) {
+	err := rls.prune(now)
+	if err != nil {
+		return false, 0, err
+	}
+
+	statement := `
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated)
+	VALUES ($1, $2::double precision - 1, $2::double precision >= 1, $4)
+ON CONFLICT (key) DO UPDATE SET
+	tokens = CASE
+		WHEN LEAST($2, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM $4 - b.updated)::double precision) * $3::double precision) >= 1
+		THEN LEAST($2, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM $4 - b.updated)::double precision) * $3::double precision) - 1
+		ELSE LEAST($2, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM $4 - b.updated)::double precision) * $3::double precision)
+	END,
+	allowed = LEAST($2, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM $4 - b.updated)::double precision) * $3::double precision) >= 1,
+	updated = GREATEST(b.updated, $4)
+RETURNING tokens, allowed;`
+	var tokens float64
+	var allowed bool
+	err = rls.db.QueryRow(statement, key, burst, rate, now).Scan(&tokens, &allowed)
+	if err != nil {
+		return false, 0, err
+	}
+	if allowed {
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - tokens) / rate * float64(time.Second)), nil
+}
+
+// prune deletes buckets that haven't been used in a while, at most once per
+// rateLimitPruneInterval.
+func (rls *RateLimitService) prune(now time.Time) error {
+	rls.mu.Lock()
+	if now.Sub(rls.lastPrune) < rateLimitPruneInterval {
+		rls.mu.Unlock()
+		return nil
+	}
+	rls.lastPrune = now
+	rls.mu.Unlock()
+
+	_, err := rls.db.Exec("DELETE FROM rate_limit_buckets WHERE updated < $1;", now.Add(-rateLimitPruneInterval))
+	return err
+}
@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTakeRateLimitToken(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		ok, _, err := pg.TakeRateLimitToken("POST /forms 198.51.100.7", 2, 0.5, now)
+		if err != nil {
+			t.Fatalf("unable to take token: %s", err)
+		}
+		if !ok {
+			t.Fatalf("unable to take token %d from a full bucket", i)
+		}
+	}
+
+	ok, wait, err := pg.TakeRateLimitToken("POST /forms 198.51.100.7", 2, 0.5, now)
+	if err != nil {
+		t.Fatalf("unable to take token: %s", err)
+	}
+	if ok || wait != 2*time.Second {
+		t.Errorf("got %t and wait %s, expected false and 2s", ok, wait)
+	}
+
+	// one token every two seconds
+	ok, _, err = pg.TakeRateLimitToken("POST /forms 198.51.100.7", 2, 0.5, now.Add(2*time.Second))
+	if err != nil {
+		t.Fatalf("unable to take token: %s", err)
+	}
+	if !ok {
+		t.Errorf("unable to take a refilled token")
+	}
+}
@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// RevisionService is an implementation of shuttletracker.RevisionService.
+type RevisionService struct {
+	db *sql.DB
+}
+
+func (rs *RevisionService) initializeSchema(db *sql.DB) error {
+	rs.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS revisions (
+	id serial PRIMARY KEY,
+	kind text NOT NULL,
+	target_id integer NOT NULL,
+	action text NOT NULL,
+	username text NOT NULL,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	data jsonb NOT NULL
+);
+CREATE INDEX IF NOT EXISTS revisions_target_idx ON revisions (kind, target_id);`
+	_, err := rs.db.Exec(schema)
+	return err
+}
+
+// recordRevision stores a snapshot of a Route or Stop as part of the transaction that
+// changed it. Revisions are never modified or deleted.
+func recordRevision(tx *sql.Tx, kind string, targetID int64, action string, username string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	statement := "INSERT INTO revisions (kind, target_id, action, username, data) VALUES ($1, $2, $3, $4, $5);"
+	_, err = tx.Exec(statement, kind, targetID, action, username, b)
+	return err
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func selectRevision(q queryRower, id int64) (*shuttletracker.Revision, error) {
+	r := &shuttletracker.Revision{ID: id}
+	statement := "SELECT kind, target_id, action, username, created, data FROM revisions WHERE id = $1;"
+	err := q.QueryRow(statement, id).Scan(&r.Kind, &r.TargetID, &r.Action, &r.Username, &r.Created, &r.Data)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrRevisionNotFound
+	}
+	return r, err
+}
+
+// Revision returns a Revision by its ID.
+func (rs *RevisionService) Revision(id int64) (*shuttletracker.Revision, error) {
+	return selectRevision(rs.db, id)
+}
+
+// Revisions returns every Revision of a Route or Stop, newest first.
+func (rs *RevisionService) Revisions(kind string, targetID int64) ([]*shuttletracker.Revision, error) {
+	revisions := []*shuttletracker.Revision{}
+	query := "SELECT id, kind, target_id, action, username, created, data FROM revisions" +
+		" WHERE kind = $1 AND target_id = $2 ORDER BY id DESC;"
+	rows, err := rs.db.Query(query, kind, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := &shuttletracker.Revision{}
+		err = rows.Scan(&r.ID, &r.Kind, &r.TargetID, &r.Action, &r.Username, &r.Created, &r.Data)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
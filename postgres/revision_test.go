@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestRouteRevisions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stop := &shuttletracker.Stop{Latitude: 42.73, Longitude: -73.68}
+	err := pg.CreateStop(stop, "alice")
+	if err != nil {
+		t.Fatalf("unable to create Stop: %s", err)
+	}
+	route := &shuttletracker.Route{
+		Name:     "Test Route",
+		Color:    "#ffffff",
+		Width:    4,
+		Points:   []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.68}},
+		StopIDs:  []int64{stop.ID},
+		Schedule: shuttletracker.RouteSchedule{},
+	}
+	err = pg.CreateRoute(route, "alice")
+	if err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+	route.Points = append(route.Points, shuttletracker.Point{Latitude: 42.74, Longitude: -73.67})
+	err = pg.ModifyRoute(route, "bob")
+	if err != nil {
+		t.Fatalf("unable to modify Route: %s", err)
+	}
+	err = pg.DeleteRoute(route.ID, "carol")
+	if err != nil {
+		t.Fatalf("unable to delete Route: %s", err)
+	}
+
+	revisions, err := pg.Revisions(shuttletracker.RevisionKindRoute, route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Revisions: %s", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("got %d revisions, expected 3", len(revisions))
+	}
+	expected := []struct {
+		action   string
+		username string
+	}{
+		{shuttletracker.RevisionActionDelete, "carol"},
+		{shuttletracker.RevisionActionModify, "bob"},
+		{shuttletracker.RevisionActionCreate, "alice"},
+	}
+	for i, e := range expected {
+		if revisions[i].Action != e.action || revisions[i].Username != e.username {
+			t.Errorf("got revision %d by %s, expected %s by %s", i, revisions[i].Username, e.action, e.username)
+		}
+	}
+
+	// restoring the first revision recreates the route with one point
+	restored, err := pg.RestoreRoute(revisions[2].ID, "dave")
+	if err != nil {
+		t.Fatalf("unable to restore Route: %s", err)
+	}
+	if restored.ID != route.ID || len(restored.Points) != 1 || len(restored.StopIDs) != 1 {
+		t.Errorf("unexpected restored Route %+v", restored)
+	}
+	route, err = pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if len(route.Points) != 1 {
+		t.Errorf("got %d points, expected 1", len(route.Points))
+	}
+
+	// stops that were deleted since are left out
+	err = pg.DeleteStop(stop.ID, true, "erin")
+	if err != nil {
+		t.Fatalf("unable to delete Stop: %s", err)
+	}
+	restored, err = pg.RestoreRoute(revisions[1].ID, "dave")
+	if err != nil {
+		t.Fatalf("unable to restore Route: %s", err)
+	}
+	if len(restored.Points) != 2 || len(restored.StopIDs) != 0 {
+		t.Errorf("unexpected restored Route %+v", restored)
+	}
+
+	revisions, err = pg.Revisions(shuttletracker.RevisionKindRoute, route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Revisions: %s", err)
+	}
+	if len(revisions) != 6 {
+		t.Errorf("got %d revisions, expected 6", len(revisions))
+	}
+
+	_, err = pg.RestoreStop(revisions[0].ID, "dave")
+	if err != shuttletracker.ErrRevisionNotFound {
+		t.Errorf("got error %v, expected %v", err, shuttletracker.ErrRevisionNotFound)
+	}
+}
+
+func TestRestoreStop(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	name := "Union"
+	stop := &shuttletracker.Stop{Name: &name, Latitude: 42.73, Longitude: -73.68}
+	err := pg.CreateStop(stop, "alice")
+	if err != nil {
+		t.Fatalf("unable to create Stop: %s", err)
+	}
+	err = pg.DeleteStop(stop.ID, false, "bob")
+	if err != nil {
+		t.Fatalf("unable to delete Stop: %s", err)
+	}
+
+	revisions, err := pg.Revisions(shuttletracker.RevisionKindStop, stop.ID)
+	if err != nil {
+		t.Fatalf("unable to get Revisions: %s", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("got %d revisions, expected 2", len(revisions))
+	}
+	restored, err := pg.RestoreStop(revisions[0].ID, "carol")
+	if err != nil {
+		t.Fatalf("unable to restore Stop: %s", err)
+	}
+	stop, err = pg.Stop(stop.ID)
+	if err != nil {
+		t.Fatalf("unable to get Stop: %s", err)
+	}
+	if stop.Name == nil || *stop.Name != name || restored.ID != stop.ID {
+		t.Errorf("unexpected restored Stop %+v", stop)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/wtg/shuttletracker"
@@ -18,11 +20,13 @@ var pointsRegex = regexp.MustCompile(`\((-?\d+\.?\d*),(-?\d+\.?\d*)\)`)
 
 // RouteService implements shuttletracker.RouteService.
 type RouteService struct {
-	db *sql.DB
+	db  *sql.DB
+	loc *time.Location
 }
 
-func (rs *RouteService) initializeSchema(db *sql.DB) error {
+func (rs *RouteService) initializeSchema(db *sql.DB, loc *time.Location) error {
 	rs.db = db
+	rs.loc = loc
 	schema := `
 CREATE TABLE IF NOT EXISTS routes (
     id serial PRIMARY KEY,
@@ -34,6 +38,7 @@ CREATE TABLE IF NOT EXISTS routes (
 	color varchar(9) NOT NULL DEFAULT '#ffffff',
 	points path
 );
+ALTER TABLE routes ADD COLUMN IF NOT EXISTS description text NOT NULL DEFAULT '';
 CREATE TABLE IF NOT EXISTS routes_stops (
 	id serial PRIMARY KEY,
 	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
@@ -45,56 +50,25 @@ CREATE TABLE IF NOT EXISTS route_schedules (
 	id serial PRIMARY KEY,
 	route_id integer REFERENCES routes ON DELETE CASCADE NOT NULL,
 	start_day smallint NOT NULL CHECK (start_day >= 0 AND start_day < 7),
-	start_time time with time zone NOT NULL,
+	start_time time NOT NULL,
 	end_day smallint NOT NULL CHECK (end_day >= 0 AND end_day < 7),
-	end_time time with time zone NOT NULL,
-
-	-- Note: active intervals for route schedules for a route cannot wrap around
-	-- the week boundary. This is for simplicity of implementation in the
-	-- route_is_active() function.
-	CHECK (
-		(start_day = end_day AND start_time < end_time) OR (start_day < end_day)
-	)
+	end_time time NOT NULL
 );
-CREATE OR REPLACE FUNCTION route_is_active(route_id integer) RETURNS boolean STABLE AS $$
-	SELECT exists(
-		SELECT true FROM
-		(
-			SELECT route_schedules.route_id,
-			make_timestamptz(
-				extract(year from (current_date - extract(dow from current_date)::int) + start_day)::int,
-				extract(month from (current_date - extract(dow from current_date)::int) + start_day)::int,
-				extract(day from (current_date - extract(dow from current_date)::int) + start_day)::int,
-				extract(hour from start_time)::int,
-				extract(minute from start_time)::int,
-				extract(sec from start_time)
-			) as start,
-			make_timestamptz(
-				extract(year from (current_date - extract(dow from current_date)::int) + end_day)::int,
-				extract(month from (current_date - extract(dow from current_date)::int) + end_day)::int,
-				extract(day from (current_date - extract(dow from current_date)::int) + end_day)::int,
-				extract(hour from end_time)::int,
-				extract(minute from end_time)::int,
-				extract(sec from end_time)
-			) as end
-			FROM route_schedules
-		) AS timestamps
-		RIGHT OUTER JOIN routes ON routes.id = timestamps.route_id
-		WHERE
-			timestamps.route_id = route_is_active.route_id
-			AND now() >= timestamps.start
-			AND now() <= timestamps.end
-			OR (
-				EXISTS (
-					SELECT 1 from routes
-					WHERE routes.id = route_is_active.route_id
-				) AND NOT EXISTS (
-					SELECT 1 from route_schedules
-					WHERE route_schedules.route_id = route_is_active.route_id
-				)
-			)
-	);
-$$ LANGUAGE sql;
+-- Schedules used to be stored with UTC offsets, which DST changes broke, and couldn't
+-- wrap around the end of the week. The times they were evaluated with were their
+-- clock readings, so dropping the offsets keeps them the same.
+ALTER TABLE route_schedules DROP CONSTRAINT IF EXISTS route_schedules_check;
+DO $$
+BEGIN
+	IF (SELECT data_type FROM information_schema.columns
+		WHERE table_name = 'route_schedules' AND column_name = 'start_time') = 'time with time zone' THEN
+		ALTER TABLE route_schedules
+			ALTER COLUMN start_time TYPE time USING start_time::time,
+			ALTER COLUMN end_time TYPE time USING end_time::time;
+	END IF;
+END $$;
+-- Whether routes are active is determined along with schedule exceptions when they're selected.
+DROP FUNCTION IF EXISTS route_is_active(integer);
 `
 	_, err := rs.db.Exec(schema)
 	return err
@@ -150,9 +124,8 @@ func (rs *RouteService) Routes() ([]*shuttletracker.Route, error) {
 	idsToRoute := map[int64]*shuttletracker.Route{}
 
 	query := `
-SELECT r.id, r.name, r.created, r.updated, r.enabled, r.width, r.color, r.points,
-	array_remove(array_agg(rs.stop_id ORDER BY rs.order ASC), NULL) as stop_ids,
-	route_is_active(r.id) as active
+SELECT r.id, r.name, r.description, r.created, r.updated, r.enabled, r.width, r.color, r.points,
+	array_remove(array_agg(rs.stop_id ORDER BY rs.order ASC), NULL) as stop_ids
 FROM
 	routes r
 LEFT JOIN routes_stops rs ON r.id = rs.route_id
@@ -165,7 +138,7 @@ GROUP BY r.id;
 	for rows.Next() {
 		r := &shuttletracker.Route{}
 		p := scanPoints{}
-		err = rows.Scan(&r.ID, &r.Name, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &p, pq.Array(&r.StopIDs), &r.Active)
+		err = rows.Scan(&r.ID, &r.Name, &r.Description, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &p, pq.Array(&r.StopIDs))
 		if err != nil {
 			return nil, err
 		}
@@ -193,6 +166,11 @@ GROUP BY r.id;
 		route.Schedule = append(route.Schedule, interval)
 	}
 
+	err = setRoutesActive(tx, rs.loc, routes...)
+	if err != nil {
+		return nil, err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return nil, err
@@ -210,9 +188,26 @@ func (rs *RouteService) Route(id int64) (*shuttletracker.Route, error) {
 	// nolint: errcheck
 	defer tx.Rollback()
 
-	query := "SELECT r.name, r.created, r.updated, r.enabled, r.width, r.color, r.points," +
-		" array_remove(array_agg(rs.stop_id ORDER BY rs.order ASC), NULL) as stop_ids," +
-		" route_is_active(r.id) as active" +
+	r, err := selectRoute(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = setRoutesActive(tx, rs.loc, r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// selectRoute returns the Route with the provided ID as it is in a transaction.
+func selectRoute(tx *sql.Tx, id int64) (*shuttletracker.Route, error) {
+	query := "SELECT r.name, r.description, r.created, r.updated, r.enabled, r.width, r.color, r.points," +
+		" array_remove(array_agg(rs.stop_id ORDER BY rs.order ASC), NULL) as stop_ids" +
 		" FROM routes r LEFT JOIN routes_stops rs" +
 		" ON r.id = rs.route_id WHERE r.id = $1 GROUP BY r.id;"
 	row := tx.QueryRow(query, id)
@@ -221,8 +216,10 @@ func (rs *RouteService) Route(id int64) (*shuttletracker.Route, error) {
 		Schedule: shuttletracker.RouteSchedule{},
 	}
 	p := scanPoints{}
-	err = row.Scan(&r.Name, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &p, pq.Array(&r.StopIDs), &r.Active)
-	if err != nil {
+	err := row.Scan(&r.Name, &r.Description, &r.Created, &r.Updated, &r.Enabled, &r.Width, &r.Color, &p, pq.Array(&r.StopIDs))
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrRouteNotFound
+	} else if err != nil {
 		return nil, err
 	}
 	r.Points = p.points
@@ -233,6 +230,7 @@ func (rs *RouteService) Route(id int64) (*shuttletracker.Route, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		interval := shuttletracker.RouteActiveInterval{
 			RouteID: id,
@@ -243,12 +241,27 @@ func (rs *RouteService) Route(id int64) (*shuttletracker.Route, error) {
 		}
 		r.Schedule = append(r.Schedule, interval)
 	}
+	return r, rows.Err()
+}
 
-	err = tx.Commit()
+// setRoutesActive sets the time zone of Routes' schedules and determines whether they
+// are active now, taking schedule exceptions into account.
+func setRoutesActive(tx *sql.Tx, loc *time.Location, routes ...*shuttletracker.Route) error {
+	exceptions, err := selectScheduleExceptions(tx, "")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return r, nil
+	now := time.Now().In(loc)
+	for _, route := range routes {
+		route.Timezone = loc.String()
+		route.Active = route.ActiveAt(now, exceptions)
+	}
+	return nil
+}
+
+// valueClock is the wall-clock time of a schedule as Postgres takes it.
+func valueClock(t time.Time) string {
+	return t.Format("15:04:05")
 }
 
 // TODO: document this
@@ -285,8 +298,14 @@ func (p valuePoints) Value() (driver.Value, error) {
 	return buf.Bytes(), nil
 }
 
-// CreateRoute creates a Route.
-func (rs *RouteService) CreateRoute(route *shuttletracker.Route) error {
+// CreateRoute creates a Route. username is recorded in its first revision.
+func (rs *RouteService) CreateRoute(route *shuttletracker.Route, username string) error {
+	return rs.CreateRouteWithStops(route, nil, username)
+}
+
+// CreateRouteWithStops creates a Route and modifies stops in the same transaction.
+// username is recorded in all of their revisions.
+func (rs *RouteService) CreateRouteWithStops(route *shuttletracker.Route, stops []*shuttletracker.Stop, username string) error {
 	tx, err := rs.db.Begin()
 	if err != nil {
 		return err
@@ -295,50 +314,135 @@ func (rs *RouteService) CreateRoute(route *shuttletracker.Route) error {
 	// nolint: errcheck
 	defer tx.Rollback()
 
-	// insert route
-	statement := "INSERT INTO routes (name, enabled, width, color, points)" +
-		" VALUES ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
-	row := tx.QueryRow(statement, route.Name, route.Enabled, route.Width, route.Color, valuePoints(route.Points))
-	err = row.Scan(&route.ID, &route.Created, &route.Updated)
+	err = insertRoute(tx, route, false)
+	if err != nil {
+		return err
+	}
+	err = setRoutesActive(tx, rs.loc, route)
+	if err != nil {
+		return err
+	}
+	err = recordRevision(tx, shuttletracker.RevisionKindRoute, route.ID, shuttletracker.RevisionActionCreate, username, route)
+	if err != nil {
+		return err
+	}
+	err = modifyStops(tx, stops, username)
 	if err != nil {
 		return err
 	}
+	return tx.Commit()
+}
+
+// CreateRoutesAndStops creates Stops and then Routes that stop at them, all in one
+// transaction. username is recorded in their first revisions.
+func (rs *RouteService) CreateRoutesAndStops(stops []*shuttletracker.Stop, routes []*shuttletracker.Route, routeStops [][]*shuttletracker.Stop, username string) error {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	for _, stop := range stops {
+		err = insertStop(tx, stop, false)
+		if err != nil {
+			return err
+		}
+		err = recordRevision(tx, shuttletracker.RevisionKindStop, stop.ID, shuttletracker.RevisionActionCreate, username, stop)
+		if err != nil {
+			return err
+		}
+	}
+	for i, route := range routes {
+		route.StopIDs = []int64{}
+		for _, stop := range routeStops[i] {
+			route.StopIDs = append(route.StopIDs, stop.ID)
+		}
+		err = insertRoute(tx, route, false)
+		if err != nil {
+			return err
+		}
+	}
+	err = setRoutesActive(tx, rs.loc, routes...)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		err = recordRevision(tx, shuttletracker.RevisionKindRoute, route.ID, shuttletracker.RevisionActionCreate, username, route)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
+// insertRoute inserts a Route along with its stops and schedule. The Route's ID is
+// used if withID is true.
+func insertRoute(tx *sql.Tx, route *shuttletracker.Route, withID bool) error {
+	var row *sql.Row
+	if withID {
+		statement := "INSERT INTO routes (id, name, description, enabled, width, color, points)" +
+			" VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created, updated;"
+		row = tx.QueryRow(statement, route.ID, route.Name, route.Description, route.Enabled, route.Width, route.Color, valuePoints(route.Points))
+	} else {
+		statement := "INSERT INTO routes (name, description, enabled, width, color, points)" +
+			" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created, updated;"
+		row = tx.QueryRow(statement, route.Name, route.Description, route.Enabled, route.Width, route.Color, valuePoints(route.Points))
+	}
+	err := row.Scan(&route.ID, &route.Created, &route.Updated)
+	if err != nil {
+		return err
+	}
+	return insertRouteStopsAndSchedule(tx, route)
+}
+
+// insertRouteStopsAndSchedule inserts a Route's stop ordering and schedule.
+func insertRouteStopsAndSchedule(tx *sql.Tx, route *shuttletracker.Route) error {
 	// insert stop ordering
-	statement = "INSERT INTO routes_stops (route_id, stop_id, \"order\")" +
+	statement := "INSERT INTO routes_stops (route_id, stop_id, \"order\")" +
 		" SELECT $1, stop_id, \"order\" - 1 AS \"order\" FROM" +
 		" unnest($2::integer[]) WITH ORDINALITY AS s(stop_id, \"order\");"
-	_, err = tx.Exec(statement, route.ID, pq.Array(route.StopIDs))
+	_, err := tx.Exec(statement, route.ID, pq.Array(route.StopIDs))
 	if err != nil {
 		return err
 	}
 
 	// insert route schedule
-	for _, interval := range route.Schedule {
+	for i := range route.Schedule {
+		interval := &route.Schedule[i]
 		statement = "INSERT INTO route_schedules (route_id, start_day, start_time, end_day, end_time)" +
 			" VALUES ($1, $2, $3, $4, $5) RETURNING id;"
-		row = tx.QueryRow(statement, route.ID, interval.StartDay, interval.StartTime, interval.EndDay, interval.EndTime)
+		interval.StartTime = shuttletracker.Clock(interval.StartTime)
+		interval.EndTime = shuttletracker.Clock(interval.EndTime)
+		row := tx.QueryRow(statement, route.ID, interval.StartDay, valueClock(interval.StartTime),
+			interval.EndDay, valueClock(interval.EndTime))
 		err = row.Scan(&interval.ID)
 		if err != nil {
 			return err
 		}
 		interval.RouteID = route.ID
 	}
+	return nil
+}
 
-	// Determine if route is active. Must happen after inserting the route schedule.
-	row = tx.QueryRow("SELECT route_is_active($1);", route.ID)
-	err = row.Scan(&route.Active)
+// DeleteRoute deletes a Route. username is recorded in its last revision.
+func (rs *RouteService) DeleteRoute(id int64, username string) error {
+	tx, err := rs.db.Begin()
 	if err != nil {
 		return err
 	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
 
-	return tx.Commit()
-}
+	route, err := selectRoute(tx, id)
+	if err != nil {
+		return err
+	}
 
-// DeleteRoute deletes a Route.
-func (rs *RouteService) DeleteRoute(id int64) error {
 	statement := "DELETE FROM routes WHERE id = $1;"
-	result, err := rs.db.Exec(statement, id)
+	result, err := tx.Exec(statement, id)
 	if err != nil {
 		return err
 	}
@@ -351,11 +455,24 @@ func (rs *RouteService) DeleteRoute(id int64) error {
 		return shuttletracker.ErrRouteNotFound
 	}
 
-	return nil
+	err = recordRevision(tx, shuttletracker.RevisionKindRoute, id, shuttletracker.RevisionActionDelete, username, route)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// ModifyRoute modifies an existing Route.
-func (rs *RouteService) ModifyRoute(route *shuttletracker.Route) error {
+// ModifyRoute modifies an existing Route, including its points, stops, and schedule.
+// route.Updated must be the time that the Route was last modified, otherwise
+// ErrRouteModified is returned. This keeps concurrent edits from silently
+// overwriting each other. username is recorded in the Route's new revision.
+func (rs *RouteService) ModifyRoute(route *shuttletracker.Route, username string) error {
+	return rs.ModifyRouteWithStops(route, nil, username)
+}
+
+// ModifyRouteWithStops is like ModifyRoute, but it also modifies stops in the same
+// transaction. username is recorded in all of their revisions.
+func (rs *RouteService) ModifyRouteWithStops(route *shuttletracker.Route, stops []*shuttletracker.Stop, username string) error {
 	tx, err := rs.db.Begin()
 	if err != nil {
 		return err
@@ -364,47 +481,112 @@ func (rs *RouteService) ModifyRoute(route *shuttletracker.Route) error {
 	// nolint: errcheck
 	defer tx.Rollback()
 
-	// update route
-	statement := "UPDATE routes SET name = $1, enabled = $2, width = $3, color = $4, points = $5, updated = now()" +
-		" WHERE id = $6 RETURNING updated;"
-	row := tx.QueryRow(statement, route.Name, route.Enabled, route.Width, route.Color, valuePoints(route.Points), route.ID)
-	err = row.Scan(&route.Updated)
+	err = updateRoute(tx, route)
 	if err != nil {
 		return err
 	}
-
-	// remove existing stop ordering
-	_, err = tx.Exec("DELETE FROM routes_stops WHERE route_id = $1;", route.ID)
+	err = setRoutesActive(tx, rs.loc, route)
 	if err != nil {
 		return err
 	}
-
-	// insert stop ordering
-	statement = "INSERT INTO routes_stops (route_id, stop_id, \"order\")" +
-		" SELECT $1, stop_id, \"order\" - 1 AS \"order\" FROM" +
-		" unnest($2::integer[]) WITH ORDINALITY AS s(stop_id, \"order\");"
-	_, err = tx.Exec(statement, route.ID, pq.Array(route.StopIDs))
+	err = recordRevision(tx, shuttletracker.RevisionKindRoute, route.ID, shuttletracker.RevisionActionModify, username, route)
 	if err != nil {
 		return err
 	}
-
-	// remove existing route schedule
-	_, err = tx.Exec("DELETE FROM route_schedules WHERE route_id = $1;", route.ID)
+	err = modifyStops(tx, stops, username)
 	if err != nil {
 		return err
 	}
+	return tx.Commit()
+}
 
-	// insert route schedule
-	for _, interval := range route.Schedule {
-		statement = "INSERT INTO route_schedules (route_id, start_day, start_time, end_day, end_time)" +
-			" VALUES ($1, $2, $3, $4, $5) RETURNING id;"
-		row := tx.QueryRow(statement, route.ID, interval.StartDay, interval.StartTime, interval.EndDay, interval.EndTime)
-		err = row.Scan(&interval.ID)
+func updateRoute(tx *sql.Tx, route *shuttletracker.Route) error {
+	statement := "UPDATE routes SET name = $1, description = $2, enabled = $3, width = $4, color = $5, points = $6," +
+		" updated = now() WHERE id = $7 AND updated = $8 RETURNING updated;"
+	row := tx.QueryRow(statement, route.Name, route.Description, route.Enabled, route.Width, route.Color,
+		valuePoints(route.Points), route.ID, route.Updated)
+	err := row.Scan(&route.Updated)
+	if err == sql.ErrNoRows {
+		var exists bool
+		err = tx.QueryRow("SELECT exists(SELECT 1 FROM routes WHERE id = $1);", route.ID).Scan(&exists)
 		if err != nil {
 			return err
 		}
-		interval.RouteID = route.ID
+		if !exists {
+			return shuttletracker.ErrRouteNotFound
+		}
+		return shuttletracker.ErrRouteModified
+	} else if err != nil {
+		return err
 	}
 
-	return tx.Commit()
+	// remove existing stop ordering and route schedule
+	_, err = tx.Exec("DELETE FROM routes_stops WHERE route_id = $1;", route.ID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM route_schedules WHERE route_id = $1;", route.ID)
+	if err != nil {
+		return err
+	}
+
+	return insertRouteStopsAndSchedule(tx, route)
+}
+
+// RestoreRoute sets a Route back to how it was in a revision, recreating it if it
+// was deleted. Stops that no longer exist are left out. username is recorded in
+// the Route's new revision.
+func (rs *RouteService) RestoreRoute(revisionID int64, username string) (*shuttletracker.Route, error) {
+	tx, err := rs.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	revision, err := selectRevision(tx, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if revision.Kind != shuttletracker.RevisionKindRoute {
+		return nil, shuttletracker.ErrRevisionNotFound
+	}
+	route := &shuttletracker.Route{}
+	err = json.Unmarshal(revision.Data, route)
+	if err != nil {
+		return nil, err
+	}
+	route.ID = revision.TargetID
+
+	// leave out stops that have been deleted since
+	statement := "SELECT coalesce(array_agg(s.id ORDER BY ids.\"order\"), '{}') FROM" +
+		" unnest($1::integer[]) WITH ORDINALITY AS ids(id, \"order\")" +
+		" JOIN stops s ON s.id = ids.id;"
+	stopIDs := []int64{}
+	err = tx.QueryRow(statement, pq.Array(route.StopIDs)).Scan(pq.Array(&stopIDs))
+	if err != nil {
+		return nil, err
+	}
+	route.StopIDs = stopIDs
+
+	err = tx.QueryRow("SELECT updated FROM routes WHERE id = $1 FOR UPDATE;", route.ID).Scan(&route.Updated)
+	if err == sql.ErrNoRows {
+		err = insertRoute(tx, route, true)
+	} else if err == nil {
+		err = updateRoute(tx, route)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = setRoutesActive(tx, rs.loc, route)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordRevision(tx, shuttletracker.RevisionKindRoute, route.ID, shuttletracker.RevisionActionRestore, username, route)
+	if err != nil {
+		return nil, err
+	}
+	return route, tx.Commit()
 }
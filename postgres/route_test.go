@@ -18,7 +18,7 @@ func TestCreateEmptySchedule(t *testing.T) {
 		Name:     "Test Route",
 		Schedule: shuttletracker.RouteSchedule{},
 	}
-	err := pg.CreateRoute(route)
+	err := pg.CreateRoute(route, "")
 	if err != nil {
 		t.Fatalf("unable to create Route: %s", err)
 	}
@@ -63,7 +63,7 @@ func TestCreateSchedule(t *testing.T) {
 			},
 		},
 	}
-	err := pg.CreateRoute(route)
+	err := pg.CreateRoute(route, "")
 	if err != nil {
 		t.Fatalf("unable to create Route: %s", err)
 	}
@@ -117,7 +117,7 @@ func TestModifySchedule(t *testing.T) {
 		Name:     "Test Route",
 		Schedule: shuttletracker.RouteSchedule{},
 	}
-	err := pg.CreateRoute(route)
+	err := pg.CreateRoute(route, "")
 	if err != nil {
 		t.Fatalf("unable to create Route: %s", err)
 	}
@@ -139,7 +139,7 @@ func TestModifySchedule(t *testing.T) {
 			EndTime:   time.Date(0, 1, 0, 23, 59, 59, 0, time.UTC),
 		},
 	}
-	err = pg.ModifyRoute(route)
+	err = pg.ModifyRoute(route, "")
 	if err != nil {
 		t.Fatalf("unable to modify Route: %s", err)
 	}
@@ -176,7 +176,7 @@ func TestModifySchedule(t *testing.T) {
 			EndTime:   time.Date(0, 1, 0, 23, 59, 59, 0, time.UTC),
 		},
 	}
-	err = pg.ModifyRoute(route)
+	err = pg.ModifyRoute(route, "")
 	if err != nil {
 		t.Fatalf("unable to modify Route: %s", err)
 	}
@@ -200,7 +200,7 @@ func TestModifySchedule(t *testing.T) {
 
 	// delete the route schedule and check again
 	route.Schedule = shuttletracker.RouteSchedule{}
-	err = pg.ModifyRoute(route)
+	err = pg.ModifyRoute(route, "")
 	if err != nil {
 		t.Fatalf("unable to modify Route: %s", err)
 	}
@@ -250,7 +250,7 @@ func TestActiveTransition(t *testing.T) {
 			},
 		},
 	}
-	err := pg.CreateRoute(route)
+	err := pg.CreateRoute(route, "")
 	if err != nil {
 		t.Fatalf("unable to create Route: %s", err)
 	}
@@ -288,3 +288,123 @@ func TestActiveTransition(t *testing.T) {
 		t.Error("route is active")
 	}
 }
+
+// nolint: gocyclo
+func TestModifyRoute(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stops := []*shuttletracker.Stop{{Latitude: 42.73, Longitude: -73.68}, {Latitude: 42.74, Longitude: -73.67}}
+	for _, stop := range stops {
+		err := pg.CreateStop(stop, "")
+		if err != nil {
+			t.Fatalf("unable to create Stop: %s", err)
+		}
+	}
+
+	route := &shuttletracker.Route{
+		Name:     "Test Route",
+		Color:    "#ffffff",
+		Width:    4,
+		Points:   []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.68}},
+		StopIDs:  []int64{stops[0].ID},
+		Schedule: shuttletracker.RouteSchedule{},
+	}
+	err := pg.CreateRoute(route, "")
+	if err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+	stale := *route
+
+	route.Name = "Renamed Route"
+	route.Description = "Goes around twice"
+	route.Color = "#ff0000"
+	route.Width = 6
+	route.Points = []shuttletracker.Point{{Latitude: 42.73, Longitude: -73.68}, {Latitude: 42.74, Longitude: -73.67}}
+	route.StopIDs = []int64{stops[1].ID, stops[0].ID}
+	err = pg.ModifyRoute(route, "")
+	if err != nil {
+		t.Fatalf("unable to modify Route: %s", err)
+	}
+
+	modified, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if modified.Name != route.Name || modified.Description != route.Description ||
+		modified.Color != route.Color || modified.Width != route.Width {
+		t.Errorf("got %+v, expected %+v", modified, route)
+	}
+	if len(modified.Points) != 2 {
+		t.Errorf("got %d points, expected 2", len(modified.Points))
+	}
+	if len(modified.StopIDs) != 2 || modified.StopIDs[0] != stops[1].ID || modified.StopIDs[1] != stops[0].ID {
+		t.Errorf("got stop IDs %v, expected %v", modified.StopIDs, route.StopIDs)
+	}
+	if !modified.Updated.Equal(route.Updated) {
+		t.Errorf("got updated %s, expected %s", modified.Updated, route.Updated)
+	}
+
+	// the stale copy was retrieved before the modification, so it can't overwrite it
+	stale.Name = "Stale Route"
+	err = pg.ModifyRoute(&stale, "")
+	if err != shuttletracker.ErrRouteModified {
+		t.Errorf("got error %v, expected %v", err, shuttletracker.ErrRouteModified)
+	}
+	modified, err = pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if modified.Name != "Renamed Route" {
+		t.Errorf("got name %q, expected \"Renamed Route\"", modified.Name)
+	}
+
+	stale.ID = route.ID + 1
+	err = pg.ModifyRoute(&stale, "")
+	if err != shuttletracker.ErrRouteNotFound {
+		t.Errorf("got error %v, expected %v", err, shuttletracker.ErrRouteNotFound)
+	}
+}
+
+// nolint: gocyclo
+func TestCreateRoutesAndStops(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	north := &shuttletracker.Stop{Latitude: 42.74, Longitude: -73.68}
+	south := &shuttletracker.Stop{Latitude: 42.73, Longitude: -73.68}
+	loop := &shuttletracker.Route{Name: "Loop", Color: "#ff0000", Width: 4}
+	// too long for the color column, so nothing should be created
+	spur := &shuttletracker.Route{Name: "Spur", Color: "#ff0000ff00", Width: 4}
+	stops := []*shuttletracker.Stop{north, south}
+	err := pg.CreateRoutesAndStops(stops, []*shuttletracker.Route{loop, spur}, [][]*shuttletracker.Stop{{south, north}, {north}}, "")
+	if err == nil {
+		t.Fatalf("expected an error creating a route with an invalid color")
+	}
+	existing, err := pg.Stops()
+	if err != nil {
+		t.Fatalf("unable to get Stops: %s", err)
+	}
+	if len(existing) != 0 {
+		t.Errorf("got %d stops after a failed import, expected 0", len(existing))
+	}
+
+	north.ID, south.ID = 0, 0
+	err = pg.CreateRoutesAndStops(stops, []*shuttletracker.Route{loop}, [][]*shuttletracker.Stop{{south, north}}, "")
+	if err != nil {
+		t.Fatalf("unable to create Routes and Stops: %s", err)
+	}
+	route, err := pg.Route(loop.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if len(route.StopIDs) != 2 || route.StopIDs[0] != south.ID || route.StopIDs[1] != north.ID {
+		t.Errorf("got stop IDs %v, expected [%d %d]", route.StopIDs, south.ID, north.ID)
+	}
+}
@@ -0,0 +1,391 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// ScheduleService implements shuttletracker.ScheduleService.
+type ScheduleService struct {
+	db *sql.DB
+}
+
+func (ss *ScheduleService) initializeSchema(db *sql.DB) error {
+	ss.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS service_calendars (
+	id serial PRIMARY KEY,
+	name text NOT NULL,
+	description text NOT NULL DEFAULT '',
+	start_date date NOT NULL,
+	end_date date NOT NULL CHECK (end_date >= start_date),
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS schedule_exceptions (
+	id serial PRIMARY KEY,
+	route_id integer REFERENCES routes ON DELETE CASCADE,
+	calendar_id integer REFERENCES service_calendars,
+	start_date date,
+	end_date date,
+	kind text NOT NULL CHECK (kind IN ('suspend', 'replace')),
+	description text NOT NULL DEFAULT '',
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	updated timestamp with time zone NOT NULL DEFAULT now(),
+
+	-- Exceptions apply during either a calendar or their own dates.
+	CHECK (
+		(calendar_id IS NOT NULL AND start_date IS NULL AND end_date IS NULL) OR
+		(calendar_id IS NULL AND start_date IS NOT NULL AND end_date >= start_date)
+	)
+);
+CREATE TABLE IF NOT EXISTS schedule_exception_intervals (
+	id serial PRIMARY KEY,
+	exception_id integer REFERENCES schedule_exceptions ON DELETE CASCADE NOT NULL,
+	start_day smallint NOT NULL CHECK (start_day >= 0 AND start_day < 7),
+	start_time time NOT NULL,
+	end_day smallint NOT NULL CHECK (end_day >= 0 AND end_day < 7),
+	end_time time NOT NULL
+);
+ALTER TABLE schedule_exception_intervals DROP CONSTRAINT IF EXISTS schedule_exception_intervals_check;
+DO $$
+BEGIN
+	IF (SELECT data_type FROM information_schema.columns
+		WHERE table_name = 'schedule_exception_intervals' AND column_name = 'start_time') = 'time with time zone' THEN
+		ALTER TABLE schedule_exception_intervals
+			ALTER COLUMN start_time TYPE time USING start_time::time,
+			ALTER COLUMN end_time TYPE time USING end_time::time;
+	END IF;
+END $$;`
+	_, err := ss.db.Exec(schema)
+	return err
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// valueDate is a Date as Postgres takes it, or NULL if it's zero.
+func valueDate(d shuttletracker.Date) interface{} {
+	if d.IsZero() {
+		return nil
+	}
+	return d.String()
+}
+
+// scanDate scans a Postgres date, which may be NULL.
+type scanDate struct {
+	date *shuttletracker.Date
+}
+
+func (d scanDate) Scan(src interface{}) error {
+	t, ok := src.(time.Time)
+	if !ok {
+		*d.date = shuttletracker.Date{}
+		return nil
+	}
+	*d.date = shuttletracker.DateOf(t)
+	return nil
+}
+
+// ServiceCalendars returns all ServiceCalendars, ordered by when they start.
+func (ss *ScheduleService) ServiceCalendars() ([]*shuttletracker.ServiceCalendar, error) {
+	calendars := []*shuttletracker.ServiceCalendar{}
+	query := "SELECT id, name, description, start_date, end_date, created, updated" +
+		" FROM service_calendars ORDER BY start_date, id;"
+	rows, err := ss.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := &shuttletracker.ServiceCalendar{}
+		err = rows.Scan(&c.ID, &c.Name, &c.Description, scanDate{&c.StartDate}, scanDate{&c.EndDate}, &c.Created, &c.Updated)
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, c)
+	}
+	return calendars, rows.Err()
+}
+
+// ServiceCalendar returns a ServiceCalendar by its ID.
+func (ss *ScheduleService) ServiceCalendar(id int64) (*shuttletracker.ServiceCalendar, error) {
+	c := &shuttletracker.ServiceCalendar{ID: id}
+	query := "SELECT name, description, start_date, end_date, created, updated FROM service_calendars WHERE id = $1;"
+	err := ss.db.QueryRow(query, id).Scan(&c.Name, &c.Description, scanDate{&c.StartDate}, scanDate{&c.EndDate}, &c.Created, &c.Updated)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrServiceCalendarNotFound
+	}
+	return c, err
+}
+
+// CreateServiceCalendar creates a ServiceCalendar.
+func (ss *ScheduleService) CreateServiceCalendar(calendar *shuttletracker.ServiceCalendar) error {
+	statement := "INSERT INTO service_calendars (name, description, start_date, end_date)" +
+		" VALUES ($1, $2, $3, $4) RETURNING id, created, updated;"
+	row := ss.db.QueryRow(statement, calendar.Name, calendar.Description, valueDate(calendar.StartDate), valueDate(calendar.EndDate))
+	return row.Scan(&calendar.ID, &calendar.Created, &calendar.Updated)
+}
+
+// ModifyServiceCalendar modifies an existing ServiceCalendar. Exceptions that apply
+// during it move with its dates.
+func (ss *ScheduleService) ModifyServiceCalendar(calendar *shuttletracker.ServiceCalendar) error {
+	statement := "UPDATE service_calendars SET name = $1, description = $2, start_date = $3, end_date = $4," +
+		" updated = now() WHERE id = $5 RETURNING created, updated;"
+	row := ss.db.QueryRow(statement, calendar.Name, calendar.Description, valueDate(calendar.StartDate),
+		valueDate(calendar.EndDate), calendar.ID)
+	err := row.Scan(&calendar.Created, &calendar.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrServiceCalendarNotFound
+	}
+	return err
+}
+
+// DeleteServiceCalendar deletes a ServiceCalendar that no ScheduleExceptions apply
+// during.
+func (ss *ScheduleService) DeleteServiceCalendar(id int64) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	var inUse bool
+	err = tx.QueryRow("SELECT exists(SELECT 1 FROM schedule_exceptions WHERE calendar_id = $1);", id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return shuttletracker.ErrServiceCalendarInUse
+	}
+
+	result, err := tx.Exec("DELETE FROM service_calendars WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrServiceCalendarNotFound
+	}
+	return tx.Commit()
+}
+
+const selectScheduleExceptionsQuery = "SELECT e.id, e.route_id, e.calendar_id," +
+	" coalesce(c.start_date, e.start_date), coalesce(c.end_date, e.end_date)," +
+	" e.kind, e.description, e.created, e.updated" +
+	" FROM schedule_exceptions e LEFT JOIN service_calendars c ON c.id = e.calendar_id"
+
+// selectScheduleExceptions returns ScheduleExceptions with their schedules. Those
+// that apply during a ServiceCalendar have its dates. The query's conditions, if
+// any, can use the alias "e" for schedule_exceptions.
+func selectScheduleExceptions(q queryer, where string, args ...interface{}) ([]*shuttletracker.ScheduleException, error) {
+	exceptions := []*shuttletracker.ScheduleException{}
+	idsToException := map[int64]*shuttletracker.ScheduleException{}
+
+	rows, err := q.Query(selectScheduleExceptionsQuery+" "+where+" ORDER BY e.id;", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := &shuttletracker.ScheduleException{Schedule: shuttletracker.RouteSchedule{}}
+		var routeID, calendarID sql.NullInt64
+		err = rows.Scan(&e.ID, &routeID, &calendarID, scanDate{&e.StartDate}, scanDate{&e.EndDate},
+			&e.Kind, &e.Description, &e.Created, &e.Updated)
+		if err != nil {
+			return nil, err
+		}
+		if routeID.Valid {
+			e.RouteID = &routeID.Int64
+		}
+		if calendarID.Valid {
+			e.CalendarID = &calendarID.Int64
+		}
+		exceptions = append(exceptions, e)
+		idsToException[e.ID] = e
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	if len(exceptions) == 0 {
+		return exceptions, nil
+	}
+
+	query := "SELECT exception_id, id, start_day, start_time, end_day, end_time" +
+		" FROM schedule_exception_intervals ORDER BY id;"
+	rows, err = q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var exceptionID int64
+		interval := shuttletracker.RouteActiveInterval{}
+		err = rows.Scan(&exceptionID, &interval.ID, &interval.StartDay, &interval.StartTime, &interval.EndDay, &interval.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		e, ok := idsToException[exceptionID]
+		if !ok {
+			continue
+		}
+		if e.RouteID != nil {
+			interval.RouteID = *e.RouteID
+		}
+		e.Schedule = append(e.Schedule, interval)
+	}
+	return exceptions, rows.Err()
+}
+
+// ScheduleExceptions returns all ScheduleExceptions.
+func (ss *ScheduleService) ScheduleExceptions() ([]*shuttletracker.ScheduleException, error) {
+	return selectScheduleExceptions(ss.db, "")
+}
+
+// ScheduleException returns a ScheduleException by its ID.
+func (ss *ScheduleService) ScheduleException(id int64) (*shuttletracker.ScheduleException, error) {
+	exceptions, err := selectScheduleExceptions(ss.db, "WHERE e.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(exceptions) == 0 {
+		return nil, shuttletracker.ErrScheduleExceptionNotFound
+	}
+	return exceptions[0], nil
+}
+
+// CreateScheduleException creates a ScheduleException along with its schedule.
+func (ss *ScheduleService) CreateScheduleException(exception *shuttletracker.ScheduleException) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "INSERT INTO schedule_exceptions (route_id, calendar_id, start_date, end_date, kind, description)" +
+		" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created, updated;"
+	start, end := exceptionDates(exception)
+	row := tx.QueryRow(statement, exception.RouteID, exception.CalendarID, start, end, exception.Kind, exception.Description)
+	err = row.Scan(&exception.ID, &exception.Created, &exception.Updated)
+	if err != nil {
+		return err
+	}
+	err = insertExceptionSchedule(tx, exception)
+	if err != nil {
+		return err
+	}
+	err = exceptionCalendarDates(tx, exception)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ModifyScheduleException modifies an existing ScheduleException, replacing its
+// schedule.
+func (ss *ScheduleService) ModifyScheduleException(exception *shuttletracker.ScheduleException) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	statement := "UPDATE schedule_exceptions SET route_id = $1, calendar_id = $2, start_date = $3, end_date = $4," +
+		" kind = $5, description = $6, updated = now() WHERE id = $7 RETURNING created, updated;"
+	start, end := exceptionDates(exception)
+	row := tx.QueryRow(statement, exception.RouteID, exception.CalendarID, start, end, exception.Kind,
+		exception.Description, exception.ID)
+	err = row.Scan(&exception.Created, &exception.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrScheduleExceptionNotFound
+	} else if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM schedule_exception_intervals WHERE exception_id = $1;", exception.ID)
+	if err != nil {
+		return err
+	}
+	err = insertExceptionSchedule(tx, exception)
+	if err != nil {
+		return err
+	}
+	err = exceptionCalendarDates(tx, exception)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// exceptionDates returns the dates to store for a ScheduleException. Ones that apply
+// during a ServiceCalendar use its dates instead.
+func exceptionDates(exception *shuttletracker.ScheduleException) (interface{}, interface{}) {
+	if exception.CalendarID != nil {
+		return nil, nil
+	}
+	return valueDate(exception.StartDate), valueDate(exception.EndDate)
+}
+
+// exceptionCalendarDates sets the dates of a ScheduleException that applies during a
+// ServiceCalendar to the calendar's.
+func exceptionCalendarDates(tx *sql.Tx, exception *shuttletracker.ScheduleException) error {
+	if exception.CalendarID == nil {
+		return nil
+	}
+	row := tx.QueryRow("SELECT start_date, end_date FROM service_calendars WHERE id = $1;", *exception.CalendarID)
+	err := row.Scan(scanDate{&exception.StartDate}, scanDate{&exception.EndDate})
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrServiceCalendarNotFound
+	}
+	return err
+}
+
+func insertExceptionSchedule(tx *sql.Tx, exception *shuttletracker.ScheduleException) error {
+	for i := range exception.Schedule {
+		interval := &exception.Schedule[i]
+		statement := "INSERT INTO schedule_exception_intervals (exception_id, start_day, start_time, end_day, end_time)" +
+			" VALUES ($1, $2, $3, $4, $5) RETURNING id;"
+		interval.StartTime = shuttletracker.Clock(interval.StartTime)
+		interval.EndTime = shuttletracker.Clock(interval.EndTime)
+		row := tx.QueryRow(statement, exception.ID, interval.StartDay, valueClock(interval.StartTime),
+			interval.EndDay, valueClock(interval.EndTime))
+		err := row.Scan(&interval.ID)
+		if err != nil {
+			return err
+		}
+		interval.RouteID = 0
+		if exception.RouteID != nil {
+			interval.RouteID = *exception.RouteID
+		}
+	}
+	return nil
+}
+
+// DeleteScheduleException deletes a ScheduleException.
+func (ss *ScheduleService) DeleteScheduleException(id int64) error {
+	result, err := ss.db.Exec("DELETE FROM schedule_exceptions WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrScheduleExceptionNotFound
+	}
+	return nil
+}
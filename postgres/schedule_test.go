@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestScheduleExceptions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	route := &shuttletracker.Route{Name: "Test Route", Schedule: shuttletracker.RouteSchedule{}}
+	err := pg.CreateRoute(route, "")
+	if err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	today := shuttletracker.DateOf(time.Now())
+	calendar := &shuttletracker.ServiceCalendar{Name: "Finals week", StartDate: today.AddDays(-1), EndDate: today.AddDays(1)}
+	err = pg.CreateServiceCalendar(calendar)
+	if err != nil {
+		t.Fatalf("unable to create ServiceCalendar: %s", err)
+	}
+
+	exception := &shuttletracker.ScheduleException{
+		RouteID:    &route.ID,
+		CalendarID: &calendar.ID,
+		Kind:       shuttletracker.ExceptionSuspend,
+		Schedule:   shuttletracker.RouteSchedule{},
+	}
+	err = pg.CreateScheduleException(exception)
+	if err != nil {
+		t.Fatalf("unable to create ScheduleException: %s", err)
+	}
+	if exception.StartDate != calendar.StartDate || exception.EndDate != calendar.EndDate {
+		t.Errorf("got dates %s to %s, expected the calendar's", exception.StartDate, exception.EndDate)
+	}
+
+	route, err = pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if route.Active {
+		t.Error("suspended route is active")
+	}
+
+	err = pg.DeleteServiceCalendar(calendar.ID)
+	if err != shuttletracker.ErrServiceCalendarInUse {
+		t.Errorf("got error %v deleting calendar, expected ErrServiceCalendarInUse", err)
+	}
+
+	// Replace the schedule with one that runs all week.
+	exception.Kind = shuttletracker.ExceptionReplace
+	exception.Schedule = shuttletracker.RouteSchedule{{
+		StartDay:  time.Sunday,
+		StartTime: time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDay:    time.Saturday,
+		EndTime:   time.Date(0, 1, 1, 23, 59, 59, 0, time.UTC),
+	}}
+	err = pg.ModifyScheduleException(exception)
+	if err != nil {
+		t.Fatalf("unable to modify ScheduleException: %s", err)
+	}
+	exception, err = pg.ScheduleException(exception.ID)
+	if err != nil {
+		t.Fatalf("unable to get ScheduleException: %s", err)
+	}
+	if len(exception.Schedule) != 1 || exception.Schedule[0].RouteID != route.ID {
+		t.Errorf("got schedule %+v, expected one interval", exception.Schedule)
+	}
+	routes, err := pg.Routes()
+	if err != nil {
+		t.Fatalf("unable to get Routes: %s", err)
+	}
+	if len(routes) != 1 || !routes[0].Active {
+		t.Error("route is not active")
+	}
+
+	err = pg.DeleteScheduleException(exception.ID)
+	if err != nil {
+		t.Fatalf("unable to delete ScheduleException: %s", err)
+	}
+	err = pg.DeleteScheduleException(exception.ID)
+	if err != shuttletracker.ErrScheduleExceptionNotFound {
+		t.Errorf("got error %v, expected ErrScheduleExceptionNotFound", err)
+	}
+	err = pg.DeleteServiceCalendar(calendar.ID)
+	if err != nil {
+		t.Errorf("unable to delete ServiceCalendar: %s", err)
+	}
+}
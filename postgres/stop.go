@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 
 	"github.com/wtg/shuttletracker"
 )
@@ -27,18 +28,47 @@ CREATE TABLE IF NOT EXISTS stops (
 	return err
 }
 
-// CreateStop creates a Stop.
-func (ss *StopService) CreateStop(stop *shuttletracker.Stop) error {
-	statement := "INSERT INTO stops (name, description, latitude, longitude) VALUES" +
-		" ($1, $2, $3, $4) RETURNING id, created, updated;"
-	row := ss.db.QueryRow(statement, stop.Name, stop.Description, stop.Latitude, stop.Longitude)
-	return row.Scan(&stop.ID, &stop.Created, &stop.Updated)
+// CreateStop creates a Stop. username is recorded in its first revision.
+func (ss *StopService) CreateStop(stop *shuttletracker.Stop, username string) error {
+	return ss.createStop(stop, false, username)
+}
+
+// CreateStopWithID creates a Stop with the ID that it already has.
+func (ss *StopService) CreateStopWithID(stop *shuttletracker.Stop, username string) error {
+	return ss.createStop(stop, true, username)
 }
 
-func (ss *StopService) CreateStopWithID(stop *shuttletracker.Stop) error {
-	statement := "INSERT INTO stops (id, name, description, latitude, longitude) VALUES" +
-		" ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
-	row := ss.db.QueryRow(statement, stop.ID, stop.Name, stop.Description, stop.Latitude, stop.Longitude)
+func (ss *StopService) createStop(stop *shuttletracker.Stop, withID bool, username string) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	err = insertStop(tx, stop, withID)
+	if err != nil {
+		return err
+	}
+	err = recordRevision(tx, shuttletracker.RevisionKindStop, stop.ID, shuttletracker.RevisionActionCreate, username, stop)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertStop(tx *sql.Tx, stop *shuttletracker.Stop, withID bool) error {
+	var row *sql.Row
+	if withID {
+		statement := "INSERT INTO stops (id, name, description, latitude, longitude) VALUES" +
+			" ($1, $2, $3, $4, $5) RETURNING id, created, updated;"
+		row = tx.QueryRow(statement, stop.ID, stop.Name, stop.Description, stop.Latitude, stop.Longitude)
+	} else {
+		statement := "INSERT INTO stops (name, description, latitude, longitude) VALUES" +
+			" ($1, $2, $3, $4) RETURNING id, created, updated;"
+		row = tx.QueryRow(statement, stop.Name, stop.Description, stop.Latitude, stop.Longitude)
+	}
 	return row.Scan(&stop.ID, &stop.Created, &stop.Updated)
 }
 
@@ -59,6 +89,22 @@ func (ss *StopService) Stop(id int64) (*shuttletracker.Stop, error) {
 	return s, err
 }
 
+// selectStopForUpdate returns a Stop and locks it until the transaction ends, so
+// that it can't be added to a Route in the meantime.
+func selectStopForUpdate(tx *sql.Tx, id int64) (*shuttletracker.Stop, error) {
+	s := &shuttletracker.Stop{
+		ID: id,
+	}
+	statement := "SELECT s.name, s.created, s.updated, s.description, s.latitude, s.longitude" +
+		" FROM stops s WHERE id = $1 FOR UPDATE;"
+	row := tx.QueryRow(statement, id)
+	err := row.Scan(&s.Name, &s.Created, &s.Updated, &s.Description, &s.Latitude, &s.Longitude)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrStopNotFound
+	}
+	return s, err
+}
+
 // Stops returns all Stops.
 func (ss *StopService) Stops() ([]*shuttletracker.Stop, error) {
 	stops := []*shuttletracker.Stop{}
@@ -79,21 +125,165 @@ func (ss *StopService) Stops() ([]*shuttletracker.Stop, error) {
 	return stops, nil
 }
 
-// DeleteStop deletes a Stop.
-func (ss *StopService) DeleteStop(id int64) error {
-	statement := "DELETE FROM stops WHERE id = $1;"
-	result, err := ss.db.Exec(statement, id)
+// ModifyStop modifies an existing Stop's name, description, and location. username
+// is recorded in the Stop's new revision.
+func (ss *StopService) ModifyStop(stop *shuttletracker.Stop, username string) error {
+	tx, err := ss.db.Begin()
 	if err != nil {
 		return err
 	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
 
-	n, err := result.RowsAffected()
+	err = updateStop(tx, stop)
 	if err != nil {
 		return err
 	}
-	if n == 0 {
-		return shuttletracker.ErrStopNotFound
+	err = recordRevision(tx, shuttletracker.RevisionKindStop, stop.ID, shuttletracker.RevisionActionModify, username, stop)
+	if err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
+// modifyStops updates Stops and records their revisions.
+func modifyStops(tx *sql.Tx, stops []*shuttletracker.Stop, username string) error {
+	for _, stop := range stops {
+		err := updateStop(tx, stop)
+		if err != nil {
+			return err
+		}
+		err = recordRevision(tx, shuttletracker.RevisionKindStop, stop.ID, shuttletracker.RevisionActionModify, username, stop)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func updateStop(tx *sql.Tx, stop *shuttletracker.Stop) error {
+	statement := "UPDATE stops SET name = $1, description = $2, latitude = $3, longitude = $4, updated = now()" +
+		" WHERE id = $5 RETURNING created, updated;"
+	row := tx.QueryRow(statement, stop.Name, stop.Description, stop.Latitude, stop.Longitude, stop.ID)
+	err := row.Scan(&stop.Created, &stop.Updated)
+	if err == sql.ErrNoRows {
+		return shuttletracker.ErrStopNotFound
+	}
+	return err
+}
+
+// DeleteStop deletes a Stop. Routes that stop at it either prevent the deletion or,
+// if detach is true, have it removed from their stops in the same transaction.
+// username is recorded in the revisions of the Stop and any Routes it's removed from.
+func (ss *StopService) DeleteStop(id int64, detach bool, username string) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	stop, err := selectStopForUpdate(tx, id)
+	if err != nil {
+		return err
+	}
+
+	routeIDs := []int64{}
+	statement := "SELECT DISTINCT route_id FROM routes_stops WHERE stop_id = $1 ORDER BY route_id;"
+	rows, err := tx.Query(statement, id)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var routeID int64
+		err = rows.Scan(&routeID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		routeIDs = append(routeIDs, routeID)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	if len(routeIDs) > 0 && !detach {
+		return &shuttletracker.StopInUseError{RouteIDs: routeIDs}
+	}
+	for _, routeID := range routeIDs {
+		err = detachStop(tx, routeID, id, username)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM stops WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	err = recordRevision(tx, shuttletracker.RevisionKindStop, id, shuttletracker.RevisionActionDelete, username, stop)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// detachStop removes a Stop from a Route's stops and records the Route's new revision.
+func detachStop(tx *sql.Tx, routeID, stopID int64, username string) error {
+	_, err := tx.Exec("DELETE FROM routes_stops WHERE route_id = $1 AND stop_id = $2;", routeID, stopID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE routes SET updated = now() WHERE id = $1;", routeID)
+	if err != nil {
+		return err
+	}
+	route, err := selectRoute(tx, routeID)
+	if err != nil {
+		return err
+	}
+	return recordRevision(tx, shuttletracker.RevisionKindRoute, routeID, shuttletracker.RevisionActionModify, username, route)
+}
+
+// RestoreStop sets a Stop back to how it was in a revision, recreating it if it was
+// deleted. username is recorded in the Stop's new revision.
+func (ss *StopService) RestoreStop(revisionID int64, username string) (*shuttletracker.Stop, error) {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// We can't really do anything if rolling back a transaction fails.
+	// nolint: errcheck
+	defer tx.Rollback()
+
+	revision, err := selectRevision(tx, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if revision.Kind != shuttletracker.RevisionKindStop {
+		return nil, shuttletracker.ErrRevisionNotFound
+	}
+	stop := &shuttletracker.Stop{}
+	err = json.Unmarshal(revision.Data, stop)
+	if err != nil {
+		return nil, err
+	}
+	stop.ID = revision.TargetID
+
+	err = updateStop(tx, stop)
+	if err == shuttletracker.ErrStopNotFound {
+		err = insertStop(tx, stop, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordRevision(tx, shuttletracker.RevisionKindStop, stop.ID, shuttletracker.RevisionActionRestore, username, stop)
+	if err != nil {
+		return nil, err
+	}
+	return stop, tx.Commit()
+}
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/wtg/shuttletracker"
+)
+
+func TestModifyStop(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	name := "Union"
+	stop := &shuttletracker.Stop{Name: &name, Latitude: 42.73, Longitude: -73.68}
+	err := pg.CreateStop(stop, "")
+	if err != nil {
+		t.Fatalf("unable to create Stop: %s", err)
+	}
+
+	newName := "Student Union"
+	stop.Name = &newName
+	stop.Latitude = 42.74
+	err = pg.ModifyStop(stop, "")
+	if err != nil {
+		t.Fatalf("unable to modify Stop: %s", err)
+	}
+	stop, err = pg.Stop(stop.ID)
+	if err != nil {
+		t.Fatalf("unable to get Stop: %s", err)
+	}
+	if stop.Name == nil || *stop.Name != newName || stop.Latitude != 42.74 {
+		t.Errorf("unexpected Stop %+v", stop)
+	}
+
+	stop.ID++
+	err = pg.ModifyStop(stop, "")
+	if err != shuttletracker.ErrStopNotFound {
+		t.Errorf("got error %v, expected %v", err, shuttletracker.ErrStopNotFound)
+	}
+}
+
+// nolint: gocyclo
+func TestDeleteStopInUse(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	stops := []*shuttletracker.Stop{{Latitude: 42.73, Longitude: -73.68}, {Latitude: 42.74, Longitude: -73.67}}
+	for _, stop := range stops {
+		err := pg.CreateStop(stop, "")
+		if err != nil {
+			t.Fatalf("unable to create Stop: %s", err)
+		}
+	}
+	route := &shuttletracker.Route{
+		Name:     "Test Route",
+		StopIDs:  []int64{stops[0].ID, stops[1].ID},
+		Schedule: shuttletracker.RouteSchedule{},
+	}
+	err := pg.CreateRoute(route, "")
+	if err != nil {
+		t.Fatalf("unable to create Route: %s", err)
+	}
+
+	err = pg.DeleteStop(stops[0].ID, false, "")
+	inUse, ok := err.(*shuttletracker.StopInUseError)
+	if !ok {
+		t.Fatalf("got error %v, expected a StopInUseError", err)
+	}
+	if len(inUse.RouteIDs) != 1 || inUse.RouteIDs[0] != route.ID {
+		t.Errorf("got route IDs %v, expected [%d]", inUse.RouteIDs, route.ID)
+	}
+	_, err = pg.Stop(stops[0].ID)
+	if err != nil {
+		t.Errorf("unable to get Stop that should not have been deleted: %s", err)
+	}
+
+	err = pg.DeleteStop(stops[0].ID, true, "")
+	if err != nil {
+		t.Fatalf("unable to delete Stop: %s", err)
+	}
+	_, err = pg.Stop(stops[0].ID)
+	if err != shuttletracker.ErrStopNotFound {
+		t.Errorf("got error %v, expected %v", err, shuttletracker.ErrStopNotFound)
+	}
+	modified, err := pg.Route(route.ID)
+	if err != nil {
+		t.Fatalf("unable to get Route: %s", err)
+	}
+	if len(modified.StopIDs) != 1 || modified.StopIDs[0] != stops[1].ID {
+		t.Errorf("got stop IDs %v, expected [%d]", modified.StopIDs, stops[1].ID)
+	}
+	if !modified.Updated.After(route.Updated) {
+		t.Error("route was not marked as updated")
+	}
+
+	err = pg.DeleteStop(stops[0].ID, true, "")
+	if err != shuttletracker.ErrStopNotFound {
+		t.Errorf("got error %v, expected %v", err, shuttletracker.ErrStopNotFound)
+	}
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// APITokenService is an implementation of shuttletracker.APITokenService.
+type APITokenService struct {
+	db *sql.DB
+}
+
+func (ats *APITokenService) initializeSchema(db *sql.DB) error {
+	ats.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id serial PRIMARY KEY,
+	name text NOT NULL,
+	username text NOT NULL REFERENCES users (username) ON DELETE CASCADE ON UPDATE CASCADE,
+	scopes text[] NOT NULL DEFAULT '{}',
+	hash bytea UNIQUE NOT NULL,
+	prefix text NOT NULL,
+	created timestamp with time zone NOT NULL DEFAULT now(),
+	expires timestamp with time zone NOT NULL,
+	last_used timestamp with time zone
+);
+ALTER TABLE api_tokens ALTER COLUMN username TYPE text;`
+	_, err := ats.db.Exec(schema)
+	return err
+}
+
+const apiTokenColumns = "id, name, username, scopes, prefix, created, expires, last_used"
+
+func scanAPIToken(row interface {
+	Scan(dest ...interface{}) error
+}) (*shuttletracker.APIToken, error) {
+	t := &shuttletracker.APIToken{}
+	var lastUsed pq.NullTime
+	err := row.Scan(&t.ID, &t.Name, &t.Username, pq.Array(&t.Scopes), &t.Prefix, &t.Created, &t.Expires, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		t.LastUsed = &lastUsed.Time
+	}
+	return t, nil
+}
+
+// CreateAPIToken stores an APIToken along with the hash of its secret.
+func (ats *APITokenService) CreateAPIToken(token *shuttletracker.APIToken, hash []byte) error {
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+	statement := "INSERT INTO api_tokens (name, username, scopes, hash, prefix, expires)" +
+		" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created;"
+	row := ats.db.QueryRow(statement, token.Name, token.Username, pq.Array(token.Scopes), hash, token.Prefix, token.Expires)
+	return row.Scan(&token.ID, &token.Created)
+}
+
+// APIToken returns an APIToken by its ID.
+func (ats *APITokenService) APIToken(id int64) (*shuttletracker.APIToken, error) {
+	row := ats.db.QueryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = $1;", id)
+	t, err := scanAPIToken(row)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrAPITokenNotFound
+	}
+	return t, err
+}
+
+// APITokenWithHash returns the APIToken whose secret has a hash.
+func (ats *APITokenService) APITokenWithHash(hash []byte) (*shuttletracker.APIToken, error) {
+	row := ats.db.QueryRow("SELECT "+apiTokenColumns+" FROM api_tokens WHERE hash = $1;", hash)
+	t, err := scanAPIToken(row)
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrAPITokenNotFound
+	}
+	return t, err
+}
+
+// APITokens returns a User's APITokens, or everyone's if username is empty.
+func (ats *APITokenService) APITokens(username string) ([]*shuttletracker.APIToken, error) {
+	rows, err := ats.db.Query("SELECT "+apiTokenColumns+" FROM api_tokens"+
+		" WHERE $1 = '' OR username = $1 ORDER BY id;", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*shuttletracker.APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken deletes an APIToken, so it can't be used anymore.
+func (ats *APITokenService) DeleteAPIToken(id int64) error {
+	result, err := ats.db.Exec("DELETE FROM api_tokens WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// TouchAPIToken records when an APIToken was last used.
+func (ats *APITokenService) TouchAPIToken(id int64, used time.Time) error {
+	_, err := ats.db.Exec("UPDATE api_tokens SET last_used = $2 WHERE id = $1;", id, used)
+	return err
+}
@@ -0,0 +1,108 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestAPITokens(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	err := pg.CreateUser(&shuttletracker.User{Username: "dispatch"})
+	if err != nil {
+		t.Fatalf("unable to create User: %s", err)
+	}
+	token := &shuttletracker.APIToken{
+		Name:     "console",
+		Username: "dispatch",
+		Scopes:   []string{shuttletracker.ScopeMessages},
+		Prefix:   "st_abcde",
+		Expires:  time.Now().Add(time.Hour),
+	}
+	err = pg.CreateAPIToken(token, []byte("hash"))
+	if err != nil {
+		t.Fatalf("unable to create APIToken: %s", err)
+	}
+
+	found, err := pg.APITokenWithHash([]byte("hash"))
+	if err != nil {
+		t.Fatalf("unable to get APIToken: %s", err)
+	}
+	if found.ID != token.ID || !found.HasScope(shuttletracker.ScopeMessages) || found.LastUsed != nil {
+		t.Errorf("got %+v, expected %+v", found, token)
+	}
+	_, err = pg.APITokenWithHash([]byte("other"))
+	if err != shuttletracker.ErrAPITokenNotFound {
+		t.Errorf("got error %v, expected %s", err, shuttletracker.ErrAPITokenNotFound)
+	}
+
+	used := time.Now().Truncate(time.Second)
+	err = pg.TouchAPIToken(token.ID, used)
+	if err != nil {
+		t.Fatalf("unable to touch APIToken: %s", err)
+	}
+	found, err = pg.APIToken(token.ID)
+	if err != nil {
+		t.Fatalf("unable to get APIToken: %s", err)
+	}
+	if found.LastUsed == nil || !found.LastUsed.Equal(used) {
+		t.Errorf("got last used %v, expected %v", found.LastUsed, used)
+	}
+
+	// removing the user revokes their tokens
+	err = pg.DeleteUser("dispatch")
+	if err != nil {
+		t.Fatalf("unable to delete User: %s", err)
+	}
+	tokens, err := pg.APITokens("")
+	if err != nil {
+		t.Fatalf("unable to get APITokens: %s", err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("got %d tokens, expected 0", len(tokens))
+	}
+	err = pg.DeleteAPIToken(token.ID)
+	if err != shuttletracker.ErrAPITokenNotFound {
+		t.Errorf("got error %v, expected %s", err, shuttletracker.ErrAPITokenNotFound)
+	}
+}
+
+func TestAPITokensLongUsername(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	// OIDC usernames are often email addresses
+	const username = "transportation.dispatcher@example.edu"
+	err := pg.CreateUser(&shuttletracker.User{Username: username})
+	if err != nil {
+		t.Fatalf("unable to create User: %s", err)
+	}
+	token := &shuttletracker.APIToken{
+		Name:     "console",
+		Username: username,
+		Scopes:   []string{shuttletracker.ScopeRead},
+		Prefix:   "st_abcde",
+		Expires:  time.Now().Add(time.Hour),
+	}
+	err = pg.CreateAPIToken(token, []byte("hash"))
+	if err != nil {
+		t.Fatalf("unable to create APIToken: %s", err)
+	}
+	tokens, err := pg.APITokens(username)
+	if err != nil {
+		t.Fatalf("unable to get APITokens: %s", err)
+	}
+	if len(tokens) != 1 || tokens[0].Username != username {
+		t.Errorf("got %+v, expected the token for %s", tokens, username)
+	}
+}
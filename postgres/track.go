@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// TrackService implements shuttletracker.TrackService.
+type TrackService struct {
+	db *sql.DB
+}
+
+func (ts *TrackService) initializeSchema(db *sql.DB) error {
+	ts.db = db
+	schema := `
+CREATE TABLE IF NOT EXISTS track_positions (
+	id serial PRIMARY KEY,
+	track varchar(36) NOT NULL,
+	latitude double precision NOT NULL,
+	longitude double precision NOT NULL,
+	speed real,
+	heading real,
+	time timestamp with time zone NOT NULL
+);
+CREATE INDEX IF NOT EXISTS track_positions_time_idx ON track_positions (time);
+	`
+	_, err := ts.db.Exec(schema)
+	return err
+}
+
+// CreateTrackPosition creates a TrackPosition.
+func (ts *TrackService) CreateTrackPosition(p *shuttletracker.TrackPosition) error {
+	statement := "INSERT INTO track_positions (track, latitude, longitude, speed, heading, time) " +
+		"VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;"
+	row := ts.db.QueryRow(statement, p.Track, p.Latitude, p.Longitude, p.Speed, p.Heading, p.Time)
+	return row.Scan(&p.ID)
+}
+
+// TrackPositionsSince returns all TrackPositions since a time, ordered by track and then oldest to newest.
+func (ts *TrackService) TrackPositionsSince(since time.Time) ([]*shuttletracker.TrackPosition, error) {
+	positions := []*shuttletracker.TrackPosition{}
+	query := "SELECT id, track, latitude, longitude, speed, heading, time FROM track_positions " +
+		"WHERE time > $1 ORDER BY track, time;"
+	rows, err := ts.db.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		p := &shuttletracker.TrackPosition{}
+		err := rows.Scan(&p.ID, &p.Track, &p.Latitude, &p.Longitude, &p.Speed, &p.Heading, &p.Time)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, p)
+	}
+	return positions, nil
+}
+
+// DeleteTrackPositionsBefore deletes all TrackPositions from before a time.
+func (ts *TrackService) DeleteTrackPositionsBefore(before time.Time) (int, error) {
+	statement := "DELETE FROM track_positions WHERE time < $1;"
+	res, err := ts.db.Exec(statement, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wtg/shuttletracker"
+)
+
+// nolint: gocyclo
+func TestTrackPositions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	now := time.Now()
+	speed := 4.5
+	positions := []*shuttletracker.TrackPosition{
+		{Track: "b", Latitude: 1.1, Longitude: 1.2, Time: now.Add(-time.Minute)},
+		{Track: "a", Latitude: 1.3, Longitude: 1.4, Speed: &speed, Time: now.Add(-time.Minute)},
+		{Track: "a", Latitude: 1.5, Longitude: 1.6, Time: now.Add(-2 * time.Minute)},
+		{Track: "a", Latitude: 1.7, Longitude: 1.8, Time: now.Add(-time.Hour)},
+	}
+	for _, p := range positions {
+		err := pg.CreateTrackPosition(p)
+		if err != nil {
+			t.Fatalf("unable to create TrackPosition: %s", err)
+		}
+	}
+
+	actual, err := pg.TrackPositionsSince(now.Add(-10 * time.Minute))
+	if err != nil {
+		t.Fatalf("unable to get TrackPositions: %s", err)
+	}
+	if len(actual) != 3 {
+		t.Fatalf("got %d positions, expected 3", len(actual))
+	}
+	// ordered by track and then time
+	expected := []int64{positions[2].ID, positions[1].ID, positions[0].ID}
+	for i, p := range actual {
+		if p.ID != expected[i] {
+			t.Errorf("got position %d at index %d, expected %d", p.ID, i, expected[i])
+		}
+	}
+	if actual[1].Speed == nil || *actual[1].Speed != speed {
+		t.Errorf("speed was not stored")
+	}
+	if actual[0].Heading != nil {
+		t.Errorf("got heading %f, expected none", *actual[0].Heading)
+	}
+
+	deleted, err := pg.DeleteTrackPositionsBefore(now.Add(-10 * time.Minute))
+	if err != nil {
+		t.Fatalf("unable to delete TrackPositions: %s", err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted %d positions, expected 1", deleted)
+	}
+}
@@ -3,6 +3,8 @@ package postgres
 import (
 	"database/sql"
 
+	"github.com/lib/pq"
+
 	"github.com/wtg/shuttletracker"
 )
 
@@ -16,18 +18,35 @@ func (us *UserService) initializeSchema(db *sql.DB) error {
 	schema := `
 CREATE TABLE IF NOT EXISTS users (
 	id serial PRIMARY KEY,
-	username varchar(10) UNIQUE NOT NULL
+	username text UNIQUE NOT NULL,
+	permissions text[] NOT NULL DEFAULT '{}',
+	role text NOT NULL DEFAULT 'viewer'
 );
+-- usernames from OIDC providers can be longer than RCS IDs
+ALTER TABLE users ALTER COLUMN username TYPE text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS permissions text[] NOT NULL DEFAULT '{}';
+-- administrators from before roles could already change everything
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'owner';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash bytea;
 	`
 	_, err := us.db.Exec(schema)
 	return err
 }
 
-// CreateUser creates a User.
+// CreateUser creates a User. Users without a role are viewers.
 func (us *UserService) CreateUser(user *shuttletracker.User) error {
-	statement := "INSERT INTO users (username) " +
-		"VALUES ($1) RETURNING id;"
-	row := us.db.QueryRow(statement, user.Username)
+	if user.Permissions == nil {
+		user.Permissions = []string{}
+	}
+	if user.Role == "" {
+		user.Role = shuttletracker.RoleViewer
+	}
+	if !shuttletracker.ValidRole(user.Role) {
+		return shuttletracker.ErrInvalidRole
+	}
+	statement := "INSERT INTO users (username, role, permissions) " +
+		"VALUES ($1, $2, $3) RETURNING id;"
+	row := us.db.QueryRow(statement, user.Username, user.Role, pq.Array(user.Permissions))
 	err := row.Scan(&user.ID)
 	return err
 }
@@ -51,11 +70,23 @@ func (us *UserService) DeleteUser(username string) error {
 	return nil
 }
 
+// User returns a User by its username.
+func (us *UserService) User(username string) (*shuttletracker.User, error) {
+	user := &shuttletracker.User{}
+	statement := "SELECT id, username, role, permissions FROM users WHERE username = $1;"
+	row := us.db.QueryRow(statement, username)
+	err := row.Scan(&user.ID, &user.Username, &user.Role, pq.Array(&user.Permissions))
+	if err == sql.ErrNoRows {
+		return nil, shuttletracker.ErrUserNotFound
+	}
+	return user, err
+}
+
 // Users returns all existing Users..
 func (us *UserService) Users() ([]*shuttletracker.User, error) {
 	var users []*shuttletracker.User
 
-	statement := "SELECT id, username FROM users;"
+	statement := "SELECT id, username, role, permissions FROM users ORDER BY username;"
 	rows, err := us.db.Query(statement)
 	if err != nil {
 		return users, err
@@ -63,7 +94,7 @@ func (us *UserService) Users() ([]*shuttletracker.User, error) {
 
 	for rows.Next() {
 		user := &shuttletracker.User{}
-		err := rows.Scan(&user.ID, &user.Username)
+		err := rows.Scan(&user.ID, &user.Username, &user.Role, pq.Array(&user.Permissions))
 		if err != nil {
 			return users, err
 		}
@@ -84,3 +115,74 @@ func (us *UserService) UserExists(username string) (bool, error) {
 	}
 	return true, nil
 }
+
+// GrantPermission gives a User a permission. Granting a permission the User already
+// has does nothing.
+func (us *UserService) GrantPermission(username string, permission string) error {
+	if !shuttletracker.ValidPermission(permission) {
+		return shuttletracker.ErrInvalidPermission
+	}
+	statement := "UPDATE users SET permissions = array_append(array_remove(permissions, $2::text), $2::text) " +
+		"WHERE username = $1;"
+	return us.updateUser(statement, username, permission)
+}
+
+// RevokePermission takes a permission away from a User.
+func (us *UserService) RevokePermission(username string, permission string) error {
+	statement := "UPDATE users SET permissions = array_remove(permissions, $2::text) WHERE username = $1;"
+	return us.updateUser(statement, username, permission)
+}
+
+// SetRole changes a User's role.
+func (us *UserService) SetRole(username string, role string) error {
+	if !shuttletracker.ValidRole(role) {
+		return shuttletracker.ErrInvalidRole
+	}
+	statement := "UPDATE users SET role = $2 WHERE username = $1;"
+	return us.updateUser(statement, username, role)
+}
+
+// PasswordHash returns the hash of a User's password, or nil if the User doesn't
+// exist or has no password.
+func (us *UserService) PasswordHash(username string) ([]byte, error) {
+	var hash []byte
+	row := us.db.QueryRow("SELECT password_hash FROM users WHERE username = $1;", username)
+	err := row.Scan(&hash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return hash, err
+}
+
+// SetPasswordHash sets the hash of a User's password.
+func (us *UserService) SetPasswordHash(username string, hash []byte) error {
+	result, err := us.db.Exec("UPDATE users SET password_hash = $2 WHERE username = $1;", username, hash)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrUserNotFound
+	}
+	return nil
+}
+
+func (us *UserService) updateUser(statement string, username string, value string) error {
+	result, err := us.db.Exec(statement, username, value)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return shuttletracker.ErrUserNotFound
+	}
+
+	return nil
+}
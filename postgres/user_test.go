@@ -122,3 +122,150 @@ func TestUsers(t *testing.T) {
 		t.Fatalf("not all users returned")
 	}
 }
+
+// nolint: gocyclo
+func TestPermissions(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	const username = "testuser"
+
+	err := pg.GrantPermission(username, shuttletracker.PermissionFusionRawExport)
+	if err != shuttletracker.ErrUserNotFound {
+		t.Errorf("got unexpected error: %s", err)
+	}
+
+	err = pg.CreateUser(&shuttletracker.User{Username: username, Role: shuttletracker.RoleOwner})
+	if err != nil {
+		t.Fatalf("unable to create User: %s", err)
+	}
+	user, err := pg.User(username)
+	if err != nil {
+		t.Fatalf("unable to get User: %s", err)
+	}
+	if len(user.Permissions) != 0 {
+		t.Errorf("got permissions %v for a new owner, expected none", user.Permissions)
+	}
+
+	err = pg.GrantPermission(username, "everything")
+	if err != shuttletracker.ErrInvalidPermission {
+		t.Errorf("got error %v, expected %v", err, shuttletracker.ErrInvalidPermission)
+	}
+
+	// granting twice shouldn't duplicate the permission
+	for i := 0; i < 2; i++ {
+		err = pg.GrantPermission(username, shuttletracker.PermissionFusionRawExport)
+		if err != nil {
+			t.Fatalf("unable to grant permission: %s", err)
+		}
+	}
+	user, err = pg.User(username)
+	if err != nil {
+		t.Fatalf("unable to get User: %s", err)
+	}
+	if len(user.Permissions) != 1 || !user.HasPermission(shuttletracker.PermissionFusionRawExport) {
+		t.Errorf("got permissions %v, expected only %s", user.Permissions, shuttletracker.PermissionFusionRawExport)
+	}
+
+	err = pg.RevokePermission(username, shuttletracker.PermissionFusionRawExport)
+	if err != nil {
+		t.Fatalf("unable to revoke permission: %s", err)
+	}
+	user, err = pg.User(username)
+	if err != nil {
+		t.Fatalf("unable to get User: %s", err)
+	}
+	if len(user.Permissions) != 0 {
+		t.Errorf("got permissions %v, expected none", user.Permissions)
+	}
+}
+
+// nolint: gocyclo
+func TestRoles(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	const username = "testuser"
+
+	err := pg.SetRole(username, shuttletracker.RoleEditor)
+	if err != shuttletracker.ErrUserNotFound {
+		t.Errorf("got unexpected error: %s", err)
+	}
+
+	err = pg.CreateUser(&shuttletracker.User{Username: username, Role: "janitor"})
+	if err != shuttletracker.ErrInvalidRole {
+		t.Errorf("got error %v, expected %s", err, shuttletracker.ErrInvalidRole)
+	}
+	err = pg.CreateUser(&shuttletracker.User{Username: username})
+	if err != nil {
+		t.Fatalf("unable to create User: %s", err)
+	}
+	user, err := pg.User(username)
+	if err != nil {
+		t.Fatalf("unable to get User: %s", err)
+	}
+	if user.Role != shuttletracker.RoleViewer {
+		t.Errorf("got role %q, expected %q", user.Role, shuttletracker.RoleViewer)
+	}
+
+	err = pg.SetRole(username, shuttletracker.RoleEditor)
+	if err != nil {
+		t.Fatalf("unable to set role: %s", err)
+	}
+	err = pg.SetRole(username, "janitor")
+	if err != shuttletracker.ErrInvalidRole {
+		t.Errorf("got error %v, expected %s", err, shuttletracker.ErrInvalidRole)
+	}
+	user, err = pg.User(username)
+	if err != nil {
+		t.Fatalf("unable to get User: %s", err)
+	}
+	if !user.HasRole(shuttletracker.RoleDispatcher) || !user.HasRole(shuttletracker.RoleEditor) || user.HasRole(shuttletracker.RoleOwner) {
+		t.Errorf("editor has the wrong roles")
+	}
+}
+
+func TestPasswordHash(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	pg := setUpPostgres(t)
+	defer tearDownPostgres(t)
+
+	const username = "testuser"
+
+	hash, err := pg.PasswordHash(username)
+	if err != nil || hash != nil {
+		t.Errorf("got %v and %v for a missing user, expected nil and nil", hash, err)
+	}
+	err = pg.SetPasswordHash(username, []byte("hash"))
+	if err != shuttletracker.ErrUserNotFound {
+		t.Errorf("got unexpected error: %s", err)
+	}
+
+	err = pg.CreateUser(&shuttletracker.User{Username: username})
+	if err != nil {
+		t.Fatalf("unable to create User: %s", err)
+	}
+	hash, err = pg.PasswordHash(username)
+	if err != nil || hash != nil {
+		t.Errorf("got %v and %v for a user without a password, expected nil and nil", hash, err)
+	}
+	err = pg.SetPasswordHash(username, []byte("hash"))
+	if err != nil {
+		t.Fatalf("unable to set password hash: %s", err)
+	}
+	hash, err = pg.PasswordHash(username)
+	if err != nil || string(hash) != "hash" {
+		t.Errorf("got %q and %v, expected \"hash\"", hash, err)
+	}
+}
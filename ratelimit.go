@@ -0,0 +1,15 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// RateLimitService keeps token buckets that limit how often clients can make requests.
+// Storing them somewhere shared lets several Shuttle Tracker instances enforce the
+// same limits.
+type RateLimitService interface {
+	// TakeRateLimitToken removes a token from key's bucket, which holds up to burst
+	// tokens and refills at rate tokens per second. If the bucket is empty, it returns
+	// false and how long until a token is available.
+	TakeRateLimitToken(key string, burst float64, rate float64, now time.Time) (bool, time.Duration, error)
+}
@@ -0,0 +1,46 @@
+package shuttletracker
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Kinds of things that have Revisions.
+const (
+	RevisionKindRoute = "route"
+	RevisionKindStop  = "stop"
+)
+
+// Actions that create Revisions.
+const (
+	RevisionActionCreate  = "create"
+	RevisionActionModify  = "modify"
+	RevisionActionDelete  = "delete"
+	RevisionActionRestore = "restore"
+)
+
+// Revision is a snapshot of a Route or Stop, taken every time one is created, modified,
+// deleted, or restored. Data is the Route or Stop as JSON after the change, or just
+// before it was deleted.
+type Revision struct {
+	ID       int64           `json:"id"`
+	Kind     string          `json:"kind"`
+	TargetID int64           `json:"target_id"`
+	Action   string          `json:"action"`
+	Username string          `json:"username"`
+	Created  time.Time       `json:"created"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// RevisionService is an interface for reading Revisions. They're written by
+// RouteService and StopService.
+type RevisionService interface {
+	Revision(id int64) (*Revision, error)
+
+	// Revisions returns every Revision of a Route or Stop, newest first.
+	Revisions(kind string, targetID int64) ([]*Revision, error)
+}
+
+// ErrRevisionNotFound indicates that a Revision is not in the service.
+var ErrRevisionNotFound = errors.New("Revision not found")
@@ -19,9 +19,23 @@ type Route struct {
 	Points      []Point       `json:"points"`
 	Active      bool          `json:"active"`
 	Schedule    RouteSchedule `json:"schedule"`
+	// Timezone is the IANA time zone, like "America/New_York", that the Route's
+	// schedule is in. It's configured rather than set for each Route.
+	Timezone string `json:"timezone"`
+	// EffectivePoints and EffectiveStopIDs are where the Route goes with its active
+	// Detours applied, and DetourIDs are those Detours. Points and StopIDs are always
+	// the Route's own. Routes from a RouteService don't have any of these, and
+	// they aren't saved.
+	EffectivePoints  []Point `json:"effective_points"`
+	EffectiveStopIDs []int64 `json:"effective_stop_ids"`
+	DetourIDs        []int64 `json:"detour_ids,omitempty"`
 }
 
-// RouteActiveInterval represents a time interval during which a Route is active.
+// RouteActiveInterval represents a time interval during which a Route is active. The
+// hour, minute, and second of StartTime and EndTime are the wall-clock time in the
+// Route's Timezone; their dates and locations don't matter. An interval that ends
+// before it starts wraps around the end of the week, e.g. from Saturday at 22:00 to
+// Sunday at 02:00.
 type RouteActiveInterval struct {
 	ID        int64        `json:"id"`
 	RouteID   int64        `json:"route_id"`
@@ -31,6 +45,20 @@ type RouteActiveInterval struct {
 	EndTime   time.Time    `json:"end_time"`
 }
 
+// Clock returns the wall-clock time t as the time of day on January 1st of year 0
+// in UTC, which is how schedules store it.
+func Clock(t time.Time) time.Time {
+	return time.Date(0, 1, 1, t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// Wraps reports whether an interval wraps around the end of the week.
+func (i RouteActiveInterval) Wraps() bool {
+	if i.EndDay != i.StartDay {
+		return i.EndDay < i.StartDay
+	}
+	return Clock(i.EndTime).Before(Clock(i.StartTime))
+}
+
 // RouteSchedule represents multiple time intervals during which a Route is active.
 type RouteSchedule []RouteActiveInterval
 
@@ -44,10 +72,24 @@ type Point struct {
 type RouteService interface {
 	Route(id int64) (*Route, error)
 	Routes() ([]*Route, error)
-	CreateRoute(route *Route) error
-	DeleteRoute(id int64) error
-	ModifyRoute(route *Route) error
+	// The username of whoever makes a change is recorded in the Route's Revisions.
+	CreateRoute(route *Route, username string) error
+	DeleteRoute(id int64, username string) error
+	ModifyRoute(route *Route, username string) error
+	// CreateRouteWithStops and ModifyRouteWithStops also modify stops, such as
+	// ones that were moved onto the Route, in the same transaction.
+	CreateRouteWithStops(route *Route, stops []*Stop, username string) error
+	ModifyRouteWithStops(route *Route, stops []*Stop, username string) error
+	RestoreRoute(revisionID int64, username string) (*Route, error)
+	// CreateRoutesAndStops creates Stops and then Routes in one transaction, so
+	// either all of them are created or none are. Each Route's StopIDs are set to
+	// the Stops in routeStops at the same index, which may be shared between Routes.
+	CreateRoutesAndStops(stops []*Stop, routes []*Route, routeStops [][]*Stop, username string) error
 }
 
 // ErrRouteNotFound indicates that a Route is not in the service.
 var ErrRouteNotFound = errors.New("Route not found")
+
+// ErrRouteModified indicates that a Route was modified after it was retrieved, so
+// modifying it again would lose those changes.
+var ErrRouteModified = errors.New("Route was modified by someone else")
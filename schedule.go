@@ -0,0 +1,278 @@
+package shuttletracker
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Date is a calendar date without a time or location.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf returns the date of t in t's location.
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{y, m, d}
+}
+
+// ParseDate parses a date like "2019-12-24".
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return Date{}, err
+	}
+	return DateOf(t), nil
+}
+
+func (d Date) String() string {
+	return d.In(time.UTC).Format("2006-01-02")
+}
+
+// In returns midnight at the start of d in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// IsZero reports whether d is the zero Date.
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// Before reports whether d comes before d2.
+func (d Date) Before(d2 Date) bool {
+	return d.In(time.UTC).Before(d2.In(time.UTC))
+}
+
+// Weekday returns the day of the week of d.
+func (d Date) Weekday() time.Weekday {
+	return d.In(time.UTC).Weekday()
+}
+
+// AddDays returns the date n days after d.
+func (d Date) AddDays(n int) Date {
+	return DateOf(d.In(time.UTC).AddDate(0, 0, n))
+}
+
+// MarshalJSON encodes d like "2019-12-24", or null if it's zero.
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a date like "2019-12-24" or null.
+func (d *Date) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*d = Date{}
+		return nil
+	}
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	*d, err = ParseDate(s)
+	return err
+}
+
+// ServiceCalendar is a named span of dates, like "Fall semester" or "Finals week",
+// that ScheduleExceptions can apply during.
+type ServiceCalendar struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	StartDate   Date      `json:"start_date"`
+	EndDate     Date      `json:"end_date"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+// Kinds of ScheduleException
+const (
+	// ExceptionSuspend means that a route doesn't run at all.
+	ExceptionSuspend = "suspend"
+	// ExceptionReplace means that a route runs on the exception's Schedule instead of
+	// its own.
+	ExceptionReplace = "replace"
+)
+
+// ScheduleException changes when a Route runs from StartDate through EndDate.
+type ScheduleException struct {
+	ID int64 `json:"id"`
+	// RouteID is the Route that the exception changes, or nil for all Routes.
+	RouteID *int64 `json:"route_id"`
+	// CalendarID is the ServiceCalendar that the exception applies during. If it's set,
+	// StartDate and EndDate are the calendar's.
+	CalendarID  *int64        `json:"calendar_id"`
+	StartDate   Date          `json:"start_date"`
+	EndDate     Date          `json:"end_date"`
+	Kind        string        `json:"kind"`
+	Schedule    RouteSchedule `json:"schedule"`
+	Description string        `json:"description"`
+	Created     time.Time     `json:"created"`
+	Updated     time.Time     `json:"updated"`
+}
+
+// Covers reports whether e applies to a Route on a date.
+func (e *ScheduleException) Covers(routeID int64, date Date) bool {
+	if e.RouteID != nil && *e.RouteID != routeID {
+		return false
+	}
+	return !date.Before(e.StartDate) && !e.EndDate.Before(date)
+}
+
+// ExceptionOn returns the ScheduleException that applies to a Route on a date, or nil
+// if it runs on its own schedule. When several cover the date, the one with the
+// shortest span wins, so a holiday can suspend a route during a semester that
+// replaces its schedule. After that, exceptions for the Route win over ones for all
+// Routes, and then newer ones win.
+func ExceptionOn(routeID int64, date Date, exceptions []*ScheduleException) *ScheduleException {
+	var found *ScheduleException
+	days := func(e *ScheduleException) time.Duration {
+		return e.EndDate.In(time.UTC).Sub(e.StartDate.In(time.UTC))
+	}
+	for _, e := range exceptions {
+		if !e.Covers(routeID, date) {
+			continue
+		}
+		if found == nil || days(e) < days(found) {
+			found = e
+			continue
+		}
+		if days(e) > days(found) {
+			continue
+		}
+		if (e.RouteID != nil) != (found.RouteID != nil) {
+			if e.RouteID != nil {
+				found = e
+			}
+		} else if e.ID > found.ID {
+			found = e
+		}
+	}
+	return found
+}
+
+// ScheduleOn returns the schedule that a Route runs on on a date, and the
+// ScheduleException responsible for it if there is one. A suspended Route has an
+// empty schedule.
+func (r *Route) ScheduleOn(date Date, exceptions []*ScheduleException) (RouteSchedule, *ScheduleException) {
+	e := ExceptionOn(r.ID, date, exceptions)
+	if e == nil {
+		return r.Schedule, nil
+	}
+	if e.Kind == ExceptionSuspend {
+		return RouteSchedule{}, e
+	}
+	return e.Schedule, e
+}
+
+// ActiveAt reports whether a Route is running at t, using t's location as the Route's
+// time zone. A Route without a schedule runs all the time unless an exception says
+// otherwise.
+func (r *Route) ActiveAt(t time.Time, exceptions []*ScheduleException) bool {
+	schedule, e := r.ScheduleOn(DateOf(t), exceptions)
+	if e == nil && len(schedule) == 0 {
+		return true
+	}
+	for _, period := range schedule.Periods(DateOf(t), t.Location()) {
+		if !t.Before(period.Start) && t.Before(period.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Period is a span of time.
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// WallTime returns the time in loc when a clock there reads clock's hour, minute,
+// and second on a date. Wall-clock times that a daylight saving time change skips
+// happen as if it hadn't happened yet, so 2:30 becomes 3:30, and ones that it
+// repeats happen the first time.
+func WallTime(date Date, clock time.Time, loc *time.Location) time.Time {
+	t := time.Date(date.Year, date.Month, date.Day, clock.Hour(), clock.Minute(), clock.Second(), 0, loc)
+	if t.Hour() == clock.Hour() && t.Minute() == clock.Minute() {
+		return t
+	}
+	// t has the offset from before the change, so the wall-clock time with that
+	// offset is after it.
+	_, offset := t.Zone()
+	utc := time.Date(date.Year, date.Month, date.Day, clock.Hour(), clock.Minute(), clock.Second(), 0, time.UTC)
+	return utc.Add(-time.Duration(offset) * time.Second).In(loc)
+}
+
+// Periods returns the spans of a date in loc that a schedule's intervals cover. Each
+// interval happens once a Sunday-to-Saturday week, and intervals that wrap around
+// the end of the week carry on into the next one.
+func (s RouteSchedule) Periods(date Date, loc *time.Location) []Period {
+	midnight := time.Time{}
+	dayStart := WallTime(date, midnight, loc)
+	dayEnd := WallTime(date.AddDays(1), midnight, loc)
+	sunday := date.AddDays(-int(date.Weekday()))
+
+	periods := []Period{}
+	for _, interval := range s {
+		// An interval from last week can still be going if it wraps.
+		for _, week := range []Date{sunday.AddDays(-7), sunday} {
+			endDate := week.AddDays(int(interval.EndDay))
+			if interval.Wraps() {
+				endDate = endDate.AddDays(7)
+			}
+			start := WallTime(week.AddDays(int(interval.StartDay)), interval.StartTime, loc)
+			end := WallTime(endDate, interval.EndTime, loc)
+			if !end.After(dayStart) || !start.Before(dayEnd) {
+				continue
+			}
+			if start.Before(dayStart) {
+				start = dayStart
+			}
+			if end.After(dayEnd) {
+				end = dayEnd
+			}
+			periods = append(periods, Period{Start: start, End: end})
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].Start.Before(periods[j].Start)
+	})
+	return periods
+}
+
+// ScheduleService is an interface for interacting with ServiceCalendars and
+// ScheduleExceptions.
+type ScheduleService interface {
+	ServiceCalendars() ([]*ServiceCalendar, error)
+	ServiceCalendar(id int64) (*ServiceCalendar, error)
+	CreateServiceCalendar(calendar *ServiceCalendar) error
+	ModifyServiceCalendar(calendar *ServiceCalendar) error
+	// DeleteServiceCalendar returns ErrServiceCalendarInUse if ScheduleExceptions
+	// apply during the calendar.
+	DeleteServiceCalendar(id int64) error
+
+	ScheduleExceptions() ([]*ScheduleException, error)
+	ScheduleException(id int64) (*ScheduleException, error)
+	CreateScheduleException(exception *ScheduleException) error
+	ModifyScheduleException(exception *ScheduleException) error
+	DeleteScheduleException(id int64) error
+}
+
+// ErrServiceCalendarNotFound indicates that a ServiceCalendar is not in the service.
+var ErrServiceCalendarNotFound = errors.New("ServiceCalendar not found")
+
+// ErrServiceCalendarInUse indicates that a ServiceCalendar can't be deleted because
+// ScheduleExceptions apply during it.
+var ErrServiceCalendarInUse = errors.New("ServiceCalendar is used by schedule exceptions")
+
+// ErrScheduleExceptionNotFound indicates that a ScheduleException is not in the
+// service.
+var ErrScheduleExceptionNotFound = errors.New("ScheduleException not found")
@@ -0,0 +1,135 @@
+package shuttletracker
+
+import (
+	"testing"
+	"time"
+)
+
+func clock(hour, minute int) time.Time {
+	return time.Date(0, 1, 1, hour, minute, 0, 0, time.UTC)
+}
+
+func newYork(t *testing.T) *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("unable to load time zone: %s", err)
+	}
+	return loc
+}
+
+func date(t *testing.T, s string) Date {
+	d, err := ParseDate(s)
+	if err != nil {
+		t.Fatalf("unable to parse date: %s", err)
+	}
+	return d
+}
+
+func TestPeriodsWrap(t *testing.T) {
+	loc := newYork(t)
+	// Saturday night into Sunday morning
+	late := RouteSchedule{{StartDay: time.Saturday, StartTime: clock(22, 0), EndDay: time.Sunday, EndTime: clock(2, 0)}}
+	if !late[0].Wraps() {
+		t.Fatal("interval doesn't wrap")
+	}
+
+	periods := late.Periods(date(t, "2019-06-15"), loc)
+	if len(periods) != 1 || periods[0].Start.Hour() != 22 || periods[0].End.Day() != 16 || periods[0].End.Hour() != 0 {
+		t.Errorf("got Saturday periods %+v, expected 22:00 to midnight", periods)
+	}
+	periods = late.Periods(date(t, "2019-06-16"), loc)
+	if len(periods) != 1 || periods[0].Start.Hour() != 0 || periods[0].End.Hour() != 2 {
+		t.Errorf("got Sunday periods %+v, expected midnight to 2:00", periods)
+	}
+	periods = late.Periods(date(t, "2019-06-17"), loc)
+	if len(periods) != 0 {
+		t.Errorf("got Monday periods %+v, expected none", periods)
+	}
+
+	route := &Route{Schedule: late}
+	for _, c := range []struct {
+		t      time.Time
+		active bool
+	}{
+		{time.Date(2019, 6, 15, 21, 59, 0, 0, loc), false},
+		{time.Date(2019, 6, 15, 23, 0, 0, 0, loc), true},
+		{time.Date(2019, 6, 16, 1, 59, 0, 0, loc), true},
+		{time.Date(2019, 6, 16, 2, 0, 0, 0, loc), false},
+	} {
+		if route.ActiveAt(c.t, nil) != c.active {
+			t.Errorf("%s: expected active to be %t", c.t, c.active)
+		}
+	}
+}
+
+// nolint: gocyclo
+func TestPeriodsDST(t *testing.T) {
+	loc := newYork(t)
+	late := RouteSchedule{{StartDay: time.Saturday, StartTime: clock(22, 0), EndDay: time.Sunday, EndTime: clock(6, 0)}}
+
+	// Clocks skip from 2:00 to 3:00 on March 10th, 2019, so the night is an hour
+	// shorter.
+	periods := late.Periods(date(t, "2019-03-10"), loc)
+	if len(periods) != 1 || periods[0].End.Hour() != 6 || periods[0].End.Sub(periods[0].Start) != 5*time.Hour {
+		t.Errorf("got periods %+v, expected five hours until 6:00", periods)
+	}
+	// 2:30 doesn't happen that day, so it's 3:30.
+	skipped := RouteSchedule{{StartDay: time.Sunday, StartTime: clock(2, 30), EndDay: time.Sunday, EndTime: clock(5, 0)}}
+	periods = skipped.Periods(date(t, "2019-03-10"), loc)
+	if len(periods) != 1 || periods[0].Start.Hour() != 3 || periods[0].Start.Minute() != 30 {
+		t.Errorf("got periods %+v, expected to start at 3:30", periods)
+	}
+
+	// Clocks go back from 2:00 to 1:00 on November 3rd, 2019, so the night is an
+	// hour longer.
+	periods = late.Periods(date(t, "2019-11-03"), loc)
+	if len(periods) != 1 || periods[0].End.Sub(periods[0].Start) != 7*time.Hour {
+		t.Errorf("got periods %+v, expected seven hours", periods)
+	}
+	// 1:30 happens twice, and the interval starts the first time.
+	repeated := RouteSchedule{{StartDay: time.Sunday, StartTime: clock(1, 30), EndDay: time.Sunday, EndTime: clock(3, 0)}}
+	periods = repeated.Periods(date(t, "2019-11-03"), loc)
+	if len(periods) != 1 || periods[0].End.Sub(periods[0].Start) != 150*time.Minute {
+		t.Errorf("got periods %+v, expected two and a half hours", periods)
+	}
+	route := &Route{Schedule: repeated}
+	// 1:15 the second time, after the interval started at the first 1:30
+	secondTime := time.Date(2019, 11, 3, 6, 15, 0, 0, time.UTC).In(loc)
+	if !route.ActiveAt(secondTime, nil) {
+		t.Errorf("route isn't active at %s", secondTime)
+	}
+
+	// Times are the same wall-clock time on either side of a change.
+	weekday := RouteSchedule{{StartDay: time.Monday, StartTime: clock(8, 0), EndDay: time.Monday, EndTime: clock(17, 0)}}
+	for _, d := range []string{"2019-03-04", "2019-03-11"} {
+		periods = weekday.Periods(date(t, d), loc)
+		if len(periods) != 1 || periods[0].Start.Hour() != 8 || periods[0].End.Hour() != 17 {
+			t.Errorf("%s: got periods %+v, expected 8:00 to 17:00", d, periods)
+		}
+	}
+}
+
+func TestActiveAtExceptions(t *testing.T) {
+	loc := newYork(t)
+	routeID := int64(1)
+	route := &Route{ID: routeID}
+	exceptions := []*ScheduleException{
+		{ID: 1, StartDate: date(t, "2019-12-01"), EndDate: date(t, "2019-12-31"), Kind: ExceptionReplace,
+			Schedule: RouteSchedule{{StartDay: time.Sunday, StartTime: clock(10, 0), EndDay: time.Saturday, EndTime: clock(14, 0)}}},
+		{ID: 2, RouteID: &routeID, StartDate: date(t, "2019-12-25"), EndDate: date(t, "2019-12-25"), Kind: ExceptionSuspend},
+	}
+	for _, c := range []struct {
+		t      time.Time
+		active bool
+	}{
+		// Routes without a schedule run all the time.
+		{time.Date(2019, 11, 30, 3, 0, 0, 0, loc), true},
+		{time.Date(2019, 12, 2, 9, 0, 0, 0, loc), true},
+		{time.Date(2019, 12, 7, 15, 0, 0, 0, loc), false},
+		{time.Date(2019, 12, 25, 12, 0, 0, 0, loc), false},
+	} {
+		if route.ActiveAt(c.t, exceptions) != c.active {
+			t.Errorf("%s: expected active to be %t", c.t, c.active)
+		}
+	}
+}
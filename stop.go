@@ -2,6 +2,7 @@ package shuttletracker
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -22,10 +23,26 @@ type Stop struct {
 type StopService interface {
 	Stop(id int64) (*Stop, error)
 	Stops() ([]*Stop, error)
-	CreateStop(stop *Stop) error
-	CreateStopWithID(stop *Stop) error
-	DeleteStop(id int64) error
+
+	// The username of whoever makes a change is recorded in the Stop's Revisions.
+	CreateStop(stop *Stop, username string) error
+	CreateStopWithID(stop *Stop, username string) error
+	ModifyStop(stop *Stop, username string) error
+	RestoreStop(revisionID int64, username string) (*Stop, error)
+
+	// DeleteStop deletes a Stop. If Routes stop at it, a *StopInUseError is returned
+	// unless detach is true, in which case the Stop is removed from those Routes.
+	DeleteStop(id int64, detach bool, username string) error
 }
 
 // ErrStopNotFound indicates that a Stop is not in the service.
 var ErrStopNotFound = errors.New("Stop not found")
+
+// StopInUseError indicates that a Stop can't be deleted because Routes stop at it.
+type StopInUseError struct {
+	RouteIDs []int64
+}
+
+func (e *StopInUseError) Error() string {
+	return fmt.Sprintf("Stop is on routes %v", e.RouteIDs)
+}
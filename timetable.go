@@ -0,0 +1,103 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// Timetable is when a Route runs over a span of days, for riders who want to know
+// without watching vehicles on the map.
+type Timetable struct {
+	RouteID   int64  `json:"route_id"`
+	RouteName string `json:"route_name"`
+	Timezone  string `json:"timezone"`
+	// LoopSeconds is how long a loop of the Route typically takes, and
+	// FrequencySeconds is how often vehicles typically depart. They're zero when
+	// there isn't enough history to tell.
+	LoopSeconds      int64          `json:"loop_seconds"`
+	FrequencySeconds int64          `json:"frequency_seconds"`
+	Days             []TimetableDay `json:"days"`
+}
+
+// TimetableDay is when a Route runs on one day.
+type TimetableDay struct {
+	Date Date `json:"date"`
+	// Exception is the ScheduleException that changes the Route's schedule on Date,
+	// if any.
+	Exception *ScheduleException `json:"exception"`
+	Service   []ServiceSpan      `json:"service"`
+}
+
+// ServiceSpan is a stretch of time that a Route runs without a break.
+type ServiceSpan struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// FirstDeparture is when the first vehicle leaves, and LastDeparture is the last
+	// time that one can leave and still finish its loop before End.
+	FirstDeparture time.Time `json:"first_departure"`
+	LastDeparture  time.Time `json:"last_departure"`
+}
+
+// NewTimetable makes a Timetable for a Route for a number of days starting on from,
+// in loc. stats, which may be nil, are used for departures and frequency. Service that
+// carries on past midnight is listed on the day that it starts, unless it started at
+// midnight too.
+func NewTimetable(route *Route, exceptions []*ScheduleException, stats *RouteLoopStats, from Date, days int, loc *time.Location) *Timetable {
+	tt := &Timetable{
+		RouteID:   route.ID,
+		RouteName: route.Name,
+		Timezone:  loc.String(),
+		Days:      []TimetableDay{},
+	}
+	var loop time.Duration
+	if stats != nil && stats.Loops > 0 {
+		loop = stats.Duration
+		tt.LoopSeconds = int64(stats.Duration / time.Second)
+		tt.FrequencySeconds = int64(stats.Headway / time.Second)
+	}
+
+	// The day and span that the previous span can be carried on from
+	var prevDay, prevSpan = -1, -1
+	for i := 0; i < days; i++ {
+		date := from.AddDays(i)
+		day := TimetableDay{Date: date, Service: []ServiceSpan{}}
+		schedule, e := route.ScheduleOn(date, exceptions)
+		day.Exception = e
+		midnight := WallTime(date, time.Time{}, loc)
+		periods := schedule.Periods(date, loc)
+		if e == nil && len(schedule) == 0 {
+			periods = []Period{{Start: midnight, End: WallTime(date.AddDays(1), time.Time{}, loc)}}
+		}
+
+		for _, p := range periods {
+			if prevSpan >= 0 && p.Start.Equal(midnight) && tt.Days[prevDay].Service[prevSpan].End.Equal(p.Start) {
+				span := &tt.Days[prevDay].Service[prevSpan]
+				span.End = p.End
+				span.LastDeparture = lastDeparture(span.Start, span.End, loop)
+				continue
+			}
+			day.Service = append(day.Service, ServiceSpan{
+				Start:          p.Start,
+				End:            p.End,
+				FirstDeparture: p.Start,
+				LastDeparture:  lastDeparture(p.Start, p.End, loop),
+			})
+		}
+		tt.Days = append(tt.Days, day)
+
+		prevDay, prevSpan = -1, -1
+		if n := len(day.Service); n > 0 && !day.Service[n-1].Start.Equal(midnight) {
+			prevDay, prevSpan = i, n-1
+		}
+	}
+	return tt
+}
+
+// lastDeparture is the last time that a loop can start and still end by end. Without
+// a loop duration, it's end.
+func lastDeparture(start, end time.Time, loop time.Duration) time.Time {
+	last := end.Add(-loop)
+	if last.Before(start) {
+		return start
+	}
+	return last
+}
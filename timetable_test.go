@@ -0,0 +1,65 @@
+package shuttletracker
+
+import (
+	"testing"
+	"time"
+)
+
+// nolint: gocyclo
+func TestNewTimetable(t *testing.T) {
+	loc := newYork(t)
+	route := &Route{ID: 1, Name: "West", Schedule: RouteSchedule{
+		{StartDay: time.Monday, StartTime: clock(8, 0), EndDay: time.Monday, EndTime: clock(17, 0)},
+		{StartDay: time.Saturday, StartTime: clock(22, 0), EndDay: time.Sunday, EndTime: clock(2, 0)},
+	}}
+	stats := &RouteLoopStats{RouteID: 1, Loops: 10, Duration: 20 * time.Minute, Headway: 10 * time.Minute}
+
+	// Saturday, Sunday, and Monday
+	tt := NewTimetable(route, nil, stats, date(t, "2019-06-15"), 3, loc)
+	if tt.LoopSeconds != 1200 || tt.FrequencySeconds != 600 || tt.Timezone != "America/New_York" {
+		t.Errorf("got timetable %+v", tt)
+	}
+	if len(tt.Days) != 3 {
+		t.Fatalf("got %d days, expected 3", len(tt.Days))
+	}
+
+	// Saturday night carries on into Sunday morning.
+	saturday := tt.Days[0].Service
+	if len(saturday) != 1 || saturday[0].Start.Hour() != 22 || saturday[0].End.Day() != 16 || saturday[0].End.Hour() != 2 {
+		t.Errorf("got Saturday service %+v, expected 22:00 to 2:00", saturday)
+	} else if last := saturday[0].LastDeparture; last.Hour() != 1 || last.Minute() != 40 {
+		t.Errorf("got last departure %s, expected 1:40", last)
+	}
+	if len(tt.Days[1].Service) != 0 {
+		t.Errorf("got Sunday service %+v, expected none", tt.Days[1].Service)
+	}
+	monday := tt.Days[2].Service
+	if len(monday) != 1 || monday[0].FirstDeparture.Hour() != 8 || monday[0].LastDeparture.Hour() != 16 || monday[0].LastDeparture.Minute() != 40 {
+		t.Errorf("got Monday service %+v, expected 8:00 to 16:40", monday)
+	}
+
+	// Without history, the last departure is the end of service.
+	tt = NewTimetable(route, nil, nil, date(t, "2019-06-17"), 1, loc)
+	if tt.LoopSeconds != 0 || len(tt.Days[0].Service) != 1 || tt.Days[0].Service[0].LastDeparture.Hour() != 17 {
+		t.Errorf("got timetable %+v, expected service until 17:00", tt)
+	}
+
+	// Routes without a schedule run all day, every day.
+	exceptions := []*ScheduleException{
+		{ID: 1, StartDate: date(t, "2019-06-16"), EndDate: date(t, "2019-06-16"), Kind: ExceptionSuspend},
+	}
+	tt = NewTimetable(&Route{ID: 2}, exceptions, nil, date(t, "2019-06-15"), 3, loc)
+	for i, c := range []int{1, 0, 1} {
+		day := tt.Days[i]
+		if len(day.Service) != c {
+			t.Errorf("%s: got service %+v, expected %d spans", day.Date, day.Service, c)
+			continue
+		}
+		if c == 1 && day.Service[0].End.Sub(day.Service[0].Start) != 24*time.Hour {
+			t.Errorf("%s: got service %+v, expected all day", day.Date, day.Service)
+		}
+	}
+	if tt.Days[1].Exception == nil || tt.Days[1].Exception.ID != 1 {
+		t.Errorf("got exception %+v, expected 1", tt.Days[1].Exception)
+	}
+}
@@ -0,0 +1,103 @@
+package shuttletracker
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrAPITokenNotFound indicates that an APIToken is not in the service.
+var ErrAPITokenNotFound = errors.New("API token not found")
+
+// Scopes limit what an APIToken can do. A request made with a token needs both the
+// scope and its User's role to be enough.
+const (
+	// ScopeRead allows reading feedback, revisions, and the audit log.
+	ScopeRead = "read"
+
+	// ScopeMessages allows managing alerts and the admin message.
+	ScopeMessages = "messages"
+
+	// ScopeVehicles allows managing vehicles.
+	ScopeVehicles = "vehicles"
+
+	// ScopeFeedback allows deleting feedback.
+	ScopeFeedback = "feedback"
+
+	// ScopeRoutes allows changing routes, stops, their schedules, and detours.
+	ScopeRoutes = "routes"
+
+	// ScopeUsers allows managing Users.
+	ScopeUsers = "users"
+
+	// ScopeFusionRaw allows downloading raw Fusion rider tracks. The token's User
+	// also needs PermissionFusionRawExport.
+	ScopeFusionRaw = "fusion_raw"
+)
+
+// Scopes lists every scope that an APIToken can have.
+var Scopes = []string{
+	ScopeRead,
+	ScopeMessages,
+	ScopeVehicles,
+	ScopeFeedback,
+	ScopeRoutes,
+	ScopeUsers,
+	ScopeFusionRaw,
+}
+
+// ValidScope returns whether a scope is one of Scopes.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken lets programs act as a User without logging in. Only a hash of the token
+// itself is stored; Prefix is its first few characters so that people can tell
+// tokens apart.
+type APIToken struct {
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"`
+	Username string     `json:"username"`
+	Scopes   []string   `json:"scopes"`
+	Prefix   string     `json:"prefix"`
+	Created  time.Time  `json:"created"`
+	Expires  time.Time  `json:"expires"`
+	LastUsed *time.Time `json:"last_used"`
+}
+
+// HasScope returns whether the APIToken has a scope.
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired returns whether the APIToken can no longer be used.
+func (t *APIToken) Expired(now time.Time) bool {
+	return !now.Before(t.Expires)
+}
+
+// APITokenService is an interface for interacting with APITokens.
+type APITokenService interface {
+	// CreateAPIToken stores an APIToken along with the hash of its secret.
+	CreateAPIToken(token *APIToken, hash []byte) error
+
+	APIToken(id int64) (*APIToken, error)
+
+	// APITokenWithHash returns the APIToken whose secret has a hash.
+	APITokenWithHash(hash []byte) (*APIToken, error)
+
+	// APITokens returns a User's APITokens, or everyone's if username is empty.
+	APITokens(username string) ([]*APIToken, error)
+	DeleteAPIToken(id int64) error
+
+	// TouchAPIToken records when an APIToken was last used.
+	TouchAPIToken(id int64, used time.Time) error
+}
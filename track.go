@@ -0,0 +1,30 @@
+package shuttletracker
+
+import (
+	"time"
+)
+
+// TrackPosition is a position reported by a Fusion client. Positions with the same
+// Track make up one rider's track.
+type TrackPosition struct {
+	ID        int64   `json:"id"`
+	Track     string  `json:"track"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+
+	// Meters per second. It's a pointer because it may be unknown.
+	Speed *float64 `json:"speed"`
+
+	// Pointer because it may be unknown.
+	Heading *float64 `json:"heading"`
+
+	Time time.Time `json:"time"`
+}
+
+// TrackService is an interface for storing rider tracks. Tracks describe where people
+// have been, so implementations are only expected to keep them for a limited time.
+type TrackService interface {
+	CreateTrackPosition(position *TrackPosition) error
+	TrackPositionsSince(since time.Time) ([]*TrackPosition, error)
+	DeleteTrackPositionsBefore(before time.Time) (int, error)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/wtg/shuttletracker"
+	"github.com/wtg/shuttletracker/geo"
 	"github.com/wtg/shuttletracker/log"
 	"github.com/wtg/shuttletracker/spoofer"
 )
@@ -207,6 +208,20 @@ func (u *Updater) handleVehicleData(vehicleData string) {
 		// Timestamp is not new; don't store update.
 		return
 	}
+	if err != shuttletracker.ErrLocationNotFound && lastUpdate.Source != shuttletracker.LocationSourceITRAK {
+		// Fusion may have filled in while iTRAK was quiet, so look for the
+		// last iTRAK update instead.
+		recent, err := u.ms.LocationsSince(vehicle.ID, newTime.Add(-time.Second))
+		if err != nil {
+			log.WithError(err).Error("unable to retrieve recent updates")
+			return
+		}
+		for _, loc := range recent {
+			if loc.Source == shuttletracker.LocationSourceITRAK && newTime.Equal(loc.Time) {
+				return
+			}
+		}
+	}
 	log.Debugf("Updating %s.", vehicle.Name)
 
 	// vehicle found and no error
@@ -248,6 +263,7 @@ func (u *Updater) handleVehicleData(vehicleData string) {
 		Heading:   heading,
 		Speed:     speedMPH,
 		Time:      newTime,
+		Source:    shuttletracker.LocationSourceITRAK,
 	}
 	if route != nil {
 		update.RouteID = &route.ID
@@ -266,14 +282,23 @@ func kphToMPH(kmh float64) float64 {
 	return kmh * 0.621371192
 }
 
-// GuessRouteForVehicle returns a guess at what route the vehicle is on.
-// It may return an empty route if it does not believe a vehicle is on any route.
+// GuessRouteForVehicle returns a guess at what route the vehicle is on, following
+// the detours that routes are on. It may return an empty route if it does not
+// believe a vehicle is on any route.
 // nolint: gocyclo
 func (u *Updater) GuessRouteForVehicle(vehicle *shuttletracker.Vehicle) (route *shuttletracker.Route, err error) {
 	routes, err := u.ms.Routes()
 	if err != nil {
 		return nil, err
 	}
+	detours, err := u.ms.Detours()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range routes {
+		routes[i] = geo.FollowDetours(routes[i], detours, now)
+	}
 
 	routeDistances := make(map[int64]float64)
 	for _, route := range routes {
@@ -5,10 +5,98 @@ import "errors"
 // ErrUserNotFound indicates that a User is not in the service.
 var ErrUserNotFound = errors.New("User not found")
 
+// ErrInvalidRole indicates that a role isn't one of Roles.
+var ErrInvalidRole = errors.New("Invalid role")
+
+// ErrInvalidPermission indicates that a permission isn't one of Permissions.
+var ErrInvalidPermission = errors.New("Invalid permission")
+
+// Roles decide what a User can change. Each role can do everything that the roles
+// before it in Roles can.
+const (
+	// RoleViewer can see the admin interface, feedback, and the audit log.
+	RoleViewer = "viewer"
+
+	// RoleDispatcher can also manage alerts and vehicles, detour routes, and delete
+	// feedback.
+	RoleDispatcher = "dispatcher"
+
+	// RoleEditor can also change routes, stops, and their schedules.
+	RoleEditor = "editor"
+
+	// RoleOwner can also manage Users. Downloading raw Fusion rider tracks needs
+	// PermissionFusionRawExport whatever the role.
+	RoleOwner = "owner"
+)
+
+// Roles lists every role from least to most capable.
+var Roles = []string{
+	RoleViewer,
+	RoleDispatcher,
+	RoleEditor,
+	RoleOwner,
+}
+
+// roleRank returns where a role is in Roles, or -1 if it isn't one.
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// ValidRole returns whether a role is one of Roles.
+func ValidRole(role string) bool {
+	return roleRank(role) >= 0
+}
+
+// PermissionFusionRawExport allows a User to export Fusion rider tracks without
+// aggregation.
+const PermissionFusionRawExport = "fusion_raw_export"
+
+// Permissions lists every permission that can be granted to a User.
+var Permissions = []string{
+	PermissionFusionRawExport,
+}
+
+// ValidPermission returns whether a permission is one of Permissions.
+func ValidPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
 // User represents a user.
 type User struct {
-	ID       int64
-	Username string
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+
+	// Role is one of Roles.
+	Role string `json:"role"`
+
+	// Permissions grant access beyond what any role has.
+	Permissions []string `json:"permissions"`
+}
+
+// HasRole returns whether the User's role is at least as capable as a role.
+func (u *User) HasRole(role string) bool {
+	rank := roleRank(role)
+	return rank >= 0 && roleRank(u.Role) >= rank
+}
+
+// HasPermission returns whether the User has been granted a permission.
+func (u *User) HasPermission(permission string) bool {
+	for _, p := range u.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
 }
 
 // UserService is an interface for interacting with Users.
@@ -16,5 +104,14 @@ type UserService interface {
 	CreateUser(*User) error
 	DeleteUser(username string) error
 	UserExists(username string) (bool, error)
+	User(username string) (*User, error)
 	Users() ([]*User, error)
+	GrantPermission(username string, permission string) error
+	RevokePermission(username string, permission string) error
+	SetRole(username string, role string) error
+
+	// PasswordHash returns the bcrypt hash of a User's password for logging in with
+	// a local account. It's nil if the User doesn't exist or has no password.
+	PasswordHash(username string) ([]byte, error)
+	SetPasswordHash(username string, hash []byte) error
 }